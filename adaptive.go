@@ -0,0 +1,246 @@
+package icd
+
+import (
+	"sync"
+)
+
+// BufferMode is how an adaptive queue currently buffers its items
+type BufferMode int
+
+const (
+	// BufferNormal is the mode of a queue at its base capacity
+	BufferNormal BufferMode = iota
+	// BufferExpanded is the mode of a queue grown beyond its base capacity
+	// for a lagging consumer
+	BufferExpanded
+	// BufferSaturated is the mode of a queue full at its maximum capacity,
+	// which applies its overflow policy to the items put
+	BufferSaturated
+)
+
+// String returns the name of the mode
+func (m BufferMode) String() string {
+	switch m {
+	case BufferNormal:
+		return "normal"
+	case BufferExpanded:
+		return "expanded"
+	case BufferSaturated:
+		return "saturated"
+	default:
+		return "unknown"
+	}
+}
+
+type adaptiveQueue struct {
+	queue   *BaseQueue
+	base    int
+	max     int
+	mu      sync.Mutex
+	policy  OverflowPolicy
+	dropped uint64
+}
+
+// NewAdaptiveQueue creates an in-memory FIFO queue which absorbs transient
+// consumer slowdowns. It holds capacity items until a Put finds it full,
+// then doubles its capacity, up to max, instead of blocking. Once it is full
+// at max Put blocks, or drops the item with OverflowDrop, see Overflowable.
+// As the consumer catches up and the queue drains to a quarter of its
+// capacity, the capacity halves again, down to capacity. Stats reports the
+// current BufferMode and dropped items are counted, see DropCounter. A
+// capacity below 1 is raised to 1 and a max below capacity is raised to
+// capacity. The queue implements NonBlocking, Overflowable, DropCounter and
+// StatsReporter.
+func NewAdaptiveQueue(capacity int, max int) Queue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if max < capacity {
+		max = capacity
+	}
+	return &adaptiveQueue{
+		queue: NewBaseQueue("adaptive", capacity),
+		base:  capacity,
+		max:   max,
+	}
+}
+
+// Name provides the name of the queue
+func (q *adaptiveQueue) Name() string {
+	return q.queue.Name()
+}
+
+// SetOverflowPolicy sets what Put does while the queue is full at its
+// maximum capacity
+func (q *adaptiveQueue) SetOverflowPolicy(policy OverflowPolicy) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.policy = policy
+}
+
+// Put puts an item into the queue, growing it while it is full below its
+// maximum capacity and blocking or dropping the item once it is full at it
+func (q *adaptiveQueue) Put(item interface{}) error {
+	for {
+		err := q.queue.TryPut(item)
+		if !IsQueueFull(err) {
+			return err
+		}
+		if q.grow() {
+			continue
+		}
+		q.mu.Lock()
+		policy := q.policy
+		if policy == OverflowDrop {
+			q.dropped++
+		}
+		q.mu.Unlock()
+		if policy == OverflowDrop {
+			return nil
+		}
+		return q.queue.Put(item)
+	}
+}
+
+// TryPut puts an item into the queue, growing it while it is full below its
+// maximum capacity. Returns ErrQueueFull once it is full at it, whatever the
+// overflow policy.
+func (q *adaptiveQueue) TryPut(item interface{}) error {
+	for {
+		err := q.queue.TryPut(item)
+		if !IsQueueFull(err) || !q.grow() {
+			return err
+		}
+	}
+}
+
+// Get gets the next item from the queue, shrinking it once the consumer
+// caught up
+func (q *adaptiveQueue) Get() (interface{}, error) {
+	item, err := q.queue.Get()
+	if err == nil {
+		q.shrink()
+	}
+	return item, err
+}
+
+// TryGet gets the next item from the queue without blocking, shrinking it
+// once the consumer caught up
+func (q *adaptiveQueue) TryGet() (interface{}, error) {
+	item, err := q.queue.TryGet()
+	if err == nil {
+		q.shrink()
+	}
+	return item, err
+}
+
+// Len returns the number of items in the queue
+func (q *adaptiveQueue) Len() int {
+	return q.queue.Len()
+}
+
+// Cap returns the current capacity of the queue
+func (q *adaptiveQueue) Cap() int {
+	return q.queue.Cap()
+}
+
+// Clear removes all items from the queue, restoring its base capacity
+func (q *adaptiveQueue) Clear() {
+	q.queue.Clear()
+	q.shrink()
+}
+
+// Close closes the queue, waking all blocked callers
+func (q *adaptiveQueue) Close() error {
+	return q.queue.Close()
+}
+
+// Closed returns whether or not the queue is closed
+func (q *adaptiveQueue) Closed() bool {
+	return q.queue.Closed()
+}
+
+// grow doubles the capacity up to max, returning false when it is at max
+func (q *adaptiveQueue) grow() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	capacity := q.queue.Cap()
+	if capacity >= q.max {
+		return false
+	}
+	next := capacity * 2
+	if next > q.max {
+		next = q.max
+	}
+	q.queue.Resize(next)
+	return true
+}
+
+// shrink halves the capacity down to the base capacity while the queue holds
+// at most a quarter of it
+func (q *adaptiveQueue) shrink() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	capacity := q.queue.Cap()
+	for capacity > q.base && q.Len() <= capacity/4 {
+		capacity /= 2
+		if capacity < q.base {
+			capacity = q.base
+		}
+		q.queue.Resize(capacity)
+	}
+}
+
+// mode returns the buffering mode of the queue with stats
+func (q *adaptiveQueue) mode(stats QueueStats) BufferMode {
+	switch {
+	case stats.Cap >= q.max && stats.Len >= stats.Cap:
+		return BufferSaturated
+	case stats.Cap > q.base:
+		return BufferExpanded
+	default:
+		return BufferNormal
+	}
+}
+
+// Dropped returns the number of items dropped while the queue was saturated
+func (q *adaptiveQueue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Stats returns the current statistics of the queue, including its mode
+func (q *adaptiveQueue) Stats() QueueStats {
+	return q.addMode(q.queue.Stats())
+}
+
+// addMode adds the mode to statistics sent by the queue
+func (q *adaptiveQueue) addMode(stats interface{}) QueueStats {
+	qs := stats.(QueueStats)
+	qs.Mode = q.mode(qs).String()
+	return qs
+}
+
+// Reset removes all items, clears statistics, reopens the queue and restores
+// its base capacity
+func (q *adaptiveQueue) Reset() {
+	q.mu.Lock()
+	q.dropped = 0
+	q.queue.Resize(q.base)
+	q.mu.Unlock()
+	q.queue.Reset()
+}
+
+// Monitor provides monitoring of the queue like BaseQueue, adding the mode to
+// the statistics
+func (q *adaptiveQueue) Monitor(mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	imc := relayControl(mc)
+	imc.WaitGroup.Add(1)
+	go q.queue.Monitor(imc)
+	final, _ := relayStats(imc, mc, func(stats interface{}) interface{} {
+		return q.addMode(stats)
+	})
+	mc.FinalStatsChan <- q.addMode(final)
+}
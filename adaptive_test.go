@@ -0,0 +1,127 @@
+package icd
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveQueueExpandsAndContracts(t *testing.T) {
+	q := NewAdaptiveQueue(4, 16)
+	stats := func() QueueStats { return q.(StatsReporter).Stats() }
+	if s := stats(); s.Cap != 4 || s.Mode != "normal" {
+		t.Fatalf("expected capacity 4 in normal mode, got %d %s", s.Cap, s.Mode)
+	}
+
+	// the consumer lags, the queue grows instead of blocking
+	for i := 0; i < 10; i++ {
+		if err := q.Put(i); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if s := stats(); s.Cap != 16 || s.Mode != "expanded" {
+		t.Errorf("expected capacity 16 in expanded mode, got %d %s", s.Cap, s.Mode)
+	}
+
+	// the consumer catches up, the queue shrinks back to its base capacity
+	for i := 0; i < 10; i++ {
+		item, _ := q.Get()
+		if item != i {
+			t.Fatalf("expected %d, got %v", i, item)
+		}
+		if c := q.Cap(); c < 4 || c > 16 {
+			t.Fatalf("capacity %d out of bounds", c)
+		}
+	}
+	if s := stats(); s.Cap != 4 || s.Mode != "normal" {
+		t.Errorf("expected capacity 4 in normal mode, got %d %s", s.Cap, s.Mode)
+	}
+}
+
+func TestAdaptiveQueueNonBlocking(t *testing.T) {
+	q := NewAdaptiveQueue(2, 4)
+	nb := q.(NonBlocking)
+	if _, ok := q.(Resizable); ok {
+		t.Error("expected the queue to manage its capacity itself")
+	}
+	if _, ok := q.(BatchPutter); ok {
+		t.Error("expected the queue not to let batches bypass its growth")
+	}
+
+	// TryPut grows the queue like Put, and fails once it is full at max
+	for i := 0; i < 4; i++ {
+		if err := nb.TryPut(i); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := nb.TryPut(4); !IsQueueFull(err) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	if q.Cap() != 4 {
+		t.Errorf("expected capacity 4, got %d", q.Cap())
+	}
+	q.Clear()
+	if q.Cap() != 2 {
+		t.Errorf("expected clear to restore capacity 2, got %d", q.Cap())
+	}
+}
+
+func TestAdaptiveQueueSaturatedBlocks(t *testing.T) {
+	q := NewAdaptiveQueue(1, 2)
+	q.Put("a")
+	q.Put("b")
+	if s := q.(StatsReporter).Stats(); s.Cap != 2 || s.Mode != "saturated" {
+		t.Fatalf("expected capacity 2 in saturated mode, got %d %s", s.Cap, s.Mode)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	put := make(chan struct{})
+	go func() {
+		defer wg.Done()
+		q.Put("c")
+		close(put)
+	}()
+	select {
+	case <-put:
+		t.Fatal("expected the put into the saturated queue to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.Get()
+	wg.Wait()
+	if q.Len() != 2 {
+		t.Errorf("expected 2 items, got %d", q.Len())
+	}
+}
+
+func TestAdaptiveQueueSaturatedDrops(t *testing.T) {
+	q := NewAdaptiveQueue(1, 2)
+	q.(Overflowable).SetOverflowPolicy(OverflowDrop)
+	for i := 0; i < 5; i++ {
+		if err := q.Put(i); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if q.Len() != 2 || q.(DropCounter).Dropped() != 3 {
+		t.Errorf("expected 2 items and 3 dropped, got %d and %d", q.Len(), q.(DropCounter).Dropped())
+	}
+	q.Reset()
+	if q.Cap() != 1 || q.(DropCounter).Dropped() != 0 {
+		t.Errorf("expected reset to restore capacity 1, got %d", q.Cap())
+	}
+}
+
+func TestAdaptiveQueueMonitorReportsMode(t *testing.T) {
+	q := NewAdaptiveQueue(1, 4)
+	q.Put("a")
+	q.Put("b")
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go q.Monitor(mc)
+	close(mc.DoneChan)
+	stats := (<-mc.FinalStatsChan).(QueueStats)
+	mc.WaitGroup.Wait()
+	if stats.Mode != "expanded" || stats.Cap != 2 {
+		t.Errorf("expected final statistics in expanded mode, got %+v", stats)
+	}
+}
@@ -0,0 +1,55 @@
+package icd
+
+import (
+	"fmt"
+	"sync"
+)
+
+type atMostOnceQueue struct {
+	Queue
+	mu      sync.Mutex
+	dropped uint64
+}
+
+// NewAtMostOnceQueue wraps q so an item is delivered at most once, for sinks
+// which must never see a duplicate, e.g. non-idempotent counters. Get removes
+// the item from q and, when q is Persistent, commits the removal with Sync
+// before returning the item, so neither a crash of the consumer nor of
+// reservoird delivers the item again. The price is durability: an item is
+// lost when the consumer crashes before processing it, and Get drops it and
+// returns the error when the commit fails, as delivering it could duplicate
+// it after a crash. Dropped items are counted, see DropCounter. Use an
+// InflightQueue for at-least-once and an ExactlyOnceQueue for exactly-once
+// delivery instead.
+func NewAtMostOnceQueue(q Queue) Queue {
+	return &atMostOnceQueue{Queue: q}
+}
+
+// Get removes the next item from the queue and commits its removal before
+// returning it
+func (q *atMostOnceQueue) Get() (interface{}, error) {
+	item, err := q.Queue.Get()
+	if err != nil {
+		return nil, err
+	}
+	p, ok := q.Queue.(Persistent)
+	if !ok {
+		return item, nil
+	}
+	err = p.Sync()
+	if err != nil {
+		q.mu.Lock()
+		q.dropped++
+		q.mu.Unlock()
+		return nil, fmt.Errorf("commit get from %s: %w", q.Name(), err)
+	}
+	return item, nil
+}
+
+// Dropped returns the number of items dropped because their removal could
+// not be committed
+func (q *atMostOnceQueue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
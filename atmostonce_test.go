@@ -0,0 +1,66 @@
+package icd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtMostOnceQueueNoRedeliveryAfterCrash(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue")
+
+	crashed := newTestMmapQueue(t, path, 1024)
+	crashed.Put("a")
+	crashed.Put("b")
+	q := NewAtMostOnceQueue(crashed)
+	if got := getString(t, q); got != "a" {
+		t.Fatalf("expected a, got %s", got)
+	}
+
+	// the consumer crashes holding a, the restarted consumer does not get it
+	restarted := newTestMmapQueue(t, path, 1024)
+	defer restarted.Close()
+	if restarted.Len() != 1 {
+		t.Fatalf("expected 1 item after the crash, got %d", restarted.Len())
+	}
+	if got := getString(t, NewAtMostOnceQueue(restarted)); got != "b" {
+		t.Errorf("expected b, got %s", got)
+	}
+	crashed.Close()
+}
+
+var errSync = errors.New("sync failed")
+
+// failingSyncQueue is a Persistent queue whose Sync fails
+type failingSyncQueue struct {
+	*BaseQueue
+}
+
+func (failingSyncQueue) Sync() error { return errSync }
+
+func TestAtMostOnceQueueDropsUncommitted(t *testing.T) {
+	inner := failingSyncQueue{NewBaseQueue("inner", 0)}
+	inner.Put("a")
+	q := NewAtMostOnceQueue(inner)
+	if _, err := q.Get(); !errors.Is(err, errSync) {
+		t.Errorf("expected the sync error, got %v", err)
+	}
+	if inner.Len() != 0 || q.(DropCounter).Dropped() != 1 {
+		t.Errorf("expected the item to be dropped, got len %d dropped %d", inner.Len(), q.(DropCounter).Dropped())
+	}
+}
+
+func TestAtMostOnceQueueNotPersistent(t *testing.T) {
+	q := NewAtMostOnceQueue(NewBaseQueue("inner", 0))
+	q.Put("a")
+	q.Close()
+	if item, err := q.Get(); item != "a" || err != nil {
+		t.Errorf("expected a, got %v %v", item, err)
+	}
+	if _, err := q.Get(); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package icd
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AuditBuffer is the number of audit records an audit queue buffers for its
+// sink
+var AuditBuffer = 1024
+
+// AuditDirection is whether an audited item entered or left a queue
+type AuditDirection string
+
+const (
+	// AuditPut is the direction of an item put into a queue
+	AuditPut AuditDirection = "put"
+	// AuditGet is the direction of an item gotten from a queue
+	AuditGet AuditDirection = "get"
+)
+
+// AuditRecord records an item entering or leaving a queue
+type AuditRecord struct {
+	// Name of the queue
+	Queue string `json:"queue"`
+	// Whether the item entered or left the queue
+	Direction AuditDirection `json:"direction"`
+	// HeaderID of the item, "" when it carries none
+	ItemID string `json:"item_id,omitempty"`
+	// When the item entered or left the queue
+	Time time.Time `json:"time"`
+}
+
+// AuditSink receives the records of audit queues
+type AuditSink interface {
+	// Audit stores the record
+	Audit(record AuditRecord) error
+}
+
+// DropCounter is the optional interface for queues which drop data under
+// overload rather than block
+type DropCounter interface {
+	// Dropped returns the number of dropped elements
+	Dropped() uint64
+}
+
+type jsonLinesAuditSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONLinesAuditSink creates an AuditSink writing each record as a line
+// of JSON to w
+func NewJSONLinesAuditSink(w io.Writer) AuditSink {
+	return &jsonLinesAuditSink{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Audit writes the record as a line of JSON
+func (s *jsonLinesAuditSink) Audit(record AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(record)
+}
+
+type auditQueue struct {
+	Queue
+	sink    AuditSink
+	mu      sync.Mutex
+	records chan AuditRecord
+	stopped chan struct{}
+	dropped uint64
+}
+
+// NewAuditQueue wraps q so that every item put into and gotten from it is
+// recorded to sink, with the HeaderID of items which are an *Envelope.
+// Records are delivered by a background goroutine through a buffer of
+// AuditBuffer records so the data path never waits for the sink; records
+// which do not fit into the buffer are dropped and counted, see
+// DropCounter. Delivery stops once the queue is closed and drained, after
+// the buffered records are delivered. Sink errors are ignored. Record times
+// follow the package Clock.
+func NewAuditQueue(q Queue, sink AuditSink) Queue {
+	a := &auditQueue{
+		Queue: q,
+		sink:  sink,
+	}
+	a.start()
+	return a
+}
+
+// Put puts the item into the queue and records it
+func (q *auditQueue) Put(item interface{}) error {
+	err := q.Queue.Put(item)
+	if err != nil {
+		return err
+	}
+	q.record(AuditPut, item)
+	return nil
+}
+
+// Get gets the next item from the queue and records it
+func (q *auditQueue) Get() (interface{}, error) {
+	item, err := q.Queue.Get()
+	if IsQueueClosed(err) {
+		q.stop()
+	}
+	if err != nil {
+		return nil, err
+	}
+	q.record(AuditGet, item)
+	return item, nil
+}
+
+// Close closes the queue, delivery stops once it is drained
+func (q *auditQueue) Close() error {
+	err := q.Queue.Close()
+	if q.Queue.Len() == 0 {
+		q.stop()
+	}
+	return err
+}
+
+// Reset resets the queue, restarting delivery
+func (q *auditQueue) Reset() {
+	q.Queue.Reset()
+	q.start()
+}
+
+// Dropped returns the number of records dropped because the buffer was full
+func (q *auditQueue) Dropped() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
+
+// record queues the record of item for delivery without blocking
+func (q *auditQueue) record(direction AuditDirection, item interface{}) {
+	record := AuditRecord{
+		Queue:     q.Name(),
+		Direction: direction,
+		Time:      now(),
+	}
+	env, ok := item.(*Envelope)
+	if ok && env != nil {
+		record.ItemID = env.Header(HeaderID)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.records != nil {
+		select {
+		case q.records <- record:
+			return
+		default:
+		}
+	}
+	atomic.AddUint64(&q.dropped, 1)
+}
+
+// start starts delivery unless it is running
+func (q *auditQueue) start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.records != nil {
+		return
+	}
+	records := make(chan AuditRecord, AuditBuffer)
+	stopped := make(chan struct{})
+	q.records = records
+	q.stopped = stopped
+	go func() {
+		defer close(stopped)
+		for record := range records {
+			q.sink.Audit(record)
+		}
+	}()
+}
+
+// stop stops delivery, once the buffered records are delivered
+func (q *auditQueue) stop() {
+	q.mu.Lock()
+	records := q.records
+	stopped := q.stopped
+	q.records = nil
+	q.mu.Unlock()
+	if records == nil {
+		return
+	}
+	close(records)
+	<-stopped
+}
@@ -0,0 +1,99 @@
+package icd
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryAuditSink keeps the records, blocking while held
+type memoryAuditSink struct {
+	mu      sync.Mutex
+	hold    sync.Mutex
+	records []AuditRecord
+}
+
+func (s *memoryAuditSink) Audit(record AuditRecord) error {
+	s.hold.Lock()
+	defer s.hold.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *memoryAuditSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.records)
+}
+
+func TestAuditQueueRecords(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	sink := &memoryAuditSink{}
+	q := NewAuditQueue(NewBaseQueue("audited", 0), sink)
+
+	env := NewEnvelope("a")
+	env.SetHeader(HeaderID, "id-1")
+	q.Put(env)
+	c.Advance(time.Second)
+	q.Put("b")
+	q.Get()
+	q.Get()
+	q.Close()
+
+	want := []AuditRecord{
+		{Queue: "audited", Direction: AuditPut, ItemID: "id-1", Time: c.Now().Add(-time.Second)},
+		{Queue: "audited", Direction: AuditPut, Time: c.Now()},
+		{Queue: "audited", Direction: AuditGet, ItemID: "id-1", Time: c.Now()},
+		{Queue: "audited", Direction: AuditGet, Time: c.Now()},
+	}
+	if len(sink.records) != len(want) {
+		t.Fatalf("expected %d records delivered by close, got %v", len(want), sink.records)
+	}
+	for i, record := range sink.records {
+		if record != want[i] {
+			t.Errorf("expected record %+v, got %+v", want[i], record)
+		}
+	}
+}
+
+func TestAuditQueueOverflow(t *testing.T) {
+	buffer := AuditBuffer
+	AuditBuffer = 2
+	defer func() { AuditBuffer = buffer }()
+
+	sink := &memoryAuditSink{}
+	sink.hold.Lock()
+	q := NewAuditQueue(NewBaseQueue("audited", 0), sink)
+
+	// the first record is taken by the blocked sink, two are buffered and
+	// the rest dropped without blocking the puts
+	q.Put(1)
+	waitFor(t, "the sink to take a record", func() bool { return len(q.(*auditQueue).records) == 0 })
+	for i := 2; i <= 5; i++ {
+		q.Put(i)
+	}
+	if dropped := q.(DropCounter).Dropped(); dropped != 2 {
+		t.Errorf("expected 2 dropped records, got %d", dropped)
+	}
+	sink.hold.Unlock()
+	waitFor(t, "the buffered records", func() bool { return sink.count() == 3 })
+	q.Close()
+	q.Get()
+	waitFor(t, "the get after close to be recorded", func() bool { return sink.count() == 4 })
+}
+
+func TestJSONLinesAuditSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLinesAuditSink(&buf)
+	sink.Audit(AuditRecord{Queue: "q", Direction: AuditGet, ItemID: "x", Time: time.Unix(0, 0).UTC()})
+	sink.Audit(AuditRecord{Queue: "q", Direction: AuditPut, Time: time.Unix(0, 0).UTC()})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || lines[0] != `{"queue":"q","direction":"get","item_id":"x","time":"1970-01-01T00:00:00Z"}` {
+		t.Errorf("unexpected JSON lines %q", lines)
+	}
+}
@@ -0,0 +1,221 @@
+package icd
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// AutoTuneInterval is how often an auto-tuning queue samples its utilization
+var AutoTuneInterval = time.Second
+
+type autoTuneQueue struct {
+	queue  *BaseQueue
+	min    int
+	max    int
+	target float64
+	mu     sync.Mutex
+	last   time.Time
+	space  chan struct{}
+}
+
+// NewAutoTuneQueue creates an in-memory FIFO queue whose capacity is tuned to
+// keep its utilization, Len/Cap, near target. Every AutoTuneInterval the
+// utilization is sampled, on Put and Get, while a Put is blocked on the full
+// queue and while the queue is monitored, and the capacity moves halfway
+// towards the capacity which would give the target utilization, bounded by
+// min and max. Sustained pressure therefore grows the queue, while shrinking
+// an idle queue requires it to be monitored. A min below 1 is raised to 1, a
+// max below min is raised to min and a target outside (0, 1] is treated as 1.
+// The queue implements NonBlocking, Resizable, CloseNotifier and
+// StatsReporter.
+func NewAutoTuneQueue(min int, max int, target float64) Queue {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	if !(target > 0 && target <= 1) {
+		target = 1
+	}
+	return &autoTuneQueue{
+		queue:  NewBaseQueue("autotune", min),
+		min:    min,
+		max:    max,
+		target: target,
+		last:   now(),
+		space:  make(chan struct{}),
+	}
+}
+
+// Name provides the name of the queue
+func (q *autoTuneQueue) Name() string {
+	return q.queue.Name()
+}
+
+// Put puts an item into the queue. While the queue is full Put blocks, tuning
+// the capacity every AutoTuneInterval, until there is room.
+func (q *autoTuneQueue) Put(item interface{}) error {
+	for {
+		q.tune()
+		q.mu.Lock()
+		space := q.space
+		q.mu.Unlock()
+		err := q.queue.TryPut(item)
+		if !IsQueueFull(err) {
+			return err
+		}
+		select {
+		case <-space:
+		case <-after(AutoTuneInterval):
+		}
+	}
+}
+
+// TryPut tunes the capacity when due and puts an item into the queue,
+// returning ErrQueueFull when the queue is full
+func (q *autoTuneQueue) TryPut(item interface{}) error {
+	q.tune()
+	return q.queue.TryPut(item)
+}
+
+// Get tunes the capacity when due and gets the next item from the queue
+func (q *autoTuneQueue) Get() (interface{}, error) {
+	q.tune()
+	item, err := q.queue.Get()
+	if err == nil {
+		q.notify()
+	}
+	return item, err
+}
+
+// TryGet tunes the capacity when due and gets the next item from the queue
+// without blocking
+func (q *autoTuneQueue) TryGet() (interface{}, error) {
+	q.tune()
+	item, err := q.queue.TryGet()
+	if err == nil {
+		q.notify()
+	}
+	return item, err
+}
+
+// Len returns the number of items in the queue
+func (q *autoTuneQueue) Len() int {
+	return q.queue.Len()
+}
+
+// Cap returns the current, tuned capacity of the queue
+func (q *autoTuneQueue) Cap() int {
+	return q.queue.Cap()
+}
+
+// Clear removes all items from the queue
+func (q *autoTuneQueue) Clear() {
+	q.queue.Clear()
+	q.notify()
+}
+
+// Reset removes all items, clears statistics and reopens the queue
+func (q *autoTuneQueue) Reset() {
+	q.queue.Reset()
+	q.notify()
+}
+
+// Close closes the queue, waking all blocked callers
+func (q *autoTuneQueue) Close() error {
+	return q.CloseWithError(nil)
+}
+
+// CloseWithError closes the queue for the reason err, waking all blocked
+// callers
+func (q *autoTuneQueue) CloseWithError(err error) error {
+	closeErr := q.queue.CloseWithError(err)
+	q.notify()
+	return closeErr
+}
+
+// OnClose registers fn to be called with the reason the queue closed
+func (q *autoTuneQueue) OnClose(fn func(err error)) {
+	q.queue.OnClose(fn)
+}
+
+// Closed returns whether or not the queue is closed
+func (q *autoTuneQueue) Closed() bool {
+	return q.queue.Closed()
+}
+
+// Resize changes the capacity of the queue, waking blocked puts
+func (q *autoTuneQueue) Resize(capacity int) error {
+	err := q.queue.Resize(capacity)
+	q.notify()
+	return err
+}
+
+// Stats returns the current statistics of the queue
+func (q *autoTuneQueue) Stats() QueueStats {
+	return q.queue.Stats()
+}
+
+// Monitor provides monitoring of the queue, tuning it while idle
+func (q *autoTuneQueue) Monitor(mc *MonitorControl) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-after(AutoTuneInterval):
+				q.tune()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	q.queue.Monitor(mc)
+}
+
+// notify wakes the puts waiting for room
+func (q *autoTuneQueue) notify() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	close(q.space)
+	q.space = make(chan struct{})
+}
+
+// tune resizes the queue towards the target utilization, at most once per
+// AutoTuneInterval
+func (q *autoTuneQueue) tune() {
+	t := now()
+	q.mu.Lock()
+	if t.Sub(q.last) < AutoTuneInterval {
+		q.mu.Unlock()
+		return
+	}
+	q.last = t
+	q.mu.Unlock()
+
+	length := q.Len()
+	capacity := q.Cap()
+	desired := int(math.Ceil(float64(length) / q.target))
+	next := capacity + (desired-capacity)/2
+	if desired > capacity && next == capacity {
+		next++
+	}
+	if desired < capacity && next == capacity {
+		next--
+	}
+	if next < q.min {
+		next = q.min
+	}
+	if next > q.max {
+		next = q.max
+	}
+	if next == capacity {
+		return
+	}
+	err := q.Resize(next)
+	if err != nil {
+		logf("resize of %s from %d to %d failed: %v", q.Name(), capacity, next, err)
+	}
+}
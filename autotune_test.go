@@ -0,0 +1,131 @@
+package icd
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestAutoTuneGrowsUnderSustainedLoad(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewAutoTuneQueue(2, 16, 0.5)
+
+	// a producer without consumer keeps the queue full, blocking in Put
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			if q.Put(i) != nil {
+				return
+			}
+		}
+	}()
+
+	prev := q.Cap()
+	for i := 0; i < 10; i++ {
+		waitFor(t, "the producer to fill the queue", func() bool { return q.Len() == q.Cap() })
+		c.Advance(AutoTuneInterval)
+		waitFor(t, "the capacity to grow", func() bool { return q.Cap() > prev || q.Cap() == 16 })
+		if q.Cap() > 16 {
+			t.Fatalf("capacity %d exceeds max 16", q.Cap())
+		}
+		prev = q.Cap()
+	}
+	if q.Cap() != 16 {
+		t.Errorf("expected capacity to reach max 16, got %d", q.Cap())
+	}
+
+	q.Close()
+	wg.Wait()
+}
+
+func TestAutoTuneShrinksUnderLowLoad(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewAutoTuneQueue(2, 64, 0.5)
+	q.(Resizable).Resize(64)
+
+	// a consumer which keeps up leaves the queue empty whenever it is tuned
+	prev := q.Cap()
+	for i := 0; i < 20; i++ {
+		c.Advance(AutoTuneInterval)
+		q.Put(i)
+		q.Get()
+		if q.Cap() > prev || q.Cap() < 2 {
+			t.Fatalf("expected capacity to shrink within bounds, went from %d to %d", prev, q.Cap())
+		}
+		prev = q.Cap()
+	}
+	if q.Cap() != 2 {
+		t.Errorf("expected capacity to reach min 2, got %d", q.Cap())
+	}
+}
+
+func TestAutoTuneMonitorConvergesToTarget(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewAutoTuneQueue(1, 64, 0.5)
+	q.(Resizable).Resize(64)
+	for i := 0; i < 4; i++ {
+		q.Put(i)
+	}
+
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go q.Monitor(mc)
+
+	// with 4 items a utilization of 0.5 needs a capacity of 8
+	waitFor(t, "the capacity to converge", func() bool {
+		c.Advance(AutoTuneInterval)
+		return q.Cap() == 8
+	})
+	c.Advance(10 * AutoTuneInterval)
+	if q.Cap() != 8 {
+		t.Errorf("expected capacity to stay at 8, got %d", q.Cap())
+	}
+
+	close(mc.DoneChan)
+	mc.WaitGroup.Wait()
+}
+
+func TestAutoTuneBounds(t *testing.T) {
+	q := NewAutoTuneQueue(0, -1, 2)
+	if q.Cap() != 1 {
+		t.Errorf("expected min to be raised to 1, got capacity %d", q.Cap())
+	}
+}
+
+func TestAutoTuneNonBlockingTunes(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewAutoTuneQueue(2, 16, 0.5)
+	nb := q.(NonBlocking)
+	if _, ok := q.(Taker); ok {
+		t.Error("expected the queue not to let items be taken untuned")
+	}
+	if _, ok := q.(BatchPutter); ok {
+		t.Error("expected the queue not to let batches be put untuned")
+	}
+
+	nb.TryPut(1)
+	nb.TryPut(2)
+	if err := nb.TryPut(3); !IsQueueFull(err) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	// the next TryPut tunes the full queue first, making room
+	c.Advance(AutoTuneInterval)
+	if err := nb.TryPut(3); err != nil {
+		t.Errorf("expected the queue to grow, got %v with capacity %d", err, q.Cap())
+	}
+	nb.TryGet()
+	nb.TryGet()
+	nb.TryGet()
+	// the next TryGet tunes the empty queue, shrinking it
+	c.Advance(AutoTuneInterval)
+	prev := q.Cap()
+	nb.TryGet()
+	if q.Cap() >= prev {
+		t.Errorf("expected the capacity to shrink below %d, got %d", prev, q.Cap())
+	}
+}
@@ -0,0 +1,654 @@
+package icd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// monitorInterval is how often the built-in queues send statistics
+const monitorInterval = time.Second
+
+// AtomicPutter is the optional interface for queues which can enqueue a
+// batch of items all-or-nothing
+type AtomicPutter interface {
+	// PutAll puts either all of items into the queue or none of them.
+	// Returns ErrQueueFull, without inserting anything, when there is not
+	// room for the whole batch.
+	PutAll(items []interface{}) error
+}
+
+// NonBlocking is the optional interface for queues which offer put and get
+// operations that never block
+type NonBlocking interface {
+	// TryPut puts an item into the queue, returning ErrQueueFull instead of
+	// blocking when the queue is full
+	TryPut(item interface{}) error
+
+	// TryGet gets the next item from the queue, returning ErrQueueEmpty
+	// instead of blocking when the queue is empty
+	TryGet() (interface{}, error)
+}
+
+// Sequencer is the optional interface for queues which assign every item a
+// position at enqueue, like an offset, for correlation, acks and resume
+type Sequencer interface {
+	// PutSeq puts an item into the queue like Put, returning the sequence
+	// number assigned to it. Sequence numbers start at 1 and increase by
+	// one with every item enqueued.
+	PutSeq(item interface{}) (seq int64, err error)
+
+	// GetSeq gets the next item from the queue like Get, along with the
+	// sequence number assigned to it by PutSeq
+	GetSeq() (item interface{}, seq int64, err error)
+}
+
+// LenWaiter is the optional interface for queues which can wait for a
+// number of items to accumulate, e.g. for consumers processing batches
+type LenWaiter interface {
+	// WaitLen blocks until the queue holds at least min items and returns
+	// nil. It returns ctx.Err() once ctx is done and ErrQueueClosed once the
+	// queue is closed while holding fewer than min items, a closed queue
+	// holding min items or more returns nil. Having waited, the caller gets
+	// whatever items are available, e.g. with TryGet or DrainBatch.
+	WaitLen(ctx context.Context, min int) error
+}
+
+// Taker is the optional interface for queues which can hand over all their
+// items at once, e.g. for aggregators processing a window of items
+type Taker interface {
+	// TakeAll removes and returns all items of the queue, in the order Get
+	// would return them, in one atomic step: an item put concurrently is
+	// either returned or left in the queue for the next TakeAll. An empty
+	// queue returns no items and nil, or ErrQueueClosed when it is closed.
+	TakeAll() ([]interface{}, error)
+}
+
+// Resizable is the optional interface for queues whose capacity can change
+// at runtime
+type Resizable interface {
+	// Resize changes the maximum number of items the queue can hold
+	Resize(capacity int) error
+}
+
+// BaseQueue is the built-in in-memory FIFO queue. Put blocks while the queue
+// is full and Get blocks while it is empty, both return ErrQueueClosed once
+// the queue is closed, Get only after the remaining items are drained.
+type BaseQueue struct {
+	name     string
+	capacity int
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	grown    *sync.Cond
+	items    []interface{}
+	// when each item was put, in the order of items
+	enqueued []time.Time
+	closed   bool
+	puts     uint64
+	gets     uint64
+	traceID  string
+	hooks    closeHooks
+	// sequence number of the last item put
+	seq int64
+	// close callbacks and the reason of the last close
+	onClose []func(err error)
+	reason  error
+	// goroutines waiting in Put and Get
+	producers int
+	consumers int
+	// goroutines waiting in WaitLen
+	lenWaiters int
+	// slots held by reservations and goroutines waiting in Reserve
+	reserved  int
+	reservers int
+	// histograms of the durations of Put and Get, measured while timed
+	timed      int32
+	putLatency *LatencyHistogram
+	getLatency *LatencyHistogram
+}
+
+// NewBaseQueue creates a queue holding at most capacity items, a capacity
+// less than 1 creates an unbounded queue
+func NewBaseQueue(name string, capacity int) *BaseQueue {
+	if capacity < 1 {
+		capacity = -1
+	}
+	q := &BaseQueue{
+		name:     name,
+		capacity: capacity,
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	q.grown = sync.NewCond(&q.mu)
+	return q
+}
+
+// Name provides the name of the queue
+func (q *BaseQueue) Name() string {
+	return q.name
+}
+
+// Put puts an item into the queue, blocking while the queue is full
+func (q *BaseQueue) Put(item interface{}) error {
+	_, err := q.PutSeq(item)
+	return err
+}
+
+// PutSeq puts an item into the queue, blocking while the queue is full, and
+// returns its sequence number. Every put, of any kind, is numbered, Reset
+// starts the numbers over.
+func (q *BaseQueue) PutSeq(item interface{}) (int64, error) {
+	if item == nil {
+		return 0, ErrNilItem
+	}
+	start := q.startTimer()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed && q.full(1) {
+		q.producers++
+		for !q.closed && q.full(1) {
+			q.notFull.Wait()
+		}
+		q.producers--
+	}
+	if q.closed {
+		return 0, ErrQueueClosed
+	}
+	q.items = append(q.items, item)
+	q.stamp(1)
+	q.puts++
+	q.seq++
+	q.trace(item)
+	q.notEmpty.Signal()
+	q.grew()
+	observe(q.putLatency, start)
+	return q.seq, nil
+}
+
+// TryPut puts an item into the queue, returning ErrQueueFull when the queue
+// is full
+func (q *BaseQueue) TryPut(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.full(1) {
+		return ErrQueueFull
+	}
+	q.items = append(q.items, item)
+	q.stamp(1)
+	q.puts++
+	q.seq++
+	q.trace(item)
+	q.notEmpty.Signal()
+	q.grew()
+	return nil
+}
+
+// PutAll puts either all of items into the queue or none of them
+func (q *BaseQueue) PutAll(items []interface{}) error {
+	for _, item := range items {
+		if item == nil {
+			return ErrNilItem
+		}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.full(len(items)) {
+		return ErrQueueFull
+	}
+	q.add(items)
+	return nil
+}
+
+// add appends items to the queue, waking the consumers, must be called with
+// mu held and room for the items
+func (q *BaseQueue) add(items []interface{}) {
+	q.items = append(q.items, items...)
+	q.stamp(len(items))
+	q.puts += uint64(len(items))
+	q.seq += int64(len(items))
+	for _, item := range items {
+		q.trace(item)
+	}
+	q.notEmpty.Broadcast()
+	q.grew()
+}
+
+// TryPutBatch puts as many of items into the queue as fit without blocking,
+// in order, and returns how many were put
+func (q *BaseQueue) TryPutBatch(items []interface{}) (int, error) {
+	for _, item := range items {
+		if item == nil {
+			return 0, ErrNilItem
+		}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0, ErrQueueClosed
+	}
+	accepted := len(items)
+	if q.full(accepted) {
+		accepted = q.capacity - len(q.items) - q.reserved
+		if accepted < 0 {
+			accepted = 0
+		}
+	}
+	q.items = append(q.items, items[:accepted]...)
+	q.stamp(accepted)
+	q.puts += uint64(accepted)
+	q.seq += int64(accepted)
+	for _, item := range items[:accepted] {
+		q.trace(item)
+	}
+	if accepted > 0 {
+		q.notEmpty.Broadcast()
+		q.grew()
+	}
+	return accepted, nil
+}
+
+// Get gets the next item from the queue, blocking while the queue is empty
+func (q *BaseQueue) Get() (interface{}, error) {
+	item, _, err := q.GetSeq()
+	return item, err
+}
+
+// GetSeq gets the next item from the queue, blocking while the queue is
+// empty, along with its sequence number
+func (q *BaseQueue) GetSeq() (interface{}, int64, error) {
+	item, seq, _, err := q.get()
+	return item, seq, err
+}
+
+// get gets the next item, blocking while the queue is empty, along with its
+// sequence number and the time it was put
+func (q *BaseQueue) get() (interface{}, int64, time.Time, error) {
+	start := q.startTimer()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed && len(q.items) == 0 {
+		q.consumers++
+		for !q.closed && len(q.items) == 0 {
+			q.notEmpty.Wait()
+		}
+		q.consumers--
+	}
+	if len(q.items) == 0 {
+		return nil, 0, time.Time{}, ErrQueueClosed
+	}
+	// the queued items hold the last len(items) numbers, the head the lowest
+	seq := q.seq - int64(len(q.items)) + 1
+	enqueued := q.enqueued[0]
+	observe(q.getLatency, start)
+	return q.pop(), seq, enqueued, nil
+}
+
+// TryGet gets the next item from the queue, returning ErrQueueEmpty when the
+// queue is empty and ErrQueueClosed when it is also closed
+func (q *BaseQueue) TryGet() (interface{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		if q.closed {
+			return nil, ErrQueueClosed
+		}
+		return nil, ErrQueueEmpty
+	}
+	return q.pop(), nil
+}
+
+// DrainBatch returns an iterator removing up to batchSize items per call
+// under a single lock, a batchSize below 1 is raised to 1
+func (q *BaseQueue) DrainBatch(ctx context.Context, batchSize int) func() ([]interface{}, error) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return func() ([]interface{}, error) {
+		err := ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if len(q.items) == 0 {
+			if q.closed {
+				return nil, ErrQueueClosed
+			}
+			return nil, ErrQueueEmpty
+		}
+		n := batchSize
+		if n > len(q.items) {
+			n = len(q.items)
+		}
+		batch := make([]interface{}, n)
+		copy(batch, q.items)
+		for i := 0; i < n; i++ {
+			q.items[i] = nil
+		}
+		q.items = q.items[n:]
+		q.enqueued = q.enqueued[n:]
+		q.gets += uint64(n)
+		q.notFull.Broadcast()
+		return batch, nil
+	}
+}
+
+// TakeAll removes and returns all items of the queue under a single lock
+func (q *BaseQueue) TakeAll() ([]interface{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		if q.closed {
+			return nil, ErrQueueClosed
+		}
+		return nil, nil
+	}
+	items := q.items
+	q.items = nil
+	q.enqueued = nil
+	q.gets += uint64(len(items))
+	q.notFull.Broadcast()
+	return items, nil
+}
+
+// Len returns the number of items in the queue
+func (q *BaseQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Cap returns the maximum number of items the queue can hold, -1 if
+// unbounded
+func (q *BaseQueue) Cap() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.capacity
+}
+
+// Resize changes the maximum number of items the queue can hold, a capacity
+// less than 1 makes the queue unbounded. Shrinking below the current length
+// keeps the items, Put blocks until the length drops below the new capacity.
+func (q *BaseQueue) Resize(capacity int) error {
+	if capacity < 1 {
+		capacity = -1
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.capacity = capacity
+	q.notFull.Broadcast()
+	return nil
+}
+
+// Clear removes all items from the queue
+func (q *BaseQueue) Clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = nil
+	q.enqueued = nil
+	q.notFull.Broadcast()
+}
+
+// Reset removes all items, clears statistics and reopens the queue
+func (q *BaseQueue) Reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = nil
+	q.enqueued = nil
+	q.closed = false
+	q.reason = nil
+	q.clearLatency()
+	q.seq = 0
+	q.puts = 0
+	q.gets = 0
+	q.traceID = ""
+	q.notFull.Broadcast()
+}
+
+// Close closes the queue, waking all blocked callers. Close returns once the
+// running monitors of the queue sent statistics of the closed queue, or
+// dropped them when the stats channel was full, and the close callbacks ran.
+func (q *BaseQueue) Close() error {
+	return q.CloseWithError(nil)
+}
+
+// CloseWithError closes the queue like Close, handing err to the close
+// callbacks as the reason. Closing a closed queue keeps the first reason.
+func (q *BaseQueue) CloseWithError(err error) error {
+	q.mu.Lock()
+	closing := !q.closed
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	q.grown.Broadcast()
+	var callbacks []func(err error)
+	if closing {
+		q.reason = err
+		callbacks = q.onClose
+		q.onClose = nil
+	}
+	q.mu.Unlock()
+	if closing {
+		q.hooks.fire()
+		runOnClose(q.name, callbacks, err)
+	}
+	return nil
+}
+
+// OnClose registers fn to be called once when the queue next closes, or at
+// once when it is closed
+func (q *BaseQueue) OnClose(fn func(err error)) {
+	q.mu.Lock()
+	if !q.closed {
+		q.onClose = append(q.onClose, fn)
+		q.mu.Unlock()
+		return
+	}
+	reason := q.reason
+	q.mu.Unlock()
+	runCloseCallback(q.name, fn, reason)
+}
+
+// Closed returns whether or not the queue is closed
+func (q *BaseQueue) Closed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// Each calls fn for every item in the queue in FIFO order until fn returns
+// false. The queue is locked for the duration so fn must not call back into
+// the queue.
+func (q *BaseQueue) Each(fn func(item interface{}) bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, item := range q.items {
+		if !fn(item) {
+			break
+		}
+	}
+	return nil
+}
+
+// PeekMatch returns the first item for which pred returns true, and whether
+// there is one, without removing it
+func (q *BaseQueue) PeekMatch(pred func(item interface{}) bool) (interface{}, bool, error) {
+	return peekMatch(q, pred)
+}
+
+// WaitLen blocks until the queue holds at least min items, ctx is done or
+// the queue is closed, see LenWaiter
+func (q *BaseQueue) WaitLen(ctx context.Context, min int) error {
+	done := ctx.Done()
+	if done != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-done:
+				q.mu.Lock()
+				q.grown.Broadcast()
+				q.mu.Unlock()
+			case <-stop:
+			}
+		}()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.lenWaiters++
+	defer func() { q.lenWaiters-- }()
+	for len(q.items) < min {
+		if q.closed {
+			return ErrQueueClosed
+		}
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		q.grown.Wait()
+	}
+	return nil
+}
+
+// grew wakes the goroutines waiting in WaitLen after items were put, must be
+// called with mu held
+func (q *BaseQueue) grew() {
+	if q.lenWaiters > 0 {
+		q.grown.Broadcast()
+	}
+}
+
+// BlockedProducers returns the number of goroutines blocked in Put on the
+// full queue
+func (q *BaseQueue) BlockedProducers() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.producers
+}
+
+// BlockedConsumers returns the number of goroutines blocked in Get on the
+// empty queue
+func (q *BaseQueue) BlockedConsumers() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.consumers
+}
+
+// Stats returns the current statistics of the queue
+func (q *BaseQueue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stats()
+}
+
+// Inspect returns the statistics and a copy of the items of the queue taken
+// under a single lock
+func (q *BaseQueue) Inspect() (QueueStats, []interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := make([]interface{}, len(q.items))
+	copy(items, q.items)
+	return q.stats(), items
+}
+
+// SnapshotAt returns a snapshot of the statistics and items of the queue
+func (q *BaseQueue) SnapshotAt() Snapshot {
+	return snapshotOf(q)
+}
+
+// Monitor sends the statistics of the queue every second and once more when
+// the queue closes, clears them on request and sends the final statistics on
+// shutdown
+func (q *BaseQueue) Monitor(mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	hook := q.hooks.attach()
+	for {
+		select {
+		case <-hook.closing:
+			hook = q.hooks.flushClosed(hook, mc, q.Stats())
+		case <-mc.ClearChan:
+			q.mu.Lock()
+			q.puts = 0
+			q.gets = 0
+			q.clearLatency()
+			q.mu.Unlock()
+		case <-mc.DoneChan:
+			q.hooks.detach(hook)
+			mc.FinalStatsChan <- q.Stats()
+			return
+		case <-after(monitorInterval):
+			select {
+			case mc.StatsChan <- q.Stats():
+			default:
+			}
+		}
+	}
+}
+
+// stats returns the current statistics, must be called with mu held
+func (q *BaseQueue) stats() QueueStats {
+	return QueueStats{
+		Name:        q.name,
+		Len:         len(q.items),
+		Cap:         q.capacity,
+		Puts:        q.puts,
+		Gets:        q.gets,
+		Closed:      q.closed,
+		LastTraceID: q.traceID,
+		PutLatency:  copyHistogram(q.putLatency),
+		GetLatency:  copyHistogram(q.getLatency),
+	}
+}
+
+// trace records the trace id of item, if it carries one, must be called with
+// mu held
+func (q *BaseQueue) trace(item interface{}) {
+	id := TraceID(item)
+	if id != "" {
+		q.traceID = id
+	}
+}
+
+// pop removes and returns the first item, must be called with mu held and
+// the queue not empty
+func (q *BaseQueue) pop() interface{} {
+	item := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	q.enqueued = q.enqueued[1:]
+	q.gets++
+	if q.reservers > 0 {
+		// a reservation may need more than the one slot freed, so wake
+		// everyone rather than a single waiter
+		q.notFull.Broadcast()
+	} else {
+		q.notFull.Signal()
+	}
+	return item
+}
+
+// stamp records the time the last n items were put, must be called with mu
+// held
+func (q *BaseQueue) stamp(n int) {
+	at := now()
+	for i := 0; i < n; i++ {
+		q.enqueued = append(q.enqueued, at)
+	}
+}
+
+// full returns whether or not n more items exceed the capacity left by the
+// reservations, must be called with mu held
+func (q *BaseQueue) full(n int) bool {
+	return q.capacity >= 0 && len(q.items)+q.reserved+n > q.capacity
+}
@@ -0,0 +1,387 @@
+package icd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBaseQueueFIFO(t *testing.T) {
+	q := NewBaseQueue("fifo", 0)
+	if q.Cap() != -1 {
+		t.Errorf("expected unbounded capacity -1, got %d", q.Cap())
+	}
+	for i := 0; i < 3; i++ {
+		q.Put(i)
+	}
+	for i := 0; i < 3; i++ {
+		item, err := q.Get()
+		if err != nil || item != i {
+			t.Errorf("expected %d, got %v %v", i, item, err)
+		}
+	}
+	stats := q.Stats()
+	if stats.Puts != 3 || stats.Gets != 3 || stats.Len != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestBaseQueueBlocking(t *testing.T) {
+	q := NewBaseQueue("blocking", 1)
+	q.Put(1)
+
+	put := make(chan error)
+	go func() {
+		put <- q.Put(2)
+	}()
+	select {
+	case <-put:
+		t.Fatal("put did not block on a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	q.Get()
+	if err := <-put; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	q.Get()
+	get := make(chan error)
+	go func() {
+		_, err := q.Get()
+		get <- err
+	}()
+	select {
+	case <-get:
+		t.Fatal("get did not block on an empty queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	q.Close()
+	if err := <-get; !IsQueueClosed(err) {
+		t.Errorf("expected close to wake the getter with ErrQueueClosed, got %v", err)
+	}
+}
+
+func TestBaseQueuePutAllFits(t *testing.T) {
+	q := NewBaseQueue("putall", 3)
+	q.Put(0)
+	if err := q.PutAll([]interface{}{1, 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	items, _ := Items(q)
+	if len(items) != 3 || items[1] != 1 || items[2] != 2 {
+		t.Errorf("unexpected items %v", items)
+	}
+}
+
+func TestBaseQueuePutAllDoesNotFit(t *testing.T) {
+	q := NewBaseQueue("putall", 3)
+	q.Put(0)
+	if err := q.PutAll([]interface{}{1, 2, 3}); !IsQueueFull(err) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	if q.Len() != 1 {
+		t.Errorf("expected nothing inserted, got len %d", q.Len())
+	}
+	if err := q.PutAll([]interface{}{1, nil}); !IsNilItem(err) {
+		t.Errorf("expected ErrNilItem, got %v", err)
+	}
+	if q.Len() != 1 {
+		t.Errorf("expected nothing inserted, got len %d", q.Len())
+	}
+}
+
+func TestBaseQueuePutAllClosed(t *testing.T) {
+	q := NewBaseQueue("putall", 0)
+	q.Close()
+	if err := q.PutAll([]interface{}{1}); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+}
+
+func TestBaseQueueResetReopens(t *testing.T) {
+	q := NewBaseQueue("reset", 0)
+	q.Put(1)
+	q.Close()
+	q.Reset()
+	if q.Closed() || q.Len() != 0 || q.Stats().Puts != 0 {
+		t.Errorf("expected reset to reopen an empty queue, got %+v", q.Stats())
+	}
+	if err := q.Put(1); err != nil {
+		t.Errorf("unexpected error after reset: %v", err)
+	}
+}
+
+func TestBaseQueueMonitor(t *testing.T) {
+	q := NewBaseQueue("monitor", 0)
+	q.Put(1)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go q.Monitor(mc)
+	close(mc.DoneChan)
+	mc.WaitGroup.Wait()
+
+	final := (<-mc.FinalStatsChan).(QueueStats)
+	if final.Name != "monitor" || final.Puts != 1 {
+		t.Errorf("unexpected final stats %+v", final)
+	}
+}
+
+func newTestMonitorControl() *MonitorControl {
+	return &MonitorControl{
+		StatsChan:      make(chan interface{}, 100),
+		FinalStatsChan: make(chan interface{}, 10),
+		ClearChan:      make(chan struct{}, 1),
+		DoneChan:       make(chan struct{}),
+		WaitGroup:      &sync.WaitGroup{},
+	}
+}
+
+func TestBaseQueueResize(t *testing.T) {
+	q := NewBaseQueue("resize", 1)
+	q.Put(1)
+	put := make(chan error)
+	go func() {
+		put <- q.Put(2)
+	}()
+	q.Resize(2)
+	if err := <-put; err != nil {
+		t.Errorf("expected growing to wake the blocked put, got %v", err)
+	}
+	q.Resize(1)
+	if q.Len() != 2 || q.Cap() != 1 {
+		t.Errorf("expected shrinking to keep the items, got len %d cap %d", q.Len(), q.Cap())
+	}
+	if err := q.TryPut(3); !IsQueueFull(err) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestBaseQueueBlockedCounts(t *testing.T) {
+	var r BlockReporter = NewBaseQueue("blocked", 1)
+	q := r.(*BaseQueue)
+	done := make(chan struct{}, 6)
+	for i := 0; i < 3; i++ {
+		go func() {
+			q.Get()
+			done <- struct{}{}
+		}()
+	}
+	waitFor(t, "blocked consumers", func() bool { return r.BlockedConsumers() == 3 })
+	if r.BlockedProducers() != 0 {
+		t.Errorf("expected no blocked producers, got %d", r.BlockedProducers())
+	}
+	for i := 0; i < 3; i++ {
+		q.Put(i)
+	}
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	if r.BlockedConsumers() != 0 {
+		t.Errorf("expected no blocked consumers, got %d", r.BlockedConsumers())
+	}
+
+	q.Put(0)
+	for i := 0; i < 2; i++ {
+		i := i
+		go func() {
+			q.Put(i)
+			done <- struct{}{}
+		}()
+	}
+	waitFor(t, "blocked producers", func() bool { return r.BlockedProducers() == 2 })
+	q.Close()
+	<-done
+	<-done
+	if r.BlockedProducers() != 0 {
+		t.Errorf("expected closing to release the producers, got %d", r.BlockedProducers())
+	}
+}
+
+func TestBaseQueueSequence(t *testing.T) {
+	var s Sequencer = NewBaseQueue("seq", 0)
+	q := s.(*BaseQueue)
+	for want := int64(1); want <= 3; want++ {
+		seq, err := s.PutSeq(int(want * 10))
+		if err != nil || seq != want {
+			t.Errorf("expected sequence %d, got %d, %v", want, seq, err)
+		}
+	}
+	// the other puts are numbered too
+	q.TryPut(40)
+	q.PutAll([]interface{}{50, 60})
+	if seq, _ := s.PutSeq(70); seq != 7 {
+		t.Errorf("expected sequence 7, got %d", seq)
+	}
+
+	for want := int64(1); want <= 7; want++ {
+		item, seq, err := s.GetSeq()
+		if err != nil || seq != want || item != int(want*10) {
+			t.Errorf("expected item %d with sequence %d, got %v with %d, %v", want*10, want, item, seq, err)
+		}
+	}
+
+	// cleared items keep their numbers
+	s.PutSeq(1)
+	q.Clear()
+	s.PutSeq(2)
+	if item, seq, _ := s.GetSeq(); item != 2 || seq != 9 {
+		t.Errorf("expected item 2 with sequence 9, got %v with %d", item, seq)
+	}
+
+	q.Reset()
+	if seq, _ := s.PutSeq(1); seq != 1 {
+		t.Errorf("expected reset to start over, got %d", seq)
+	}
+	q.Close()
+	s.GetSeq()
+	if _, _, err := s.GetSeq(); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+	if _, err := s.PutSeq(nil); !IsNilItem(err) {
+		t.Errorf("expected ErrNilItem, got %v", err)
+	}
+}
+
+func TestBaseQueueWaitLen(t *testing.T) {
+	q := NewBaseQueue("wait", 0)
+	result := make(chan error, 1)
+	go func() {
+		result <- q.WaitLen(context.Background(), 3)
+	}()
+
+	q.Put("a")
+	q.PutAll([]interface{}{"b"})
+	select {
+	case err := <-result:
+		t.Fatalf("expected WaitLen to block below the threshold, got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	q.TryPut("c")
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected WaitLen to wake once the threshold is reached")
+	}
+
+	// already at the threshold
+	if err := q.WaitLen(context.Background(), 3); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestBaseQueueWaitLenCancel(t *testing.T) {
+	q := NewBaseQueue("wait", 0)
+	q.Put("a")
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- q.WaitLen(ctx, 2)
+	}()
+	cancel()
+	select {
+	case err := <-result:
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected WaitLen to return on cancellation")
+	}
+	if q.Len() != 1 {
+		t.Errorf("expected the items to stay queued, got %d", q.Len())
+	}
+}
+
+func TestBaseQueueWaitLenClose(t *testing.T) {
+	q := NewBaseQueue("wait", 0)
+	q.Put("a")
+	result := make(chan error, 1)
+	go func() {
+		result <- q.WaitLen(context.Background(), 2)
+	}()
+	q.Close()
+	select {
+	case err := <-result:
+		if !IsQueueClosed(err) {
+			t.Errorf("expected ErrQueueClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected WaitLen to return on close")
+	}
+
+	// a closed queue holding enough items still satisfies the wait
+	if err := q.WaitLen(context.Background(), 1); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestBaseQueueTakeAll(t *testing.T) {
+	q := NewBaseQueue("window", 0)
+	if items, err := q.TakeAll(); items != nil || err != nil {
+		t.Errorf("expected no items from empty queue, got %v %v", items, err)
+	}
+	q.Put("a")
+	q.Put("b")
+	items, err := q.TakeAll()
+	if err != nil || len(items) != 2 || items[0] != "a" || items[1] != "b" {
+		t.Errorf("expected [a b], got %v %v", items, err)
+	}
+	if q.Len() != 0 || q.Stats().Gets != 2 {
+		t.Errorf("expected empty queue with 2 gets, got %+v", q.Stats())
+	}
+	q.Close()
+	if _, err := q.TakeAll(); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+}
+
+func TestBaseQueueTakeAllConcurrentPuts(t *testing.T) {
+	const producers, puts = 4, 1000
+	q := NewBaseQueue("window", 0)
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < puts; i++ {
+				q.Put(p*puts + i)
+			}
+		}(p)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	seen := make(map[interface{}]int)
+	take := func() {
+		items, err := q.TakeAll()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, item := range items {
+			seen[item]++
+		}
+	}
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		take()
+	}
+	take()
+	if len(seen) != producers*puts {
+		t.Fatalf("expected %d items, got %d", producers*puts, len(seen))
+	}
+	for item, n := range seen {
+		if n != 1 {
+			t.Fatalf("expected %v once, got it %d times", item, n)
+		}
+	}
+}
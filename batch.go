@@ -0,0 +1,94 @@
+package icd
+
+import (
+	"context"
+)
+
+// BatchPutter is the optional interface for queues which can enqueue part of
+// a batch without blocking
+type BatchPutter interface {
+	// TryPutBatch puts items into the queue, in order, until it is full and
+	// returns the number accepted without blocking. Returns ErrNilItem,
+	// without inserting anything, when any item is nil and ErrQueueClosed
+	// when the queue is closed.
+	TryPutBatch(items []interface{}) (accepted int, err error)
+}
+
+// BatchDrainer is the optional interface for queues which can remove their
+// items in batches
+type BatchDrainer interface {
+	// DrainBatch returns an iterator removing up to batchSize items from
+	// the queue per call, in the order Get would return them, without
+	// blocking. Once no items remain the iterator returns ErrQueueEmpty,
+	// or ErrQueueClosed when the queue is closed, and once ctx is done it
+	// returns the error of ctx.
+	DrainBatch(ctx context.Context, batchSize int) func() ([]interface{}, error)
+}
+
+// TryPutBatch puts as many of items into q as fit without blocking and
+// returns how many were accepted. Queues which are not a BatchPutter but are
+// NonBlocking are filled one TryPut at a time, other queues return
+// ErrNotSupported.
+func TryPutBatch(q Queue, items []interface{}) (int, error) {
+	b, ok := q.(BatchPutter)
+	if ok {
+		return b.TryPutBatch(items)
+	}
+	nb, ok := q.(NonBlocking)
+	if !ok {
+		return 0, ErrNotSupported
+	}
+	for _, item := range items {
+		if item == nil {
+			return 0, ErrNilItem
+		}
+	}
+	for i, item := range items {
+		err := nb.TryPut(item)
+		if IsQueueFull(err) {
+			return i, nil
+		}
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(items), nil
+}
+
+// DrainBatch returns an iterator removing up to batchSize items from q per
+// call, see BatchDrainer. Queues which are not a BatchDrainer but are
+// NonBlocking are drained one TryGet at a time, for other queues the
+// iterator returns ErrNotSupported. A batchSize below 1 is raised to 1.
+func DrainBatch(ctx context.Context, q Queue, batchSize int) func() ([]interface{}, error) {
+	d, ok := q.(BatchDrainer)
+	if ok {
+		return d.DrainBatch(ctx, batchSize)
+	}
+	nb, ok := q.(NonBlocking)
+	if !ok {
+		return func() ([]interface{}, error) {
+			return nil, ErrNotSupported
+		}
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return func() ([]interface{}, error) {
+		err := ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+		var batch []interface{}
+		for len(batch) < batchSize {
+			item, err := nb.TryGet()
+			if err != nil {
+				if len(batch) > 0 {
+					break
+				}
+				return nil, err
+			}
+			batch = append(batch, item)
+		}
+		return batch, nil
+	}
+}
@@ -0,0 +1,153 @@
+package icd
+
+import (
+	"context"
+	"testing"
+)
+
+type tryPutOnly struct {
+	Queue
+}
+
+func (q tryPutOnly) TryPut(item interface{}) error {
+	return q.Queue.(NonBlocking).TryPut(item)
+}
+
+func (q tryPutOnly) TryGet() (interface{}, error) {
+	return q.Queue.(NonBlocking).TryGet()
+}
+
+func TestTryPutBatchFitsAll(t *testing.T) {
+	q := NewBaseQueue("q", 3)
+	accepted, err := q.TryPutBatch([]interface{}{1, 2, 3})
+	if err != nil || accepted != 3 || q.Len() != 3 {
+		t.Errorf("expected all 3 accepted, got %d, %v", accepted, err)
+	}
+}
+
+func TestTryPutBatchPartialOnFull(t *testing.T) {
+	q := NewBaseQueue("q", 3)
+	q.Put(0)
+	accepted, err := q.TryPutBatch([]interface{}{1, 2, 3})
+	if err != nil || accepted != 2 {
+		t.Errorf("expected 2 accepted, got %d, %v", accepted, err)
+	}
+	for _, want := range []int{0, 1, 2} {
+		item, _ := q.Get()
+		if item != want {
+			t.Errorf("expected %d, got %v", want, item)
+		}
+	}
+
+	accepted, err = q.TryPutBatch([]interface{}{4, nil})
+	if !IsNilItem(err) || accepted != 0 || q.Len() != 0 {
+		t.Errorf("expected a nil item to reject the batch, got %d, %v", accepted, err)
+	}
+
+	q.Put(1)
+	q.Put(2)
+	q.Put(3)
+	accepted, err = q.TryPutBatch([]interface{}{4})
+	if err != nil || accepted != 0 {
+		t.Errorf("expected nothing accepted by a full queue, got %d, %v", accepted, err)
+	}
+}
+
+func TestTryPutBatchClosed(t *testing.T) {
+	q := NewBaseQueue("q", 3)
+	q.Close()
+	accepted, err := q.TryPutBatch([]interface{}{1})
+	if !IsQueueClosed(err) || accepted != 0 {
+		t.Errorf("expected ErrQueueClosed, got %d, %v", accepted, err)
+	}
+}
+
+func TestTryPutBatchFallback(t *testing.T) {
+	q := tryPutOnly{NewBaseQueue("q", 2)}
+	accepted, err := TryPutBatch(q, []interface{}{1, 2, 3})
+	if err != nil || accepted != 2 {
+		t.Errorf("expected 2 accepted through TryPut, got %d, %v", accepted, err)
+	}
+	q.Close()
+	if _, err := TryPutBatch(q, []interface{}{1}); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+	if _, err := TryPutBatch(struct{ Queue }{NewBaseQueue("q", 1)}, []interface{}{1}); !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestDrainBatch(t *testing.T) {
+	q := NewBaseQueue("q", 0)
+	for i := 0; i < 1000; i++ {
+		q.Put(i)
+	}
+	q.Close()
+	next := q.DrainBatch(context.Background(), 64)
+	total, batches := 0, 0
+	for {
+		batch, err := next()
+		if IsQueueClosed(err) {
+			break
+		}
+		if err != nil || len(batch) == 0 || len(batch) > 64 {
+			t.Fatalf("unexpected batch of %d, %v", len(batch), err)
+		}
+		for _, item := range batch {
+			if item != total {
+				t.Fatalf("expected %d, got %v", total, item)
+			}
+			total++
+		}
+		batches++
+	}
+	if total != 1000 || batches != 16 || q.Stats().Gets != 1000 {
+		t.Errorf("expected 1000 items in 16 batches, got %d in %d", total, batches)
+	}
+}
+
+func TestDrainBatchCancel(t *testing.T) {
+	q := NewBaseQueue("q", 0)
+	for i := 0; i < 10; i++ {
+		q.Put(i)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	next := q.DrainBatch(ctx, 4)
+	if batch, _ := next(); len(batch) != 4 {
+		t.Errorf("expected a batch of 4, got %v", batch)
+	}
+	cancel()
+	if _, err := next(); err != context.Canceled {
+		t.Errorf("expected the context error, got %v", err)
+	}
+	if q.Len() != 6 {
+		t.Errorf("expected 6 items left, got %d", q.Len())
+	}
+	next = q.DrainBatch(context.Background(), 0)
+	if batch, _ := next(); len(batch) != 1 {
+		t.Errorf("expected a batch size below 1 to drain one item, got %v", batch)
+	}
+}
+
+func TestDrainBatchFallback(t *testing.T) {
+	q := tryPutOnly{NewBaseQueue("q", 0)}
+	for i := 0; i < 5; i++ {
+		q.Put(i)
+	}
+	next := DrainBatch(context.Background(), q, 2)
+	var items []interface{}
+	for {
+		batch, err := next()
+		if IsQueueEmpty(err) {
+			break
+		}
+		items = append(items, batch...)
+	}
+	if len(items) != 5 || items[4] != 4 {
+		t.Errorf("expected the 5 items in order, got %v", items)
+	}
+	next = DrainBatch(context.Background(), struct{ Queue }{NewBaseQueue("q", 0)}, 2)
+	if _, err := next(); !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
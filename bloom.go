@@ -0,0 +1,168 @@
+package icd
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// FillEstimator is the optional interface for queues backed by a
+// probabilistic filter which saturates as it sees more items
+type FillEstimator interface {
+	// Fill returns the estimated fill of the filter, the fraction of its
+	// bits which are set, from 0 to 1
+	Fill() float64
+}
+
+type bloomFilter struct {
+	bits   []uint64
+	m      uint64
+	k      uint64
+	filled uint64
+}
+
+// newBloomFilter sizes a bloom filter for n items at a false positive rate of
+// p
+func newBloomFilter(n int, p float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// hashes returns the two hashes of id the bits of the filter are derived
+// from, the halves of a single 64-bit hash. The second is odd so the bits
+// probed are distinct.
+func (f *bloomFilter) hashes(id string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	sum := h.Sum64()
+	return sum & 0xffffffff, sum>>32 | 1
+}
+
+// contains returns whether or not id was probably added to the filter
+func (f *bloomFilter) contains(id string) bool {
+	a, b := f.hashes(id)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (a + i*b) % f.m
+		if f.bits[bit/64]&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// add adds id to the filter
+func (f *bloomFilter) add(id string) {
+	a, b := f.hashes(id)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (a + i*b) % f.m
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if f.bits[word]&mask == 0 {
+			f.bits[word] |= mask
+			f.filled++
+		}
+	}
+}
+
+func (f *bloomFilter) reset() {
+	for i := range f.bits {
+		f.bits[i] = 0
+	}
+	f.filled = 0
+}
+
+type bloomDedupQueue struct {
+	Queue
+	id func(interface{}) string
+	// serializes the puts, so an id is looked up and added around the Put
+	// into the wrapped queue without a concurrent Put of it in between
+	putMu   sync.Mutex
+	mu      sync.Mutex
+	filter  *bloomFilter
+	dropped uint64
+}
+
+// NewBloomDedupQueue wraps q so items whose id has probably been put before
+// are dropped. Unlike an exact set of ids the bloom filter has a fixed size,
+// chosen for expectedN distinct ids at the false positive rate fpRate, so it
+// scales to huge numbers of ids. The tradeoff is that a new item is dropped
+// as a duplicate with probability fpRate, rising beyond it once more than
+// expectedN ids have been seen, see Fill. An id is recorded as seen once the
+// Put into q succeeded, puts are serialized to that end. Dropped items are counted, see DropCounter, and Reset
+// empties the filter. An expectedN below 1 is raised to 1 and an fpRate
+// outside (0, 1) is treated as 0.01.
+func NewBloomDedupQueue(q Queue, id func(interface{}) string, expectedN int, fpRate float64) Queue {
+	if expectedN < 1 {
+		expectedN = 1
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		fpRate = 0.01
+	}
+	return &bloomDedupQueue{
+		Queue:  q,
+		id:     id,
+		filter: newBloomFilter(expectedN, fpRate),
+	}
+}
+
+// Put puts the item into the queue unless its id has probably been seen
+func (q *bloomDedupQueue) Put(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	id := q.id(item)
+	q.putMu.Lock()
+	defer q.putMu.Unlock()
+	q.mu.Lock()
+	seen := q.filter.contains(id)
+	if seen {
+		q.dropped++
+	}
+	q.mu.Unlock()
+	if seen {
+		return nil
+	}
+	err := q.Queue.Put(item)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	q.filter.add(id)
+	q.mu.Unlock()
+	return nil
+}
+
+// Dropped returns the number of items dropped as duplicates
+func (q *bloomDedupQueue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Fill returns the fraction of the bits of the filter which are set. The
+// false positive rate of the next new id is about Fill to the power of the
+// number of hashes, so it nears fpRate once expectedN ids have been seen.
+func (q *bloomDedupQueue) Fill() float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return float64(q.filter.filled) / float64(q.filter.m)
+}
+
+// Reset resets the wrapped queue, the filter and the count of dropped items
+func (q *bloomDedupQueue) Reset() {
+	q.mu.Lock()
+	q.filter.reset()
+	q.dropped = 0
+	q.mu.Unlock()
+	q.Queue.Reset()
+}
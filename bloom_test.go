@@ -0,0 +1,81 @@
+package icd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func stringID(item interface{}) string {
+	return fmt.Sprint(item)
+}
+
+func TestBloomDedupQueueDropsDuplicates(t *testing.T) {
+	q := NewBloomDedupQueue(NewBaseQueue("dedup", 0), stringID, 100, 0.01)
+	for _, item := range []string{"a", "b", "a", "c", "b", "a"} {
+		if err := q.Put(item); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if q.Len() != 3 {
+		t.Errorf("expected 3 distinct items, got %d", q.Len())
+	}
+	if dropped := q.(DropCounter).Dropped(); dropped != 3 {
+		t.Errorf("expected 3 dropped duplicates, got %d", dropped)
+	}
+	if err := q.Put(nil); !IsNilItem(err) {
+		t.Errorf("expected ErrNilItem, got %v", err)
+	}
+
+	q.Reset()
+	if q.(DropCounter).Dropped() != 0 || q.(FillEstimator).Fill() != 0 {
+		t.Error("expected reset to clear the filter")
+	}
+	q.Put("a")
+	if q.Len() != 1 {
+		t.Error("expected a seen id to be accepted again after reset")
+	}
+}
+
+func TestBloomDedupQueueFalsePositiveRate(t *testing.T) {
+	const n = 10000
+	const fpRate = 0.01
+	q := NewBloomDedupQueue(NewBaseQueue("dedup", 0), stringID, n, fpRate)
+	for i := 0; i < n; i++ {
+		q.Put(fmt.Sprintf("seen-%d", i))
+	}
+	falsePositives := q.(DropCounter).Dropped()
+	fill := q.(FillEstimator).Fill()
+	if fill < 0.4 || fill > 0.6 {
+		t.Errorf("expected the filter to be about half full at expectedN, got %.3f", fill)
+	}
+
+	// the rate of new ids dropped stays near the configured bound, probing
+	// few enough ids not to overfill the filter
+	const probes = n / 10
+	for i := 0; i < probes; i++ {
+		q.Put(fmt.Sprintf("new-%d", i))
+	}
+	falsePositives = q.(DropCounter).Dropped() - falsePositives
+	rate := float64(falsePositives) / probes
+	if rate > 2*fpRate {
+		t.Errorf("expected a false positive rate near %v, got %v", fpRate, rate)
+	}
+}
+
+func TestBloomDedupQueueRecordsOnlyPutItems(t *testing.T) {
+	inner := NewBaseQueue("dedup", 0)
+	q := NewBloomDedupQueue(inner, stringID, 100, 0.01)
+	inner.Close()
+	if err := q.Put("a"); !IsQueueClosed(err) {
+		t.Fatalf("expected ErrQueueClosed, got %v", err)
+	}
+	// the failed put left the id unseen, it is accepted once the wrapped
+	// queue is open again
+	inner.Reset()
+	if err := q.Put("a"); err != nil || q.Len() != 1 {
+		t.Errorf("expected the retried item to be put, got %v with %d items", err, q.Len())
+	}
+	if dropped := q.(DropCounter).Dropped(); dropped != 0 {
+		t.Errorf("expected no dropped items, got %d", dropped)
+	}
+}
@@ -0,0 +1,42 @@
+package icd
+
+import (
+	"time"
+)
+
+// NewPacedBridge returns a runnable moving the items of src to dst at no
+// more than perSecond items per second, a non-positive rate moves them as
+// fast as dst accepts them. The runnable blocks until src is closed and
+// drained or flow is done, closing dst before it returns; run it in its own
+// goroutine, e.g. through flow.Go. Put blocking on a full dst holds the
+// bridge back, and a bridge which fell behind continues at the paced rate
+// rather than bursting to catch up. Pacing follows the package Clock.
+func NewPacedBridge(src Queue, dst Queue, perSecond float64) func(flow *Flow) {
+	var interval time.Duration
+	if perSecond > 0 {
+		interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return func(flow *Flow) {
+		defer dst.Close()
+		next := now()
+		for {
+			item, err := getOrDone(src, flow.DoneChan)
+			if err != nil {
+				return
+			}
+
+			wait := next.Sub(now())
+			if wait > 0 {
+				select {
+				case <-after(wait):
+				case <-flow.DoneChan:
+					return
+				}
+			}
+			if dst.Put(item) != nil {
+				return
+			}
+			next = now().Add(interval)
+		}
+	}
+}
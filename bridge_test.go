@@ -0,0 +1,102 @@
+package icd
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPacedBridgeRate(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	src := NewBaseQueue("src", 0)
+	dst := NewBaseQueue("dst", 0)
+	for i := 0; i < 5; i++ {
+		src.Put(i)
+	}
+	src.Close()
+	flow := &Flow{DoneChan: make(chan struct{}), WaitGroup: &sync.WaitGroup{}}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		NewPacedBridge(src, dst, 10)(flow)
+	}()
+
+	// the first item moves right away, then one per 100ms
+	waitFor(t, "the first item", func() bool { return dst.Len() == 1 })
+	for i := 2; i <= 5; i++ {
+		waitFor(t, "the pacing timer", func() bool { return c.Waiters() == 1 })
+		if dst.Len() != i-1 {
+			t.Fatalf("expected %d items before the interval passed, got %d", i-1, dst.Len())
+		}
+		c.Advance(100 * time.Millisecond)
+		waitFor(t, "the next item", func() bool { return dst.Len() == i })
+	}
+	<-finished
+	if !dst.Closed() {
+		t.Error("expected the bridge to close dst once src is drained")
+	}
+	for i := 0; i < 5; i++ {
+		if item, _ := dst.Get(); item != i {
+			t.Errorf("expected %d, got %v", i, item)
+		}
+	}
+}
+
+func TestPacedBridgeShutdown(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	src := NewBaseQueue("src", 0)
+	dst := NewBaseQueue("dst", 0)
+	src.Put(1)
+	src.Put(2)
+	flow := &Flow{DoneChan: make(chan struct{}), WaitGroup: &sync.WaitGroup{}}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		NewPacedBridge(src, dst, 1)(flow)
+	}()
+
+	waitFor(t, "the pacing timer", func() bool { return c.Waiters() == 1 })
+	close(flow.DoneChan)
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("expected the bridge to stop when the flow is done")
+	}
+	if dst.Len() != 1 || !dst.Closed() {
+		t.Errorf("expected one item moved and dst closed, got len %d", dst.Len())
+	}
+}
+
+func TestPacedBridgeShutdownWhileWaiting(t *testing.T) {
+	src := NewBaseQueue("src", 0)
+	dst := NewBaseQueue("dst", 0)
+	flow := &Flow{DoneChan: make(chan struct{}), WaitGroup: &sync.WaitGroup{}}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		NewPacedBridge(src, dst, 0)(flow)
+	}()
+
+	// the bridge waits on the empty src, done stops it
+	waitFor(t, "the bridge to wait for an item", func() bool {
+		src.mu.Lock()
+		defer src.mu.Unlock()
+		return src.lenWaiters == 1
+	})
+	close(flow.DoneChan)
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("expected the bridge to stop while waiting for an item")
+	}
+	if !dst.Closed() {
+		t.Error("expected dst to be closed")
+	}
+	// no item was taken from src
+	src.Put(1)
+	if src.Len() != 1 {
+		t.Errorf("expected the item to stay in src, got len %d", src.Len())
+	}
+}
@@ -0,0 +1,117 @@
+package icd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BufferedExpellerInterval is how often a buffered expeller checks whether
+// its sink recovered while no items arrive
+var BufferedExpellerInterval = time.Second
+
+type bufferedExpeller struct {
+	runner
+	inner   Expeller
+	buffer  Queue
+	healthy func() bool
+}
+
+// BufferedExpeller wraps inner so an outage of its sink does not hold back
+// the pipeline: while healthy returns false the items received are put into
+// buffer, once it returns true again the buffered items are replayed to
+// inner, in order and ahead of newer items. Recovery is checked for every
+// item and every BufferedExpellerInterval. Items still buffered when the
+// expeller stops stay in buffer, so a persistent buffer carries them over a
+// restart. inner receives the items through an internal queue, its periodic
+// statistics are passed on while the expeller sends the final statistics.
+func BufferedExpeller(inner Expeller, buffer Queue, healthy func() bool) Expeller {
+	return &bufferedExpeller{
+		runner:  runner{name: inner.Name(), kind: KindExpeller},
+		inner:   inner,
+		buffer:  buffer,
+		healthy: healthy,
+	}
+}
+
+// Expel forwards the items of rcv to inner, or to the buffer during an
+// outage, until every queue of rcv is closed or reservoird shuts down
+func (e *bufferedExpeller) Expel(rcv []Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	e.start()
+	defer e.stop(mc)
+
+	out := NewBaseQueue(e.name, 1)
+	// inner stops once out is closed, its final statistics are not relayed
+	// as the expeller sends its own
+	imc := &MonitorControl{
+		StatsChan:      make(chan interface{}, 1),
+		FinalStatsChan: make(chan interface{}, 1),
+		ClearChan:      make(chan struct{}, 1),
+		DoneChan:       make(chan struct{}),
+		WaitGroup:      &sync.WaitGroup{},
+	}
+	imc.WaitGroup.Add(1)
+	go e.inner.Expel([]Queue{out}, imc)
+	relayed := make(chan struct{})
+	go func() {
+		defer close(relayed)
+		relayStats(imc, mc, nil)
+	}()
+
+	stop := make(chan struct{})
+	// stopped while passing an item on, keep it
+	items, closed := fanIn(rcv, stop, e.divert)
+
+	for !e.poll(mc) && e.next(items, closed, out, mc) {
+	}
+
+	close(stop)
+	e.replay(out)
+	out.Close()
+	<-relayed
+}
+
+// next handles the next item or recovery check, returns false once every
+// receive queue is closed
+func (e *bufferedExpeller) next(items <-chan interface{}, closed <-chan struct{}, out Queue, mc *MonitorControl) bool {
+	select {
+	case item := <-items:
+		e.addReceived(1)
+		if !e.healthy() {
+			e.divert(item)
+			return true
+		}
+		e.replay(out)
+		if out.Put(item) == nil {
+			e.addSent(1)
+		}
+	case <-after(BufferedExpellerInterval):
+		e.replay(out)
+	case <-closed:
+		return false
+	case <-mc.DoneChan:
+	}
+	return true
+}
+
+// divert puts item into the buffer
+func (e *bufferedExpeller) divert(item interface{}) {
+	err := e.buffer.Put(item)
+	if err != nil {
+		e.report(fmt.Errorf("buffer: %w", err))
+	}
+}
+
+// replay passes the buffered items to inner while the sink is healthy
+func (e *bufferedExpeller) replay(out Queue) {
+	for e.buffer.Len() > 0 && e.healthy() {
+		item, err := e.buffer.Get()
+		if err != nil {
+			return
+		}
+		if out.Put(item) == nil {
+			e.addSent(1)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package icd
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBufferedExpellerOutageAndRecovery(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	var up int32 = 1
+	healthy := func() bool { return atomic.LoadInt32(&up) == 1 }
+	inner := &collectingExpeller{runner: runner{name: "sink", kind: KindExpeller}}
+	buffer := NewBaseQueue("buffer", 0)
+	rcv := NewBaseQueue("rcv", 0)
+	e := BufferedExpeller(inner, buffer, healthy)
+	if e.Name() != "sink" {
+		t.Errorf("expected the name of the inner expeller, got %s", e.Name())
+	}
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go e.Expel([]Queue{rcv}, mc)
+
+	rcv.Put(1)
+	waitFor(t, "the sink to get the item", func() bool { return inner.stats().Received == 1 })
+
+	// outage
+	atomic.StoreInt32(&up, 0)
+	for i := 2; i <= 4; i++ {
+		rcv.Put(i)
+	}
+	waitFor(t, "items to be buffered", func() bool { return buffer.Len() == 3 })
+
+	// recovery without new items is noticed on the interval
+	atomic.StoreInt32(&up, 1)
+	waitFor(t, "the recovery check", func() bool { return c.Waiters() > 0 })
+	c.Advance(BufferedExpellerInterval)
+	waitFor(t, "the buffer to be replayed", func() bool { return buffer.Len() == 0 })
+	rcv.Put(5)
+	rcv.Close()
+	mc.WaitGroup.Wait()
+
+	if len(inner.items) != 5 {
+		t.Fatalf("expected 5 items at the sink, got %v", inner.items)
+	}
+	for i, item := range inner.items {
+		if item != i+1 {
+			t.Errorf("expected the items in order, got %v", inner.items)
+			break
+		}
+	}
+}
+
+func TestBufferedExpellerKeepsBufferOnShutdown(t *testing.T) {
+	inner := &collectingExpeller{runner: runner{name: "sink", kind: KindExpeller}}
+	buffer := NewBaseQueue("buffer", 0)
+	rcv := NewBaseQueue("rcv", 0)
+	e := BufferedExpeller(inner, buffer, func() bool { return false })
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go e.Expel([]Queue{rcv}, mc)
+
+	rcv.Put("a")
+	rcv.Put("b")
+	waitFor(t, "items to be buffered", func() bool { return buffer.Len() == 2 })
+	close(mc.DoneChan)
+	done := make(chan struct{})
+	go func() {
+		mc.WaitGroup.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the expeller to stop on shutdown")
+	}
+	if len(inner.items) != 0 || buffer.Len() != 2 {
+		t.Errorf("expected the items to stay buffered, got %v and %d", inner.items, buffer.Len())
+	}
+	rcv.Close()
+}
+
+func TestBufferedExpellerSendsOneFinalStats(t *testing.T) {
+	inner := &collectingExpeller{runner: runner{name: "sink", kind: KindExpeller}}
+	rcv := NewBaseQueue("rcv", 0)
+	e := BufferedExpeller(inner, NewBaseQueue("buffer", 0), func() bool { return true })
+	mc := newTestMonitorControl()
+	mc.FinalStatsChan = make(chan interface{})
+	mc.WaitGroup.Add(1)
+	go e.Expel([]Queue{rcv}, mc)
+
+	rcv.Put(1)
+	rcv.Close()
+	final := (<-mc.FinalStatsChan).(PluginStats)
+	mc.WaitGroup.Wait()
+	if final.Received != 1 || final.Sent != 1 {
+		t.Errorf("unexpected final stats %+v", final)
+	}
+	select {
+	case stats := <-mc.FinalStatsChan:
+		t.Errorf("expected a single final stats, got %v", stats)
+	default:
+	}
+}
@@ -0,0 +1,75 @@
+package icd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type callbackQueue struct {
+	Queue
+	onItem  func(interface{}) error
+	mu      sync.Mutex
+	monitor *Monitor
+}
+
+// NewCallbackQueue wraps q so its items are delivered to onItem instead of
+// being gotten, for embedders driven by callbacks rather than blocking Gets.
+// Put works as usual, a goroutine run through flow.Go gets the items of q and
+// calls onItem for each, one at a time and in order. An error returned by
+// onItem is reported through the Monitor set with SetMonitor, or logged when
+// there is none, and the next item is delivered. Delivery stops once q is
+// closed and drained or flow shuts down, a Get blocked at that point
+// delivers the item it gets next before it returns.
+func NewCallbackQueue(q Queue, flow *Flow, onItem func(interface{}) error) Queue {
+	cq := &callbackQueue{
+		Queue:  q,
+		onItem: onItem,
+	}
+	flow.Go(q.Name(), KindQueue, func(ctx context.Context) {
+		cq.deliver(flow.DoneChan)
+	})
+	return cq
+}
+
+// SetMonitor sets the monitor the errors of onItem are reported to
+func (q *callbackQueue) SetMonitor(m *Monitor) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.monitor = m
+}
+
+// deliver calls onItem for the items of the wrapped queue until it is closed
+// or done is closed
+func (q *callbackQueue) deliver(done <-chan struct{}) {
+	stop := make(chan struct{})
+	defer close(stop)
+	items, closed := fanIn([]Queue{q.Queue}, stop, q.call)
+	for {
+		select {
+		case item := <-items:
+			q.call(item)
+		case <-closed:
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// call delivers item to onItem, reporting a failure
+func (q *callbackQueue) call(item interface{}) {
+	err := q.onItem(item)
+	if err == nil {
+		return
+	}
+	err = fmt.Errorf("callback: %w", err)
+	q.mu.Lock()
+	m := q.monitor
+	q.mu.Unlock()
+	if m == nil {
+		logf("%s: %v", q.Name(), err)
+		return
+	}
+	m.Error(err)
+}
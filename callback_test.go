@@ -0,0 +1,68 @@
+package icd
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+type callbackRecorder struct {
+	mu    sync.Mutex
+	items []interface{}
+}
+
+func (r *callbackRecorder) onItem(item interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items = append(r.items, item)
+	if item == "bad" {
+		return errors.New("bad item")
+	}
+	return nil
+}
+
+func (r *callbackRecorder) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.items)
+}
+
+func TestCallbackQueueDeliversItems(t *testing.T) {
+	flow := NewFlow(newTestMonitorControl())
+	r := &callbackRecorder{}
+	q := NewCallbackQueue(NewBaseQueue("callback", 0), flow, r.onItem)
+	m := NewMonitor(newTestMonitorControl())
+	q.(Monitored).SetMonitor(m)
+
+	for _, item := range []string{"a", "bad", "b"} {
+		if err := q.Put(item); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	waitFor(t, "the items to be delivered", func() bool { return r.len() == 3 })
+	if r.items[0] != "a" || r.items[1] != "bad" || r.items[2] != "b" {
+		t.Errorf("expected the items in order, got %v", r.items)
+	}
+	if err := <-m.ErrorChan; err.Error() != "callback: bad item" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// closing the queue stops the delivery
+	q.Close()
+	flow.Wait()
+}
+
+func TestCallbackQueueStopsOnFlowDone(t *testing.T) {
+	flow := NewFlow(newTestMonitorControl())
+	r := &callbackRecorder{}
+	q := NewCallbackQueue(NewBaseQueue("callback", 0), flow, r.onItem)
+	q.Put("a")
+	waitFor(t, "the item to be delivered", func() bool { return r.len() == 1 })
+
+	flow.Shutdown()
+	flow.Wait()
+	if q.Closed() {
+		t.Error("expected the queue to stay open")
+	}
+	q.Close()
+}
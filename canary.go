@@ -0,0 +1,97 @@
+package icd
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// Seedable is the optional interface for queues which sample items at
+// random, seeding makes the sampling reproducible
+type Seedable interface {
+	// Seed restarts the sampling with seed, the same seed samples the same
+	// sequence of items
+	Seed(seed int64)
+}
+
+type canaryQueue struct {
+	Queue
+	canary   Queue
+	fraction float64
+	mu       sync.Mutex
+	rand     *rand.Rand
+	dropped  uint64
+}
+
+// NewCanaryQueue wraps primary so every item put into it is also mirrored to
+// canary with probability fraction, e.g. to shadow a share of live traffic to
+// a new version of a pipeline. Mirroring is best effort and never holds back
+// primary: an item is mirrored only after primary accepted it, with TryPut, so
+// canary must be NonBlocking, and items canary does not accept are dropped
+// for it and counted, see DropCounter. Get and the other methods are those of
+// primary, Close closes both queues. The sampling is seeded from the clock
+// unless seeded with Seed, see Seedable. A fraction outside [0, 1] is clamped.
+func NewCanaryQueue(primary Queue, canary Queue, fraction float64) Queue {
+	if fraction < 0 {
+		fraction = 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	return &canaryQueue{
+		Queue:    primary,
+		canary:   canary,
+		fraction: fraction,
+		rand:     rand.New(rand.NewSource(now().UnixNano())),
+	}
+}
+
+// Put puts the item into primary and mirrors it to canary when sampled
+func (q *canaryQueue) Put(item interface{}) error {
+	err := q.Queue.Put(item)
+	if err != nil {
+		return err
+	}
+	if q.sample() {
+		q.mirror(item)
+	}
+	return nil
+}
+
+// sample returns whether or not the next item is mirrored
+func (q *canaryQueue) sample() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.rand.Float64() < q.fraction
+}
+
+// mirror puts item into canary without blocking, counting it as dropped when
+// canary does not accept it
+func (q *canaryQueue) mirror(item interface{}) {
+	nb, ok := q.canary.(NonBlocking)
+	if ok && nb.TryPut(item) == nil {
+		return
+	}
+	q.mu.Lock()
+	q.dropped++
+	q.mu.Unlock()
+}
+
+// Seed restarts the sampling with seed
+func (q *canaryQueue) Seed(seed int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rand = rand.New(rand.NewSource(seed))
+}
+
+// Dropped returns the number of sampled items canary did not accept
+func (q *canaryQueue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Close closes primary and canary, returning the error of primary
+func (q *canaryQueue) Close() error {
+	q.canary.Close()
+	return q.Queue.Close()
+}
@@ -0,0 +1,73 @@
+package icd
+
+import (
+	"testing"
+)
+
+func TestCanaryQueueMirrorsFraction(t *testing.T) {
+	const n = 10000
+	primary := NewBaseQueue("primary", 0)
+	canary := NewBaseQueue("canary", 0)
+	q := NewCanaryQueue(primary, canary, 0.1)
+	q.(Seedable).Seed(1)
+	for i := 0; i < n; i++ {
+		if err := q.Put(i); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if primary.Len() != n {
+		t.Errorf("expected all %d items in primary, got %d", n, primary.Len())
+	}
+	if canary.Len() < n/10-300 || canary.Len() > n/10+300 {
+		t.Errorf("expected about %d items in canary, got %d", n/10, canary.Len())
+	}
+	if item, _ := q.Get(); item != 0 {
+		t.Errorf("expected Get from primary, got %v", item)
+	}
+}
+
+func TestCanaryQueueSeed(t *testing.T) {
+	mirrored := func() []interface{} {
+		canary := NewBaseQueue("canary", 0)
+		q := NewCanaryQueue(NewBaseQueue("primary", 0), canary, 0.5)
+		q.(Seedable).Seed(42)
+		for i := 0; i < 100; i++ {
+			q.Put(i)
+		}
+		items, _ := canary.TakeAll()
+		return items
+	}
+	a, b := mirrored(), mirrored()
+	if len(a) != len(b) {
+		t.Fatalf("expected the same sample for the same seed, got %d and %d items", len(a), len(b))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("expected the same sample for the same seed, got %v and %v", a, b)
+		}
+	}
+}
+
+func TestCanaryQueueDoesNotBlockOnCanary(t *testing.T) {
+	primary := NewBaseQueue("primary", 0)
+	canary := NewBaseQueue("canary", 1)
+	q := NewCanaryQueue(primary, canary, 1)
+	for i := 0; i < 3; i++ {
+		if err := q.Put(i); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if primary.Len() != 3 || canary.Len() != 1 || q.(DropCounter).Dropped() != 2 {
+		t.Errorf("expected 3 items in primary, 1 in canary and 2 dropped, got %d %d %d",
+			primary.Len(), canary.Len(), q.(DropCounter).Dropped())
+	}
+
+	canary.Close()
+	if err := q.Put(3); err != nil {
+		t.Errorf("expected a closed canary not to fail the put, got %v", err)
+	}
+	q.Close()
+	if !primary.Closed() {
+		t.Error("expected Close to close primary")
+	}
+}
@@ -0,0 +1,63 @@
+package icd
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time and timers to the helpers within this
+// package. It is pluggable so time dependent behavior can be driven by a fake
+// clock when testing.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// After waits for the duration to elapse and then sends the current
+	// time on the returned channel
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+var (
+	clockMu sync.RWMutex
+	clock   Clock = systemClock{}
+)
+
+// SetClock replaces the clock used by this package. Passing nil restores the
+// system clock.
+func SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	clock = c
+}
+
+// CurrentClock returns the clock currently used by this package
+func CurrentClock() Clock {
+	clockMu.RLock()
+	defer clockMu.RUnlock()
+	return clock
+}
+
+func now() time.Time {
+	return CurrentClock().Now()
+}
+
+func after(d time.Duration) <-chan time.Time {
+	return CurrentClock().After(d)
+}
+
+// minInterval is the shortest period the timed helpers in this package run
+// at, shorter periods would spin
+const minInterval = time.Millisecond
@@ -0,0 +1,102 @@
+package icd
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// fakeClock is a Clock whose time only moves when advanced, timers created
+// through After fire once the clock is advanced past their deadline
+type fakeClock struct {
+	mu     sync.Mutex
+	t      time.Time
+	timers []fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Unix(1000000, 0)}
+}
+
+// useFakeClock installs a fake clock, callers restore the system clock with
+// defer SetClock(nil)
+func useFakeClock() *fakeClock {
+	c := newFakeClock()
+	SetClock(c)
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.t
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{at: c.t.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward, firing every timer which becomes due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if !timer.at.After(c.t) {
+			timer.ch <- c.t
+		} else {
+			pending = append(pending, timer)
+		}
+	}
+	c.timers = pending
+}
+
+// Waiters returns the number of timers which have not fired yet
+func (c *fakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// waitFor polls cond until it holds, failing the test after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSetClock(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	if !now().Equal(c.Now()) {
+		t.Errorf("expected package time to follow the fake clock")
+	}
+	c.Advance(time.Minute)
+	if !now().Equal(c.Now()) {
+		t.Errorf("expected package time to follow the advanced fake clock")
+	}
+
+	SetClock(nil)
+	if _, ok := CurrentClock().(systemClock); !ok {
+		t.Errorf("expected nil to restore the system clock")
+	}
+}
@@ -0,0 +1,112 @@
+package icd
+
+import (
+	"fmt"
+)
+
+// Iterable is the optional interface for queues which are able to visit
+// their current items without removing them.
+type Iterable interface {
+	// Each calls fn for every item in the queue, in the order in which Get
+	// would return them, until fn returns false. The queue is left
+	// unmodified.
+	Each(fn func(item interface{}) bool) error
+}
+
+// Items returns a snapshot of the items currently in the queue. The queue
+// must implement Iterable.
+func Items(q Queue) ([]interface{}, error) {
+	it, ok := q.(Iterable)
+	if !ok {
+		return nil, fmt.Errorf("queue %s iteration: %w", q.Name(), ErrNotSupported)
+	}
+	items := []interface{}{}
+	err := it.Each(func(item interface{}) bool {
+		items = append(items, item)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Peeker is the optional interface for queues which can look for an item
+// without removing it
+type Peeker interface {
+	// PeekMatch returns the first item, in the order in which Get would
+	// return them, for which pred returns true, and whether there is one.
+	// The item stays in the queue. The items are matched against one
+	// consistent state of the queue, pred must not call the queue.
+	PeekMatch(pred func(item interface{}) bool) (interface{}, bool, error)
+}
+
+// PeekMatch returns the first item of q for which pred returns true, and
+// whether there is one, leaving q unmodified. q must implement Peeker or
+// Iterable.
+func PeekMatch(q Queue, pred func(item interface{}) bool) (interface{}, bool, error) {
+	p, ok := q.(Peeker)
+	if ok {
+		return p.PeekMatch(pred)
+	}
+	it, ok := q.(Iterable)
+	if !ok {
+		return nil, false, fmt.Errorf("queue %s peek: %w", q.Name(), ErrNotSupported)
+	}
+	return peekMatch(it, pred)
+}
+
+// peekMatch finds the first item of it for which pred returns true
+func peekMatch(it Iterable, pred func(item interface{}) bool) (interface{}, bool, error) {
+	var match interface{}
+	found := false
+	err := it.Each(func(item interface{}) bool {
+		if pred(item) {
+			match = item
+			found = true
+		}
+		return !found
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return match, found, nil
+}
+
+// CloneQueue creates an independent copy of q. The items currently in q are
+// snapshotted and put, in order, into the fresh queue returned by factory.
+// q itself is left untouched and subsequent operations on either queue do not
+// affect the other.
+//
+// Items are shared references, they are not deep-copied. Payloads which are
+// mutated after cloning are visible through both queues. When the items do
+// not fit the fresh queue it is cleared and closed, so a partial clone does
+// not hold on to their storage.
+func CloneQueue(q Queue, factory func() Queue) (Queue, error) {
+	items, err := Items(q)
+	if err != nil {
+		return nil, err
+	}
+	clone := factory()
+	if clone == nil {
+		return nil, fmt.Errorf("factory returned nil queue")
+	}
+	if clone.Cap() >= 0 && clone.Cap() < len(items) {
+		discard(clone)
+		return nil, fmt.Errorf("queue %s cannot hold %d items: %w", clone.Name(), len(items), ErrQueueFull)
+	}
+	for i, item := range items {
+		err = clone.Put(item)
+		if err != nil {
+			discard(clone)
+			return nil, fmt.Errorf("clone item %d into %s: %w", i, clone.Name(), err)
+		}
+	}
+	return clone, nil
+}
+
+// discard clears and closes a partial clone
+func discard(clone Queue) {
+	clone.Clear()
+	clone.Close()
+}
@@ -0,0 +1,146 @@
+package icd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCloneQueue(t *testing.T) {
+	q := NewBaseQueue("orig", 0)
+	for i := 0; i < 3; i++ {
+		q.Put(i)
+	}
+
+	clone, err := CloneQueue(q, func() Queue { return NewBaseQueue("clone", 0) })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if clone.Len() != 3 {
+		t.Fatalf("expected clone length 3, got %d", clone.Len())
+	}
+
+	// operations on one queue must not affect the other
+	clone.Put(3)
+	item, _ := q.Get()
+	if item != 0 {
+		t.Errorf("expected 0 from original, got %v", item)
+	}
+	if q.Len() != 2 {
+		t.Errorf("expected original length 2, got %d", q.Len())
+	}
+	if clone.Len() != 4 {
+		t.Errorf("expected clone length 4, got %d", clone.Len())
+	}
+	for i := 0; i < 4; i++ {
+		item, _ := clone.Get()
+		if item != i {
+			t.Errorf("expected %d from clone, got %v", i, item)
+		}
+	}
+}
+
+func TestCloneQueueTooSmall(t *testing.T) {
+	q := NewBaseQueue("orig", 0)
+	q.Put(1)
+	q.Put(2)
+	clone := NewBaseQueue("clone", 1)
+	_, err := CloneQueue(q, func() Queue { return clone })
+	if !IsQueueFull(err) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	if !clone.Closed() {
+		t.Error("expected the unused clone to be closed")
+	}
+}
+
+// closingQueue closes its queue once the given number of puts succeeded
+type closingQueue struct {
+	Queue
+	puts int
+}
+
+func (q *closingQueue) Put(item interface{}) error {
+	if q.puts == 0 {
+		q.Queue.Close()
+	}
+	q.puts--
+	return q.Queue.Put(item)
+}
+
+func TestCloneQueuePutFails(t *testing.T) {
+	q := NewBaseQueue("orig", 0)
+	q.Put(1)
+	q.Put(2)
+	inner := NewBaseQueue("clone", 0)
+	_, err := CloneQueue(q, func() Queue { return &closingQueue{Queue: inner, puts: 1} })
+	if !IsQueueClosed(err) || err.Error() != "clone item 1 into clone: queue is closed" {
+		t.Fatalf("expected the failed put, got %v", err)
+	}
+	if inner.Len() != 0 || !inner.Closed() {
+		t.Errorf("expected the partial clone to be cleared and closed, got %d items", inner.Len())
+	}
+}
+
+func TestCloneQueueNotIterable(t *testing.T) {
+	q := NewInflightQueue(NewBaseQueue("inner", 0), 0)
+	_, err := CloneQueue(q, func() Queue { return NewBaseQueue("clone", 0) })
+	if !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestPeekMatch(t *testing.T) {
+	queues := []Queue{
+		NewBaseQueue("base", 0),
+		NewPriorityQueue("priority", 0, func(interface{}) int { return 0 }),
+	}
+	for _, q := range queues {
+		for _, item := range []string{"a", "cancel:b", "c", "cancel:d"} {
+			q.Put(item)
+		}
+		item, ok, err := PeekMatch(q, func(item interface{}) bool {
+			return strings.HasPrefix(item.(string), "cancel:")
+		})
+		if err != nil || !ok || item != "cancel:b" {
+			t.Errorf("%s: expected the first match cancel:b, got %v %v %v", q.Name(), item, ok, err)
+		}
+		item, ok, err = PeekMatch(q, func(item interface{}) bool { return item == "x" })
+		if err != nil || ok || item != nil {
+			t.Errorf("%s: expected no match, got %v %v %v", q.Name(), item, ok, err)
+		}
+		items, _ := Items(q)
+		if len(items) != 4 || items[1] != "cancel:b" {
+			t.Errorf("%s: expected the queue to be unchanged, got %v", q.Name(), items)
+		}
+	}
+}
+
+func TestPeekMatchConcurrent(t *testing.T) {
+	q := NewBaseQueue("concurrent", 0)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			q.Put(i)
+			q.Get()
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		_, _, err := PeekMatch(q, func(item interface{}) bool { return item.(int)%2 == 0 })
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestPeekMatchNotSupported(t *testing.T) {
+	q := NewInflightQueue(NewBaseQueue("inner", 0), 0)
+	if _, _, err := PeekMatch(q, func(interface{}) bool { return true }); !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
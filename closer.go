@@ -0,0 +1,62 @@
+package icd
+
+import (
+	"context"
+	"fmt"
+)
+
+// Closer is the optional interface for plugins which hold resources that must
+// be released when reservoird shuts down
+type Closer interface {
+	// Close releases the resources held by the plugin
+	Close() error
+}
+
+// TimeoutCloser is the optional interface for plugins whose cleanup is able
+// to honor a deadline
+type TimeoutCloser interface {
+	// CloseTimeout releases the resources held by the plugin, giving up
+	// once ctx is done
+	CloseTimeout(ctx context.Context) error
+}
+
+// CloseTimeout closes plugin, bounding the time spent to the lifetime of ctx.
+// Plugins implementing TimeoutCloser are handed ctx directly, the Close of
+// plugins only implementing Closer is run in its own goroutine and abandoned
+// with a logged warning, returning an error wrapping ErrTimeout, when ctx is
+// done before it returns. Plugins implementing neither are left as is.
+//
+// Abandoned cleanup keeps running in the background and may leak the
+// resources it was releasing.
+func CloseTimeout(ctx context.Context, plugin interface{}) error {
+	tc, ok := plugin.(TimeoutCloser)
+	if ok {
+		return tc.CloseTimeout(ctx)
+	}
+	c, ok := plugin.(Closer)
+	if !ok {
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Close()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		name := pluginName(plugin)
+		logf("warning: abandoned close of %s: %v", name, ctx.Err())
+		return fmt.Errorf("close of %s abandoned: %w: %v", name, ErrTimeout, ctx.Err())
+	}
+}
+
+// pluginName returns the name of plugin, if it has one
+func pluginName(plugin interface{}) string {
+	n, ok := plugin.(interface{ Name() string })
+	if ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", plugin)
+}
@@ -0,0 +1,79 @@
+package icd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testCloser struct {
+	name  string
+	delay time.Duration
+	err   error
+	done  chan struct{}
+}
+
+func (c *testCloser) Name() string {
+	return c.name
+}
+
+func (c *testCloser) Close() error {
+	time.Sleep(c.delay)
+	close(c.done)
+	return c.err
+}
+
+type testTimeoutCloser struct {
+	ctx context.Context
+}
+
+func (c *testTimeoutCloser) CloseTimeout(ctx context.Context) error {
+	c.ctx = ctx
+	return nil
+}
+
+func TestCloseTimeoutFast(t *testing.T) {
+	closeErr := errors.New("close failed")
+	c := &testCloser{name: "fast", err: closeErr, done: make(chan struct{})}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := CloseTimeout(ctx, c)
+	if err != closeErr {
+		t.Errorf("expected the error of Close, got %v", err)
+	}
+}
+
+func TestCloseTimeoutSlowIsAbandoned(t *testing.T) {
+	c := &testCloser{name: "slow", delay: time.Second, done: make(chan struct{})}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := CloseTimeout(ctx, c)
+	if err == nil {
+		t.Fatal("expected an error for the abandoned close")
+	}
+	if !IsTimeout(err) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("close was not abandoned at the deadline")
+	}
+}
+
+func TestCloseTimeoutPassesContext(t *testing.T) {
+	c := &testTimeoutCloser{}
+	ctx := context.Background()
+	err := CloseTimeout(ctx, c)
+	if err != nil || c.ctx != ctx {
+		t.Errorf("expected ctx to be passed to CloseTimeout, got %v", err)
+	}
+}
+
+func TestCloseTimeoutNotCloser(t *testing.T) {
+	err := CloseTimeout(context.Background(), struct{}{})
+	if err != nil {
+		t.Errorf("expected nil for a plugin without Close, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package icd
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// CodecRegistry selects the Codec of a payload by its content type, so a
+// digester can decode envelopes of several formats. Content types are
+// matched on their media type, ignoring case and parameters, e.g.
+// "application/json; charset=utf-8" selects the codec registered for
+// "application/json".
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+}
+
+// NewCodecRegistry creates a registry without codecs
+func NewCodecRegistry() *CodecRegistry {
+	return &CodecRegistry{
+		codecs: make(map[string]Codec),
+	}
+}
+
+// Register sets the codec for content type ct, replacing any registered
+// before
+func (r *CodecRegistry) Register(ct string, codec Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codecs[mediaType(ct)] = codec
+}
+
+// Lookup returns the codec for content type ct. Returns ErrNotSupported when
+// no codec is registered for it.
+func (r *CodecRegistry) Lookup(ct string) (Codec, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	codec, ok := r.codecs[mediaType(ct)]
+	if !ok {
+		return nil, fmt.Errorf("content type %q: %w", ct, ErrNotSupported)
+	}
+	return codec, nil
+}
+
+// Decode decodes the []byte payload of env with the codec for its content
+// type
+func (r *CodecRegistry) Decode(env *Envelope) (interface{}, error) {
+	if env == nil {
+		return nil, ErrNilItem
+	}
+	codec, err := r.Lookup(GetContentType(env))
+	if err != nil {
+		return nil, err
+	}
+	data, ok := env.Payload.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("decode %T: %w", env.Payload, ErrNotSupported)
+	}
+	return codec.Decode(data)
+}
+
+// Encode encodes item with the codec for content type ct into an envelope
+// carrying ct
+func (r *CodecRegistry) Encode(ct string, item interface{}) (*Envelope, error) {
+	codec, err := r.Lookup(ct)
+	if err != nil {
+		return nil, err
+	}
+	data, err := codec.Encode(item)
+	if err != nil {
+		return nil, err
+	}
+	env := NewEnvelope(data)
+	SetContentType(env, ct)
+	return env, nil
+}
+
+// mediaType returns the lower case media type of ct without parameters
+func mediaType(ct string) string {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		mt = strings.ToLower(strings.TrimSpace(ct))
+	}
+	return mt
+}
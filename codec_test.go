@@ -0,0 +1,77 @@
+package icd
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(item interface{}) ([]byte, error) {
+	return json.Marshal(item)
+}
+
+func (jsonCodec) Decode(data []byte) (interface{}, error) {
+	var item interface{}
+	err := json.Unmarshal(data, &item)
+	return item, err
+}
+
+func TestCodecRegistrySelectsByContentType(t *testing.T) {
+	r := NewCodecRegistry()
+	r.Register("application/json", jsonCodec{})
+	r.Register("application/octet-stream", BytesCodec{})
+
+	env := NewEnvelope([]byte(`{"a":1}`))
+	SetContentType(env, "Application/JSON; charset=utf-8")
+	item, err := r.Decode(env)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	m, ok := item.(map[string]interface{})
+	if !ok || m["a"] != float64(1) {
+		t.Errorf("expected the json codec, got %#v", item)
+	}
+
+	env = NewEnvelope([]byte(`{"a":1}`))
+	SetContentType(env, "application/octet-stream")
+	item, err = r.Decode(env)
+	if b, ok := item.([]byte); err != nil || !ok || string(b) != `{"a":1}` {
+		t.Errorf("expected the bytes codec, got %#v, %v", item, err)
+	}
+}
+
+func TestCodecRegistryUnknownType(t *testing.T) {
+	r := NewCodecRegistry()
+	r.Register("application/json", jsonCodec{})
+	if _, err := r.Lookup("application/x-protobuf"); !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	env := NewEnvelope([]byte("x"))
+	if _, err := r.Decode(env); !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported without a content type, got %v", err)
+	}
+	SetContentType(env, "application/json")
+	env.Payload = "not bytes"
+	if _, err := r.Decode(env); !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported for a non []byte payload, got %v", err)
+	}
+	if _, err := r.Decode(nil); !IsNilItem(err) {
+		t.Errorf("expected ErrNilItem, got %v", err)
+	}
+}
+
+func TestCodecRegistryEncode(t *testing.T) {
+	r := NewCodecRegistry()
+	r.Register("application/json", jsonCodec{})
+	env, err := r.Encode("application/json", map[string]int{"a": 1})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if GetContentType(env) != "application/json" || string(env.Payload.([]byte)) != `{"a":1}` {
+		t.Errorf("unexpected envelope %+v", env)
+	}
+	if _, err := r.Encode("text/plain", "x"); !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
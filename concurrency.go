@@ -0,0 +1,145 @@
+package icd
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// AutoscaleInterval is how often AutoscaleWorkers samples its queue
+var AutoscaleInterval = time.Second
+
+// ConcurrencyController bounds the number of in-flight workers of a plugin,
+// typically a digester processing items in parallel. The limit can be retuned
+// at runtime, e.g. by reservoird from config or in response to backpressure.
+type ConcurrencyController struct {
+	mu       sync.Mutex
+	limit    int
+	inflight int
+	changed  chan struct{}
+}
+
+// NewConcurrencyController creates a controller allowing limit concurrent
+// acquisitions. A limit less than 1 is treated as 1.
+func NewConcurrencyController(limit int) *ConcurrencyController {
+	if limit < 1 {
+		limit = 1
+	}
+	return &ConcurrencyController{
+		limit:   limit,
+		changed: make(chan struct{}),
+	}
+}
+
+// Acquire blocks until a worker slot is available or ctx is done. On success
+// the returned release function must be called once the work completes;
+// calling it more than once has no further effect.
+func (c *ConcurrencyController) Acquire(ctx context.Context) (func(), error) {
+	for {
+		c.mu.Lock()
+		if c.inflight < c.limit {
+			c.inflight++
+			c.mu.Unlock()
+			once := sync.Once{}
+			return func() { once.Do(c.release) }, nil
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// SetLimit changes the number of concurrent acquisitions allowed. Lowering the
+// limit does not revoke slots already held, it only takes effect for new
+// acquisitions. A limit less than 1 is treated as 1.
+func (c *ConcurrencyController) SetLimit(n int) {
+	if n < 1 {
+		n = 1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limit = n
+	c.notify()
+}
+
+// Limit returns the current limit
+func (c *ConcurrencyController) Limit() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limit
+}
+
+// InFlight returns the number of slots currently held
+func (c *ConcurrencyController) InFlight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inflight
+}
+
+func (c *ConcurrencyController) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inflight--
+	c.notify()
+}
+
+// notify wakes all waiting acquirers, must be called with mu held
+func (c *ConcurrencyController) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// AutoscaleWorkers tunes the limit of controller to the load of in, the
+// queue the workers consume, until in is closed; run it in its own
+// goroutine. Every AutoscaleInterval the utilization of in, Len/Cap, or for
+// an unbounded queue the backlog per worker, Len/limit, is sampled and the
+// limit moves halfway towards the limit which would bring the utilization to
+// target, at least by one, bounded by min and max. A min below 1 is raised to
+// 1, a max below min is raised to min and a target outside (0, 1] is treated
+// as 1. Sampling follows the package Clock.
+func AutoscaleWorkers(in Queue, controller *ConcurrencyController, min int, max int, target float64) {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	if !(target > 0 && target <= 1) {
+		target = 1
+	}
+	for !in.Closed() {
+		<-after(AutoscaleInterval)
+		controller.SetLimit(autoscale(in, controller.Limit(), min, max, target))
+	}
+}
+
+// autoscale returns the next worker limit for the load of in
+func autoscale(in Queue, limit int, min int, max int, target float64) int {
+	length := in.Len()
+	capacity := in.Cap()
+	if capacity <= 0 {
+		capacity = limit
+	}
+	utilization := float64(length) / float64(capacity)
+	desired := int(math.Ceil(float64(limit) * utilization / target))
+	next := limit + (desired-limit)/2
+	if desired > limit && next == limit {
+		next++
+	}
+	if desired < limit && next == limit {
+		next--
+	}
+	if next < min {
+		next = min
+	}
+	if next > max {
+		next = max
+	}
+	return next
+}
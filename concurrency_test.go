@@ -0,0 +1,153 @@
+package icd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyControllerBlocksAtLimit(t *testing.T) {
+	c := NewConcurrencyController(2)
+	r1, err := c.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = c.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = c.Acquire(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected acquire to block until deadline, got %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		release, err := c.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		close(acquired)
+	}()
+	r1()
+	r1() // a second release is a no-op
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("release did not free a slot")
+	}
+	if c.InFlight() != 1 {
+		t.Errorf("expected 1 in flight, got %d", c.InFlight())
+	}
+}
+
+func TestConcurrencyControllerSetLimit(t *testing.T) {
+	c := NewConcurrencyController(1)
+	release, _ := c.Acquire(context.Background())
+
+	acquired := make(chan func())
+	go func() {
+		r, err := c.Acquire(context.Background())
+		if err == nil {
+			acquired <- r
+		}
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired beyond the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	c.SetLimit(2)
+	select {
+	case r := <-acquired:
+		r()
+	case <-time.After(time.Second):
+		t.Fatal("raising the limit did not admit the waiter")
+	}
+	if c.Limit() != 2 {
+		t.Errorf("expected limit 2, got %d", c.Limit())
+	}
+
+	// lowering the limit keeps held slots but bounds new acquisitions
+	c.SetLimit(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.Acquire(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected acquire to block after lowering the limit, got %v", err)
+	}
+	release()
+}
+
+func TestAutoscaleWorkersTracksTarget(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	in := NewBaseQueue("in", 100)
+	for i := 0; i < 80; i++ {
+		in.Put(i)
+	}
+	controller := NewConcurrencyController(2)
+	done := make(chan struct{})
+	go func() {
+		AutoscaleWorkers(in, controller, 1, 8, 0.5)
+		close(done)
+	}()
+	step := func() int {
+		waitFor(t, "the next sample", func() bool { return c.Waiters() == 1 })
+		c.Advance(AutoscaleInterval)
+		waitFor(t, "the sample to be taken", func() bool { return c.Waiters() == 1 })
+		return controller.Limit()
+	}
+
+	// utilization 0.8 above the target of 0.5 grows the workers up to max
+	prev := controller.Limit()
+	for i := 0; i < 10; i++ {
+		limit := step()
+		if limit < prev || limit > 8 {
+			t.Fatalf("expected the limit to grow within bounds, got %d after %d", limit, prev)
+		}
+		prev = limit
+	}
+	if prev != 8 {
+		t.Errorf("expected the limit to reach max 8, got %d", prev)
+	}
+
+	// utilization at the target keeps the limit
+	in.DrainBatch(context.Background(), 30)()
+	if limit := step(); limit != 8 {
+		t.Errorf("expected the limit to stay at 8, got %d", limit)
+	}
+
+	// an idle queue shrinks the workers down to min
+	in.Clear()
+	for i := 0; i < 10; i++ {
+		limit := step()
+		if limit > prev || limit < 1 {
+			t.Fatalf("expected the limit to shrink within bounds, got %d after %d", limit, prev)
+		}
+		prev = limit
+	}
+	if prev != 1 {
+		t.Errorf("expected the limit to reach min 1, got %d", prev)
+	}
+
+	in.Close()
+	waitFor(t, "the next sample", func() bool { return c.Waiters() == 1 })
+	c.Advance(AutoscaleInterval)
+	<-done
+}
+
+func TestAutoscaleUnboundedQueue(t *testing.T) {
+	in := NewBaseQueue("in", 0)
+	for i := 0; i < 8; i++ {
+		in.Put(i)
+	}
+	// a backlog of 2 items per worker is 4 times the target of 0.5
+	if next := autoscale(in, 4, 1, 100, 0.5); next != 10 {
+		t.Errorf("expected the limit to move halfway to 16, got %d", next)
+	}
+}
@@ -0,0 +1,31 @@
+package icd
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Configurable is the optional interface for plugins which expose their
+// effective configuration, e.g. for debugging, audits or detecting drift
+// between the configuration deployed and the one running
+type Configurable interface {
+	// Config returns the current configuration of the plugin as JSON, with
+	// the defaults applied. A plugin which reloads its configuration returns
+	// the configuration as of the last reload.
+	Config() string
+}
+
+// CurrentConfig returns the effective configuration of plugin, a plugin
+// which is not Configurable returns ErrNotSupported and one whose
+// configuration is not valid JSON an error
+func CurrentConfig(plugin interface{}) (string, error) {
+	c, ok := plugin.(Configurable)
+	if !ok {
+		return "", ErrNotSupported
+	}
+	cfg := c.Config()
+	if !json.Valid([]byte(cfg)) {
+		return "", fmt.Errorf("config is not valid JSON: %q", cfg)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,61 @@
+package icd
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// reloadablePlugin applies defaults to the configuration it is created and
+// reloaded with
+type reloadablePlugin struct {
+	cfg struct {
+		Path    string `json:"path"`
+		Retries int    `json:"retries"`
+	}
+}
+
+func newReloadablePlugin(cfg string) (*reloadablePlugin, error) {
+	p := &reloadablePlugin{}
+	return p, p.Reload(cfg)
+}
+
+func (p *reloadablePlugin) Reload(cfg string) error {
+	p.cfg.Path = "/var/log"
+	p.cfg.Retries = 3
+	return json.Unmarshal([]byte(cfg), &p.cfg)
+}
+
+func (p *reloadablePlugin) Config() string {
+	cfg, _ := json.Marshal(p.cfg)
+	return string(cfg)
+}
+
+func TestCurrentConfig(t *testing.T) {
+	p, err := newReloadablePlugin(`{"path":"/tmp"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := CurrentConfig(p)
+	if err != nil || cfg != `{"path":"/tmp","retries":3}` {
+		t.Errorf("expected the config with defaults, got %s %v", cfg, err)
+	}
+
+	p.Reload(`{"retries":5}`)
+	cfg, err = CurrentConfig(p)
+	if err != nil || cfg != `{"path":"/var/log","retries":5}` {
+		t.Errorf("expected the reloaded config, got %s %v", cfg, err)
+	}
+}
+
+type badConfig struct{}
+
+func (badConfig) Config() string { return "path=/tmp" }
+
+func TestCurrentConfigErrors(t *testing.T) {
+	if _, err := CurrentConfig(NewBaseQueue("q", 0)); !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	if _, err := CurrentConfig(badConfig{}); err == nil {
+		t.Error("expected an error for a config which is not JSON")
+	}
+}
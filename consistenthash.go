@@ -0,0 +1,228 @@
+package icd
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Rebalancer is the optional interface for queues which route items to
+// partitions that can change at runtime
+type Rebalancer interface {
+	// Rebalance replaces the partitions items are routed to
+	Rebalance(partitions []Queue) error
+}
+
+type ringPoint struct {
+	hash      uint64
+	partition int
+}
+
+type consistentHashQueue struct {
+	key        func(interface{}) string
+	replicas   int
+	mu         sync.RWMutex
+	partitions []Queue
+	ring       []ringPoint
+}
+
+// NewConsistentHashQueue creates a queue routing each item put to one of the
+// partitions, chosen by the key of the item on a consistent hash ring holding
+// replicas points per partition. Items with the same key go to the same
+// partition, and when the partitions change through Rebalance only the keys
+// whose ring segment changed owner move, about 1/n of them when adding an
+// n-th partition. Partitions are placed on the ring by name, so names must
+// be unique and a partition keeps its keys across a Rebalance. Without
+// partitions Put returns an error.
+//
+// The queue only routes: consumers get from the partitions directly, Get
+// returns ErrNotSupported. Len, Cap, Clear, Reset, Close and Closed apply to
+// all partitions.
+func NewConsistentHashQueue(partitions []Queue, key func(interface{}) string, replicas int) Queue {
+	if replicas < 1 {
+		replicas = 1
+	}
+	q := &consistentHashQueue{
+		key:      key,
+		replicas: replicas,
+	}
+	q.Rebalance(partitions)
+	return q
+}
+
+// Rebalance replaces the partitions items are routed to. Items already put
+// stay in their partition.
+func (q *consistentHashQueue) Rebalance(partitions []Queue) error {
+	if len(partitions) == 0 {
+		return errors.New("consistent hash queue needs at least one partition")
+	}
+	ring := make([]ringPoint, 0, len(partitions)*q.replicas)
+	for i, p := range partitions {
+		for r := 0; r < q.replicas; r++ {
+			ring = append(ring, ringPoint{hash: ringHash(p.Name() + "#" + strconv.Itoa(r)), partition: i})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.partitions = append([]Queue(nil), partitions...)
+	q.ring = ring
+	return nil
+}
+
+// Name provides the name of the queue
+func (q *consistentHashQueue) Name() string {
+	return "consistenthash"
+}
+
+// Put puts the item into the partition owning its key
+func (q *consistentHashQueue) Put(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	p, err := q.partition(q.key(item))
+	if err != nil {
+		return err
+	}
+	return p.Put(item)
+}
+
+// Get returns ErrNotSupported, items are gotten from the partitions
+func (q *consistentHashQueue) Get() (interface{}, error) {
+	return nil, fmt.Errorf("get from consistent hash queue, get from its partitions: %w", ErrNotSupported)
+}
+
+// Len returns the number of items in all partitions
+func (q *consistentHashQueue) Len() int {
+	n := 0
+	for _, p := range q.snapshot() {
+		n += p.Len()
+	}
+	return n
+}
+
+// Cap returns the capacity of all partitions, -1 if any is unbounded
+func (q *consistentHashQueue) Cap() int {
+	n := 0
+	for _, p := range q.snapshot() {
+		c := p.Cap()
+		if c < 0 {
+			return -1
+		}
+		n += c
+	}
+	return n
+}
+
+// Clear clears all partitions
+func (q *consistentHashQueue) Clear() {
+	for _, p := range q.snapshot() {
+		p.Clear()
+	}
+}
+
+// Reset resets all partitions
+func (q *consistentHashQueue) Reset() {
+	for _, p := range q.snapshot() {
+		p.Reset()
+	}
+}
+
+// Close closes all partitions, returning the first error
+func (q *consistentHashQueue) Close() error {
+	var first error
+	for _, p := range q.snapshot() {
+		err := p.Close()
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Closed returns whether or not all partitions are closed
+func (q *consistentHashQueue) Closed() bool {
+	for _, p := range q.snapshot() {
+		if !p.Closed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Stats returns the statistics of the partitions summed up under the name
+// of the queue
+func (q *consistentHashQueue) Stats() QueueStats {
+	stats := QueueStats{
+		Name:   q.Name(),
+		Cap:    q.Cap(),
+		Closed: q.Closed(),
+	}
+	for _, p := range q.snapshot() {
+		ps := statsOf(p)
+		stats.Len += ps.Len
+		stats.Puts += ps.Puts
+		stats.Gets += ps.Gets
+	}
+	return stats
+}
+
+// Monitor sends the summed statistics of the partitions every second and the
+// final statistics on shutdown. The partitions are monitored themselves, a
+// clear request is left to their monitors.
+func (q *consistentHashQueue) Monitor(mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	for {
+		select {
+		case <-mc.DoneChan:
+			mc.FinalStatsChan <- q.Stats()
+			return
+		case <-after(monitorInterval):
+			select {
+			case mc.StatsChan <- q.Stats():
+			default:
+			}
+		}
+	}
+}
+
+// snapshot returns the current partitions
+func (q *consistentHashQueue) snapshot() []Queue {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.partitions
+}
+
+// partition returns the partition owning key, the first ring point at or
+// after the hash of key
+func (q *consistentHashQueue) partition(key string) (Queue, error) {
+	h := ringHash(key)
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if len(q.ring) == 0 {
+		return nil, errors.New("consistent hash queue has no partitions")
+	}
+	i := sort.Search(len(q.ring), func(i int) bool { return q.ring[i].hash >= h })
+	if i == len(q.ring) {
+		i = 0
+	}
+	return q.partitions[q.ring[i].partition], nil
+}
+
+// ringHash hashes s onto the ring. FNV alone clusters similar strings such
+// as "name#1" and "name#2", the finalizer spreads them.
+func ringHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
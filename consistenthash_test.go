@@ -0,0 +1,123 @@
+package icd
+
+import (
+	"strconv"
+	"testing"
+)
+
+func keyString(item interface{}) string {
+	return item.(string)
+}
+
+func newPartitions(n int) []Queue {
+	partitions := make([]Queue, n)
+	for i := range partitions {
+		partitions[i] = NewBaseQueue("partition"+strconv.Itoa(i), 0)
+	}
+	return partitions
+}
+
+// owners puts the keys and returns the name of the partition each went to
+func owners(t *testing.T, q Queue, partitions []Queue, keys []string) map[string]string {
+	t.Helper()
+	for _, k := range keys {
+		if err := q.Put(k); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	owner := map[string]string{}
+	for _, p := range partitions {
+		for p.Len() > 0 {
+			item, _ := p.Get()
+			owner[item.(string)] = p.Name()
+		}
+	}
+	return owner
+}
+
+func TestConsistentHashQueueSticky(t *testing.T) {
+	partitions := newPartitions(4)
+	q := NewConsistentHashQueue(partitions, keyString, 50)
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	first := owners(t, q, partitions, keys)
+	second := owners(t, q, partitions, keys)
+	for _, k := range keys {
+		if first[k] != second[k] {
+			t.Errorf("expected key %s to stick to %s, went to %s", k, first[k], second[k])
+		}
+	}
+	if _, err := q.Get(); !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestConsistentHashQueueMinimalReassignment(t *testing.T) {
+	keys := make([]string, 2000)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	partitions := newPartitions(4)
+	q := NewConsistentHashQueue(partitions, keyString, 100)
+	before := owners(t, q, partitions, keys)
+
+	partitions = append(partitions, NewBaseQueue("partition4", 0))
+	if err := q.(Rebalancer).Rebalance(partitions); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after := owners(t, q, partitions, keys)
+
+	moved := 0
+	for _, k := range keys {
+		if before[k] == after[k] {
+			continue
+		}
+		moved++
+		if after[k] != "partition4" {
+			t.Fatalf("expected key %s to move only to the new partition, moved from %s to %s", k, before[k], after[k])
+		}
+	}
+	// about a fifth of the keys should move to the fifth partition
+	if moved < len(keys)/10 || moved > len(keys)*3/10 {
+		t.Errorf("expected about %d keys to move, %d moved", len(keys)/5, moved)
+	}
+}
+
+func TestConsistentHashQueuePartitions(t *testing.T) {
+	partitions := []Queue{NewBaseQueue("a", 2), NewBaseQueue("b", 3)}
+	q := NewConsistentHashQueue(partitions, keyString, 10)
+	if q.Cap() != 5 {
+		t.Errorf("expected the combined capacity 5, got %d", q.Cap())
+	}
+	if err := q.(Rebalancer).Rebalance(nil); err == nil {
+		t.Error("expected an error rebalancing to no partitions")
+	}
+	q.Put("x")
+	if q.Len() != 1 {
+		t.Errorf("expected len 1, got %d", q.Len())
+	}
+	q.Close()
+	if !q.Closed() || !partitions[0].Closed() || !partitions[1].Closed() {
+		t.Error("expected close to close every partition")
+	}
+}
+
+func TestConsistentHashQueueMonitor(t *testing.T) {
+	partitions := newPartitions(2)
+	q := NewConsistentHashQueue(partitions, keyString, 10)
+	for _, k := range []string{"a", "b", "c"} {
+		q.Put(k)
+	}
+	partitions[0].Put("d")
+	partitions[1].Put("e")
+	partitions[1].Get()
+
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go q.Monitor(mc)
+	close(mc.DoneChan)
+	mc.WaitGroup.Wait()
+	final := (<-mc.FinalStatsChan).(QueueStats)
+	if final.Name != q.Name() || final.Len != 4 || final.Puts != 5 || final.Gets != 1 || final.Cap != -1 {
+		t.Errorf("expected the summed statistics of the partitions, got %+v", final)
+	}
+}
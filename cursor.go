@@ -0,0 +1,296 @@
+package icd
+
+import (
+	"fmt"
+	"sync"
+)
+
+// CursorQueue is an in-memory queue which, like a Kafka partition, separates
+// reading items from committing the progress of reading them. Fetch reads
+// items from the read position without removing them, Commit removes the
+// items before an offset, and Rewind moves the read position back to the
+// last commit, so a consumer taking over after a crash re-reads the items its
+// predecessor fetched but did not commit. Every item put gets the next
+// offset, starting at 0. The items until the last commit count against the
+// capacity, so Put blocks while the queue holds capacity uncommitted items.
+type CursorQueue struct {
+	name     string
+	capacity int
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	// the uncommitted items, the first one at offset committed
+	items     []interface{}
+	committed int64
+	position  int64
+	closed    bool
+	puts      uint64
+	gets      uint64
+	hooks     closeHooks
+}
+
+// NewCursorQueue creates a cursor queue holding at most capacity uncommitted
+// items, a capacity less than 1 creates an unbounded queue
+func NewCursorQueue(name string, capacity int) *CursorQueue {
+	if capacity < 1 {
+		capacity = -1
+	}
+	q := &CursorQueue{
+		name:     name,
+		capacity: capacity,
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// Name provides the name of the queue
+func (q *CursorQueue) Name() string {
+	return q.name
+}
+
+// Put puts an item into the queue, blocking while the queue holds capacity
+// uncommitted items
+func (q *CursorQueue) Put(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && q.capacity >= 0 && len(q.items) >= q.capacity {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return ErrQueueClosed
+	}
+	q.items = append(q.items, item)
+	q.puts++
+	q.notEmpty.Broadcast()
+	return nil
+}
+
+// Fetch reads up to n items from the read position, blocking while there are
+// none, and returns them along with the offset to Commit once they are
+// processed. The items stay in the queue until they are committed. Returns
+// ErrQueueClosed once the queue is closed and every item was fetched. An n
+// below 1 is raised to 1.
+func (q *CursorQueue) Fetch(n int) ([]interface{}, int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.fetch(n)
+}
+
+// fetch reads up to n items, must be called with mu held
+func (q *CursorQueue) fetch(n int) ([]interface{}, int64, error) {
+	if n < 1 {
+		n = 1
+	}
+	for !q.closed && q.position == q.end() {
+		q.notEmpty.Wait()
+	}
+	if q.position == q.end() {
+		return nil, q.position, ErrQueueClosed
+	}
+	start := int(q.position - q.committed)
+	if n > len(q.items)-start {
+		n = len(q.items) - start
+	}
+	items := make([]interface{}, n)
+	copy(items, q.items[start:])
+	q.position += int64(n)
+	return items, q.position, nil
+}
+
+// Commit removes the items before offset, freeing their room in the queue.
+// Committing an offset at or before the last commit does nothing, an offset
+// beyond the read position, i.e. of items not fetched yet, returns an error.
+func (q *CursorQueue) Commit(offset int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.commit(offset)
+}
+
+// commit removes the items before offset, must be called with mu held
+func (q *CursorQueue) commit(offset int64) error {
+	if offset > q.position {
+		return fmt.Errorf("commit offset %d of %s beyond read position %d", offset, q.name, q.position)
+	}
+	if offset <= q.committed {
+		return nil
+	}
+	n := int(offset - q.committed)
+	for i := 0; i < n; i++ {
+		q.items[i] = nil
+	}
+	q.items = q.items[n:]
+	q.committed = offset
+	q.gets += uint64(n)
+	q.notFull.Broadcast()
+	return nil
+}
+
+// Rewind moves the read position back to the last commit, so the next Fetch
+// reads the uncommitted items again
+func (q *CursorQueue) Rewind() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.position = q.committed
+}
+
+// Committed returns the offset of the last commit, the offset of the first
+// item still in the queue
+func (q *CursorQueue) Committed() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.committed
+}
+
+// Position returns the read position, the offset of the item the next Fetch
+// reads first
+func (q *CursorQueue) Position() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.position
+}
+
+// Get fetches and commits the next item, blocking while there is none. Get
+// does not mix with Fetch, as committing the item would commit the items
+// fetched before it as well: it returns an error while fetched items are
+// uncommitted.
+func (q *CursorQueue) Get() (interface{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	err := q.uncommitted()
+	if err != nil {
+		return nil, err
+	}
+	items, offset, err := q.fetch(1)
+	if err != nil {
+		return nil, err
+	}
+	if offset-1 > q.committed {
+		// items were fetched while waiting, leave the item to be fetched
+		q.position = offset - 1
+		return nil, q.uncommitted()
+	}
+	q.commit(offset)
+	return items[0], nil
+}
+
+// Len returns the number of uncommitted items in the queue, fetched or not
+func (q *CursorQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Cap returns the maximum number of uncommitted items the queue can hold, -1
+// if unbounded
+func (q *CursorQueue) Cap() int {
+	return q.capacity
+}
+
+// Clear removes all items from the queue, committing them
+func (q *CursorQueue) Clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.committed = q.end()
+	q.position = q.committed
+	q.items = nil
+	q.notFull.Broadcast()
+}
+
+// Reset removes all items, clears statistics, starts the offsets over and
+// reopens the queue
+func (q *CursorQueue) Reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = nil
+	q.committed = 0
+	q.position = 0
+	q.closed = false
+	q.puts = 0
+	q.gets = 0
+	q.notFull.Broadcast()
+}
+
+// Close closes the queue, waking all blocked callers. The uncommitted items
+// can still be fetched and committed. Close returns once the running
+// monitors of the queue sent statistics of the closed queue, or dropped them
+// when the stats channel was full.
+func (q *CursorQueue) Close() error {
+	q.mu.Lock()
+	closing := !q.closed
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+	if closing {
+		q.hooks.fire()
+	}
+	return nil
+}
+
+// Closed returns whether or not the queue is closed
+func (q *CursorQueue) Closed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// Stats returns the current statistics of the queue, the gets count the
+// committed items
+func (q *CursorQueue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStats{
+		Name:   q.name,
+		Len:    len(q.items),
+		Cap:    q.capacity,
+		Puts:   q.puts,
+		Gets:   q.gets,
+		Closed: q.closed,
+	}
+}
+
+// Monitor sends the statistics of the queue every second and once more when
+// the queue closes, clears them on request and sends the final statistics on
+// shutdown
+func (q *CursorQueue) Monitor(mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	hook := q.hooks.attach()
+	for {
+		select {
+		case <-hook.closing:
+			hook = q.hooks.flushClosed(hook, mc, q.Stats())
+		case <-mc.ClearChan:
+			q.mu.Lock()
+			q.puts = 0
+			q.gets = 0
+			q.mu.Unlock()
+		case <-mc.DoneChan:
+			q.hooks.detach(hook)
+			mc.FinalStatsChan <- q.Stats()
+			return
+		case <-after(monitorInterval):
+			select {
+			case mc.StatsChan <- q.Stats():
+			default:
+			}
+		}
+	}
+}
+
+// uncommitted returns an error when fetched items are uncommitted, must be
+// called with mu held
+func (q *CursorQueue) uncommitted() error {
+	if q.position > q.committed {
+		return fmt.Errorf("get from %s with %d fetched items uncommitted", q.name, q.position-q.committed)
+	}
+	return nil
+}
+
+// end returns the offset the next item put gets, must be called with mu held
+func (q *CursorQueue) end() int64 {
+	return q.committed + int64(len(q.items))
+}
@@ -0,0 +1,126 @@
+package icd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCursorQueueFetchAndCommit(t *testing.T) {
+	q := NewCursorQueue("cursor", 0)
+	q.Put("a")
+	q.Put("b")
+	q.Put("c")
+
+	items, offset, err := q.Fetch(2)
+	if err != nil || !reflect.DeepEqual(items, []interface{}{"a", "b"}) || offset != 2 {
+		t.Fatalf("unexpected fetch %v %d %v", items, offset, err)
+	}
+	items, offset, _ = q.Fetch(5)
+	if !reflect.DeepEqual(items, []interface{}{"c"}) || offset != 3 {
+		t.Errorf("expected the fetch to continue at the read position, got %v %d", items, offset)
+	}
+	if q.Len() != 3 || q.Committed() != 0 {
+		t.Errorf("expected fetching not to commit, got %d items from offset %d", q.Len(), q.Committed())
+	}
+
+	// a restarted consumer re-reads everything since the last commit
+	q.Rewind()
+	items, _, _ = q.Fetch(10)
+	if !reflect.DeepEqual(items, []interface{}{"a", "b", "c"}) {
+		t.Errorf("expected the uncommitted items again, got %v", items)
+	}
+
+	if err := q.Commit(2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q.Len() != 1 || q.Committed() != 2 || q.Stats().Gets != 2 {
+		t.Errorf("expected the commit to progress, got %+v", q.Stats())
+	}
+	q.Rewind()
+	items, offset, _ = q.Fetch(10)
+	if !reflect.DeepEqual(items, []interface{}{"c"}) || offset != 3 || q.Position() != 3 {
+		t.Errorf("expected to re-read from the last commit, got %v %d", items, offset)
+	}
+
+	if err := q.Commit(1); err != nil || q.Committed() != 2 {
+		t.Errorf("expected an older commit to do nothing, got %v at %d", err, q.Committed())
+	}
+	if err := q.Commit(4); err == nil {
+		t.Error("expected committing unfetched items to fail")
+	}
+}
+
+func TestCursorQueueCapacity(t *testing.T) {
+	q := NewCursorQueue("cursor", 2)
+	q.Put("a")
+	q.Put("b")
+	_, offset, _ := q.Fetch(2)
+	put := make(chan error)
+	go func() {
+		put <- q.Put("c")
+	}()
+	select {
+	case <-put:
+		t.Fatal("expected the put to block on the uncommitted items")
+	default:
+	}
+	q.Commit(offset)
+	if err := <-put; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	items, offset, _ := q.Fetch(1)
+	if !reflect.DeepEqual(items, []interface{}{"c"}) || offset != 3 {
+		t.Errorf("expected c up to offset 3, got %v %d", items, offset)
+	}
+}
+
+func TestCursorQueueGetAndClose(t *testing.T) {
+	q := NewCursorQueue("cursor", 0)
+	q.Put("a")
+	q.Put("b")
+	q.Put("c")
+	_, offset, _ := q.Fetch(1)
+	// Get does not commit the items fetched before it
+	if _, err := q.Get(); err == nil || q.Committed() != 0 || q.Position() != 1 {
+		t.Errorf("expected Get to fail while a is uncommitted, got %v at %d", err, q.Committed())
+	}
+	q.Commit(offset)
+	item, err := q.Get()
+	if item != "b" || err != nil {
+		t.Errorf("expected b, got %v %v", item, err)
+	}
+	if q.Committed() != 2 {
+		t.Errorf("expected Get to commit b, got %d", q.Committed())
+	}
+
+	q.Close()
+	if err := q.Put("d"); !IsQueueClosed(err) {
+		t.Errorf("expected a closed queue to refuse items, got %v", err)
+	}
+	items, offset, err := q.Fetch(10)
+	if err != nil || !reflect.DeepEqual(items, []interface{}{"c"}) {
+		t.Errorf("expected the remaining item, got %v %v", items, err)
+	}
+	if _, _, err := q.Fetch(10); !IsQueueClosed(err) {
+		t.Errorf("expected the drained queue to be closed, got %v", err)
+	}
+	q.Commit(offset)
+
+	q.Reset()
+	q.Put("x")
+	if _, offset, _ := q.Fetch(1); offset != 1 || q.Stats().Puts != 1 {
+		t.Errorf("expected Reset to start the offsets over, got %d", offset)
+	}
+}
+
+func TestCursorQueueClear(t *testing.T) {
+	q := NewCursorQueue("cursor", 0)
+	q.Put("a")
+	q.Put("b")
+	q.Clear()
+	q.Put("c")
+	items, offset, _ := q.Fetch(10)
+	if !reflect.DeepEqual(items, []interface{}{"c"}) || offset != 3 || q.Committed() != 2 {
+		t.Errorf("expected Clear to commit the items, got %v %d", items, offset)
+	}
+}
@@ -0,0 +1,144 @@
+package icd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Compression is the compression algorithm of a stream
+type Compression string
+
+const (
+	// CompressionNone is an uncompressed stream
+	CompressionNone Compression = "none"
+	// CompressionAuto detects the algorithm from the magic bytes starting
+	// the stream, streams starting with none of them are uncompressed
+	CompressionAuto Compression = "auto"
+	// CompressionGzip is a gzip stream
+	CompressionGzip Compression = "gzip"
+	// CompressionZlib is a zlib stream
+	CompressionZlib Compression = "zlib"
+	// CompressionBzip2 is a bzip2 stream
+	CompressionBzip2 Compression = "bzip2"
+	// CompressionZstd is a zstd stream, which is detected but not supported
+	CompressionZstd Compression = "zstd"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// DetectCompression returns the algorithm of the stream starting with head,
+// CompressionNone when it starts with no known magic bytes. Zlib streams
+// have no magic bytes but a header checksum, so a few uncompressed streams
+// starting with e.g. "x^" are mistaken for zlib.
+func DetectCompression(head []byte) Compression {
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(head, zstdMagic):
+		return CompressionZstd
+	case bytes.HasPrefix(head, bzip2Magic):
+		return CompressionBzip2
+	case len(head) >= 2 && head[0]&0x0f == 8 && head[0]>>4 <= 7 && head[1]&0x20 == 0 && (uint(head[0])<<8|uint(head[1]))%31 == 0:
+		// deflate without a preset dictionary and a valid header checksum
+		return CompressionZlib
+	default:
+		return CompressionNone
+	}
+}
+
+// decompress returns the decompressed stream of r compressed with algo
+func decompress(r io.Reader, algo Compression) (io.ReadCloser, error) {
+	if algo == CompressionAuto {
+		br := bufio.NewReader(r)
+		head, err := br.Peek(len(zstdMagic))
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		algo = DetectCompression(head)
+		r = br
+	}
+	switch algo {
+	case CompressionNone:
+		return ioutil.NopCloser(r), nil
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZlib:
+		return zlib.NewReader(r)
+	case CompressionBzip2:
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	default:
+		return nil, fmt.Errorf("compression %s: %w", algo, ErrNotSupported)
+	}
+}
+
+type decompressingIngester struct {
+	runner
+	r     io.Reader
+	algo  Compression
+	inner func(io.Reader) Ingester
+	mu    sync.Mutex
+	ing   Ingester
+}
+
+// DecompressingIngester creates an ingester decompressing r, compressed with
+// algo, and delegating to the reader-based ingester inner creates for the
+// decompressed stream, e.g. one splitting it into lines. CompressionAuto
+// detects the algorithm, see DetectCompression. The inner ingester puts the
+// items, closes the send queue and gets the Monitor set with SetMonitor; its
+// reads fail when the stream is corrupt. When the stream cannot be
+// decompressed, e.g. for CompressionZstd, which yields ErrNotSupported, the
+// error is reported and the ingester stops, closing the send queue.
+func DecompressingIngester(name string, r io.Reader, algo Compression, inner func(io.Reader) Ingester) Ingester {
+	return &decompressingIngester{
+		runner: runner{name: name, kind: KindIngester},
+		r:      r,
+		algo:   algo,
+		inner:  inner,
+	}
+}
+
+// Running returns whether or not the inner ingester, or the ingester while it
+// fails to decompress the stream, is running
+func (i *decompressingIngester) Running() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.ing == nil {
+		return i.runner.Running()
+	}
+	return i.ing.Running()
+}
+
+// Ingest runs the inner ingester on the decompressed stream
+func (i *decompressingIngester) Ingest(snd Queue, mc *MonitorControl) {
+	rc, err := decompress(i.r, i.algo)
+	if err != nil {
+		defer mc.WaitGroup.Done()
+		i.start()
+		defer i.stop(mc)
+		i.report(fmt.Errorf("decompress: %w", err))
+		snd.Close()
+		return
+	}
+	defer rc.Close()
+
+	ing := i.inner(rc)
+	m, ok := ing.(Monitored)
+	if ok && i.monitor != nil {
+		m.SetMonitor(i.monitor)
+	}
+	i.mu.Lock()
+	i.ing = ing
+	i.mu.Unlock()
+	ing.Ingest(snd, mc)
+}
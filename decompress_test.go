@@ -0,0 +1,119 @@
+package icd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// wordSource returns the whitespace separated words of a reader
+type wordSource struct {
+	scanner *bufio.Scanner
+}
+
+func (s *wordSource) Next() (interface{}, error) {
+	if !s.scanner.Scan() {
+		err := s.scanner.Err()
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	return s.scanner.Text(), nil
+}
+
+func wordIngester(r io.Reader) Ingester {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+	return SourceToIngester("words", &wordSource{scanner: scanner})
+}
+
+// bzip2Words is "a b\nc\n" compressed with bzip2
+var bzip2Words = []byte{
+	66, 90, 104, 57, 49, 65, 89, 38, 83, 89, 211, 31, 197, 21, 0, 0, 1, 209,
+	0, 0, 16, 64, 0, 56, 0, 32, 0, 48, 205, 0, 193, 160, 24, 156, 93, 201, 20,
+	225, 66, 67, 76, 127, 20, 84,
+}
+
+// runIngester runs ing into a new queue and returns the items it put
+func runIngester(t *testing.T, ing Ingester) []interface{} {
+	t.Helper()
+	snd := NewBaseQueue("snd", 0)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	ing.Ingest(snd, mc)
+	mc.WaitGroup.Wait()
+	if !snd.Closed() {
+		t.Error("expected the send queue to be closed")
+	}
+	items, _ := snd.TakeAll()
+	return items
+}
+
+func TestDecompressingIngester(t *testing.T) {
+	var gz, zl bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("a b\nc\n"))
+	w.Close()
+	zw := zlib.NewWriter(&zl)
+	zw.Write([]byte("a b\nc\n"))
+	zw.Close()
+
+	want := []interface{}{"a", "b", "c"}
+	for _, tc := range []struct {
+		name string
+		data []byte
+		algo Compression
+	}{
+		{"gzip", gz.Bytes(), CompressionGzip},
+		{"auto gzip", gz.Bytes(), CompressionAuto},
+		{"auto zlib", zl.Bytes(), CompressionAuto},
+		{"auto bzip2", bzip2Words, CompressionAuto},
+		{"auto none", []byte("a b\nc\n"), CompressionAuto},
+		{"none", []byte("a b\nc\n"), CompressionNone},
+	} {
+		ing := DecompressingIngester("decompress", bytes.NewReader(tc.data), tc.algo, wordIngester)
+		if got := runIngester(t, ing); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, want, got)
+		}
+	}
+}
+
+func TestDecompressingIngesterUnsupported(t *testing.T) {
+	m := NewMonitor(newTestMonitorControl())
+	data := append([]byte{0x28, 0xb5, 0x2f, 0xfd}, "frame"...)
+	ing := DecompressingIngester("decompress", bytes.NewReader(data), CompressionAuto, wordIngester)
+	ing.(Monitored).SetMonitor(m)
+	if got := runIngester(t, ing); len(got) != 0 {
+		t.Errorf("expected no items, got %v", got)
+	}
+	select {
+	case err := <-m.ErrorChan:
+		if !errors.Is(err, ErrNotSupported) || !strings.Contains(err.Error(), "zstd") {
+			t.Errorf("expected zstd to be unsupported, got %v", err)
+		}
+	default:
+		t.Error("expected the error to be reported")
+	}
+}
+
+func TestDetectCompression(t *testing.T) {
+	for head, want := range map[string]Compression{
+		"\x1f\x8b\x08\x00": CompressionGzip,
+		"\x78\x9c":         CompressionZlib,
+		"BZh9":             CompressionBzip2,
+		"\x28\xb5\x2f\xfd": CompressionZstd,
+		"x y":              CompressionNone,
+		"":                 CompressionNone,
+	} {
+		if got := DetectCompression([]byte(head)); got != want {
+			t.Errorf("%q: expected %s, got %s", head, want, got)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package icd
+
+import (
+	"fmt"
+)
+
+// RunDigester runs the digest plugin, in its DigesterErr form when plugin
+// implements it and in its Digester form otherwise. Like Digest it is a long
+// running function and marks mc.WaitGroup done when it returns, so the
+// caller adds to the WaitGroup beforehand as usual. A DigesterErr does not
+// see mc, RunDigester sends its final statistics, which carry its name and
+// kind only, when it returns. The error returned by a DigesterErr is wrapped
+// with its name, a Digester always yields nil and a plugin which is neither
+// yields ErrNotSupported.
+func RunDigester(plugin interface{}, rcv Queue, snd Queue, mc *MonitorControl) error {
+	switch d := plugin.(type) {
+	case DigesterErr:
+		defer mc.WaitGroup.Done()
+		err := d.Digest(rcv, snd)
+		mc.FinalStatsChan <- PluginStats{Name: d.Name(), Kind: KindDigester}
+		if err != nil {
+			return fmt.Errorf("digest %s: %w", d.Name(), err)
+		}
+		return nil
+	case Digester:
+		d.Digest(rcv, snd, mc)
+		return nil
+	default:
+		mc.WaitGroup.Done()
+		return fmt.Errorf("digest %T: %w", plugin, ErrNotSupported)
+	}
+}
@@ -0,0 +1,146 @@
+package icd
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errDigest = errors.New("digest failed")
+
+// failingDigester forwards items until it receives "fail", then stops with
+// errDigest
+type failingDigester struct {
+	running int32
+}
+
+func (d *failingDigester) Name() string {
+	return "failing"
+}
+
+func (d *failingDigester) Running() bool {
+	return atomic.LoadInt32(&d.running) == 1
+}
+
+func (d *failingDigester) Digest(rcv Queue, snd Queue) error {
+	atomic.StoreInt32(&d.running, 1)
+	defer atomic.StoreInt32(&d.running, 0)
+	for {
+		item, err := rcv.Get()
+		if IsQueueClosed(err) {
+			return snd.Close()
+		}
+		if err != nil {
+			return err
+		}
+		if item == "fail" {
+			return errDigest
+		}
+		err = snd.Put(item)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func TestRunDigesterErrRestarts(t *testing.T) {
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	for _, item := range []string{"a", "fail", "b", "fail", "c"} {
+		rcv.Put(item)
+	}
+	rcv.Close()
+
+	// the supervisor restarts the digester on every error until it stops
+	// cleanly
+	mc := newTestMonitorControl()
+	var errs []error
+	for {
+		mc.WaitGroup.Add(1)
+		err := RunDigester(&failingDigester{}, rcv, snd, mc)
+		if err == nil {
+			break
+		}
+		errs = append(errs, err)
+	}
+	mc.WaitGroup.Wait()
+
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 restarts, got %v", errs)
+	}
+	for _, err := range errs {
+		if !errors.Is(err, errDigest) || err.Error() != "digest failing: digest failed" {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	var items []interface{}
+	for {
+		item, err := snd.Get()
+		if err != nil {
+			break
+		}
+		items = append(items, item)
+	}
+	if len(items) != 3 || items[0] != "a" || items[1] != "b" || items[2] != "c" {
+		t.Errorf("unexpected items %v", items)
+	}
+}
+
+func TestRunDigesterErrAlerts(t *testing.T) {
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	rcv.Put("fail")
+	m := NewMonitor(newTestMonitorControl())
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+
+	// the supervisor reports the error to the monitor instead of restarting
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := RunDigester(&failingDigester{}, rcv, snd, mc)
+		if err != nil {
+			m.Error(err)
+		}
+	}()
+	select {
+	case err := <-m.ErrorChan:
+		if !errors.Is(err, errDigest) {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the error to be reported")
+	}
+	wg.Wait()
+	mc.WaitGroup.Wait()
+	if snd.Closed() {
+		t.Error("expected a failed digester to leave its send queue open")
+	}
+	final := (<-mc.FinalStatsChan).(PluginStats)
+	if final.Name != "failing" || final.Kind != KindDigester || final.Running {
+		t.Errorf("expected the final stats of the failed digester, got %+v", final)
+	}
+}
+
+func TestRunDigester(t *testing.T) {
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	rcv.Close()
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	err := RunDigester(WindowDigester("window", time.Second, count), rcv, snd, mc)
+	mc.WaitGroup.Wait()
+	if err != nil || !snd.Closed() {
+		t.Errorf("expected the digester to stop cleanly, got %v", err)
+	}
+
+	mc.WaitGroup.Add(1)
+	err = RunDigester("not a digester", rcv, snd, mc)
+	mc.WaitGroup.Wait()
+	if !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package icd
+
+import (
+	"sync"
+	"time"
+)
+
+// DigesterMiddleware adds a cross-cutting concern, e.g. timing or retries,
+// to a digester by wrapping it
+type DigesterMiddleware func(Digester) Digester
+
+// ChainDigesters wraps d with mws in order like Chain does for queues: the
+// first middleware wraps d itself and the last is the outermost.
+// ChainDigesters(d, a, b) is b(a(d)).
+func ChainDigesters(d Digester, mws ...DigesterMiddleware) Digester {
+	for _, mw := range mws {
+		d = mw(d)
+	}
+	return d
+}
+
+// queueDigester wraps a digester, handing it wrapped queues
+type queueDigester struct {
+	Digester
+	wrap func(rcv Queue, snd Queue, mc *MonitorControl) (Queue, Queue)
+}
+
+// Digest runs the wrapped digester with the wrapped queues
+func (d *queueDigester) Digest(rcv Queue, snd Queue, mc *MonitorControl) {
+	rcv, snd = d.wrap(rcv, snd, mc)
+	d.Digester.Digest(rcv, snd, mc)
+}
+
+// SetMonitor sets the monitor of the wrapped digester when it is Monitored
+func (d *queueDigester) SetMonitor(m *Monitor) {
+	mon, ok := d.Digester.(Monitored)
+	if ok {
+		mon.SetMonitor(m)
+	}
+}
+
+// Timing returns the middleware measuring how long the digester takes to
+// process an item, from getting it from rcv until sending the result to
+// snd, and passing each duration to observe. It suits digesters which
+// process one item at a time; a digester sending several results for an item
+// observes each, an item filtered out is not observed. The wrapped queues
+// offer only the methods of Queue. Durations follow the package Clock.
+func Timing(observe func(d time.Duration)) DigesterMiddleware {
+	return func(d Digester) Digester {
+		return &queueDigester{
+			Digester: d,
+			wrap: func(rcv Queue, snd Queue, mc *MonitorControl) (Queue, Queue) {
+				t := &itemTimer{}
+				return &timedRcvQueue{Queue: rcv, timer: t}, &timedSndQueue{Queue: snd, timer: t, observe: observe}
+			},
+		}
+	}
+}
+
+// itemTimer holds when the item being processed was gotten
+type itemTimer struct {
+	mu     sync.Mutex
+	gotten time.Time
+}
+
+type timedRcvQueue struct {
+	Queue
+	timer *itemTimer
+}
+
+// Get gets the next item, starting its timer
+func (q *timedRcvQueue) Get() (interface{}, error) {
+	item, err := q.Queue.Get()
+	if err == nil {
+		q.timer.mu.Lock()
+		q.timer.gotten = now()
+		q.timer.mu.Unlock()
+	}
+	return item, err
+}
+
+type timedSndQueue struct {
+	Queue
+	timer   *itemTimer
+	observe func(d time.Duration)
+}
+
+// Put puts the item, observing the time since the item processed was gotten
+func (q *timedSndQueue) Put(item interface{}) error {
+	q.timer.mu.Lock()
+	gotten := q.timer.gotten
+	q.timer.mu.Unlock()
+	if !gotten.IsZero() {
+		q.observe(now().Sub(gotten))
+	}
+	return q.Queue.Put(item)
+}
+
+// Retry returns the middleware retrying the sends of the digester which
+// fail, e.g. with ErrQueueFull, up to attempts times in total, waiting
+// backoff between attempts. A send failing with ErrQueueClosed or ErrNilItem
+// is not retried, nor is one whose backoff is cut short by the done message;
+// the digester gets the error of the last attempt. The wrapped queues offer
+// only the methods of Queue. An attempts below 1 is raised to 1 and the
+// backoff follows the package Clock.
+func Retry(attempts int, backoff time.Duration) DigesterMiddleware {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return func(d Digester) Digester {
+		return &queueDigester{
+			Digester: d,
+			wrap: func(rcv Queue, snd Queue, mc *MonitorControl) (Queue, Queue) {
+				return rcv, &retryQueue{Queue: snd, attempts: attempts, backoff: backoff, done: mc.DoneChan}
+			},
+		}
+	}
+}
+
+type retryQueue struct {
+	Queue
+	attempts int
+	backoff  time.Duration
+	done     <-chan struct{}
+}
+
+// Put puts the item, retrying failed attempts
+func (q *retryQueue) Put(item interface{}) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = q.Queue.Put(item)
+		if err == nil || IsQueueClosed(err) || IsNilItem(err) || attempt >= q.attempts {
+			return err
+		}
+		select {
+		case <-after(q.backoff):
+		case <-q.done:
+			return err
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package icd
+
+import (
+	"testing"
+	"time"
+)
+
+// advancingDigester forwards its items, each taking step on the fake clock
+type advancingDigester struct {
+	runner
+	clock *fakeClock
+	step  time.Duration
+	errs  []error
+}
+
+func (d *advancingDigester) Digest(rcv Queue, snd Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	d.start()
+	defer d.stop(mc)
+	for {
+		item, err := rcv.Get()
+		if err != nil {
+			snd.Close()
+			return
+		}
+		d.clock.Advance(d.step)
+		err = snd.Put(item)
+		if err != nil {
+			d.errs = append(d.errs, err)
+		}
+	}
+}
+
+// flakyQueue fails the given number of puts with ErrQueueFull
+type flakyQueue struct {
+	Queue
+	failures int
+	attempts int
+}
+
+func (q *flakyQueue) Put(item interface{}) error {
+	q.attempts++
+	if q.failures > 0 {
+		q.failures--
+		return ErrQueueFull
+	}
+	return q.Queue.Put(item)
+}
+
+func TestChainDigestersTimingAndRetry(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	core := &advancingDigester{runner: runner{name: "core"}, clock: c, step: 20 * time.Millisecond}
+	var observed []time.Duration
+	d := ChainDigesters(core, Timing(func(d time.Duration) { observed = append(observed, d) }), Retry(3, 0))
+	if d.Name() != "core" {
+		t.Errorf("expected the name of the core digester, got %s", d.Name())
+	}
+
+	rcv := NewBaseQueue("rcv", 0)
+	rcv.Put("a")
+	rcv.Put("b")
+	rcv.Close()
+	snd := &flakyQueue{Queue: NewBaseQueue("snd", 0), failures: 2}
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	d.Digest(rcv, snd, mc)
+
+	if len(core.errs) != 0 || snd.Len() != 2 || snd.attempts != 4 {
+		t.Errorf("expected both items sent in 4 attempts, got %d in %d, errors %v", snd.Len(), snd.attempts, core.errs)
+	}
+	// the timing wraps the queue closest to the core digester, so it observes
+	// every item once rather than every attempt
+	if len(observed) != 2 || observed[0] != 20*time.Millisecond || observed[1] != 20*time.Millisecond {
+		t.Errorf("expected 2 observations of 20ms, got %v", observed)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	core := &advancingDigester{runner: runner{name: "core"}, clock: c}
+	d := ChainDigesters(core, Retry(2, time.Second))
+
+	rcv := NewBaseQueue("rcv", 0)
+	rcv.Put("a")
+	rcv.Close()
+	snd := &flakyQueue{Queue: NewBaseQueue("snd", 0), failures: 5}
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	done := make(chan struct{})
+	go func() {
+		d.Digest(rcv, snd, mc)
+		close(done)
+	}()
+	waitFor(t, "the backoff", func() bool { return c.Waiters() == 1 })
+	c.Advance(time.Second)
+	<-done
+	if len(core.errs) != 1 || !IsQueueFull(core.errs[0]) || snd.attempts != 2 {
+		t.Errorf("expected ErrQueueFull after 2 attempts, got %v after %d", core.errs, snd.attempts)
+	}
+}
+
+func TestRetrySkipsClosed(t *testing.T) {
+	q := &retryQueue{Queue: NewBaseQueue("q", 0), attempts: 3}
+	q.Close()
+	if err := q.Put("a"); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed without retries, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package icd
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// CacheConfig configures the cache of lookup results of an EnrichDigester
+type CacheConfig struct {
+	// Key returns the cache key of an item, items with the same key share
+	// the result of one lookup. A nil Key disables the cache.
+	Key func(item interface{}) string
+	// Maximum number of results cached, the least recently used result is
+	// evicted beyond it. A Size below 1 leaves the cache unbounded.
+	Size int
+	// How long a result stays cached, 0 keeps it until it is evicted. The
+	// TTL follows the package Clock.
+	TTL time.Duration
+}
+
+// Enriched is an item sent by an EnrichDigester, merged with the result of
+// its lookup
+type Enriched struct {
+	// The item received
+	Item interface{}
+	// The result of the lookup of the item
+	Value interface{}
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// lookupCall is a lookup in progress, shared by the items with its key
+type lookupCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+type lookupCache struct {
+	config  CacheConfig
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	calls   map[string]*lookupCall
+}
+
+func newLookupCache(config CacheConfig) *lookupCache {
+	return &lookupCache{
+		config:  config,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		calls:   make(map[string]*lookupCall),
+	}
+}
+
+// get returns the cached result for key, calling lookup on a miss. Callers
+// missing the same key concurrently wait for the first one's lookup instead
+// of repeating it. Failed lookups are not cached.
+func (c *lookupCache) get(key string, lookup func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	el, ok := c.entries[key]
+	if ok {
+		entry := el.Value.(*cacheEntry)
+		if entry.expires.IsZero() || now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			return entry.value, nil
+		}
+		c.lru.Remove(el)
+		delete(c.entries, key)
+	}
+	call, ok := c.calls[key]
+	if ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	call = &lookupCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	call.value, call.err = lookup()
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	if call.err == nil {
+		c.add(key, call.value)
+	}
+	c.mu.Unlock()
+	close(call.done)
+	return call.value, call.err
+}
+
+// add caches value for key, evicting the least recently used result when
+// the cache is full, must be called with mu held
+func (c *lookupCache) add(key string, value interface{}) {
+	entry := &cacheEntry{key: key, value: value}
+	if c.config.TTL > 0 {
+		entry.expires = now().Add(c.config.TTL)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	if c.config.Size > 0 && c.lru.Len() > c.config.Size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// EnrichDigester creates a digester which looks up every item it receives,
+// e.g. the location of an IP address, and sends the item merged with the
+// result as an Enriched. At most concurrency lookups run at a time and the
+// items are sent in the order they were received, like with
+// ParallelOrderedDigester. The results are cached as configured by cache,
+// concurrent lookups of items with the same key are made only once. An item
+// whose lookup fails is dropped and the error reported through the Monitor
+// set with SetMonitor. A concurrency below 1 is raised to 1.
+func EnrichDigester(name string, lookup func(ctx context.Context, item interface{}) (interface{}, error), cache CacheConfig, concurrency int) Digester {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	c := newLookupCache(cache)
+	enrich := func(item interface{}) (interface{}, error) {
+		do := func() (interface{}, error) {
+			return lookup(context.Background(), item)
+		}
+		var value interface{}
+		var err error
+		if cache.Key == nil {
+			value, err = do()
+		} else {
+			value, err = c.get(cache.Key(item), do)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return Enriched{Item: item, Value: value}, nil
+	}
+	return &parallelOrderedDigester{
+		runner:    runner{name: name, kind: KindDigester},
+		workers:   concurrency,
+		transform: enrich,
+		op:        "lookup",
+	}
+}
@@ -0,0 +1,159 @@
+package icd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingLookup upper-cases items, counting its calls per item
+type countingLookup struct {
+	mu    sync.Mutex
+	calls map[interface{}]int
+}
+
+func (l *countingLookup) lookup(ctx context.Context, item interface{}) (interface{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.calls == nil {
+		l.calls = make(map[interface{}]int)
+	}
+	l.calls[item]++
+	if item == "bad" {
+		return nil, errors.New("no such item")
+	}
+	return strings.ToUpper(item.(string)), nil
+}
+
+func runEnrich(t *testing.T, d Digester, inputs ...interface{}) []interface{} {
+	t.Helper()
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	for _, input := range inputs {
+		rcv.Put(input)
+	}
+	rcv.Close()
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	d.Digest(rcv, snd, mc)
+	var outputs []interface{}
+	for {
+		item, err := snd.Get()
+		if err != nil {
+			return outputs
+		}
+		outputs = append(outputs, item)
+	}
+}
+
+func TestEnrichDigesterCache(t *testing.T) {
+	l := &countingLookup{}
+	d := EnrichDigester("enrich", l.lookup, CacheConfig{Key: stringID}, 2)
+	outputs := runEnrich(t, d, "a", "b", "a", "a", "b")
+
+	expected := []string{"a", "b", "a", "a", "b"}
+	if len(outputs) != len(expected) {
+		t.Fatalf("expected %d outputs, got %v", len(expected), outputs)
+	}
+	for i, output := range outputs {
+		e := output.(Enriched)
+		if e.Item != expected[i] || e.Value != strings.ToUpper(expected[i]) {
+			t.Errorf("unexpected output %d %+v", i, e)
+		}
+	}
+	if l.calls["a"] != 1 || l.calls["b"] != 1 {
+		t.Errorf("expected one lookup per key, got %v", l.calls)
+	}
+}
+
+func TestLookupCacheEviction(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	l := &countingLookup{}
+	cache := newLookupCache(CacheConfig{Size: 1, TTL: time.Minute})
+	get := func(key string) {
+		cache.get(key, func() (interface{}, error) { return l.lookup(context.Background(), key) })
+	}
+
+	get("a")
+	get("a")
+	c.Advance(time.Minute)
+	get("a")
+	if l.calls["a"] != 2 {
+		t.Errorf("expected the expired result to be looked up again, got %d lookups", l.calls["a"])
+	}
+	get("b")
+	get("a")
+	if l.calls["a"] != 3 || l.calls["b"] != 1 {
+		t.Errorf("expected the least recently used result to be evicted, got %v", l.calls)
+	}
+}
+
+func TestEnrichDigesterConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	active, peak := 0, 0
+	release := make(chan struct{})
+	lookup := func(ctx context.Context, item interface{}) (interface{}, error) {
+		mu.Lock()
+		active++
+		if active > peak {
+			peak = active
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return item, nil
+	}
+	d := EnrichDigester("enrich", lookup, CacheConfig{}, 3)
+
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	for i := 0; i < 10; i++ {
+		rcv.Put(i)
+	}
+	rcv.Close()
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go d.Digest(rcv, snd, mc)
+	waitFor(t, "lookups to start", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return active == 3
+	})
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	mc.WaitGroup.Wait()
+
+	if peak != 3 {
+		t.Errorf("expected at most 3 concurrent lookups, got %d", peak)
+	}
+	if snd.Len() != 10 {
+		t.Errorf("expected every item to be sent, got %d", snd.Len())
+	}
+}
+
+func TestEnrichDigesterErrors(t *testing.T) {
+	l := &countingLookup{}
+	d := EnrichDigester("enrich", l.lookup, CacheConfig{Key: stringID}, 1)
+	m := NewMonitor(newTestMonitorControl())
+	d.(Monitored).SetMonitor(m)
+	outputs := runEnrich(t, d, "a", "bad", "bad", "b")
+
+	if len(outputs) != 2 || outputs[0].(Enriched).Item != "a" || outputs[1].(Enriched).Item != "b" {
+		t.Errorf("expected the failed items to be dropped, got %v", outputs)
+	}
+	if len(m.ErrorChan) != 2 {
+		t.Fatalf("expected 2 reported errors, got %d", len(m.ErrorChan))
+	}
+	if err := <-m.ErrorChan; err.Error() != "lookup: no such item" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if l.calls["bad"] != 2 {
+		t.Errorf("expected failed lookups not to be cached, got %d lookups", l.calls["bad"])
+	}
+}
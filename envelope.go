@@ -0,0 +1,71 @@
+package icd
+
+// Well known envelope headers
+const (
+	// HeaderID carries the unique id of the item
+	HeaderID = "id"
+	// HeaderSequence carries the global sequence number of the item
+	HeaderSequence = "sequence"
+	// HeaderTraceID carries the id of the trace the item belongs to
+	HeaderTraceID = "trace_id"
+	// HeaderEnqueued carries the time, in nanoseconds since the Unix epoch,
+	// the item was put into the latency queue it is in
+	HeaderEnqueued = "enqueued"
+	// HeaderContentType carries the media type of the payload, e.g.
+	// "application/json"
+	HeaderContentType = "content_type"
+)
+
+// Envelope wraps the payload of an item with headers describing it, e.g. its
+// sequence number or trace id
+type Envelope struct {
+	// Headers describing the payload
+	Headers map[string]string
+	// The item itself
+	Payload interface{}
+}
+
+// NewEnvelope creates an envelope without headers around payload
+func NewEnvelope(payload interface{}) *Envelope {
+	return &Envelope{
+		Headers: make(map[string]string),
+		Payload: payload,
+	}
+}
+
+// Header returns the value of the header, or "" when not set
+func (e *Envelope) Header(key string) string {
+	return e.Headers[key]
+}
+
+// SetHeader sets the value of the header
+func (e *Envelope) SetHeader(key string, value string) {
+	if e.Headers == nil {
+		e.Headers = make(map[string]string)
+	}
+	e.Headers[key] = value
+}
+
+// TraceID returns the trace id carried by item, or "" when item is not an
+// *Envelope or carries none
+func TraceID(item interface{}) string {
+	env, ok := item.(*Envelope)
+	if !ok || env == nil {
+		return ""
+	}
+	return env.Header(HeaderTraceID)
+}
+
+// SetContentType sets the media type of the payload of env
+func SetContentType(env *Envelope, ct string) {
+	env.SetHeader(HeaderContentType, ct)
+}
+
+// GetContentType returns the media type of the payload of env, or "" when
+// env is nil or carries none
+func GetContentType(env *Envelope) string {
+	if env == nil {
+		return ""
+	}
+	return env.Header(HeaderContentType)
+}
@@ -0,0 +1,36 @@
+package icd
+
+import (
+	"testing"
+)
+
+func TestEnvelopeHeaders(t *testing.T) {
+	env := &Envelope{Payload: "payload"}
+	if env.Header(HeaderTraceID) != "" {
+		t.Error("expected an unset header to be empty")
+	}
+	env.SetHeader(HeaderTraceID, "abc")
+	if env.Header(HeaderTraceID) != "abc" || TraceID(env) != "abc" {
+		t.Errorf("expected trace id abc, got %q", TraceID(env))
+	}
+}
+
+func TestTraceIDWithoutEnvelope(t *testing.T) {
+	if TraceID("payload") != "" {
+		t.Error("expected no trace id for a plain item")
+	}
+	if TraceID((*Envelope)(nil)) != "" {
+		t.Error("expected no trace id for a nil envelope")
+	}
+}
+
+func TestContentType(t *testing.T) {
+	env := &Envelope{}
+	if GetContentType(env) != "" || GetContentType(nil) != "" {
+		t.Error("expected no content type")
+	}
+	SetContentType(env, "application/json")
+	if GetContentType(env) != "application/json" || env.Header(HeaderContentType) != "application/json" {
+		t.Errorf("unexpected content type %q", GetContentType(env))
+	}
+}
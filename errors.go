@@ -0,0 +1,72 @@
+package icd
+
+import (
+	"errors"
+)
+
+var (
+	// ErrQueueFull is returned when an item cannot be put into a queue
+	// because it is at capacity
+	ErrQueueFull = errors.New("queue is full")
+
+	// ErrQueueEmpty is returned when an item cannot be gotten from a queue
+	// because it has no items
+	ErrQueueEmpty = errors.New("queue is empty")
+
+	// ErrQueueClosed is returned by operations on a queue which is closed
+	ErrQueueClosed = errors.New("queue is closed")
+
+	// ErrTimeout is returned when an operation does not complete in time
+	ErrTimeout = errors.New("timeout")
+
+	// ErrNilItem is returned when putting a nil item into a queue
+	ErrNilItem = errors.New("nil item")
+
+	// ErrNotSupported is returned when an optional operation is not
+	// supported by the implementation
+	ErrNotSupported = errors.New("not supported")
+
+	// ErrUnknownToken is returned when acknowledging a token which is not
+	// in flight, either because it was already acknowledged or because its
+	// visibility timeout expired and the item was redelivered
+	ErrUnknownToken = errors.New("unknown ack token")
+
+	// ErrOutOfOrder is returned when putting an item which does not follow
+	// the order a queue enforces
+	ErrOutOfOrder = errors.New("item out of order")
+)
+
+// IsQueueFull returns whether or not err is, or wraps, ErrQueueFull
+func IsQueueFull(err error) bool {
+	return errors.Is(err, ErrQueueFull)
+}
+
+// IsQueueEmpty returns whether or not err is, or wraps, ErrQueueEmpty
+func IsQueueEmpty(err error) bool {
+	return errors.Is(err, ErrQueueEmpty)
+}
+
+// IsQueueClosed returns whether or not err is, or wraps, ErrQueueClosed
+func IsQueueClosed(err error) bool {
+	return errors.Is(err, ErrQueueClosed)
+}
+
+// IsTimeout returns whether or not err is, or wraps, ErrTimeout
+func IsTimeout(err error) bool {
+	return errors.Is(err, ErrTimeout)
+}
+
+// IsNilItem returns whether or not err is, or wraps, ErrNilItem
+func IsNilItem(err error) bool {
+	return errors.Is(err, ErrNilItem)
+}
+
+// IsNotSupported returns whether or not err is, or wraps, ErrNotSupported
+func IsNotSupported(err error) bool {
+	return errors.Is(err, ErrNotSupported)
+}
+
+// IsOutOfOrder returns whether or not err is, or wraps, ErrOutOfOrder
+func IsOutOfOrder(err error) bool {
+	return errors.Is(err, ErrOutOfOrder)
+}
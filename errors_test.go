@@ -0,0 +1,59 @@
+package icd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSentinelsThroughWrapping(t *testing.T) {
+	tests := []struct {
+		err error
+		is  func(error) bool
+	}{
+		{ErrQueueFull, IsQueueFull},
+		{ErrQueueEmpty, IsQueueEmpty},
+		{ErrQueueClosed, IsQueueClosed},
+		{ErrTimeout, IsTimeout},
+		{ErrNilItem, IsNilItem},
+		{ErrNotSupported, IsNotSupported},
+		{ErrOutOfOrder, IsOutOfOrder},
+	}
+	for _, test := range tests {
+		wrapped := fmt.Errorf("outer: %w", fmt.Errorf("inner: %w", test.err))
+		if !test.is(wrapped) {
+			t.Errorf("expected %v to be detected through wrapping", test.err)
+		}
+		for _, other := range tests {
+			if other.err != test.err && other.is(wrapped) {
+				t.Errorf("%v detected as %v", test.err, other.err)
+			}
+		}
+	}
+}
+
+func TestBaseQueueSentinels(t *testing.T) {
+	q := NewBaseQueue("sentinels", 1)
+	if err := q.Put(nil); !IsNilItem(err) {
+		t.Errorf("expected ErrNilItem, got %v", err)
+	}
+	if _, err := q.TryGet(); !IsQueueEmpty(err) {
+		t.Errorf("expected ErrQueueEmpty, got %v", err)
+	}
+	q.Put(1)
+	if err := q.TryPut(2); !IsQueueFull(err) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	q.Close()
+	if err := q.Put(2); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+	if item, err := q.TryGet(); err != nil || item != 1 {
+		t.Errorf("expected remaining item after close, got %v %v", item, err)
+	}
+	if _, err := q.Get(); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+	if _, err := q.TryGet(); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+package icd
+
+import (
+	"sync"
+	"time"
+)
+
+// KeyStore is the storage for idempotency keys used by ExactlyOnceQueue. It
+// is pluggable so that the record of accepted and processed keys can be made
+// durable across restarts when required.
+type KeyStore interface {
+	// Add records key as accepted, it returns false if the key was already
+	// present
+	Add(key string) (bool, error)
+
+	// Remove forgets an accepted key which was not processed, e.g. because
+	// the item could not be enqueued
+	Remove(key string) error
+
+	// Commit records key as processed
+	Commit(key string) error
+
+	// Committed returns whether or not key has been processed
+	Committed(key string) (bool, error)
+}
+
+type memoryKeyStore struct {
+	mu        sync.Mutex
+	accepted  map[string]struct{}
+	committed map[string]struct{}
+}
+
+// NewMemoryKeyStore creates a non-durable KeyStore held in memory. Keys are
+// never forgotten so memory grows with the number of distinct keys.
+func NewMemoryKeyStore() KeyStore {
+	return &memoryKeyStore{
+		accepted:  make(map[string]struct{}),
+		committed: make(map[string]struct{}),
+	}
+}
+
+func (s *memoryKeyStore) Add(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.accepted[key]
+	if ok {
+		return false, nil
+	}
+	s.accepted[key] = struct{}{}
+	return true, nil
+}
+
+func (s *memoryKeyStore) Remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.accepted, key)
+	return nil
+}
+
+func (s *memoryKeyStore) Commit(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.committed[key] = struct{}{}
+	return nil
+}
+
+func (s *memoryKeyStore) Committed(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.committed[key]
+	return ok, nil
+}
+
+// ExactlyOnceQueue combines idempotency keys with ack tracking so that each
+// item is delivered and processed effectively once:
+//
+//   - Put drops items whose key has already been accepted
+//   - GetAck hands items out until they are acknowledged, items which are not
+//     acknowledged within the visibility timeout are redelivered
+//   - Ack commits the item's key, committed items are never delivered again
+//
+// The guarantee is effectively-once, not distributed consensus. An item whose
+// processing outlives the visibility timeout is redelivered and may be
+// processed twice; only the first Ack commits it. Durability is only as
+// strong as the KeyStore provided.
+type ExactlyOnceQueue struct {
+	*InflightQueue
+	key        func(interface{}) string
+	store      KeyStore
+	mu         sync.Mutex
+	tokens     map[AckToken]string
+	latest     map[string]AckToken
+	duplicates uint64
+}
+
+// NewExactlyOnceQueue wraps q, identifying items through key and recording
+// keys in store. Items must be acknowledged within timeout of being handed
+// out through GetAck.
+func NewExactlyOnceQueue(q Queue, key func(interface{}) string, store KeyStore, timeout time.Duration) *ExactlyOnceQueue {
+	return &ExactlyOnceQueue{
+		InflightQueue: NewInflightQueue(q, timeout),
+		key:           key,
+		store:         store,
+		tokens:        make(map[AckToken]string),
+		latest:        make(map[string]AckToken),
+	}
+}
+
+// Put puts an item into the queue unless an item with the same key has
+// already been accepted, in which case it is dropped. When the wrapped queue
+// rejects the item its key is removed again so the item can be retried.
+func (q *ExactlyOnceQueue) Put(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	key := q.key(item)
+	added, err := q.store.Add(key)
+	if err != nil {
+		return err
+	}
+	if !added {
+		q.mu.Lock()
+		q.duplicates++
+		q.mu.Unlock()
+		return nil
+	}
+	err = q.InflightQueue.Put(item)
+	if err != nil {
+		q.store.Remove(key)
+		return err
+	}
+	return nil
+}
+
+// Get gets the next item from the queue and commits it immediately
+func (q *ExactlyOnceQueue) Get() (interface{}, error) {
+	item, token, err := q.GetAck()
+	if err != nil {
+		return nil, err
+	}
+	err = q.Ack(token)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// GetAck gets the next uncommitted item from the queue along with the token
+// which must be passed to Ack once the item has been processed
+func (q *ExactlyOnceQueue) GetAck() (interface{}, AckToken, error) {
+	for {
+		item, token, err := q.InflightQueue.GetAck()
+		if err != nil {
+			return nil, 0, err
+		}
+		key := q.key(item)
+		committed, err := q.store.Committed(key)
+		if err != nil {
+			q.InflightQueue.Nack(token)
+			return nil, 0, err
+		}
+		if committed {
+			q.InflightQueue.Ack(token)
+			continue
+		}
+
+		q.mu.Lock()
+		prev, ok := q.latest[key]
+		if ok {
+			delete(q.tokens, prev)
+		}
+		q.latest[key] = token
+		q.tokens[token] = key
+		q.mu.Unlock()
+		return item, token, nil
+	}
+}
+
+// Ack commits the item identified by token. A token superseded by a
+// redelivery of the same item returns ErrUnknownToken.
+func (q *ExactlyOnceQueue) Ack(token AckToken) error {
+	q.mu.Lock()
+	key, ok := q.tokens[token]
+	if ok {
+		delete(q.tokens, token)
+		delete(q.latest, key)
+	}
+	q.mu.Unlock()
+	if !ok {
+		return ErrUnknownToken
+	}
+
+	err := q.store.Commit(key)
+	if err != nil {
+		return err
+	}
+	err = q.InflightQueue.Ack(token)
+	if err == ErrUnknownToken {
+		// the visibility timeout expired after the item was processed, the
+		// commit above prevents the pending redelivery from being handed out
+		return nil
+	}
+	return err
+}
+
+// Nack negatively acknowledges the item identified by token so that it is
+// redelivered immediately
+func (q *ExactlyOnceQueue) Nack(token AckToken) error {
+	q.mu.Lock()
+	key, ok := q.tokens[token]
+	if ok {
+		delete(q.tokens, token)
+		delete(q.latest, key)
+	}
+	q.mu.Unlock()
+	return q.InflightQueue.Nack(token)
+}
+
+// AckBatch commits the items identified by tokens, like Ack for every token
+// but acknowledging them under a single lock. Unknown tokens, including ones
+// superseded by a redelivery, are returned in a *BatchAckError once the
+// others are committed. When the KeyStore fails to commit a key the first
+// such error is returned instead and the item is redelivered.
+func (q *ExactlyOnceQueue) AckBatch(tokens []AckToken) error {
+	var unknown []AckToken
+	keys := make(map[AckToken]string, len(tokens))
+	q.mu.Lock()
+	for _, token := range tokens {
+		key, ok := q.tokens[token]
+		if !ok {
+			unknown = append(unknown, token)
+			continue
+		}
+		delete(q.tokens, token)
+		delete(q.latest, key)
+		keys[token] = key
+	}
+	q.mu.Unlock()
+
+	var committed []AckToken
+	var commitErr error
+	for _, token := range tokens {
+		key, ok := keys[token]
+		if !ok {
+			continue
+		}
+		err := q.store.Commit(key)
+		if err != nil {
+			if commitErr == nil {
+				commitErr = err
+			}
+			continue
+		}
+		committed = append(committed, token)
+	}
+	// tokens whose visibility timeout expired after the item was processed
+	// are unknown to the InflightQueue, the commits prevent the redelivery
+	q.InflightQueue.AckBatch(committed)
+	if commitErr != nil {
+		return commitErr
+	}
+	return batchAckError(unknown)
+}
+
+// NackBatch negatively acknowledges the items identified by tokens so that
+// they are redelivered immediately, see InflightQueue.NackBatch
+func (q *ExactlyOnceQueue) NackBatch(tokens []AckToken) error {
+	q.mu.Lock()
+	for _, token := range tokens {
+		key, ok := q.tokens[token]
+		if ok {
+			delete(q.tokens, token)
+			delete(q.latest, key)
+		}
+	}
+	q.mu.Unlock()
+	return q.InflightQueue.NackBatch(tokens)
+}
+
+// Duplicates returns the number of items dropped by Put because their key had
+// already been accepted
+func (q *ExactlyOnceQueue) Duplicates() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.duplicates
+}
+
+// Clear clears the queue along with all in flight items, accepted keys are
+// retained
+func (q *ExactlyOnceQueue) Clear() {
+	q.mu.Lock()
+	q.tokens = make(map[AckToken]string)
+	q.latest = make(map[string]AckToken)
+	q.mu.Unlock()
+	q.InflightQueue.Clear()
+}
+
+// Reset resets the queue, dropping all in flight items, accepted keys are
+// retained
+func (q *ExactlyOnceQueue) Reset() {
+	q.mu.Lock()
+	q.tokens = make(map[AckToken]string)
+	q.latest = make(map[string]AckToken)
+	q.mu.Unlock()
+	q.InflightQueue.Reset()
+}
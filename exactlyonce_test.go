@@ -0,0 +1,141 @@
+package icd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestExactlyOnceQueue(inner Queue) *ExactlyOnceQueue {
+	key := func(item interface{}) string { return fmt.Sprint(item) }
+	return NewExactlyOnceQueue(inner, key, NewMemoryKeyStore(), time.Second)
+}
+
+func TestExactlyOnceQueueDuplicateSubmission(t *testing.T) {
+	q := newTestExactlyOnceQueue(NewBaseQueue("inner", 0))
+	q.Put("a")
+	q.Put("a")
+	q.Put("b")
+	if q.Len() != 2 {
+		t.Errorf("expected 2 items, got %d", q.Len())
+	}
+	if q.Duplicates() != 1 {
+		t.Errorf("expected 1 duplicate, got %d", q.Duplicates())
+	}
+}
+
+func TestExactlyOnceQueueRedeliveryAfterNoAck(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := newTestExactlyOnceQueue(NewBaseQueue("inner", 0))
+	q.Put("a")
+	q.Put("b")
+
+	item, stale, _ := q.GetAck()
+	if item != "a" {
+		t.Fatalf("expected a, got %v", item)
+	}
+	c.Advance(2 * time.Second)
+
+	item, token, _ := q.GetAck()
+	if item != "a" {
+		t.Fatalf("expected a to be redelivered, got %v", item)
+	}
+	if err := q.Ack(stale); err != ErrUnknownToken {
+		t.Errorf("expected superseded token to be unknown, got %v", err)
+	}
+	if err := q.Ack(token); err != nil {
+		t.Errorf("unexpected ack error: %v", err)
+	}
+}
+
+func TestExactlyOnceQueueSingleProcessing(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := newTestExactlyOnceQueue(NewBaseQueue("inner", 0))
+	q.Put("a")
+	q.Put("b")
+
+	_, token, _ := q.GetAck()
+	c.Advance(2 * time.Second)
+	// the late ack of an expired delivery still commits the key
+	if err := q.Ack(token); err != nil {
+		t.Fatalf("unexpected ack error: %v", err)
+	}
+
+	// the pending redelivery of a is committed so it is skipped
+	item, _ := q.Get()
+	if item != "b" {
+		t.Errorf("expected b, got %v", item)
+	}
+	q.Put("a")
+	if q.Len() != 0 {
+		t.Errorf("expected committed a to be rejected, got len %d", q.Len())
+	}
+}
+
+func TestExactlyOnceQueueAckBatch(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := newTestExactlyOnceQueue(NewBaseQueue("inner", 0))
+	q.Put("a")
+	q.Put("b")
+	q.Put("c")
+
+	_, stale, _ := q.GetAck()
+	c.Advance(2 * time.Second)
+	_, a, _ := q.GetAck()
+	_, b, _ := q.GetAck()
+	err := q.AckBatch([]AckToken{stale, a, b})
+	if !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("expected the superseded token to be unknown, got %v", err)
+	}
+
+	_, token, _ := q.GetAck()
+	if err := q.NackBatch([]AckToken{token}); err != nil {
+		t.Fatalf("unexpected nack error: %v", err)
+	}
+	item, _ := q.Get()
+	if item != "c" {
+		t.Errorf("expected nacked c to be redelivered, got %v", item)
+	}
+	q.Put("a")
+	q.Put("b")
+	if q.Len() != 0 {
+		t.Errorf("expected the acked keys to be committed, got len %d", q.Len())
+	}
+}
+
+func TestExactlyOnceQueueRetryAfterFailedPut(t *testing.T) {
+	inner := NewBaseQueue("inner", 0)
+	q := newTestExactlyOnceQueue(inner)
+	inner.Close()
+	if err := q.Put("a"); !IsQueueClosed(err) {
+		t.Fatalf("expected ErrQueueClosed, got %v", err)
+	}
+
+	inner.Reset()
+	if err := q.Put("a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q.Len() != 1 || q.Duplicates() != 0 {
+		t.Errorf("expected retried item to be enqueued, got len %d duplicates %d", q.Len(), q.Duplicates())
+	}
+}
+
+func TestExactlyOnceQueueInflightStats(t *testing.T) {
+	useFakeClock()
+	defer SetClock(nil)
+	q := newTestExactlyOnceQueue(NewBaseQueue("inner", 0))
+	q.Put("a")
+	q.Put("b")
+	_, token, _ := q.GetAck()
+	if stats := q.Stats(); stats.Inflight != 1 || stats.Len != 1 {
+		t.Errorf("expected 1 in flight and 1 queued, got %+v", stats)
+	}
+	q.Ack(token)
+	if stats := q.Stats(); stats.Inflight != 0 {
+		t.Errorf("expected nothing in flight after the ack, got %d", stats.Inflight)
+	}
+}
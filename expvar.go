@@ -0,0 +1,15 @@
+package icd
+
+import (
+	"expvar"
+)
+
+// PublishExpvar publishes the statistics of q as the expvar name, served as
+// JSON on /debug/vars by the expvar handler. The statistics are read on
+// every request, from Stats when q is a StatsReporter and from Len, Cap and
+// Closed otherwise. Like expvar.Publish it panics when name is taken.
+func PublishExpvar(name string, q Queue) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return statsOf(q)
+	}))
+}
@@ -0,0 +1,54 @@
+package icd
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// expvars numbers the published variables, expvar names can be published
+// only once per process
+var expvars int32
+
+func expvarName(name string) string {
+	return fmt.Sprintf("icd_test_%s_%d", name, atomic.AddInt32(&expvars, 1))
+}
+
+func TestPublishExpvar(t *testing.T) {
+	q := NewBaseQueue("published", 10)
+	name := expvarName("published")
+	PublishExpvar(name, q)
+	read := func() QueueStats {
+		var stats QueueStats
+		err := json.Unmarshal([]byte(expvar.Get(name).String()), &stats)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return stats
+	}
+	if s := read(); s.Name != "published" || s.Len != 0 || s.Cap != 10 {
+		t.Errorf("unexpected statistics %+v", s)
+	}
+
+	q.Put("a")
+	q.Put("b")
+	q.Get()
+	q.Close()
+	if s := read(); s.Len != 1 || s.Puts != 2 || s.Gets != 1 || !s.Closed {
+		t.Errorf("expected the current statistics, got %+v", s)
+	}
+}
+
+func TestPublishExpvarWithoutStats(t *testing.T) {
+	q := struct{ Queue }{NewBaseQueue("plain", 0)}
+	name := expvarName("plain")
+	PublishExpvar(name, q)
+	q.Put("a")
+	var stats QueueStats
+	json.Unmarshal([]byte(expvar.Get(name).String()), &stats)
+	if stats.Name != "plain" || stats.Len != 1 || stats.Cap != -1 {
+		t.Errorf("unexpected statistics %+v", stats)
+	}
+}
@@ -0,0 +1,69 @@
+package icd
+
+import (
+	"sync"
+	"time"
+)
+
+// FailoverInterval is how often a Failover checks the health of the primary
+var FailoverInterval = time.Second
+
+// Failover runs a primary plugin, keeping a standby instance idle until the
+// primary reports itself unhealthy through HealthReporter and then promoting
+// the standby. A primary which does not implement HealthReporter is never
+// failed over. Failover is one-shot: once promoted the standby stays active.
+type Failover struct {
+	primary  interface{}
+	standby  interface{}
+	mu       sync.Mutex
+	promoted bool
+}
+
+// NewFailover creates a failover of primary to standby, primary is active
+func NewFailover(primary interface{}, standby interface{}) *Failover {
+	return &Failover{
+		primary: primary,
+		standby: standby,
+	}
+}
+
+// Active returns the active instance
+func (f *Failover) Active() interface{} {
+	if f.Promoted() {
+		return f.standby
+	}
+	return f.primary
+}
+
+// Promoted returns whether or not the standby has been promoted
+func (f *Failover) Promoted() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.promoted
+}
+
+// Run starts the primary by calling start, checks its health every
+// FailoverInterval and, once it is unhealthy, promotes the standby and
+// starts it by calling start. start must not block, e.g. it starts the
+// plugin in a goroutine tracked by a Flow, and is responsible for wiring the
+// instance to the queues. Run returns after promoting the standby or once
+// done is closed. The interval follows the package Clock.
+func (f *Failover) Run(start func(plugin interface{}), done <-chan struct{}) {
+	start(f.primary)
+	hr, ok := f.primary.(HealthReporter)
+	for {
+		select {
+		case <-after(FailoverInterval):
+		case <-done:
+			return
+		}
+		if !ok || hr.Health().Status != HealthUnhealthy {
+			continue
+		}
+		f.mu.Lock()
+		f.promoted = true
+		f.mu.Unlock()
+		start(f.standby)
+		return
+	}
+}
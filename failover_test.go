@@ -0,0 +1,130 @@
+package icd
+
+import (
+	"sync"
+	"testing"
+)
+
+// healthPlugin processes items from a queue until it is unhealthy
+type healthPlugin struct {
+	name      string
+	mu        sync.Mutex
+	status    HealthStatus
+	processed []interface{}
+}
+
+func (p *healthPlugin) Health() Health {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Health{Status: p.status}
+}
+
+func (p *healthPlugin) setStatus(status HealthStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = status
+}
+
+func (p *healthPlugin) run(q Queue) {
+	for p.Health().Status != HealthUnhealthy {
+		item, err := q.Get()
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		p.processed = append(p.processed, item)
+		p.mu.Unlock()
+	}
+}
+
+func (p *healthPlugin) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.processed)
+}
+
+func TestFailoverPromotesStandby(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewBaseQueue("items", 0)
+	defer q.Close()
+	primary := &healthPlugin{name: "primary"}
+	standby := &healthPlugin{name: "standby"}
+	f := NewFailover(primary, standby)
+
+	var wg sync.WaitGroup
+	start := func(plugin interface{}) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			plugin.(*healthPlugin).run(q)
+		}()
+	}
+	done := make(chan struct{})
+	ran := make(chan struct{})
+	go func() {
+		defer close(ran)
+		f.Run(start, done)
+	}()
+
+	q.Put(1)
+	waitFor(t, "the primary to process", func() bool { return primary.count() == 1 })
+	waitFor(t, "the health check", func() bool { return c.Waiters() == 1 })
+	c.Advance(FailoverInterval)
+	waitFor(t, "the health check", func() bool { return c.Waiters() == 1 })
+	if f.Promoted() || f.Active() != primary {
+		t.Fatal("expected the healthy primary to stay active")
+	}
+
+	primary.setStatus(HealthUnhealthy)
+	c.Advance(FailoverInterval)
+	<-ran
+	if !f.Promoted() || f.Active() != standby {
+		t.Fatal("expected the standby to be promoted")
+	}
+
+	// the primary stops after its current get, the standby takes over
+	q.Put(2)
+	q.Put(3)
+	waitFor(t, "the standby to process", func() bool { return primary.count()+standby.count() == 3 })
+	if standby.count() == 0 {
+		t.Error("expected the standby to process items")
+	}
+	q.Close()
+	wg.Wait()
+	close(done)
+}
+
+func TestFailoverWithoutHealth(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	started := []interface{}{}
+	f := NewFailover("primary", "standby")
+	done := make(chan struct{})
+	ran := make(chan struct{})
+	go func() {
+		defer close(ran)
+		f.Run(func(plugin interface{}) { started = append(started, plugin) }, done)
+	}()
+	waitFor(t, "the health check", func() bool { return c.Waiters() == 1 })
+	c.Advance(FailoverInterval)
+	waitFor(t, "the health check", func() bool { return c.Waiters() == 1 })
+	close(done)
+	<-ran
+	if f.Promoted() || len(started) != 1 || started[0] != "primary" {
+		t.Errorf("expected a primary without health never to fail over, started %v", started)
+	}
+}
+
+func TestFailoverPromotedIsTracked(t *testing.T) {
+	// the same instance as primary and standby, and instances which cannot
+	// be compared, are not taken for promoted
+	p := &healthPlugin{name: "both"}
+	if f := NewFailover(p, p); f.Promoted() {
+		t.Error("expected a shared instance not to count as promoted")
+	}
+	f := NewFailover([]string{"primary"}, []string{"standby"})
+	if f.Promoted() || f.Active().([]string)[0] != "primary" {
+		t.Errorf("expected the primary to be active, got %v", f.Active())
+	}
+}
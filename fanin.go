@@ -0,0 +1,39 @@
+package icd
+
+import (
+	"sync"
+)
+
+// fanIn gets the items of every queue of rcv, each in its own goroutine, and
+// passes them on through items. closed is closed once every queue is closed
+// and drained. Once stop is closed the getters pass the item they hold to
+// leftover and return; getters blocked in Get do so when they get their next
+// item, leftover must therefore be safe for concurrent use.
+func fanIn(rcv []Queue, stop <-chan struct{}, leftover func(item interface{})) (<-chan interface{}, <-chan struct{}) {
+	items := make(chan interface{})
+	closed := make(chan struct{})
+	var getters sync.WaitGroup
+	for _, q := range rcv {
+		getters.Add(1)
+		go func(q Queue) {
+			defer getters.Done()
+			for {
+				item, err := q.Get()
+				if err != nil {
+					return
+				}
+				select {
+				case items <- item:
+				case <-stop:
+					leftover(item)
+					return
+				}
+			}
+		}(q)
+	}
+	go func() {
+		getters.Wait()
+		close(closed)
+	}()
+	return items, closed
+}
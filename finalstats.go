@@ -0,0 +1,77 @@
+package icd
+
+import (
+	"sync"
+)
+
+// closeHook is the link between a queue and one of its running monitors,
+// closing is closed when the queue closes and the monitor closes flushed
+// once it sent the final statistics, or gone when it stops
+type closeHook struct {
+	closing chan struct{}
+	flushed chan struct{}
+	gone    chan struct{}
+}
+
+// closeHooks lets Close wait for the monitors of a queue to send statistics
+// reflecting the closed queue. The zero value is ready to use.
+type closeHooks struct {
+	mu    sync.Mutex
+	hooks map[*closeHook]struct{}
+}
+
+// attach registers a running monitor
+func (h *closeHooks) attach() *closeHook {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.hooks == nil {
+		h.hooks = make(map[*closeHook]struct{})
+	}
+	hook := &closeHook{
+		closing: make(chan struct{}),
+		flushed: make(chan struct{}),
+		gone:    make(chan struct{}),
+	}
+	h.hooks[hook] = struct{}{}
+	return hook
+}
+
+// detach unregisters a monitor which stops
+func (h *closeHooks) detach(hook *closeHook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.hooks, hook)
+	close(hook.gone)
+}
+
+// fire signals every attached monitor that the queue closed and waits until
+// each sent its statistics or stopped. The hooks are spent, monitors attach
+// again to see the next close.
+func (h *closeHooks) fire() {
+	h.mu.Lock()
+	hooks := h.hooks
+	h.hooks = nil
+	h.mu.Unlock()
+	for hook := range hooks {
+		close(hook.closing)
+	}
+	for hook := range hooks {
+		select {
+		case <-hook.flushed:
+		case <-hook.gone:
+		}
+	}
+}
+
+// flushClosed sends stats as the statistics of the closed queue, dropping
+// them like the periodic statistics when the stats channel is full, and
+// re-attaches the monitor
+func (h *closeHooks) flushClosed(hook *closeHook, mc *MonitorControl, stats QueueStats) *closeHook {
+	select {
+	case mc.StatsChan <- stats:
+	default:
+	}
+	next := h.attach()
+	close(hook.flushed)
+	return next
+}
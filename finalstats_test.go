@@ -0,0 +1,74 @@
+package icd
+
+import (
+	"testing"
+)
+
+type closeMonitored interface {
+	Queue
+	Stats() QueueStats
+}
+
+func testFinalStatsOnClose(t *testing.T, q closeMonitored) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go q.Monitor(mc)
+	waitFor(t, "the monitor to start", func() bool { return c.Waiters() == 1 })
+
+	q.Put(1)
+	q.Put(2)
+	q.Get()
+	q.Close()
+	// Close returned, so the snapshot is already sent
+	if len(mc.StatsChan) != 1 {
+		t.Fatalf("expected one snapshot on close, got %d", len(mc.StatsChan))
+	}
+	stats := (<-mc.StatsChan).(QueueStats)
+	if !stats.Closed || stats.Puts != 2 || stats.Gets != 1 || stats.Len != 1 {
+		t.Errorf("expected the end state, got %+v", stats)
+	}
+
+	// closing again sends nothing
+	q.Close()
+	if len(mc.StatsChan) != 0 {
+		t.Error("expected no snapshot on a second close")
+	}
+
+	// the monitor sees the next close after a reset
+	q.Reset()
+	q.Close()
+	if len(mc.StatsChan) != 1 {
+		t.Errorf("expected a snapshot on close after reset, got %d", len(mc.StatsChan))
+	}
+
+	close(mc.DoneChan)
+	mc.WaitGroup.Wait()
+	final := (<-mc.FinalStatsChan).(QueueStats)
+	if !final.Closed {
+		t.Errorf("unexpected final stats %+v", final)
+	}
+	// without a running monitor Close does not wait
+	q.Reset()
+	q.Close()
+}
+
+func TestBaseQueueFinalStatsOnClose(t *testing.T) {
+	testFinalStatsOnClose(t, NewBaseQueue("base", 10))
+}
+
+func TestPriorityQueueFinalStatsOnClose(t *testing.T) {
+	testFinalStatsOnClose(t, NewPriorityQueue("priority", 10, intPriority))
+}
+
+func TestCloseDoesNotBlockOnFullStats(t *testing.T) {
+	q := NewBaseQueue("base", 10)
+	mc := newTestMonitorControl()
+	mc.StatsChan = make(chan interface{})
+	mc.WaitGroup.Add(1)
+	go q.Monitor(mc)
+	q.Close()
+	close(mc.DoneChan)
+	mc.WaitGroup.Wait()
+}
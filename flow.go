@@ -0,0 +1,112 @@
+package icd
+
+import (
+	"context"
+	"runtime/pprof"
+	"sync"
+)
+
+// Flow contains what is needed to control the flow of reservoird threads
+type Flow struct {
+	// The channel to receive the done message and initiate a graceful shutdown
+	DoneChan chan struct{}
+	// Reservoird uses this variable to wait for all threads to stop before
+	// exiting
+	WaitGroup *sync.WaitGroup
+
+	mu       sync.Mutex
+	cleanups []func()
+	shutdown sync.Once
+	values   sync.Map
+}
+
+// NewFlow creates a flow sharing the done channel and wait group of mc
+func NewFlow(mc *MonitorControl) *Flow {
+	return &Flow{
+		DoneChan:  mc.DoneChan,
+		WaitGroup: mc.WaitGroup,
+	}
+}
+
+// Go runs fn in a new goroutine tracked by the flow's WaitGroup. The
+// goroutine carries the pprof labels "plugin" and "kind" so that profiles
+// attribute its work to the plugin which spawned it. fn is handed a context
+// carrying the labels, goroutines it spawns with pprof.Do inherit them.
+func (f *Flow) Go(name string, kind Kind, fn func(ctx context.Context)) {
+	if f.WaitGroup != nil {
+		f.WaitGroup.Add(1)
+	}
+	go func() {
+		if f.WaitGroup != nil {
+			defer f.WaitGroup.Done()
+		}
+		labels := pprof.Labels("plugin", name, "kind", string(kind))
+		pprof.Do(context.Background(), labels, fn)
+	}()
+}
+
+// Shutdown closes DoneChan, initiating a graceful shutdown of the threads of
+// the flow. Unlike closing DoneChan directly it is safe to call more than
+// once.
+func (f *Flow) Shutdown() {
+	f.shutdown.Do(func() {
+		if f.DoneChan != nil {
+			close(f.DoneChan)
+		}
+	})
+}
+
+// WithValue sets the flow-scoped value of key to val, e.g. a tenant id which
+// reservoird injects for every plugin of the flow to read with Value. A nil
+// val removes the value. Like context keys, key should be of a type defined
+// by the package setting it to avoid collisions.
+func (f *Flow) WithValue(key interface{}, val interface{}) {
+	if val == nil {
+		f.values.Delete(key)
+		return
+	}
+	f.values.Store(key, val)
+}
+
+// Value returns the flow-scoped value of key, nil when it is not set
+func (f *Flow) Value(key interface{}) interface{} {
+	val, _ := f.values.Load(key)
+	return val
+}
+
+// Defer registers fn to be run when the flow shuts down, see Wait. Cleanups
+// run in the reverse order of their registration.
+func (f *Flow) Defer(fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cleanups = append(f.cleanups, fn)
+}
+
+// Wait blocks until the WaitGroup drains and then runs the cleanups
+// registered with Defer, last registered first. Reservoird calls Wait after
+// sending the done message. A panicking cleanup is recovered and logged so
+// the remaining cleanups still run. Each cleanup runs at most once.
+func (f *Flow) Wait() {
+	if f.WaitGroup != nil {
+		f.WaitGroup.Wait()
+	}
+
+	f.mu.Lock()
+	cleanups := f.cleanups
+	f.cleanups = nil
+	f.mu.Unlock()
+
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		runCleanup(cleanups[i])
+	}
+}
+
+func runCleanup(fn func()) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			logf("warning: recovered panic in flow cleanup: %v", r)
+		}
+	}()
+	fn()
+}
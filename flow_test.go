@@ -0,0 +1,133 @@
+package icd
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"sync"
+	"testing"
+)
+
+func TestFlowGoLabels(t *testing.T) {
+	f := &Flow{WaitGroup: &sync.WaitGroup{}}
+	labels := map[string]string{}
+	f.Go("stdin", KindIngester, func(ctx context.Context) {
+		pprof.ForLabels(ctx, func(key, value string) bool {
+			labels[key] = value
+			return true
+		})
+	})
+	f.WaitGroup.Wait()
+
+	if labels["plugin"] != "stdin" {
+		t.Errorf("expected plugin label stdin, got %q", labels["plugin"])
+	}
+	if labels["kind"] != "ingester" {
+		t.Errorf("expected kind label ingester, got %q", labels["kind"])
+	}
+}
+
+func TestFlowDeferLIFO(t *testing.T) {
+	f := &Flow{WaitGroup: &sync.WaitGroup{}}
+	order := []int{}
+	f.Defer(func() { order = append(order, 1) })
+	f.Defer(func() { order = append(order, 2) })
+	f.Defer(func() { order = append(order, 3) })
+	f.Wait()
+
+	if len(order) != 3 || order[0] != 3 || order[1] != 2 || order[2] != 1 {
+		t.Errorf("expected cleanups in LIFO order, got %v", order)
+	}
+	f.Wait()
+	if len(order) != 3 {
+		t.Errorf("expected cleanups to run once, got %v", order)
+	}
+}
+
+func TestFlowDeferPanicIsolation(t *testing.T) {
+	f := &Flow{WaitGroup: &sync.WaitGroup{}}
+	ran := []int{}
+	f.Defer(func() { ran = append(ran, 1) })
+	f.Defer(func() { panic("cleanup failed") })
+	f.Defer(func() { ran = append(ran, 3) })
+	f.Wait()
+
+	if len(ran) != 2 || ran[0] != 3 || ran[1] != 1 {
+		t.Errorf("expected cleanups around the panic to run, got %v", ran)
+	}
+}
+
+func TestFlowWaitDrainsWaitGroup(t *testing.T) {
+	f := &Flow{WaitGroup: &sync.WaitGroup{}}
+	release := make(chan struct{})
+	finished := false
+	f.Go("worker", KindDigester, func(context.Context) {
+		<-release
+		finished = true
+	})
+	cleaned := false
+	f.Defer(func() { cleaned = finished })
+	close(release)
+	f.Wait()
+	if !cleaned {
+		t.Error("expected cleanup to run after the goroutine finished")
+	}
+}
+
+func TestFlowShutdownOnce(t *testing.T) {
+	f := NewFlow(newTestMonitorControl())
+	f.Shutdown()
+	f.Shutdown()
+	select {
+	case <-f.DoneChan:
+	default:
+		t.Error("expected shutdown to close the done channel")
+	}
+}
+
+type flowKey string
+
+func TestFlowValue(t *testing.T) {
+	f := NewFlow(newTestMonitorControl())
+	if f.Value(flowKey("tenant")) != nil {
+		t.Error("expected no value for an unset key")
+	}
+	f.WithValue(flowKey("tenant"), "acme")
+	if val := f.Value(flowKey("tenant")); val != "acme" {
+		t.Errorf("expected tenant acme, got %v", val)
+	}
+	if f.Value("tenant") != nil {
+		t.Error("expected keys of different types not to collide")
+	}
+	f.WithValue(flowKey("tenant"), nil)
+	if f.Value(flowKey("tenant")) != nil {
+		t.Error("expected a nil value to remove the key")
+	}
+}
+
+func TestFlowValueConcurrent(t *testing.T) {
+	f := NewFlow(newTestMonitorControl())
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := flowKey(fmt.Sprintf("key-%d", i))
+			for j := 0; j < 100; j++ {
+				f.WithValue(key, j)
+				if val := f.Value(key); val != j {
+					t.Errorf("expected %s to be %d, got %v", key, j, val)
+					return
+				}
+				f.Value(flowKey("key-0"))
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 8; i++ {
+		if val := f.Value(flowKey(fmt.Sprintf("key-%d", i))); val != 99 {
+			t.Errorf("expected the last value 99, got %v", val)
+		}
+	}
+}
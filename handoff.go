@@ -0,0 +1,83 @@
+package icd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// HandoffTimeout is how long a Handoff waits for the old instance to stop
+// and release its resources
+var HandoffTimeout = 30 * time.Second
+
+// Pausable is the optional interface for plugins which can stop taking items
+// without stopping, e.g. to hand their queues over to another instance
+type Pausable interface {
+	// Pause stops the plugin from getting items from its receive queues
+	// and returns once the items it already got have been sent on
+	Pause()
+
+	// Resume lets the paused plugin get items again
+	Resume()
+}
+
+// Handoff coordinates rolling upgrades of plugins, handing the queues of a
+// running instance over to its replacement without losing the items in
+// flight
+type Handoff struct {
+	start func(plugin interface{})
+	mu    sync.Mutex
+}
+
+// NewHandoff creates a handoff which starts instances by calling start. Like
+// with Failover, start must not block, e.g. it starts the plugin in a
+// goroutine tracked by a Flow, and wires the new instance to the queues of
+// the old.
+func NewHandoff(start func(plugin interface{})) *Handoff {
+	return &Handoff{
+		start: start,
+	}
+}
+
+// Prepare hands the queues of old over to new:
+//
+//  1. old is paused, so it gets no more items and sends on those it got
+//  2. new is started on the queues of old
+//  3. old is stopped, through Stop when it is Stoppable, waited for to stop
+//     running and closed, see CloseTimeout
+//
+// old must be Pausable, otherwise Prepare returns ErrNotSupported without
+// touching either instance, and must leave its queues open when it stops
+// while paused, as they belong to new by then. Step 3 is bounded by
+// HandoffTimeout, an error wrapping ErrTimeout is returned when old does not
+// stop in time, but new runs nonetheless. Handoffs are serialized. The wait for
+// old to stop follows the package Clock.
+func (h *Handoff) Prepare(old interface{}, new interface{}) error {
+	p, ok := old.(Pausable)
+	if !ok {
+		return fmt.Errorf("handoff from %s: %w", pluginName(old), ErrNotSupported)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p.Pause()
+	h.start(new)
+
+	st, ok := old.(Stoppable)
+	if ok {
+		st.Stop()
+	}
+	deadline := now().Add(HandoffTimeout)
+	r, ok := old.(interface{ Running() bool })
+	if ok && !waitUntil(deadline, func() bool { return !r.Running() }) {
+		return fmt.Errorf("handoff from %s: still running: %w", pluginName(old), ErrTimeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deadline.Sub(now()))
+	defer cancel()
+	err := CloseTimeout(ctx, old)
+	if err != nil {
+		return fmt.Errorf("handoff from %s: %w", pluginName(old), err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package icd
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pausableDigester forwards items one at a time, polling rcv so that Pause
+// never has to interrupt a blocked Get
+type pausableDigester struct {
+	mu        sync.Mutex
+	paused    bool
+	stopped   bool
+	running   int32
+	closed    int32
+	processed int
+}
+
+func (d *pausableDigester) Name() string {
+	return "pausable"
+}
+
+func (d *pausableDigester) Running() bool {
+	return atomic.LoadInt32(&d.running) == 1
+}
+
+func (d *pausableDigester) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paused = true
+}
+
+func (d *pausableDigester) Resume() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paused = false
+}
+
+func (d *pausableDigester) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = true
+}
+
+func (d *pausableDigester) Close() error {
+	atomic.StoreInt32(&d.closed, 1)
+	return nil
+}
+
+func (d *pausableDigester) Digest(rcv Queue, snd Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	atomic.StoreInt32(&d.running, 1)
+	defer atomic.StoreInt32(&d.running, 0)
+	for d.step(rcv, snd) {
+	}
+}
+
+// step handles the next item unless paused, returns false once stopped or
+// rcv is closed and drained
+func (d *pausableDigester) step(rcv Queue, snd Queue) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		// the queues belong to the next instance
+		return false
+	}
+	if d.paused {
+		time.Sleep(time.Millisecond)
+		return true
+	}
+	item, err := rcv.(NonBlocking).TryGet()
+	if IsQueueClosed(err) {
+		snd.Close()
+		return false
+	}
+	if err != nil {
+		time.Sleep(time.Millisecond)
+		return true
+	}
+	snd.Put(item)
+	d.processed++
+	return true
+}
+
+func TestHandoffLosesNoItems(t *testing.T) {
+	const n = 1000
+	rcv := NewBaseQueue("rcv", 10)
+	snd := NewBaseQueue("snd", 0)
+	mc := newTestMonitorControl()
+	start := func(plugin interface{}) {
+		mc.WaitGroup.Add(1)
+		go plugin.(Digester).Digest(rcv, snd, mc)
+	}
+	old := &pausableDigester{}
+	next := &pausableDigester{}
+	start(old)
+
+	go func() {
+		for i := 0; i < n; i++ {
+			rcv.Put(i)
+		}
+		rcv.Close()
+	}()
+	waitFor(t, "the old instance to process items", func() bool {
+		old.mu.Lock()
+		defer old.mu.Unlock()
+		return old.processed > n/4
+	})
+	h := NewHandoff(start)
+	if err := h.Prepare(old, next); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if old.Running() || atomic.LoadInt32(&old.closed) != 1 {
+		t.Error("expected the old instance to be stopped and closed")
+	}
+	mc.WaitGroup.Wait()
+
+	for i := 0; i < n; i++ {
+		item, err := snd.Get()
+		if err != nil || item != i {
+			t.Fatalf("expected item %d, got %v %v", i, item, err)
+		}
+	}
+	if _, err := snd.Get(); !IsQueueClosed(err) {
+		t.Errorf("expected no further items, got %v", err)
+	}
+	if old.processed+next.processed != n || next.processed == 0 {
+		t.Errorf("expected the items split between the instances, got %d and %d", old.processed, next.processed)
+	}
+}
+
+func TestHandoffRequiresPausable(t *testing.T) {
+	started := false
+	h := NewHandoff(func(plugin interface{}) { started = true })
+	err := h.Prepare(WindowDigester("window", time.Second, count), &pausableDigester{})
+	if !IsNotSupported(err) || started {
+		t.Errorf("expected ErrNotSupported without starting the new instance, got %v", err)
+	}
+}
+
+func TestHandoffTimeout(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	old := &pausableDigester{running: 1}
+	h := NewHandoff(func(plugin interface{}) {})
+	result := make(chan error, 1)
+	go func() {
+		result <- h.Prepare(old, &pausableDigester{})
+	}()
+	waitFor(t, "the wait for the old instance", func() bool { return c.Waiters() == 1 })
+	for c.Waiters() > 0 {
+		c.Advance(HandoffTimeout)
+		time.Sleep(time.Millisecond)
+	}
+	if err := <-result; !IsTimeout(err) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+}
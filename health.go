@@ -0,0 +1,63 @@
+package icd
+
+import (
+	"fmt"
+)
+
+// HealthStatus is the health of a plugin
+type HealthStatus int
+
+const (
+	// HealthHealthy means the plugin works as intended
+	HealthHealthy HealthStatus = iota
+	// HealthDegraded means the plugin works, but impaired, e.g. slowed down
+	// by retries
+	HealthDegraded
+	// HealthUnhealthy means the plugin does not work
+	HealthUnhealthy
+)
+
+// String returns the name of the status
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthHealthy:
+		return "healthy"
+	case HealthDegraded:
+		return "degraded"
+	case HealthUnhealthy:
+		return "unhealthy"
+	default:
+		return fmt.Sprintf("HealthStatus(%d)", int(s))
+	}
+}
+
+// MarshalText encodes the status as its name, e.g. in JSON
+func (s HealthStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes the status from its name
+func (s *HealthStatus) UnmarshalText(text []byte) error {
+	for _, status := range []HealthStatus{HealthHealthy, HealthDegraded, HealthUnhealthy} {
+		if string(text) == status.String() {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown health status %q", text)
+}
+
+// Health is the health of a plugin at a point in time
+type Health struct {
+	// Status of the plugin
+	Status HealthStatus `json:"status"`
+	// Human readable reason for the status, optional
+	Message string `json:"message,omitempty"`
+}
+
+// HealthReporter is the optional interface for plugins which report their
+// health
+type HealthReporter interface {
+	// Health returns the current health of the plugin
+	Health() Health
+}
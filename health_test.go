@@ -0,0 +1,23 @@
+package icd
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestHealthJSON(t *testing.T) {
+	data, err := json.Marshal(Health{Status: HealthDegraded, Message: "retrying"})
+	if err != nil || string(data) != `{"status":"degraded","message":"retrying"}` {
+		t.Errorf("unexpected JSON %s %v", data, err)
+	}
+	var h Health
+	if err := json.Unmarshal(data, &h); err != nil || h.Status != HealthDegraded || h.Message != "retrying" {
+		t.Errorf("expected the health to round trip, got %+v %v", h, err)
+	}
+	if err := json.Unmarshal([]byte(`{"status":"sick"}`), &h); err == nil {
+		t.Error("expected an unknown status to fail")
+	}
+	if HealthStatus(9).String() != "HealthStatus(9)" {
+		t.Errorf("unexpected name %s", HealthStatus(9))
+	}
+}
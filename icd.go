@@ -41,14 +41,21 @@ type MonitorControl struct {
 // This plugin provides the means for communication between
 // the ingester, digester, and expeller reservoird plugin
 // types.
+//
+// Failures common to all queues are reported with the sentinel errors
+// ErrQueueFull, ErrQueueEmpty, ErrQueueClosed, ErrTimeout, ErrNilItem and
+// ErrNotSupported, optionally wrapped, so callers can distinguish them with
+// errors.Is or the IsX helpers.
 type Queue interface {
 	// Name provides the name of the queue
 	Name() string
 
-	// Put puts an item into the the queue
+	// Put puts an item into the the queue. Returns ErrNilItem when the
+	// item is nil and ErrQueueClosed when the queue is closed
 	Put(interface{}) error
 
-	// Get gets the next item from the queue
+	// Get gets the next item from the queue. Returns ErrQueueClosed when
+	// the queue is closed and no items remain
 	Get() (interface{}, error)
 
 	// Len returns the number of items in the queue
@@ -125,6 +132,54 @@ type Digester interface {
 	)
 }
 
+// DigesterErr is the interface for digesters which report why they stopped.
+// Reservoird prefers this form to Digester, see RunDigester. Digest returns
+// nil once rcv is closed and drained, and the error which stopped it
+// otherwise, so that the supervisor can act on it, e.g. restart the digester
+// or alert. A DigesterErr closes snd before returning nil and leaves it open
+// when returning an error, so a restarted digester can keep sending into it.
+type DigesterErr interface {
+	// Name provides the name of the digest plugin
+	Name() string
+
+	// Running returns whether or not digest is running
+	Running() bool
+
+	// Digest is a long running function which captures data from one queue,
+	// processes the data, then forwards the processed data through
+	// another queue for further processing.
+	Digest(
+		// The queue which data is received from
+		rcv Queue,
+		// The queue which data is forwarded through
+		snd Queue,
+	) error
+}
+
+// DigesterMulti is the interface for digesters which combine several input
+// streams, e.g. joining two streams on a key. It digests data from every queue
+// of rcv and forwards the result through snd, what each queue of rcv holds is
+// up to the digester.
+type DigesterMulti interface {
+	// Name provides the name of the digest plugin
+	Name() string
+
+	// Running returns whether or not digest is running
+	Running() bool
+
+	// DigestMulti is a long running function which captures data from the
+	// queues, processes the data, then forwards the processed data through
+	// another queue for further processing.
+	DigestMulti(
+		// The queues which data is received from
+		rcv []Queue,
+		// The queue which data is forwarded through
+		snd Queue,
+		// Provides monitor and control
+		mc *MonitorControl,
+	)
+}
+
 // Expeller is the inteface for the reservoird expeller plugin type. This
 // plugin type receives data from a queue and expels the data outside
 // of reservorid.
@@ -147,3 +202,33 @@ type Expeller interface {
 		mc *MonitorControl,
 	)
 }
+
+// ExpellerWithRequeue is the optional interface for expellers which retry
+// failed deliveries through the pipeline rather than dropping them. When an
+// expeller implements it reservoird calls ExpelWithRequeue instead of Expel.
+//
+// The retry loop works as follows: reservoird creates the requeue queue and
+// passes it both as requeue and as the last of the rcv queues, so an item put
+// into requeue is received again by the expeller like any other item. The
+// expeller
+//
+//   - puts an item it failed to deliver into requeue, instead of dropping it
+//   - bounds the retries itself, e.g. by counting attempts in an Envelope
+//     header, dropping or dead-lettering an item once it gives up on it
+//   - must not close requeue, reservoird closes it after the expeller stops
+//   - should not block on requeue while it is the only one draining it, e.g.
+//     use TryPut when the queue is NonBlocking
+type ExpellerWithRequeue interface {
+	Expeller
+
+	// ExpelWithRequeue is a long running function which captures data from
+	// the queues and expels it, putting failed items into requeue.
+	ExpelWithRequeue(
+		// The queue(s) which data is received from, the last being requeue
+		rcv []Queue,
+		// The queue which failed items are put into for a later retry
+		requeue Queue,
+		// Provides monitor and control
+		mc *MonitorControl,
+	)
+}
@@ -0,0 +1,79 @@
+package icd
+
+import (
+	"errors"
+	"testing"
+)
+
+// flakyExpeller fails the first delivery of every item and requeues it
+type flakyExpeller struct {
+	runner
+	failed    map[interface{}]bool
+	delivered []interface{}
+}
+
+func (e *flakyExpeller) Expel(rcv []Queue, mc *MonitorControl) {
+	e.ExpelWithRequeue(rcv, nil, mc)
+}
+
+func (e *flakyExpeller) ExpelWithRequeue(rcv []Queue, requeue Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	e.start()
+	defer e.stop(mc)
+
+	for !e.poll(mc) {
+		idle := true
+		for _, q := range rcv {
+			item, err := q.(NonBlocking).TryGet()
+			if err != nil {
+				continue
+			}
+			idle = false
+			e.addReceived(1)
+			if err := e.deliver(item); err != nil && requeue != nil {
+				requeue.(NonBlocking).TryPut(item)
+			}
+		}
+		if idle {
+			return
+		}
+	}
+}
+
+func (e *flakyExpeller) deliver(item interface{}) error {
+	if !e.failed[item] {
+		e.failed[item] = true
+		return errors.New("delivery failed")
+	}
+	e.delivered = append(e.delivered, item)
+	e.addSent(1)
+	return nil
+}
+
+func TestExpellerWithRequeue(t *testing.T) {
+	var expeller Expeller = &flakyExpeller{
+		runner: runner{name: "flaky", kind: KindExpeller},
+		failed: map[interface{}]bool{},
+	}
+	in := NewBaseQueue("in", 0)
+	in.Put("a")
+	in.Put("b")
+	requeue := NewBaseQueue("requeue", 0)
+
+	rq, ok := expeller.(ExpellerWithRequeue)
+	if !ok {
+		t.Fatal("expected the expeller to support requeue")
+	}
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	rq.ExpelWithRequeue([]Queue{in, requeue}, requeue, mc)
+
+	delivered := expeller.(*flakyExpeller).delivered
+	if len(delivered) != 2 || delivered[0] != "a" || delivered[1] != "b" {
+		t.Errorf("expected the failed items to be retried and delivered, got %v", delivered)
+	}
+	final := (<-mc.FinalStatsChan).(PluginStats)
+	if final.Received != 4 || final.Sent != 2 {
+		t.Errorf("unexpected final stats %+v", final)
+	}
+}
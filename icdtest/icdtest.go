@@ -0,0 +1,111 @@
+// Package icdtest provides fakes and helpers for testing reservoird plugins
+// built on icd.
+package icdtest
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/reservoird/icd"
+)
+
+// RunTimeout is how long DiffRuns waits for a digester to stop
+var RunTimeout = 10 * time.Second
+
+// NewMonitorControl creates the monitor and control reservoird hands to a
+// plugin, with buffered channels so a plugin under test never blocks on
+// statistics nobody reads
+func NewMonitorControl() *icd.MonitorControl {
+	return &icd.MonitorControl{
+		StatsChan:      make(chan interface{}, 100),
+		FinalStatsChan: make(chan interface{}, 10),
+		ClearChan:      make(chan struct{}, 1),
+		DoneChan:       make(chan struct{}),
+		WaitGroup:      &sync.WaitGroup{},
+	}
+}
+
+// Diff is a difference between the outputs of two runs
+type Diff struct {
+	// Position of the output
+	Index int
+	// Output of the first run, nil when it has none at Index
+	A interface{}
+	// Output of the second run, nil when it has none at Index
+	B interface{}
+}
+
+// String describes the difference
+func (d Diff) String() string {
+	return fmt.Sprintf("output %d: %#v != %#v", d.Index, d.A, d.B)
+}
+
+// Run feeds inputs through the digester d and returns what it sends, in
+// order. The receive queue is closed after the inputs, so d stops once it
+// digested them; t fails when d does not stop within RunTimeout.
+func Run(t testing.TB, inputs []interface{}, d icd.Digester) []interface{} {
+	t.Helper()
+	rcv := icd.NewBaseQueue("rcv", 0)
+	snd := icd.NewBaseQueue("snd", 0)
+	for _, input := range inputs {
+		err := rcv.Put(input)
+		if err != nil {
+			t.Fatalf("put %#v: %v", input, err)
+		}
+	}
+	rcv.Close()
+
+	mc := NewMonitorControl()
+	mc.WaitGroup.Add(1)
+	done := make(chan struct{})
+	go func() {
+		d.Digest(rcv, snd, mc)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(RunTimeout):
+		close(mc.DoneChan)
+		t.Fatalf("digester %s did not stop within %v", d.Name(), RunTimeout)
+	}
+
+	var outputs []interface{}
+	for {
+		item, err := snd.TryGet()
+		if err != nil {
+			return outputs
+		}
+		outputs = append(outputs, item)
+	}
+}
+
+// DiffRuns feeds the same inputs through the digesters built by buildA and
+// buildB, e.g. the old and the new version of a digester, and returns the
+// differences between their outputs by position, nil when they are
+// identical. Outputs are compared with reflect.DeepEqual.
+func DiffRuns(t testing.TB, inputs []interface{}, buildA func() icd.Digester, buildB func() icd.Digester) []Diff {
+	t.Helper()
+	a := Run(t, inputs, buildA())
+	b := Run(t, inputs, buildB())
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	var diffs []Diff
+	for i := 0; i < n; i++ {
+		var outA, outB interface{}
+		if i < len(a) {
+			outA = a[i]
+		}
+		if i < len(b) {
+			outB = b[i]
+		}
+		if !reflect.DeepEqual(outA, outB) {
+			diffs = append(diffs, Diff{Index: i, A: outA, B: outB})
+		}
+	}
+	return diffs
+}
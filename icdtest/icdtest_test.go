@@ -0,0 +1,57 @@
+package icdtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/reservoird/icd"
+)
+
+func upper(item interface{}) (interface{}, error) {
+	return strings.ToUpper(item.(string)), nil
+}
+
+func TestDiffRunsIdentical(t *testing.T) {
+	build := func() icd.Digester {
+		return icd.ParallelOrderedDigester("upper", 2, upper)
+	}
+	inputs := []interface{}{"a", "b", "c"}
+	if diffs := DiffRuns(t, inputs, build, build); diffs != nil {
+		t.Errorf("expected no differences, got %v", diffs)
+	}
+}
+
+func TestDiffRunsDivergent(t *testing.T) {
+	old := func() icd.Digester {
+		return icd.ParallelOrderedDigester("upper", 2, upper)
+	}
+	// the new version drops "b" and no longer upper cases "c"
+	changed := func() icd.Digester {
+		return icd.ParallelOrderedDigester("changed", 2, func(item interface{}) (interface{}, error) {
+			switch item {
+			case "b":
+				return nil, nil
+			case "c":
+				return item, nil
+			}
+			return upper(item)
+		})
+	}
+	diffs := DiffRuns(t, []interface{}{"a", "b", "c"}, old, changed)
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 differences, got %v", diffs)
+	}
+	if diffs[0] != (Diff{Index: 1, A: "B", B: "c"}) || diffs[1] != (Diff{Index: 2, A: "C", B: nil}) {
+		t.Errorf("unexpected differences %v", diffs)
+	}
+	if diffs[0].String() != `output 1: "B" != "c"` {
+		t.Errorf("unexpected description %s", diffs[0])
+	}
+}
+
+func TestRun(t *testing.T) {
+	outputs := Run(t, []interface{}{"x"}, icd.ParallelOrderedDigester("upper", 1, upper))
+	if len(outputs) != 1 || outputs[0] != "X" {
+		t.Errorf("unexpected outputs %v", outputs)
+	}
+}
@@ -0,0 +1,40 @@
+package icdtest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/reservoird/icd"
+)
+
+// SequentialIDs is a deterministic icd.IDGenerator returning the ids
+// prefix-1, prefix-2 and so on, for tests asserting on ids
+type SequentialIDs struct {
+	prefix string
+	mu     sync.Mutex
+	next   int
+}
+
+// NewSequentialIDs creates a generator of sequential ids with prefix
+func NewSequentialIDs(prefix string) *SequentialIDs {
+	return &SequentialIDs{prefix: prefix}
+}
+
+// NewID returns the next id in the sequence
+func (g *SequentialIDs) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.next++
+	return fmt.Sprintf("%s-%d", g.prefix, g.next)
+}
+
+// UseSequentialIDs makes icd generate sequential ids with prefix until the
+// returned function restores the default generator, e.g.
+//
+//	defer icdtest.UseSequentialIDs("item")()
+func UseSequentialIDs(prefix string) func() {
+	icd.SetIDGenerator(NewSequentialIDs(prefix))
+	return func() {
+		icd.SetIDGenerator(nil)
+	}
+}
@@ -0,0 +1,44 @@
+package icdtest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/reservoird/icd"
+)
+
+func TestUseSequentialIDs(t *testing.T) {
+	restore := UseSequentialIDs("item")
+	for _, want := range []string{"item-1", "item-2", "item-3"} {
+		if id := icd.NewID(); id != want {
+			t.Errorf("expected id %q, got %q", want, id)
+		}
+	}
+	restore()
+	if id := icd.NewID(); len(id) != 36 {
+		t.Errorf("expected a uuid after restoring, got %q", id)
+	}
+}
+
+func TestSequentialIDsConcurrent(t *testing.T) {
+	g := NewSequentialIDs("id")
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				id := g.NewID()
+				mu.Lock()
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 400 || !seen["id-1"] || !seen["id-400"] {
+		t.Errorf("expected the ids id-1 to id-400, got %d distinct ids", len(seen))
+	}
+}
@@ -0,0 +1,59 @@
+package icd
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// IDGenerator creates the ids used within this package, e.g. for items and
+// correlation. It is pluggable so ids can be made deterministic when testing,
+// see icdtest.SequentialIDs.
+type IDGenerator interface {
+	// NewID returns a new unique id
+	NewID() string
+}
+
+type uuidGenerator struct{}
+
+// NewID returns a random version 4 UUID in its canonical form. It panics
+// when the system's random source fails, as no unique id can be made then.
+func (uuidGenerator) NewID() string {
+	var u [16]byte
+	_, err := io.ReadFull(rand.Reader, u[:])
+	if err != nil {
+		panic(fmt.Sprintf("icd: generating uuid: %v", err))
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+var (
+	idMu        sync.RWMutex
+	idGenerator IDGenerator = uuidGenerator{}
+)
+
+// SetIDGenerator replaces the id generator used by this package. Passing nil
+// restores the default, which generates random version 4 UUIDs.
+func SetIDGenerator(g IDGenerator) {
+	if g == nil {
+		g = uuidGenerator{}
+	}
+	idMu.Lock()
+	defer idMu.Unlock()
+	idGenerator = g
+}
+
+// CurrentIDGenerator returns the id generator currently used by this package
+func CurrentIDGenerator() IDGenerator {
+	idMu.RLock()
+	defer idMu.RUnlock()
+	return idGenerator
+}
+
+// NewID returns a new id from the current id generator
+func NewID() string {
+	return CurrentIDGenerator().NewID()
+}
@@ -0,0 +1,46 @@
+package icd
+
+import (
+	"regexp"
+	"testing"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+type fixedIDs []string
+
+func (ids *fixedIDs) NewID() string {
+	id := (*ids)[0]
+	*ids = (*ids)[1:]
+	return id
+}
+
+func TestNewIDDefault(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := NewID()
+		if !uuidV4.MatchString(id) {
+			t.Fatalf("expected a version 4 uuid, got %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("expected unique ids, got %q twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestSetIDGenerator(t *testing.T) {
+	defer SetIDGenerator(nil)
+	SetIDGenerator(&fixedIDs{"a", "b"})
+	if id := NewID(); id != "a" {
+		t.Errorf("expected id a, got %q", id)
+	}
+	if id := NewID(); id != "b" {
+		t.Errorf("expected id b, got %q", id)
+	}
+
+	SetIDGenerator(nil)
+	if _, ok := CurrentIDGenerator().(uuidGenerator); !ok {
+		t.Error("expected nil to restore the uuid generator")
+	}
+}
@@ -0,0 +1,416 @@
+package icd
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AckToken identifies an item handed out by an InflightQueue which has not
+// yet been acknowledged
+type AckToken uint64
+
+type inflightItem struct {
+	item     interface{}
+	deadline time.Time
+}
+
+type fetchResult struct {
+	item interface{}
+	err  error
+}
+
+// InflightQueue wraps a queue and tracks items handed out through GetAck
+// until they are acknowledged. Items which are not acknowledged within the
+// visibility timeout, or which are negatively acknowledged, are redelivered
+// ahead of new items. Getters blocked waiting on the wrapped queue are woken
+// when an item becomes due for redelivery.
+//
+// Items handed out through Get are not tracked.
+type InflightQueue struct {
+	queue     Queue
+	timeout   time.Duration
+	mu        sync.Mutex
+	next      AckToken
+	inflight  map[AckToken]inflightItem
+	redeliver []interface{}
+	fetching  bool
+	// the result of the background fetch not yet handed to a getter
+	fetched *fetchResult
+	// incremented by Reset, so a fetch started before it cannot hand out a
+	// stale error
+	generation uint64
+	wake       chan struct{}
+}
+
+// DefaultVisibilityTimeout is the visibility timeout of an InflightQueue
+// created without a positive one
+const DefaultVisibilityTimeout = 30 * time.Second
+
+// NewInflightQueue wraps q so items handed out through GetAck are redelivered
+// unless they are acknowledged within timeout. A timeout of 0 or below, which
+// would redeliver every item at once, is treated as
+// DefaultVisibilityTimeout.
+func NewInflightQueue(q Queue, timeout time.Duration) *InflightQueue {
+	if timeout <= 0 {
+		timeout = DefaultVisibilityTimeout
+	}
+	return &InflightQueue{
+		queue:    q,
+		timeout:  timeout,
+		inflight: make(map[AckToken]inflightItem),
+		wake:     make(chan struct{}),
+	}
+}
+
+// Name provides the name of the queue
+func (q *InflightQueue) Name() string {
+	return q.queue.Name()
+}
+
+// Put puts an item into the queue
+func (q *InflightQueue) Put(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	return q.queue.Put(item)
+}
+
+// Get gets the next item from the queue without tracking it
+func (q *InflightQueue) Get() (interface{}, error) {
+	return q.get()
+}
+
+// GetAck gets the next item from the queue along with the token which must
+// be passed to Ack once the item has been processed
+func (q *InflightQueue) GetAck() (interface{}, AckToken, error) {
+	item, err := q.get()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.next++
+	q.inflight[q.next] = inflightItem{
+		item:     item,
+		deadline: now().Add(q.timeout),
+	}
+	// waiting getters need to learn about the new deadline
+	q.notify()
+	return item, q.next, nil
+}
+
+// Ack acknowledges the item identified by token has been processed
+func (q *InflightQueue) Ack(token AckToken) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expire()
+	_, ok := q.inflight[token]
+	if !ok {
+		return ErrUnknownToken
+	}
+	delete(q.inflight, token)
+	return nil
+}
+
+// Nack negatively acknowledges the item identified by token so that it is
+// redelivered immediately
+func (q *InflightQueue) Nack(token AckToken) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expire()
+	in, ok := q.inflight[token]
+	if !ok {
+		return ErrUnknownToken
+	}
+	delete(q.inflight, token)
+	q.redeliver = append(q.redeliver, in.item)
+	q.notify()
+	return nil
+}
+
+// BatchAckError is returned by AckBatch and NackBatch when some tokens of the
+// batch were unknown, e.g. because their visibility timeout expired. The
+// other tokens of the batch were processed.
+type BatchAckError struct {
+	// The tokens which were not acknowledged, in batch order
+	Unknown []AckToken
+}
+
+// Error returns the number of unknown tokens
+func (e *BatchAckError) Error() string {
+	return fmt.Sprintf("%d of the batch: %v", len(e.Unknown), ErrUnknownToken)
+}
+
+// Unwrap returns ErrUnknownToken
+func (e *BatchAckError) Unwrap() error {
+	return ErrUnknownToken
+}
+
+// AckBatch acknowledges the items identified by tokens under a single lock.
+// Unknown tokens do not fail the batch, they are returned in a
+// *BatchAckError, which wraps ErrUnknownToken, once the others are
+// acknowledged.
+func (q *InflightQueue) AckBatch(tokens []AckToken) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expire()
+	var unknown []AckToken
+	for _, token := range tokens {
+		_, ok := q.inflight[token]
+		if !ok {
+			unknown = append(unknown, token)
+			continue
+		}
+		delete(q.inflight, token)
+	}
+	return batchAckError(unknown)
+}
+
+// NackBatch negatively acknowledges the items identified by tokens under a
+// single lock, they are redelivered in batch order. Unknown tokens are
+// handled like with AckBatch.
+func (q *InflightQueue) NackBatch(tokens []AckToken) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expire()
+	var unknown []AckToken
+	for _, token := range tokens {
+		in, ok := q.inflight[token]
+		if !ok {
+			unknown = append(unknown, token)
+			continue
+		}
+		delete(q.inflight, token)
+		q.redeliver = append(q.redeliver, in.item)
+	}
+	if len(unknown) < len(tokens) {
+		q.notify()
+	}
+	return batchAckError(unknown)
+}
+
+// batchAckError returns the error of a batch with the unknown tokens, nil
+// when there are none
+func batchAckError(unknown []AckToken) error {
+	if len(unknown) == 0 {
+		return nil
+	}
+	return &BatchAckError{Unknown: unknown}
+}
+
+// InFlight returns the number of items handed out but not yet acknowledged
+func (q *InflightQueue) InFlight() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expire()
+	return len(q.inflight)
+}
+
+// Len returns the number of items waiting to be delivered, including those
+// awaiting redelivery and the one fetched from the wrapped queue for the
+// next getter
+func (q *InflightQueue) Len() int {
+	q.mu.Lock()
+	q.expire()
+	n := q.waiting()
+	q.mu.Unlock()
+	return n + q.queue.Len()
+}
+
+// waiting returns the number of items held for delivery besides those of
+// the wrapped queue, must be called with mu held
+func (q *InflightQueue) waiting() int {
+	n := len(q.redeliver)
+	if q.fetched != nil && q.fetched.err == nil {
+		n++
+	}
+	return n
+}
+
+// Cap returns the capacity of the wrapped queue
+func (q *InflightQueue) Cap() int {
+	return q.queue.Cap()
+}
+
+// Clear clears the queue along with all in flight items
+func (q *InflightQueue) Clear() {
+	q.mu.Lock()
+	q.inflight = make(map[AckToken]inflightItem)
+	q.redeliver = nil
+	if q.fetched != nil && q.fetched.err == nil {
+		q.fetched = nil
+	}
+	q.mu.Unlock()
+	q.queue.Clear()
+}
+
+// Reset resets the queue, dropping all in flight items
+func (q *InflightQueue) Reset() {
+	q.mu.Lock()
+	q.inflight = make(map[AckToken]inflightItem)
+	q.redeliver = nil
+	q.fetched = nil
+	q.generation++
+	q.mu.Unlock()
+	q.queue.Reset()
+}
+
+// Close closes the wrapped queue
+func (q *InflightQueue) Close() error {
+	return q.queue.Close()
+}
+
+// Closed returns whether or not the wrapped queue is closed
+func (q *InflightQueue) Closed() bool {
+	return q.queue.Closed()
+}
+
+// Stats returns the statistics of the wrapped queue, as far as it reports
+// them, with Len including the items awaiting redelivery and the number of
+// items in flight
+func (q *InflightQueue) Stats() QueueStats {
+	var stats QueueStats
+	sr, ok := q.queue.(StatsReporter)
+	if ok {
+		stats = sr.Stats()
+	} else {
+		stats = QueueStats{
+			Name:   q.Name(),
+			Cap:    q.Cap(),
+			Closed: q.Closed(),
+		}
+	}
+	return q.inflightStats(stats)
+}
+
+// Monitor provides monitoring of the wrapped queue, adding the items in
+// flight to the statistics it sends. When the monitor of the wrapped queue
+// returns without final statistics, the current ones are sent instead.
+func (q *InflightQueue) Monitor(mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	imc := relayControl(mc)
+	imc.WaitGroup.Add(1)
+	go q.queue.Monitor(imc)
+	final, ok := relayStats(imc, mc, q.addInflight)
+	if !ok {
+		final = q.Stats()
+	}
+	mc.FinalStatsChan <- q.addInflight(final)
+}
+
+// addInflight adds the items in flight to statistics sent by the wrapped
+// queue, statistics other than QueueStats are passed on as is
+func (q *InflightQueue) addInflight(stats interface{}) interface{} {
+	qs, ok := stats.(QueueStats)
+	if !ok {
+		return stats
+	}
+	return q.inflightStats(qs)
+}
+
+// inflightStats adds the items in flight to stats of the wrapped queue
+func (q *InflightQueue) inflightStats(stats QueueStats) QueueStats {
+	q.mu.Lock()
+	q.expire()
+	stats.Inflight = len(q.inflight)
+	waiting := q.waiting()
+	q.mu.Unlock()
+	stats.Len = waiting + q.queue.Len()
+	return stats
+}
+
+// get returns the next item due for redelivery or, failing that, the next
+// item of the wrapped queue. A single background fetch waits on the wrapped
+// queue so that getters can also wait for the earliest in flight deadline or
+// a Nack, and an item fetched while its getter was served otherwise is kept
+// in fetched for the next getter rather than lost.
+func (q *InflightQueue) get() (interface{}, error) {
+	for {
+		q.mu.Lock()
+		q.expire()
+		if len(q.redeliver) > 0 {
+			item := q.redeliver[0]
+			q.redeliver[0] = nil
+			q.redeliver = q.redeliver[1:]
+			q.mu.Unlock()
+			return item, nil
+		}
+		if q.fetched != nil {
+			r := q.fetched
+			q.fetched = nil
+			q.mu.Unlock()
+			return r.item, r.err
+		}
+		if !q.fetching {
+			q.fetching = true
+			go q.fetch(q.generation)
+		}
+		wake := q.wake
+		var expiry <-chan time.Time
+		deadline, ok := q.earliest()
+		if ok {
+			expiry = after(deadline.Sub(now()))
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-expiry:
+		}
+	}
+}
+
+// fetch gets the next item of the wrapped queue for the getters, an error of
+// a fetch started before the last Reset is dropped
+func (q *InflightQueue) fetch(generation uint64) {
+	item, err := q.queue.Get()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.fetching = false
+	if err != nil && generation != q.generation {
+		q.notify()
+		return
+	}
+	q.fetched = &fetchResult{item: item, err: err}
+	q.notify()
+}
+
+// earliest returns the earliest in flight deadline, must be called with mu
+// held
+func (q *InflightQueue) earliest() (time.Time, bool) {
+	deadline := time.Time{}
+	found := false
+	for _, in := range q.inflight {
+		if !found || in.deadline.Before(deadline) {
+			deadline = in.deadline
+			found = true
+		}
+	}
+	return deadline, found
+}
+
+// notify wakes all waiting getters, must be called with mu held
+func (q *InflightQueue) notify() {
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
+
+// expire moves items past their deadline to the redelivery list, must be
+// called with mu held
+func (q *InflightQueue) expire() {
+	t := now()
+	expired := []AckToken{}
+	for token, in := range q.inflight {
+		if !t.Before(in.deadline) {
+			expired = append(expired, token)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i] < expired[j] })
+	for _, token := range expired {
+		q.redeliver = append(q.redeliver, q.inflight[token].item)
+		delete(q.inflight, token)
+	}
+}
@@ -0,0 +1,284 @@
+package icd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInflightQueueAck(t *testing.T) {
+	useFakeClock()
+	defer SetClock(nil)
+	q := NewInflightQueue(NewBaseQueue("inner", 0), time.Second)
+	q.Put("a")
+
+	item, token, err := q.GetAck()
+	if err != nil || item != "a" {
+		t.Fatalf("unexpected get: %v %v", item, err)
+	}
+	if q.InFlight() != 1 {
+		t.Errorf("expected 1 in flight, got %d", q.InFlight())
+	}
+	if err := q.Ack(token); err != nil {
+		t.Errorf("unexpected ack error: %v", err)
+	}
+	if err := q.Ack(token); err != ErrUnknownToken {
+		t.Errorf("expected ErrUnknownToken on second ack, got %v", err)
+	}
+	if q.InFlight() != 0 || q.Len() != 0 {
+		t.Errorf("expected empty queue, got len %d inflight %d", q.Len(), q.InFlight())
+	}
+}
+
+func TestInflightQueueNack(t *testing.T) {
+	useFakeClock()
+	defer SetClock(nil)
+	q := NewInflightQueue(NewBaseQueue("inner", 0), time.Second)
+	q.Put("a")
+	q.Put("b")
+
+	_, token, _ := q.GetAck()
+	q.Nack(token)
+	item, _, _ := q.GetAck()
+	if item != "a" {
+		t.Errorf("expected nacked item to be redelivered first, got %v", item)
+	}
+}
+
+func TestInflightQueueAckBatch(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewInflightQueue(NewBaseQueue("inner", 0), time.Second)
+	q.Put("a")
+	q.Put("b")
+
+	_, expired, _ := q.GetAck()
+	c.Advance(2 * time.Second)
+	_, redelivered, _ := q.GetAck()
+	_, token, _ := q.GetAck()
+
+	err := q.AckBatch([]AckToken{expired, redelivered, token})
+	var batchErr *BatchAckError
+	if !errors.As(err, &batchErr) || !errors.Is(err, ErrUnknownToken) {
+		t.Fatalf("expected a BatchAckError, got %v", err)
+	}
+	if !reflect.DeepEqual(batchErr.Unknown, []AckToken{expired}) {
+		t.Errorf("expected the expired token to be unknown, got %v", batchErr.Unknown)
+	}
+	if q.InFlight() != 0 {
+		t.Errorf("expected the known tokens to be acked, got %d in flight", q.InFlight())
+	}
+	if err := q.AckBatch(nil); err != nil {
+		t.Errorf("unexpected error on empty batch: %v", err)
+	}
+}
+
+func TestInflightQueueNackBatch(t *testing.T) {
+	useFakeClock()
+	defer SetClock(nil)
+	q := NewInflightQueue(NewBaseQueue("inner", 0), time.Second)
+	q.Put("a")
+	q.Put("b")
+	q.Put("c")
+
+	_, a, _ := q.GetAck()
+	_, b, _ := q.GetAck()
+	if err := q.NackBatch([]AckToken{b, a}); err != nil {
+		t.Fatalf("unexpected nack error: %v", err)
+	}
+	for _, want := range []string{"b", "a", "c"} {
+		item, _, _ := q.GetAck()
+		if item != want {
+			t.Errorf("expected %s, got %v", want, item)
+		}
+	}
+	if err := q.NackBatch([]AckToken{a}); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("expected ErrUnknownToken, got %v", err)
+	}
+}
+
+func TestInflightQueueRedeliversToBlockedGetter(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewInflightQueue(NewBaseQueue("inner", 0), time.Second)
+	q.Put("a")
+	_, token, _ := q.GetAck()
+
+	got := make(chan interface{})
+	go func() {
+		item, _, _ := q.GetAck()
+		got <- item
+	}()
+	// the getter is blocked on the empty inner queue, waiting on the deadline
+	waitFor(t, "getter to wait on the deadline", func() bool { return c.Waiters() > 0 })
+	c.Advance(2 * time.Second)
+
+	select {
+	case item := <-got:
+		if item != "a" {
+			t.Errorf("expected redelivery of a, got %v", item)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked getter was not woken by the expired item")
+	}
+	if err := q.Ack(token); err != ErrUnknownToken {
+		t.Errorf("expected the expired token to be unknown, got %v", err)
+	}
+}
+
+func TestInflightQueueKeepsItemFetchedDuringRedelivery(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewInflightQueue(NewBaseQueue("inner", 0), time.Second)
+	q.Put("a")
+	q.GetAck()
+
+	waitFor(t, "item to be in flight", func() bool { return q.InFlight() == 1 })
+	c.Advance(2 * time.Second)
+	q.Put("b")
+
+	first, _ := q.Get()
+	second, _ := q.Get()
+	if first == second || (first != "a" && first != "b") || (second != "a" && second != "b") {
+		t.Errorf("expected both a and b, got %v and %v", first, second)
+	}
+}
+
+// leaveFetch has a getter served by a redelivery while the background fetch
+// keeps waiting on the empty wrapped queue
+func leaveFetch(t *testing.T, q *InflightQueue) {
+	t.Helper()
+	q.Put("a")
+	_, token, _ := q.GetAck()
+	got := make(chan interface{})
+	go func() {
+		item, _ := q.Get()
+		got <- item
+	}()
+	waitFor(t, "the background fetch", func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.fetching
+	})
+	q.Nack(token)
+	if item := <-got; item != "a" {
+		t.Fatalf("expected the redelivered a, got %v", item)
+	}
+}
+
+func TestInflightQueueCountsFetchedItem(t *testing.T) {
+	q := NewInflightQueue(NewBaseQueue("inner", 0), time.Minute)
+	leaveFetch(t, q)
+	q.Put("b")
+	waitFor(t, "b to be fetched", func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.fetched != nil
+	})
+	if q.Len() != 1 || q.Stats().Len != 1 {
+		t.Errorf("expected the fetched item to be counted, got %d and %d", q.Len(), q.Stats().Len)
+	}
+
+	q.Clear()
+	if q.Len() != 0 {
+		t.Errorf("expected Clear to drop the fetched item, got %d", q.Len())
+	}
+	q.Put("c")
+	if item, _ := q.Get(); item != "c" {
+		t.Errorf("expected c, got %v", item)
+	}
+}
+
+func TestInflightQueueResetDropsStaleClose(t *testing.T) {
+	q := NewInflightQueue(NewBaseQueue("inner", 0), time.Minute)
+	leaveFetch(t, q)
+	q.Close()
+	waitFor(t, "the fetch to fail", func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.fetched != nil
+	})
+	q.Reset()
+	q.Put("b")
+	if item, err := q.Get(); item != "b" || err != nil {
+		t.Errorf("expected b after the Reset, got %v %v", item, err)
+	}
+}
+
+func TestInflightQueueDefaultTimeout(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewInflightQueue(NewBaseQueue("inner", 0), 0)
+	q.Put("a")
+	q.GetAck()
+	c.Advance(DefaultVisibilityTimeout - time.Millisecond)
+	if q.InFlight() != 1 || q.Len() != 0 {
+		t.Error("expected a zero timeout not to redeliver at once")
+	}
+	c.Advance(time.Millisecond)
+	if q.InFlight() != 0 || q.Len() != 1 {
+		t.Error("expected the default timeout to redeliver")
+	}
+}
+
+func TestInflightQueueClosed(t *testing.T) {
+	q := NewInflightQueue(NewBaseQueue("inner", 0), time.Second)
+	q.Close()
+	_, _, err := q.GetAck()
+	if !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+	if err := q.Put(nil); err != ErrNilItem {
+		t.Errorf("expected ErrNilItem, got %v", err)
+	}
+}
+
+func TestInflightQueueStats(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewInflightQueue(NewBaseQueue("inner", 0), time.Minute)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go q.Monitor(mc)
+	waitFor(t, "monitor timer", func() bool { return c.Waiters() == 1 })
+
+	q.Put("a")
+	q.Put("b")
+	q.Put("c")
+	_, first, _ := q.GetAck()
+	q.GetAck()
+	stats := q.Stats()
+	if stats.Inflight != 2 || stats.Len != 1 || stats.Puts != 3 || stats.Gets != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	q.Ack(first)
+	if stats := q.Stats(); stats.Inflight != 1 {
+		t.Errorf("expected 1 in flight after the ack, got %d", stats.Inflight)
+	}
+
+	c.Advance(monitorInterval)
+	stats = (<-mc.StatsChan).(QueueStats)
+	if stats.Name != "inner" || stats.Inflight != 1 || stats.Len != 1 {
+		t.Errorf("unexpected monitored stats %+v", stats)
+	}
+	close(mc.DoneChan)
+	mc.WaitGroup.Wait()
+	final := (<-mc.FinalStatsChan).(QueueStats)
+	if final.Inflight != 1 {
+		t.Errorf("unexpected final stats %+v", final)
+	}
+}
+
+func TestInflightQueueMonitorWithoutFinalStats(t *testing.T) {
+	q := NewInflightQueue(silentQueue{NewBaseQueue("inner", 0)}, time.Minute)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go q.Monitor(mc)
+	close(mc.DoneChan)
+	mc.WaitGroup.Wait()
+	final := (<-mc.FinalStatsChan).(QueueStats)
+	if final.Name != "inner" {
+		t.Errorf("expected the current statistics as final ones, got %+v", final)
+	}
+}
@@ -0,0 +1,32 @@
+package icd
+
+import (
+	"time"
+)
+
+// ItemMeta describes how an item passed through a queue
+type ItemMeta struct {
+	// When the item was put into the queue
+	EnqueuedAt time.Time
+	// How long the item waited in the queue until it was gotten
+	Dwell time.Duration
+}
+
+// MetaGetter is the optional interface for queues which timestamp the items
+// put into them, e.g. for consumers measuring per-item latency against an SLA
+type MetaGetter interface {
+	// GetWithMeta gets the next item from the queue like Get, along with
+	// when it was put and how long it waited
+	GetWithMeta() (item interface{}, meta ItemMeta, err error)
+}
+
+// GetWithMeta gets the next item from the queue, blocking while the queue is
+// empty, along with when it was put and how long it waited. Both follow the
+// package Clock.
+func (q *BaseQueue) GetWithMeta() (interface{}, ItemMeta, error) {
+	item, _, enqueued, err := q.get()
+	if err != nil {
+		return nil, ItemMeta{}, err
+	}
+	return item, ItemMeta{EnqueuedAt: enqueued, Dwell: now().Sub(enqueued)}, nil
+}
@@ -0,0 +1,56 @@
+package icd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBaseQueueGetWithMeta(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewBaseQueue("q", 0)
+	q.Put("a")
+	putA := now()
+	c.Advance(2 * time.Second)
+	q.PutAll([]interface{}{"b", "c"})
+	c.Advance(3 * time.Second)
+
+	item, meta, err := q.GetWithMeta()
+	if err != nil || item != "a" {
+		t.Fatalf("unexpected get: %v %v", item, err)
+	}
+	if !meta.EnqueuedAt.Equal(putA) || meta.Dwell != 5*time.Second {
+		t.Errorf("expected a to have waited 5s, got %+v", meta)
+	}
+
+	// items removed otherwise do not shift the timestamps of the others
+	q.TryGet()
+	c.Advance(time.Second)
+	item, meta, _ = q.GetWithMeta()
+	if item != "c" || meta.Dwell != 4*time.Second {
+		t.Errorf("expected c to have waited 4s, got %v %+v", item, meta)
+	}
+
+	q.Close()
+	if _, _, err := q.GetWithMeta(); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+}
+
+func TestBaseQueueGetWithMetaAfterDrain(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewBaseQueue("q", 0)
+	q.Put("a")
+	q.Put("b")
+	q.TakeAll()
+	q.Put("c")
+	c.Advance(time.Second)
+	q.Clear()
+	q.Put("d")
+	c.Advance(time.Second)
+	item, meta, _ := q.GetWithMeta()
+	if item != "d" || meta.Dwell != time.Second {
+		t.Errorf("expected d to have waited 1s, got %v %+v", item, meta)
+	}
+}
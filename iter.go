@@ -0,0 +1,32 @@
+//go:build go1.23
+
+package icd
+
+import (
+	"iter"
+)
+
+// All returns an iterator over the items gotten from q, yielding each item
+// with a nil error until the queue is closed and drained. Any other error
+// from Get is yielded once before iteration stops. Breaking out of the range
+// stops iteration without consuming further items.
+//
+//	for item, err := range icd.All(q) {
+//		...
+//	}
+func All(q Queue) iter.Seq2[interface{}, error] {
+	return func(yield func(interface{}, error) bool) {
+		for {
+			item, err := q.Get()
+			if err != nil {
+				if !IsQueueClosed(err) {
+					yield(nil, err)
+				}
+				return
+			}
+			if !yield(item, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+//go:build go1.23
+
+package icd
+
+import (
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	q := NewBaseQueue("iter", 0)
+	for i := 0; i < 5; i++ {
+		q.Put(i)
+	}
+
+	got := []interface{}{}
+	for item, err := range All(q) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, item)
+		if item == 1 {
+			break
+		}
+	}
+	if len(got) != 2 || q.Len() != 3 {
+		t.Fatalf("expected break to stop after 2 items, got %v with %d left", got, q.Len())
+	}
+
+	q.Close()
+	for item, err := range All(q) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, item)
+	}
+	for i, item := range got {
+		if item != i {
+			t.Errorf("expected %d, got %v", i, item)
+		}
+	}
+	if len(got) != 5 {
+		t.Errorf("expected to drain to close, got %v", got)
+	}
+}
+
+type failingQueue struct {
+	*BaseQueue
+	err error
+}
+
+func (q *failingQueue) Get() (interface{}, error) {
+	return nil, q.err
+}
+
+func TestAllYieldsErrors(t *testing.T) {
+	q := &failingQueue{BaseQueue: NewBaseQueue("failing", 0), err: ErrTimeout}
+	n := 0
+	for _, err := range All(q) {
+		n++
+		if !IsTimeout(err) {
+			t.Errorf("expected ErrTimeout, got %v", err)
+		}
+	}
+	if n != 1 {
+		t.Errorf("expected the error to be yielded once, got %d", n)
+	}
+}
@@ -0,0 +1,238 @@
+package icd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// the inputs of a JoinDigester
+const (
+	joinA = iota
+	joinB
+)
+
+type joinEntry struct {
+	item    interface{}
+	at      time.Time
+	matched bool
+}
+
+// joinItem is an item received by a JoinDigester and the input it came from
+type joinItem struct {
+	side int
+	item interface{}
+}
+
+type joinDigester struct {
+	runner
+	keys    [2]func(interface{}) string
+	window  time.Duration
+	join    func(a, b interface{}) interface{}
+	mu      sync.Mutex
+	pending [2]map[string][]*joinEntry
+	dropped uint64
+}
+
+// JoinDigester creates a digester joining two streams on a key: rcv[0] is
+// stream A, keyed by keyA, and rcv[1] stream B, keyed by keyB. Every item is
+// buffered for window, and an item arriving while items of the other stream
+// with the same key are buffered is joined with each of them, sending
+// join(a, b) in the order the other stream's items arrived. An item which
+// expires, or is still buffered when the digester stops, without having been
+// joined is dropped and counted, see DropCounter. The window follows the
+// package Clock and is clamped to a millisecond. DigestMulti reports an error
+// when rcv does not hold exactly two queues, and closes snd once both are
+// closed and drained or reservoird shuts down.
+func JoinDigester(name string, keyA, keyB func(interface{}) string, window time.Duration, join func(a, b interface{}) interface{}) DigesterMulti {
+	if window < minInterval {
+		window = minInterval
+	}
+	return &joinDigester{
+		runner: runner{name: name, kind: KindDigester},
+		keys:   [2]func(interface{}) string{keyA, keyB},
+		window: window,
+		join:   join,
+	}
+}
+
+// DigestMulti joins the items of the two queues of rcv and sends the joined
+// results to snd
+func (d *joinDigester) DigestMulti(rcv []Queue, snd Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	d.start()
+	defer d.stop(mc)
+	defer snd.Close()
+
+	if len(rcv) != 2 {
+		d.report(fmt.Errorf("join needs 2 receive queues, got %d", len(rcv)))
+		return
+	}
+	d.mu.Lock()
+	d.pending = [2]map[string][]*joinEntry{{}, {}}
+	d.mu.Unlock()
+
+	stop := make(chan struct{})
+	expired := make(chan struct{})
+	go func() {
+		defer close(expired)
+		for {
+			select {
+			case <-after(d.window):
+				d.expire()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	items, closed := d.receive(rcv, stop)
+	for !d.poll(mc) && d.next(items, closed, snd, mc) {
+	}
+
+	close(stop)
+	<-expired
+	d.mu.Lock()
+	for side := range d.pending {
+		for _, entries := range d.pending[side] {
+			for _, e := range entries {
+				if !e.matched {
+					d.dropped++
+				}
+			}
+		}
+		d.pending[side] = nil
+	}
+	d.mu.Unlock()
+}
+
+// receive gets the items of the two queues, tagged with their input, until
+// stop is closed; closed is closed once both queues are closed and drained
+func (d *joinDigester) receive(rcv []Queue, stop <-chan struct{}) (<-chan joinItem, <-chan struct{}) {
+	items := make(chan joinItem)
+	closed := make(chan struct{})
+	var getters sync.WaitGroup
+	for side, q := range rcv {
+		getters.Add(1)
+		go func(side int, q Queue) {
+			defer getters.Done()
+			for {
+				item, err := q.Get()
+				if err != nil {
+					return
+				}
+				select {
+				case items <- joinItem{side: side, item: item}:
+				case <-stop:
+					d.drop()
+					return
+				}
+			}
+		}(side, q)
+	}
+	go func() {
+		getters.Wait()
+		close(closed)
+	}()
+	return items, closed
+}
+
+// next joins the next item, returns false once both receive queues are
+// closed
+func (d *joinDigester) next(items <-chan joinItem, closed <-chan struct{}, snd Queue, mc *MonitorControl) bool {
+	select {
+	case in := <-items:
+		d.addReceived(1)
+		d.add(in, snd)
+	case <-closed:
+		return false
+	case <-mc.DoneChan:
+	}
+	return true
+}
+
+// add joins the item with the buffered items of the other input sharing its
+// key, then buffers it
+func (d *joinDigester) add(in joinItem, snd Queue) {
+	key := d.keys[in.side](in.item)
+	at := now()
+	other := 1 - in.side
+	entry := &joinEntry{item: in.item, at: at}
+
+	d.mu.Lock()
+	var joined []interface{}
+	var live []*joinEntry
+	for _, e := range d.pending[other][key] {
+		if at.Sub(e.at) >= d.window {
+			if !e.matched {
+				d.dropped++
+			}
+			continue
+		}
+		live = append(live, e)
+		e.matched = true
+		entry.matched = true
+		if in.side == joinA {
+			joined = append(joined, d.join(in.item, e.item))
+		} else {
+			joined = append(joined, d.join(e.item, in.item))
+		}
+	}
+	d.setPending(other, key, live)
+	d.pending[in.side][key] = append(d.pending[in.side][key], entry)
+	d.mu.Unlock()
+
+	for _, item := range joined {
+		err := snd.Put(item)
+		if err != nil {
+			d.report(fmt.Errorf("put into %s: %w", snd.Name(), err))
+			continue
+		}
+		d.addSent(1)
+	}
+}
+
+// expire drops the buffered items older than the window
+func (d *joinDigester) expire() {
+	at := now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for side := range d.pending {
+		for key, entries := range d.pending[side] {
+			var live []*joinEntry
+			for _, e := range entries {
+				if at.Sub(e.at) < d.window {
+					live = append(live, e)
+					continue
+				}
+				if !e.matched {
+					d.dropped++
+				}
+			}
+			d.setPending(side, key, live)
+		}
+	}
+}
+
+// setPending replaces the buffered items of side with key, must be called
+// with mu held
+func (d *joinDigester) setPending(side int, key string, entries []*joinEntry) {
+	if len(entries) == 0 {
+		delete(d.pending[side], key)
+		return
+	}
+	d.pending[side][key] = entries
+}
+
+func (d *joinDigester) drop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dropped++
+}
+
+// Dropped returns the number of items dropped without having been joined
+func (d *joinDigester) Dropped() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dropped
+}
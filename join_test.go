@@ -0,0 +1,126 @@
+package icd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// joinKey keys "key:value" items by key
+func joinKey(item interface{}) string {
+	return strings.SplitN(item.(string), ":", 2)[0]
+}
+
+func joinPair(a, b interface{}) interface{} {
+	return a.(string) + "+" + b.(string)
+}
+
+// buffered returns the number of items buffered by a JoinDigester
+func buffered(d DigesterMulti) int {
+	j := d.(*joinDigester)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	n := 0
+	for _, pending := range j.pending {
+		for _, entries := range pending {
+			n += len(entries)
+		}
+	}
+	return n
+}
+
+func startJoin(t *testing.T, c *fakeClock) (DigesterMulti, []Queue, Queue, *MonitorControl) {
+	rcv := []Queue{NewBaseQueue("a", 0), NewBaseQueue("b", 0)}
+	snd := NewBaseQueue("snd", 0)
+	d := JoinDigester("join", joinKey, joinKey, time.Minute, joinPair)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go d.DigestMulti(rcv, snd, mc)
+	waitFor(t, "expiry timer", func() bool { return c.Waiters() == 1 })
+	return d, rcv, snd, mc
+}
+
+func TestJoinDigesterJoinsMatches(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	d, rcv, snd, mc := startJoin(t, c)
+
+	rcv[0].Put("1:a")
+	rcv[0].Put("2:a")
+	waitFor(t, "items to be buffered", func() bool { return buffered(d) == 2 })
+	c.Advance(time.Minute - time.Millisecond)
+	rcv[1].Put("1:b")
+	item, _ := snd.Get()
+	if item != "1:a+1:b" {
+		t.Errorf("expected 1:a+1:b, got %v", item)
+	}
+
+	// a later A joins the buffered B, still in the order a, b
+	waitFor(t, "items to be buffered", func() bool { return buffered(d) == 3 })
+	rcv[0].Put("1:c")
+	item, _ = snd.Get()
+	if item != "1:c+1:b" {
+		t.Errorf("expected 1:c+1:b, got %v", item)
+	}
+
+	rcv[0].Close()
+	rcv[1].Close()
+	mc.WaitGroup.Wait()
+	if !snd.Closed() || d.Running() {
+		t.Error("expected the digester to stop and close its send queue")
+	}
+	if d.(DropCounter).Dropped() != 1 {
+		t.Errorf("expected the unmatched 2:a to be dropped, got %d", d.(DropCounter).Dropped())
+	}
+	final := (<-mc.FinalStatsChan).(PluginStats)
+	if final.Received != 4 || final.Sent != 2 {
+		t.Errorf("unexpected final stats %+v", final)
+	}
+}
+
+func TestJoinDigesterExpiresUnmatched(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	d, rcv, snd, mc := startJoin(t, c)
+
+	rcv[0].Put("1:a")
+	waitFor(t, "item to be buffered", func() bool { return buffered(d) == 1 })
+	c.Advance(time.Minute)
+	waitFor(t, "item to expire", func() bool { return buffered(d) == 0 })
+	if d.(DropCounter).Dropped() != 1 {
+		t.Errorf("expected the expired item to be dropped, got %d", d.(DropCounter).Dropped())
+	}
+
+	rcv[1].Put("1:b")
+	waitFor(t, "item to be buffered", func() bool { return buffered(d) == 1 })
+	if snd.Len() != 0 {
+		t.Errorf("expected no join after the window, got %d items", snd.Len())
+	}
+
+	close(mc.DoneChan)
+	mc.WaitGroup.Wait()
+	if !snd.Closed() || d.(DropCounter).Dropped() != 2 {
+		t.Errorf("expected the buffered item to be dropped on shutdown, got %d", d.(DropCounter).Dropped())
+	}
+}
+
+func TestJoinDigesterNeedsTwoQueues(t *testing.T) {
+	m := NewMonitor(newTestMonitorControl())
+	snd := NewBaseQueue("snd", 0)
+	d := JoinDigester("join", joinKey, joinKey, time.Minute, joinPair)
+	d.(Monitored).SetMonitor(m)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	d.DigestMulti([]Queue{NewBaseQueue("a", 0)}, snd, mc)
+	if !snd.Closed() {
+		t.Error("expected the send queue to be closed")
+	}
+	select {
+	case err := <-m.ErrorChan:
+		if !strings.Contains(err.Error(), "got 1") {
+			t.Errorf("unexpected error %v", err)
+		}
+	default:
+		t.Error("expected the error to be reported")
+	}
+}
@@ -0,0 +1,122 @@
+package icd
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// KeyedState is sent by a keyed state digester when the state of a key is
+// flushed, either because the key was idle or because the digester stopped
+type KeyedState struct {
+	// Key the state belongs to
+	Key string
+	// Final state of the key
+	State interface{}
+}
+
+type keyedEntry struct {
+	state    interface{}
+	lastSeen time.Time
+}
+
+type keyedStateDigester struct {
+	runner
+	key     func(interface{}) string
+	fold    func(state interface{}, item interface{}) (interface{}, interface{})
+	idle    time.Duration
+	mu      sync.Mutex
+	entries map[string]*keyedEntry
+}
+
+// KeyedStateDigester creates a digester maintaining state per key, e.g. for
+// sessionization or running totals. Each item is folded into the state of its
+// key, starting from a nil state, and fold's output, when not nil, is sent
+// downstream. State which has not seen an item for idle is evicted and sent
+// downstream as a KeyedState, as is all remaining state when the digester
+// stops. Idleness follows the package Clock. Idle periods shorter than a
+// millisecond are clamped to a millisecond.
+func KeyedStateDigester(name string, key func(interface{}) string, fold func(state interface{}, item interface{}) (interface{}, interface{}), idle time.Duration) Digester {
+	if idle < minInterval {
+		idle = minInterval
+	}
+	return &keyedStateDigester{
+		runner:  runner{name: name, kind: KindDigester},
+		key:     key,
+		fold:    fold,
+		idle:    idle,
+		entries: make(map[string]*keyedEntry),
+	}
+}
+
+// Digest folds the items from rcv into per key state until rcv is closed or
+// reservoird shuts down
+func (d *keyedStateDigester) Digest(rcv Queue, snd Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	d.start()
+	defer d.stop(mc)
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-after(d.idle / 2):
+				d.evict(snd, false)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	for !d.poll(mc) {
+		item, err := rcv.Get()
+		if err != nil {
+			break
+		}
+		d.addReceived(1)
+		k := d.key(item)
+
+		d.mu.Lock()
+		entry, ok := d.entries[k]
+		if !ok {
+			entry = &keyedEntry{}
+			d.entries[k] = entry
+		}
+		state, out := d.fold(entry.state, item)
+		entry.state = state
+		entry.lastSeen = now()
+		d.mu.Unlock()
+
+		if out != nil && snd.Put(out) == nil {
+			d.addSent(1)
+		}
+	}
+
+	close(stop)
+	<-stopped
+	d.evict(snd, true)
+	snd.Close()
+}
+
+// evict sends and removes the state of idle keys, or of all keys, in key order
+func (d *keyedStateDigester) evict(snd Queue, all bool) {
+	t := now()
+	d.mu.Lock()
+	evicted := []KeyedState{}
+	for k, entry := range d.entries {
+		if all || t.Sub(entry.lastSeen) >= d.idle {
+			evicted = append(evicted, KeyedState{Key: k, State: entry.state})
+			delete(d.entries, k)
+		}
+	}
+	d.mu.Unlock()
+
+	sort.Slice(evicted, func(i, j int) bool { return evicted[i].Key < evicted[j].Key })
+	for _, ks := range evicted {
+		if snd.Put(ks) == nil {
+			d.addSent(1)
+		}
+	}
+}
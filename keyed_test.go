@@ -0,0 +1,103 @@
+package icd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type keyedItem struct {
+	key   string
+	value int
+}
+
+func keyOf(item interface{}) string {
+	return item.(keyedItem).key
+}
+
+// sumFold keeps a running total per key and sends every total reaching 10
+func sumFold(state interface{}, item interface{}) (interface{}, interface{}) {
+	total := item.(keyedItem).value
+	if state != nil {
+		total += state.(int)
+	}
+	if total >= 10 {
+		return total, total
+	}
+	return total, nil
+}
+
+func TestKeyedStateDigesterFoldAndEvict(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	d := KeyedStateDigester("keyed", keyOf, sumFold, time.Minute)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go d.Digest(rcv, snd, mc)
+	waitFor(t, "sweep timer", func() bool { return c.Waiters() == 1 })
+
+	rcv.Put(keyedItem{"a", 4})
+	rcv.Put(keyedItem{"b", 1})
+	rcv.Put(keyedItem{"a", 6})
+	item, _ := snd.Get()
+	if item != 10 {
+		t.Errorf("expected fold output 10, got %v", item)
+	}
+
+	// half the idle period, nothing is idle yet
+	c.Advance(30 * time.Second)
+	waitFor(t, "sweep timer", func() bool { return c.Waiters() == 1 })
+	rcv.Put(keyedItem{"b", 1})
+	waitFor(t, "items to be received", func() bool { return rcv.Len() == 0 })
+	if snd.Len() != 0 {
+		t.Errorf("expected no eviction before the idle period, got %d items", snd.Len())
+	}
+
+	// a has been idle for the idle period, b only for half of it
+	c.Advance(30 * time.Second)
+	item, _ = snd.Get()
+	if ks, ok := item.(KeyedState); !ok || ks.Key != "a" || ks.State != 10 {
+		t.Errorf("expected a to be evicted with state 10, got %v", item)
+	}
+
+	rcv.Close()
+	mc.WaitGroup.Wait()
+	item, _ = snd.Get()
+	if ks, ok := item.(KeyedState); !ok || ks.Key != "b" || ks.State != 2 {
+		t.Errorf("expected b to be flushed on stop with state 2, got %v", item)
+	}
+	if _, err := snd.Get(); !IsQueueClosed(err) {
+		t.Errorf("expected the send queue to be closed, got %v", err)
+	}
+}
+
+func TestKeyedStateDigesterFlushInKeyOrder(t *testing.T) {
+	useFakeClock()
+	defer SetClock(nil)
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	d := KeyedStateDigester("keyed", keyOf, sumFold, 0)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go d.Digest(rcv, snd, mc)
+
+	for _, k := range []string{"c", "a", "b"} {
+		rcv.Put(keyedItem{k, 1})
+	}
+	rcv.Close()
+	mc.WaitGroup.Wait()
+
+	keys := []string{}
+	for {
+		item, err := snd.Get()
+		if err != nil {
+			break
+		}
+		keys = append(keys, item.(KeyedState).Key)
+	}
+	if strings.Join(keys, "") != "abc" {
+		t.Errorf("expected states flushed in key order, got %v", keys)
+	}
+}
@@ -0,0 +1,31 @@
+package icd
+
+// Kind is the kind of a reservoird plugin
+type Kind string
+
+const (
+	// KindQueue is the kind of Queue plugins
+	KindQueue Kind = "queue"
+	// KindIngester is the kind of Ingester plugins
+	KindIngester Kind = "ingester"
+	// KindDigester is the kind of Digester plugins
+	KindDigester Kind = "digester"
+	// KindExpeller is the kind of Expeller plugins
+	KindExpeller Kind = "expeller"
+)
+
+// KindOf returns the kind of plugin, "" when it is none of the plugin types
+func KindOf(plugin interface{}) Kind {
+	switch plugin.(type) {
+	case Queue:
+		return KindQueue
+	case Ingester:
+		return KindIngester
+	case Digester, DigesterErr, DigesterMulti:
+		return KindDigester
+	case Expeller:
+		return KindExpeller
+	default:
+		return ""
+	}
+}
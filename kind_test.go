@@ -0,0 +1,26 @@
+package icd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		plugin interface{}
+		kind   Kind
+	}{
+		{NewBaseQueue("queue", 0), KindQueue},
+		{&testIngester{}, KindIngester},
+		{WindowDigester("window", time.Second, count), KindDigester},
+		{&failingDigester{}, KindDigester},
+		{JoinDigester("join", joinKey, joinKey, time.Second, joinPair), KindDigester},
+		{&flakyExpeller{}, KindExpeller},
+		{"not a plugin", ""},
+	}
+	for _, test := range tests {
+		if kind := KindOf(test.plugin); kind != test.kind {
+			t.Errorf("expected kind %q for %T, got %q", test.kind, test.plugin, kind)
+		}
+	}
+}
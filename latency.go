@@ -0,0 +1,175 @@
+package icd
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the buckets of latency histograms
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// LatencyHistogram counts latencies per bucket
+type LatencyHistogram struct {
+	// Upper bounds of the buckets, inclusive
+	Bounds []time.Duration
+	// Number of latencies per bucket, the last counting those above the
+	// largest bound
+	Counts []uint64
+	// Total number of latencies
+	Count uint64
+	// Sum of the latencies
+	Sum time.Duration
+}
+
+// NewLatencyHistogram creates an empty histogram with buckets bounded by
+// bounds, which must be ascending
+func NewLatencyHistogram(bounds []time.Duration) *LatencyHistogram {
+	return &LatencyHistogram{
+		Bounds: append([]time.Duration(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe counts latency d
+func (h *LatencyHistogram) Observe(d time.Duration) {
+	i := 0
+	for i < len(h.Bounds) && d > h.Bounds[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+}
+
+// copy returns a deep copy of the histogram
+func (h *LatencyHistogram) copy() *LatencyHistogram {
+	c := *h
+	c.Bounds = append([]time.Duration(nil), h.Bounds...)
+	c.Counts = append([]uint64(nil), h.Counts...)
+	return &c
+}
+
+type latencyQueue struct {
+	Queue
+	mu      sync.Mutex
+	latency *LatencyHistogram
+}
+
+// NewLatencyQueue wraps q so that every item put is stamped with the time in
+// the HeaderEnqueued header of its Envelope and the time it spent in the
+// queue is counted into a histogram when it is gotten. Items which are not
+// already an *Envelope are wrapped in one, so consumers get *Envelope items.
+// An item passing through several latency queues is restamped by each, so
+// each reports the latency of its own stage. Stats reports the histogram as
+// QueueStats.Latency, the clear message of Monitor clears it. The time
+// follows the package Clock.
+func NewLatencyQueue(q Queue) Queue {
+	return &latencyQueue{
+		Queue:   q,
+		latency: NewLatencyHistogram(LatencyBuckets),
+	}
+}
+
+// Put stamps the item with the current time and puts it into the queue. A
+// nil item, including a nil *Envelope, returns ErrNilItem; when the put fails
+// the envelope's header is left as it was.
+func (q *latencyQueue) Put(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	env, ok := item.(*Envelope)
+	if ok && env == nil {
+		return ErrNilItem
+	}
+	if !ok {
+		env = NewEnvelope(item)
+	}
+	prev, stamped := env.Headers[HeaderEnqueued]
+	env.SetHeader(HeaderEnqueued, strconv.FormatInt(now().UnixNano(), 10))
+	err := q.Queue.Put(env)
+	if err != nil {
+		if stamped {
+			env.Headers[HeaderEnqueued] = prev
+		} else {
+			delete(env.Headers, HeaderEnqueued)
+		}
+		return err
+	}
+	return nil
+}
+
+// Get gets the next item and counts the time it spent in the queue
+func (q *latencyQueue) Get() (interface{}, error) {
+	item, err := q.Queue.Get()
+	if err != nil {
+		return nil, err
+	}
+	env, ok := item.(*Envelope)
+	if !ok || env == nil {
+		return item, nil
+	}
+	enqueued, err := strconv.ParseInt(env.Header(HeaderEnqueued), 10, 64)
+	if err == nil {
+		d := now().Sub(time.Unix(0, enqueued))
+		q.mu.Lock()
+		q.latency.Observe(d)
+		q.mu.Unlock()
+	}
+	return item, nil
+}
+
+// Reset resets the wrapped queue and clears the histogram
+func (q *latencyQueue) Reset() {
+	q.Queue.Reset()
+	q.clear()
+}
+
+// Stats returns the statistics of the wrapped queue, as far as it reports
+// them, with the latency histogram
+func (q *latencyQueue) Stats() QueueStats {
+	stats := statsOf(q.Queue)
+	q.mu.Lock()
+	stats.Latency = q.latency.copy()
+	q.mu.Unlock()
+	return stats
+}
+
+// Monitor sends the statistics of the queue, including the histogram, every
+// second, clears the histogram on request and sends the final statistics on
+// shutdown
+func (q *latencyQueue) Monitor(mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	for {
+		select {
+		case <-mc.ClearChan:
+			q.clear()
+		case <-mc.DoneChan:
+			mc.FinalStatsChan <- q.Stats()
+			return
+		case <-after(monitorInterval):
+			select {
+			case mc.StatsChan <- q.Stats():
+			default:
+			}
+		}
+	}
+}
+
+// clear empties the histogram
+func (q *latencyQueue) clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.latency = NewLatencyHistogram(q.latency.Bounds)
+}
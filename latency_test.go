@@ -0,0 +1,96 @@
+package icd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	h := NewLatencyHistogram([]time.Duration{time.Second, time.Minute})
+	for _, d := range []time.Duration{0, time.Second, 2 * time.Second, time.Hour} {
+		h.Observe(d)
+	}
+	if h.Counts[0] != 2 || h.Counts[1] != 1 || h.Counts[2] != 1 {
+		t.Errorf("unexpected bucket counts %v", h.Counts)
+	}
+	if h.Count != 4 || h.Sum != time.Hour+3*time.Second {
+		t.Errorf("unexpected count %d and sum %v", h.Count, h.Sum)
+	}
+}
+
+func TestLatencyQueue(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewLatencyQueue(NewBaseQueue("latency", 0))
+
+	q.Put("a")
+	q.Put("b")
+	c.Advance(3 * time.Millisecond)
+	q.Put("c")
+	q.Get()
+	c.Advance(2 * time.Second)
+	q.Get()
+	item, _ := q.Get()
+	if item.(*Envelope).Payload != "c" {
+		t.Errorf("expected the wrapped payload c, got %v", item)
+	}
+
+	stats := q.(StatsReporter).Stats()
+	if stats.Name != "latency" || stats.Gets != 3 {
+		t.Errorf("expected the statistics of the wrapped queue, got %+v", stats)
+	}
+	h := stats.Latency
+	if h == nil || h.Count != 3 || h.Sum != 3*time.Millisecond+2*time.Second+3*time.Millisecond+2*time.Second {
+		t.Fatalf("unexpected histogram %+v", h)
+	}
+	// 3ms lands in the 5ms bucket, 2s and 2.003s in the 5s bucket
+	if h.Counts[1] != 1 || h.Counts[7] != 2 {
+		t.Errorf("unexpected bucket counts %v", h.Counts)
+	}
+
+	h.Counts[1] = 100
+	if q.(StatsReporter).Stats().Latency.Counts[1] != 1 {
+		t.Error("expected Stats to return a copy of the histogram")
+	}
+	q.Reset()
+	if q.(StatsReporter).Stats().Latency.Count != 0 {
+		t.Error("expected reset to clear the histogram")
+	}
+}
+
+func TestLatencyQueueRestampsPerStage(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	first := NewLatencyQueue(NewBaseQueue("first", 0))
+	second := NewLatencyQueue(NewBaseQueue("second", 0))
+
+	first.Put("a")
+	c.Advance(time.Second)
+	item, _ := first.Get()
+	second.Put(item)
+	c.Advance(time.Minute)
+	second.Get()
+
+	if sum := first.(StatsReporter).Stats().Latency.Sum; sum != time.Second {
+		t.Errorf("expected the first stage to take a second, got %v", sum)
+	}
+	if sum := second.(StatsReporter).Stats().Latency.Sum; sum != time.Minute {
+		t.Errorf("expected the second stage to take a minute, got %v", sum)
+	}
+}
+
+func TestLatencyQueueFailedPutKeepsHeader(t *testing.T) {
+	inner := NewBaseQueue("closed", 0)
+	inner.Close()
+	q := NewLatencyQueue(inner)
+	env := NewEnvelope("a")
+	if err := q.Put(env); !IsQueueClosed(err) {
+		t.Fatalf("expected ErrQueueClosed, got %v", err)
+	}
+	if env.Header(HeaderEnqueued) != "" {
+		t.Error("expected no enqueued header after a failed put")
+	}
+	if err := q.Put((*Envelope)(nil)); !IsNilItem(err) {
+		t.Errorf("expected ErrNilItem, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package icd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy is what a queue does with an item put while it is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the Put until there is room
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop drops the item, counting it, and returns from the Put
+	// without an error
+	OverflowDrop
+)
+
+// String returns the name of the policy
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDrop:
+		return "drop"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// Overflowable is the optional interface for queues whose behavior when full
+// can be configured
+type Overflowable interface {
+	// SetOverflowPolicy sets what Put does while the queue is full. The
+	// default is OverflowBlock.
+	SetOverflowPolicy(policy OverflowPolicy)
+}
+
+type leakyBucketQueue struct {
+	queue    *BaseQueue
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time
+	policy   OverflowPolicy
+	dropped  uint64
+}
+
+// NewLeakyBucketQueue creates an in-memory FIFO queue accepting bursts of up
+// to capacity items while releasing them at no more than drainPerSecond items
+// per second, a non-positive rate releases them as fast as they are gotten.
+// Get blocks until the next item is due, TryGet returns ErrQueueEmpty until
+// then. An item put into an idle queue is released at once, items queued
+// behind it follow at the drain rate. Put blocks while the queue is full
+// unless the queue is set to OverflowDrop, dropped items are reported through
+// DropCounter. Pacing follows the package Clock. The queue implements
+// NonBlocking, Overflowable, DropCounter and StatsReporter.
+func NewLeakyBucketQueue(capacity int, drainPerSecond float64) Queue {
+	var interval time.Duration
+	if drainPerSecond > 0 {
+		interval = time.Duration(float64(time.Second) / drainPerSecond)
+	}
+	return &leakyBucketQueue{
+		queue:    NewBaseQueue("leakybucket", capacity),
+		interval: interval,
+	}
+}
+
+// Name provides the name of the queue
+func (q *leakyBucketQueue) Name() string {
+	return q.queue.Name()
+}
+
+// SetOverflowPolicy sets what Put does while the queue is full
+func (q *leakyBucketQueue) SetOverflowPolicy(policy OverflowPolicy) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.policy = policy
+}
+
+// Put puts an item into the queue, blocking or dropping it while the queue
+// is full depending on the overflow policy
+func (q *leakyBucketQueue) Put(item interface{}) error {
+	q.mu.Lock()
+	policy := q.policy
+	q.mu.Unlock()
+	if policy != OverflowDrop {
+		return q.queue.Put(item)
+	}
+	err := q.queue.TryPut(item)
+	if IsQueueFull(err) {
+		q.mu.Lock()
+		q.dropped++
+		q.mu.Unlock()
+		return nil
+	}
+	return err
+}
+
+// Get gets the next item from the queue, blocking until it is due
+func (q *leakyBucketQueue) Get() (interface{}, error) {
+	q.mu.Lock()
+	wait := q.next.Sub(now())
+	q.mu.Unlock()
+	if wait > 0 {
+		<-after(wait)
+	}
+	item, err := q.queue.Get()
+	if err != nil {
+		return nil, err
+	}
+	// a concurrent get may have taken the release slot waited for
+	wait = q.reserve().Sub(now())
+	if wait > 0 {
+		<-after(wait)
+	}
+	return item, nil
+}
+
+// TryPut puts an item into the queue, returning ErrQueueFull when the queue
+// is full
+func (q *leakyBucketQueue) TryPut(item interface{}) error {
+	return q.queue.TryPut(item)
+}
+
+// TryGet gets the next item from the queue, returning ErrQueueEmpty when
+// the queue is empty or the next item is not due yet
+func (q *leakyBucketQueue) TryGet() (interface{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t := now()
+	if t.Before(q.next) {
+		if q.queue.Closed() && q.queue.Len() == 0 {
+			return nil, ErrQueueClosed
+		}
+		return nil, ErrQueueEmpty
+	}
+	item, err := q.queue.TryGet()
+	if err != nil {
+		return nil, err
+	}
+	q.next = t.Add(q.interval)
+	return item, nil
+}
+
+// Len returns the number of items in the queue
+func (q *leakyBucketQueue) Len() int {
+	return q.queue.Len()
+}
+
+// Cap returns the capacity of the queue
+func (q *leakyBucketQueue) Cap() int {
+	return q.queue.Cap()
+}
+
+// Clear removes all items from the queue
+func (q *leakyBucketQueue) Clear() {
+	q.queue.Clear()
+}
+
+// Reset removes all items, clears statistics and reopens the queue
+func (q *leakyBucketQueue) Reset() {
+	q.queue.Reset()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.next = time.Time{}
+	q.dropped = 0
+}
+
+// Close closes the queue, the items left can still be gotten at the drain
+// rate
+func (q *leakyBucketQueue) Close() error {
+	return q.queue.Close()
+}
+
+// Closed returns whether or not the queue is closed
+func (q *leakyBucketQueue) Closed() bool {
+	return q.queue.Closed()
+}
+
+// Stats returns the current statistics of the queue
+func (q *leakyBucketQueue) Stats() QueueStats {
+	return q.queue.Stats()
+}
+
+// Monitor provides monitoring of the queue
+func (q *leakyBucketQueue) Monitor(mc *MonitorControl) {
+	q.queue.Monitor(mc)
+}
+
+// Dropped returns the number of items dropped because the queue was full
+func (q *leakyBucketQueue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// reserve returns the time of the next release slot and moves the slot
+// after it
+func (q *leakyBucketQueue) reserve() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t := now()
+	if q.next.After(t) {
+		t = q.next
+	}
+	q.next = t.Add(q.interval)
+	return t
+}
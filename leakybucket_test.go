@@ -0,0 +1,123 @@
+package icd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeakyBucketQueueDrainRate(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewLeakyBucketQueue(10, 2)
+	for i := 0; i < 10; i++ {
+		if err := q.Put(i); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	released := make(chan time.Time, 10)
+	go func() {
+		for {
+			_, err := q.Get()
+			if err != nil {
+				close(released)
+				return
+			}
+			released <- c.Now()
+		}
+	}()
+
+	start := c.Now()
+	first := <-released
+	if !first.Equal(start) {
+		t.Errorf("expected the first item at once, got it after %v", first.Sub(start))
+	}
+	for i := 1; i < 10; i++ {
+		waitFor(t, "the next release", func() bool { return c.Waiters() == 1 })
+		c.Advance(500 * time.Millisecond)
+		at := <-released
+		if want := start.Add(time.Duration(i) * 500 * time.Millisecond); !at.Equal(want) {
+			t.Errorf("expected item %d after %v, got %v", i, want.Sub(start), at.Sub(start))
+		}
+	}
+	q.Close()
+	waitFor(t, "the getter to stop", func() bool { return c.Waiters() == 1 })
+	c.Advance(500 * time.Millisecond)
+	if _, ok := <-released; ok {
+		t.Error("expected no item after the queue is drained")
+	}
+}
+
+func TestLeakyBucketQueueTryGet(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewLeakyBucketQueue(10, 1).(NonBlocking)
+	q.TryPut(1)
+	q.TryPut(2)
+	if item, err := q.TryGet(); err != nil || item != 1 {
+		t.Errorf("expected 1 at once, got %v, %v", item, err)
+	}
+	if _, err := q.TryGet(); !IsQueueEmpty(err) {
+		t.Errorf("expected ErrQueueEmpty before the drain interval, got %v", err)
+	}
+	c.Advance(time.Second)
+	if item, err := q.TryGet(); err != nil || item != 2 {
+		t.Errorf("expected 2 after the drain interval, got %v, %v", item, err)
+	}
+	q.(Queue).Close()
+	if _, err := q.TryGet(); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+}
+
+func TestLeakyBucketQueueOverflow(t *testing.T) {
+	q := NewLeakyBucketQueue(2, 1)
+	q.(Overflowable).SetOverflowPolicy(OverflowDrop)
+	for i := 0; i < 5; i++ {
+		if err := q.Put(i); err != nil {
+			t.Errorf("expected dropping puts not to fail, got %v", err)
+		}
+	}
+	if q.Len() != 2 || q.(DropCounter).Dropped() != 3 {
+		t.Errorf("expected 2 queued and 3 dropped, got %d and %d", q.Len(), q.(DropCounter).Dropped())
+	}
+
+	q.(Overflowable).SetOverflowPolicy(OverflowBlock)
+	done := make(chan error)
+	go func() {
+		done <- q.Put(5)
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected the put to block on the full queue")
+	case <-time.After(10 * time.Millisecond):
+	}
+	q.Close()
+	if err := <-done; !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+
+	q.Reset()
+	if q.(DropCounter).Dropped() != 0 {
+		t.Error("expected reset to clear the drop count")
+	}
+	if OverflowDrop.String() != "drop" || OverflowPolicy(7).String() != "OverflowPolicy(7)" {
+		t.Error("unexpected policy names")
+	}
+}
+
+func TestLeakyBucketQueueHidesUnpacedInterfaces(t *testing.T) {
+	q := NewLeakyBucketQueue(10, 1)
+	if _, ok := q.(Taker); ok {
+		t.Error("expected the queue not to let items be taken past the drain rate")
+	}
+	if _, ok := q.(BatchPutter); ok {
+		t.Error("expected the queue not to let batches bypass the overflow policy")
+	}
+	if _, ok := q.(Reserver); ok {
+		t.Error("expected the queue not to let room be reserved past the overflow policy")
+	}
+	if _, ok := q.(StatsReporter); !ok {
+		t.Error("expected the queue to report its statistics")
+	}
+}
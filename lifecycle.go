@@ -0,0 +1,45 @@
+package icd
+
+import (
+	"fmt"
+)
+
+// EventLifecycle is the type of the events reported by Monitor.Lifecycle,
+// the phase is in the field "phase"
+const EventLifecycle = "lifecycle"
+
+// LifecyclePhase is a phase in the life of a plugin
+type LifecyclePhase int
+
+const (
+	// LifecycleStarting is reported when the plugin begins to start
+	LifecycleStarting LifecyclePhase = iota
+	// LifecycleStarted is reported once the plugin runs
+	LifecycleStarted
+	// LifecycleStopping is reported when the plugin begins to stop
+	LifecycleStopping
+	// LifecycleStopped is reported once the plugin stopped
+	LifecycleStopped
+)
+
+// String returns the name of the phase
+func (p LifecyclePhase) String() string {
+	switch p {
+	case LifecycleStarting:
+		return "starting"
+	case LifecycleStarted:
+		return "started"
+	case LifecycleStopping:
+		return "stopping"
+	case LifecycleStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("LifecyclePhase(%d)", int(p))
+	}
+}
+
+// Lifecycle reports that the plugin entered phase as an EventLifecycle
+// event, so lifecycle markers are kept apart from statistics and errors
+func (m *Monitor) Lifecycle(phase LifecyclePhase) {
+	m.Event(EventLifecycle, map[string]string{"phase": phase.String()})
+}
@@ -0,0 +1,32 @@
+package icd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonitorLifecycle(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	m := NewMonitor(newTestMonitorControl())
+	m.Name = "stdin"
+
+	phases := []LifecyclePhase{LifecycleStarting, LifecycleStarted, LifecycleStopping, LifecycleStopped}
+	for _, phase := range phases {
+		m.Lifecycle(phase)
+		c.Advance(time.Second)
+	}
+	start := c.Now().Add(-4 * time.Second)
+	for i, want := range []string{"starting", "started", "stopping", "stopped"} {
+		e := <-m.EventChan
+		if e.Plugin != "stdin" || e.Type != EventLifecycle || e.Fields["phase"] != want {
+			t.Errorf("expected the %s event, got %+v", want, e)
+		}
+		if !e.Time.Equal(start.Add(time.Duration(i) * time.Second)) {
+			t.Errorf("expected the %s event at %v, got %v", want, start.Add(time.Duration(i)*time.Second), e.Time)
+		}
+	}
+	if LifecyclePhase(9).String() != "LifecyclePhase(9)" {
+		t.Errorf("unexpected name %s", LifecyclePhase(9))
+	}
+}
@@ -0,0 +1,250 @@
+package icd
+
+import (
+	"sync"
+)
+
+// EchoSessions is the optional interface for queues handing out sessions
+// with read-your-writes consistency
+type EchoSessions interface {
+	// Session opens a session of the queue
+	Session() *EchoSession
+}
+
+// EchoSession is a handle on a queue with read-your-writes consistency: Get
+// returns the items put through the session, in the order they were put, no
+// matter what is put and gotten through the queue and its other sessions. A
+// session is not safe for concurrent use, each request/reply loop opens its
+// own.
+type EchoSession struct {
+	q      *localEchoQueue
+	id     uint64
+	closed bool
+}
+
+// sharedEchoID is the partition of the items put through the queue itself
+const sharedEchoID = 0
+
+type localEchoQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  map[uint64][]interface{}
+	nextID uint64
+	length int
+	closed bool
+	puts   uint64
+	gets   uint64
+}
+
+// NewLocalEchoQueue creates an unbounded in-memory FIFO queue offering
+// read-your-writes sessions, see EchoSessions. Items put through the queue
+// can be gotten by every consumer of the queue, items put through a session
+// only through that session, so a digester in a request/reply loop gets its
+// own items back in order while others use the queue. Closing a session
+// hands the items left in it to the consumers of the queue, after the items
+// queued already.
+func NewLocalEchoQueue() Queue {
+	q := &localEchoQueue{
+		items:  make(map[uint64][]interface{}),
+		nextID: sharedEchoID + 1,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Name provides the name of the queue
+func (q *localEchoQueue) Name() string {
+	return "localecho"
+}
+
+// Session opens a session of the queue
+func (q *localEchoQueue) Session() *EchoSession {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := &EchoSession{q: q, id: q.nextID}
+	q.nextID++
+	return s
+}
+
+// Put puts an item into the queue for every consumer
+func (q *localEchoQueue) Put(item interface{}) error {
+	return q.put(sharedEchoID, item)
+}
+
+// Get gets the next item put through the queue, or left by a closed
+// session, blocking while there is none
+func (q *localEchoQueue) Get() (interface{}, error) {
+	return q.get(sharedEchoID, nil)
+}
+
+// put appends the item to the partition id
+func (q *localEchoQueue) put(id uint64, item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	q.items[id] = append(q.items[id], item)
+	q.length++
+	q.puts++
+	// the waiters are of different partitions, wake them all
+	q.cond.Broadcast()
+	return nil
+}
+
+// get removes the next item of the partition id, blocking while it has none
+// until the queue, or the session s when not nil, is closed
+func (q *localEchoQueue) get(id uint64, s *EchoSession) (interface{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && (s == nil || !s.closed) && len(q.items[id]) == 0 {
+		q.cond.Wait()
+	}
+	items := q.items[id]
+	if len(items) == 0 || s != nil && s.closed {
+		return nil, ErrQueueClosed
+	}
+	item := items[0]
+	items[0] = nil
+	if len(items) == 1 {
+		delete(q.items, id)
+	} else {
+		q.items[id] = items[1:]
+	}
+	q.length--
+	q.gets++
+	return item, nil
+}
+
+// Put puts an item into the session. Returns ErrQueueClosed when the session
+// or its queue is closed.
+func (s *EchoSession) Put(item interface{}) error {
+	s.q.mu.Lock()
+	closed := s.closed
+	s.q.mu.Unlock()
+	if closed {
+		return ErrQueueClosed
+	}
+	return s.q.put(s.id, item)
+}
+
+// Get gets the next item put through the session, blocking while it has
+// none. Returns ErrQueueClosed once the session is closed, or the queue is
+// closed and the session has no items left.
+func (s *EchoSession) Get() (interface{}, error) {
+	return s.q.get(s.id, s)
+}
+
+// Len returns the number of items of the session
+func (s *EchoSession) Len() int {
+	s.q.mu.Lock()
+	defer s.q.mu.Unlock()
+	return len(s.q.items[s.id])
+}
+
+// Close closes the session, waking a blocked Get, and hands the items left
+// in it to the consumers of the queue
+func (s *EchoSession) Close() error {
+	q := s.q
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	left := q.items[s.id]
+	delete(q.items, s.id)
+	q.items[sharedEchoID] = append(q.items[sharedEchoID], left...)
+	if len(q.items[sharedEchoID]) == 0 {
+		delete(q.items, sharedEchoID)
+	}
+	q.cond.Broadcast()
+	return nil
+}
+
+// Len returns the number of items of the queue and its sessions
+func (q *localEchoQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.length
+}
+
+// Cap returns -1, the queue is unbounded
+func (q *localEchoQueue) Cap() int {
+	return -1
+}
+
+// Clear removes the items of the queue and its sessions
+func (q *localEchoQueue) Clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = make(map[uint64][]interface{})
+	q.length = 0
+}
+
+// Reset removes all items, clears statistics and reopens the queue
+func (q *localEchoQueue) Reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = make(map[uint64][]interface{})
+	q.length = 0
+	q.closed = false
+	q.puts = 0
+	q.gets = 0
+}
+
+// Close closes the queue, waking all blocked callers
+func (q *localEchoQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+	return nil
+}
+
+// Closed returns whether or not the queue is closed
+func (q *localEchoQueue) Closed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// Stats returns the current statistics of the queue
+func (q *localEchoQueue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStats{
+		Name:   q.Name(),
+		Len:    q.length,
+		Cap:    -1,
+		Puts:   q.puts,
+		Gets:   q.gets,
+		Closed: q.closed,
+	}
+}
+
+// Monitor sends the statistics of the queue every second, clears them on
+// request and sends the final statistics on shutdown
+func (q *localEchoQueue) Monitor(mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	for {
+		select {
+		case <-mc.ClearChan:
+			q.mu.Lock()
+			q.puts = 0
+			q.gets = 0
+			q.mu.Unlock()
+		case <-mc.DoneChan:
+			mc.FinalStatsChan <- q.Stats()
+			return
+		case <-after(monitorInterval):
+			select {
+			case mc.StatsChan <- q.Stats():
+			default:
+			}
+		}
+	}
+}
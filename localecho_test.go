@@ -0,0 +1,122 @@
+package icd
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestLocalEchoQueueReadYourWrites(t *testing.T) {
+	q := NewLocalEchoQueue()
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	// others put and get through the queue meanwhile
+	stop := make(chan struct{})
+	var shared sync.WaitGroup
+	shared.Add(1)
+	go func() {
+		defer shared.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			q.Put(-1)
+			q.Get()
+		}
+	}()
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			s := q.(EchoSessions).Session()
+			defer s.Close()
+			for i := 0; i < 200; i++ {
+				want := g*1000 + i
+				s.Put(want)
+				if i%3 == 0 {
+					// several writes in flight
+					s.Put(want + 500)
+					item, _ := s.Get()
+					if item != want {
+						errs <- "out of order"
+						return
+					}
+					want += 500
+				}
+				item, err := s.Get()
+				if err != nil || item != want {
+					errs <- "did not read own write"
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(stop)
+	shared.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if q.Len() != 0 {
+		t.Errorf("expected every item to be echoed, %d left", q.Len())
+	}
+}
+
+func TestLocalEchoQueueIsolatesSessions(t *testing.T) {
+	q := NewLocalEchoQueue()
+	mine := q.(EchoSessions).Session()
+	other := q.(EchoSessions).Session()
+	mine.Put("mine")
+	q.Put("shared")
+	got := make(chan interface{})
+	go func() {
+		item, _ := other.Get()
+		got <- item
+	}()
+	if item, _ := q.Get(); item != "shared" {
+		t.Errorf("expected the shared item, got %v", item)
+	}
+	if item, _ := mine.Get(); item != "mine" {
+		t.Errorf("expected the own item, got %v", item)
+	}
+	other.Close()
+	if item := <-got; item != nil {
+		t.Errorf("expected the other session to get nothing, got %v", item)
+	}
+	if err := other.Put(1); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+
+	q.Close()
+	if err := q.Put(1); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+	q.Reset()
+	q.Put(1)
+	q.Clear()
+	if q.Len() != 0 || q.Cap() != -1 || q.Closed() {
+		t.Error("expected an open empty unbounded queue")
+	}
+}
+
+func TestLocalEchoSessionCloseHandsOverItems(t *testing.T) {
+	q := NewLocalEchoQueue()
+	s := q.(EchoSessions).Session()
+	q.Put("queued")
+	s.Put("left1")
+	s.Put("left2")
+	if s.Len() != 2 || q.Len() != 3 {
+		t.Fatalf("expected 2 session items of 3, got %d of %d", s.Len(), q.Len())
+	}
+	s.Close()
+	for _, want := range []string{"queued", "left1", "left2"} {
+		if item, _ := q.Get(); item != want {
+			t.Errorf("expected %s, got %v", want, item)
+		}
+	}
+	if _, err := s.Get(); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package icd
+
+import (
+	"log"
+	"sync"
+)
+
+// Logger receives the warnings and errors of the helpers within this package
+// which cannot be returned to a caller, e.g. a failed background resize or a
+// panicking close callback. It is pluggable so they can be routed to the
+// logging of reservoird, or captured when testing. *log.Logger implements
+// it.
+type Logger interface {
+	// Printf logs a message, formatted like fmt.Printf
+	Printf(format string, v ...interface{})
+}
+
+type standardLogger struct{}
+
+func (standardLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+var (
+	loggerMu sync.RWMutex
+	logger   Logger = standardLogger{}
+)
+
+// SetLogger replaces the logger used by this package. Passing nil restores
+// the standard logger of package log.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = standardLogger{}
+	}
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = l
+}
+
+// CurrentLogger returns the logger currently used by this package
+func CurrentLogger() Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+func logf(format string, v ...interface{}) {
+	CurrentLogger().Printf(format, v...)
+}
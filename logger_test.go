@@ -0,0 +1,29 @@
+package icd
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestSetLogger(t *testing.T) {
+	var logged bytes.Buffer
+	l := log.New(&logged, "icd: ", 0)
+	SetLogger(l)
+	defer SetLogger(nil)
+	if CurrentLogger() != l {
+		t.Fatal("expected the logger to be replaced")
+	}
+
+	// a plugin without monitor logs its errors
+	r := &runner{name: "plugin"}
+	r.report(errNegative)
+	if got := logged.String(); got != "icd: plugin: negative\n" {
+		t.Errorf("expected the error to reach the logger, got %q", got)
+	}
+
+	SetLogger(nil)
+	if _, ok := CurrentLogger().(standardLogger); !ok {
+		t.Errorf("expected nil to restore the standard logger, got %T", CurrentLogger())
+	}
+}
@@ -0,0 +1,152 @@
+package icd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type metricFamily struct {
+	name     string
+	help     string
+	counter  bool
+	value    func(s QueueStats) float64
+	exemplar bool
+}
+
+var queueMetrics = []metricFamily{
+	{
+		name:  "icd_queue_length",
+		help:  "Number of items in the queue.",
+		value: func(s QueueStats) float64 { return float64(s.Len) },
+	},
+	{
+		name:  "icd_queue_capacity",
+		help:  "Maximum number of items the queue can hold, -1 if unbounded.",
+		value: func(s QueueStats) float64 { return float64(s.Cap) },
+	},
+	{
+		name:     "icd_queue_puts",
+		help:     "Total number of items put into the queue.",
+		counter:  true,
+		value:    func(s QueueStats) float64 { return float64(s.Puts) },
+		exemplar: true,
+	},
+	{
+		name:    "icd_queue_gets",
+		help:    "Total number of items gotten from the queue.",
+		counter: true,
+		value:   func(s QueueStats) float64 { return float64(s.Gets) },
+	},
+	{
+		name: "icd_queue_closed",
+		help: "Whether or not the queue is closed.",
+		value: func(s QueueStats) float64 {
+			if s.Closed {
+				return 1
+			}
+			return 0
+		},
+	},
+}
+
+type histogramFamily struct {
+	name  string
+	help  string
+	value func(s QueueStats) *LatencyHistogram
+}
+
+var queueHistograms = []histogramFamily{
+	{
+		name:  "icd_queue_put_duration_seconds",
+		help:  "Time taken by Put, including the time blocked on a full queue.",
+		value: func(s QueueStats) *LatencyHistogram { return s.PutLatency },
+	},
+	{
+		name:  "icd_queue_get_duration_seconds",
+		help:  "Time taken by Get, including the time blocked on an empty queue.",
+		value: func(s QueueStats) *LatencyHistogram { return s.GetLatency },
+	},
+}
+
+// WritePrometheus writes the statistics of the queues in the Prometheus text
+// exposition format. The histograms of the operation durations are written
+// for the queues which measure them, see BaseQueue.SetLatencyBuckets.
+func WritePrometheus(w io.Writer, stats []QueueStats) error {
+	return writeMetrics(w, stats, false)
+}
+
+// WriteOpenMetrics writes the statistics of the queues in the OpenMetrics
+// text format. The puts counter of a queue carries an exemplar linking it to
+// the trace of the most recent item put, when that item carried a trace id;
+// otherwise the exemplar is omitted.
+func WriteOpenMetrics(w io.Writer, stats []QueueStats) error {
+	return writeMetrics(w, stats, true)
+}
+
+func writeMetrics(w io.Writer, stats []QueueStats, openMetrics bool) error {
+	bw := bufio.NewWriter(w)
+	for _, m := range queueMetrics {
+		family := m.name
+		sample := m.name
+		kind := "gauge"
+		if m.counter {
+			kind = "counter"
+			sample = m.name + "_total"
+			if !openMetrics {
+				family = sample
+			}
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n", family, m.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", family, kind)
+		for _, s := range stats {
+			fmt.Fprintf(bw, "%s{queue=\"%s\"} %v", sample, escapeLabel(s.Name), m.value(s))
+			if openMetrics && m.exemplar && s.LastTraceID != "" {
+				fmt.Fprintf(bw, " # {trace_id=\"%s\"} 1", escapeLabel(s.LastTraceID))
+			}
+			fmt.Fprint(bw, "\n")
+		}
+	}
+	for _, m := range queueHistograms {
+		writeHistogram(bw, m, stats)
+	}
+	if openMetrics {
+		fmt.Fprint(bw, "# EOF\n")
+	}
+	return bw.Flush()
+}
+
+// writeHistogram writes the histogram family for the queues which have it,
+// nothing when none does
+func writeHistogram(w io.Writer, m histogramFamily, stats []QueueStats) {
+	header := false
+	for _, s := range stats {
+		h := m.value(s)
+		if h == nil {
+			continue
+		}
+		if !header {
+			fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+			fmt.Fprintf(w, "# TYPE %s histogram\n", m.name)
+			header = true
+		}
+		queue := escapeLabel(s.Name)
+		var cumulative uint64
+		for i, bound := range h.Bounds {
+			cumulative += h.Counts[i]
+			le := strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)
+			fmt.Fprintf(w, "%s_bucket{queue=\"%s\",le=\"%s\"} %d\n", m.name, queue, le, cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{queue=\"%s\",le=\"+Inf\"} %d\n", m.name, queue, h.Count)
+		fmt.Fprintf(w, "%s_sum{queue=\"%s\"} %v\n", m.name, queue, h.Sum.Seconds())
+		fmt.Fprintf(w, "%s_count{queue=\"%s\"} %d\n", m.name, queue, h.Count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
@@ -0,0 +1,67 @@
+package icd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	var buf bytes.Buffer
+	stats := []QueueStats{{Name: `q"1`, Len: 2, Cap: -1, Puts: 5, Gets: 3, LastTraceID: "abc"}}
+	if err := WritePrometheus(&buf, stats); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE icd_queue_puts_total counter\n",
+		`icd_queue_puts_total{queue="q\"1"} 5` + "\n",
+		`icd_queue_capacity{queue="q\"1"} -1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "trace_id") || strings.Contains(out, "# EOF") {
+		t.Errorf("expected no OpenMetrics syntax, got:\n%s", out)
+	}
+}
+
+func TestWriteOpenMetricsExemplar(t *testing.T) {
+	var buf bytes.Buffer
+	stats := []QueueStats{
+		{Name: "traced", Puts: 5, LastTraceID: "abc"},
+		{Name: "untraced", Puts: 1},
+	}
+	if err := WriteOpenMetrics(&buf, stats); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE icd_queue_puts counter\n",
+		`icd_queue_puts_total{queue="traced"} 5 # {trace_id="abc"} 1` + "\n",
+		`icd_queue_puts_total{queue="untraced"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "trace_id") != 1 {
+		t.Errorf("expected a single exemplar, got:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("expected output to end with # EOF, got:\n%s", out)
+	}
+}
+
+func TestWriteOpenMetricsFromQueue(t *testing.T) {
+	q := NewBaseQueue("queue", 0)
+	env := NewEnvelope(1)
+	env.SetHeader(HeaderTraceID, "xyz")
+	q.Put(env)
+	var buf bytes.Buffer
+	WriteOpenMetrics(&buf, []QueueStats{q.Stats()})
+	if !strings.Contains(buf.String(), `# {trace_id="xyz"} 1`) {
+		t.Errorf("expected the trace id of the last item as exemplar, got:\n%s", buf.String())
+	}
+}
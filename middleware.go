@@ -0,0 +1,44 @@
+package icd
+
+// QueueMiddleware adds a behavior to a queue by wrapping it
+type QueueMiddleware func(Queue) Queue
+
+// Chain wraps q with mws in order: the first middleware wraps q itself and
+// each following one wraps the result, so the last is the outermost and sees
+// a Put first and a Get last. Chain(q, a, b) is b(a(q)).
+func Chain(q Queue, mws ...QueueMiddleware) Queue {
+	for _, mw := range mws {
+		q = mw(q)
+	}
+	return q
+}
+
+// Metered returns the middleware measuring the time items spend in the
+// queue, see NewLatencyQueue
+func Metered() QueueMiddleware {
+	return NewLatencyQueue
+}
+
+// Limited returns the middleware granting the queue at most limits, see
+// NewResourceLimiter
+func Limited(limits ResourceLimits) QueueMiddleware {
+	return func(q Queue) Queue {
+		return NewResourceLimiter(q, limits)
+	}
+}
+
+// Validating returns the middleware checking the items put with validate,
+// see NewValidatingQueue
+func Validating(validate func(interface{}) error) QueueMiddleware {
+	return func(q Queue) Queue {
+		return NewValidatingQueue(q, validate)
+	}
+}
+
+// Audited returns the middleware recording the items put and gotten to
+// sink, see NewAuditQueue
+func Audited(sink AuditSink) QueueMiddleware {
+	return func(q Queue) Queue {
+		return NewAuditQueue(q, sink)
+	}
+}
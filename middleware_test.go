@@ -0,0 +1,54 @@
+package icd
+
+import (
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	sink := &memoryAuditSink{}
+	var validated []interface{}
+	validate := func(item interface{}) error {
+		validated = append(validated, item)
+		return nonNegative(item)
+	}
+	inner := NewBaseQueue("chained", 0)
+	q := Chain(inner, Metered(), Audited(sink), Validating(validate))
+
+	if err := q.Put(-1); err != errNegative {
+		t.Errorf("expected the validation error, got %v", err)
+	}
+	if err := q.Put(1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the outermost middleware sees the items before the others wrap them
+	if len(validated) != 2 || validated[0] != -1 || validated[1] != 1 {
+		t.Errorf("expected validation of the items as put, got %v", validated)
+	}
+	// the innermost middleware wrapped the item past validation
+	got, err := q.Get()
+	env, ok := got.(*Envelope)
+	if err != nil || !ok || env.Payload != 1 {
+		t.Fatalf("expected an envelope of 1, got %v %v", got, err)
+	}
+	q.Close()
+	if sink.count() != 2 {
+		t.Errorf("expected the put and get of 1 to be audited, got %d records", sink.count())
+	}
+	if q.(Validated).Invalid() != 1 {
+		t.Errorf("expected 1 invalid item, got %d", q.(Validated).Invalid())
+	}
+}
+
+func TestLimited(t *testing.T) {
+	q := Chain(NewBaseQueue("q", 0), Limited(ResourceLimits{MaxBytes: 1}))
+	if err := q.Put("ab"); !IsQueueFull(err) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestChainEmpty(t *testing.T) {
+	q := NewBaseQueue("q", 0)
+	if Chain(q) != Queue(q) {
+		t.Error("expected Chain without middlewares to return the queue")
+	}
+}
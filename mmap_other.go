@@ -0,0 +1,20 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package icd
+
+import (
+	"os"
+)
+
+func mmap(f *os.File, size int) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+func munmap(data []byte) error {
+	return ErrNotSupported
+}
+
+func msync(data []byte) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,29 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package icd
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// mmap maps size bytes of f shared into memory
+func mmap(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+// munmap unmaps data mapped by mmap
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
+
+// msync flushes data mapped by mmap to the file
+func msync(data []byte) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), syscall.MS_SYNC)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
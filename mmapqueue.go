@@ -0,0 +1,624 @@
+package icd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sync"
+)
+
+// Layout of a memory-mapped queue file: a header followed by the ring of
+// records. The header holds the magic, the ring size and two slots for the
+// ring offsets. Offsets are committed to the slots alternately, each slot
+// carrying a sequence number and a checksum, so a torn header write leaves
+// the previous slot intact. The file may end before the ring does, after a
+// Compact, and is grown again once a record is written past its end.
+const (
+	mmapMagic      = "ICDMMAP1"
+	mmapHeaderSize = 80
+	mmapSlotOffset = 16
+	mmapSlotSize   = 32
+	mmapRecordSize = 4
+)
+
+// mmapOffsets are the ring offsets of a memory-mapped queue. head and tail
+// only grow, the position in the ring is the offset modulo the ring size.
+type mmapOffsets struct {
+	seq   uint64
+	head  uint64
+	tail  uint64
+	count uint32
+}
+
+type mmapQueue struct {
+	path     string
+	size     uint64
+	codec    Codec
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	file     *os.File
+	data     []byte
+	extent   uint64
+	offsets  mmapOffsets
+	closed   bool
+	puts     uint64
+	gets     uint64
+
+	policy      ErrorPolicy
+	deadLetter  Queue
+	codecErrors uint64
+}
+
+// NewMmapQueue creates a durable FIFO queue storing its items, encoded by
+// codec, in a ring of sizeBytes bytes inside the memory-mapped file at path.
+// Items stay out of the Go heap and a Put or Get costs no syscall. Each item
+// takes the size of its encoding plus 4 bytes of the ring. Like BaseQueue,
+// Put blocks while there is not room for the item and Get blocks while the
+// queue is empty. The queue implements NonBlocking, Persistent, CodecBacked,
+// Compacter, Verifier, Iterable and StatsReporter.
+//
+// The file is created if it does not exist, otherwise the items left in it
+// are gotten first and it must have been created with the same sizeBytes.
+// Items are written before the offsets referencing them are committed, so
+// after a crash the queue holds every item whose Put returned and which was
+// not gotten, except that an item gotten just before the crash may be
+// delivered again. Writes reach the file when the operating system flushes
+// the mapping, or on Sync and Close. Returns ErrNotSupported on platforms
+// without mmap.
+func NewMmapQueue(path string, sizeBytes int, codec Codec) (Queue, error) {
+	if sizeBytes <= mmapRecordSize {
+		return nil, fmt.Errorf("mmap queue size %d too small", sizeBytes)
+	}
+	q := &mmapQueue{
+		path:  path,
+		size:  uint64(sizeBytes),
+		codec: codec,
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	err := q.open()
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// open maps the file, initializing it when new, and loads the offsets
+func (q *mmapQueue) open() error {
+	file, err := os.OpenFile(q.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	total := int64(mmapHeaderSize + q.size)
+	size := info.Size()
+	created := size == 0
+	if created {
+		err = file.Truncate(total)
+		size = total
+	} else if size < mmapHeaderSize || size > total {
+		err = fmt.Errorf("mmap queue file %s is %d bytes, expected %d to %d", q.path, size, mmapHeaderSize, total)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	data, err := mmap(file, int(total))
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("map %s: %w", q.path, err)
+	}
+
+	if created {
+		copy(data, mmapMagic)
+		binary.LittleEndian.PutUint64(data[8:], q.size)
+	} else if string(data[:8]) != mmapMagic || binary.LittleEndian.Uint64(data[8:]) != q.size {
+		munmap(data)
+		file.Close()
+		return fmt.Errorf("%s is not an mmap queue file of size %d", q.path, q.size)
+	}
+	q.file = file
+	q.data = data
+	q.extent = uint64(size - mmapHeaderSize)
+	q.offsets = q.load()
+	return nil
+}
+
+// release flushes and unmaps the file, must be called with mu held
+func (q *mmapQueue) release() error {
+	err := msync(q.data)
+	err2 := munmap(q.data)
+	err3 := q.file.Close()
+	q.data = nil
+	q.file = nil
+	if err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = err3
+	}
+	return err
+}
+
+// Name provides the name of the queue, its path
+func (q *mmapQueue) Name() string {
+	return q.path
+}
+
+// Put encodes the item and puts it into the queue, blocking while there is
+// not room for it. Returns ErrQueueFull when the item is larger than the
+// ring.
+func (q *mmapQueue) Put(item interface{}) error {
+	return q.put(item, true)
+}
+
+// TryPut encodes the item and puts it into the queue, returning ErrQueueFull
+// when there is not room for it
+func (q *mmapQueue) TryPut(item interface{}) error {
+	return q.put(item, false)
+}
+
+// put encodes the item and writes it to the ring, waiting for room when
+// block is set
+func (q *mmapQueue) put(item interface{}, block bool) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	encoded, err := q.codec.Encode(item)
+	if err != nil {
+		return q.codecError(item, fmt.Errorf("encode item for %s: %w", q.path, err))
+	}
+	need := uint64(mmapRecordSize + len(encoded))
+	if need > q.size {
+		return fmt.Errorf("item of %d bytes does not fit into %d byte ring: %w", len(encoded), q.size, ErrQueueFull)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for block && !q.closed && q.free() < need {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.free() < need {
+		return ErrQueueFull
+	}
+	err = q.grow(q.offsets.tail, need)
+	if err != nil {
+		return err
+	}
+	var length [mmapRecordSize]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(encoded)))
+	next := q.offsets
+	q.write(next.tail, length[:])
+	q.write(next.tail+mmapRecordSize, encoded)
+	next.tail += need
+	next.count++
+	q.commit(next)
+	q.puts++
+	q.notEmpty.Signal()
+	return nil
+}
+
+// Get gets and decodes the next item from the queue, blocking while the
+// queue is empty
+func (q *mmapQueue) Get() (interface{}, error) {
+	return q.decode(true)
+}
+
+// TryGet gets and decodes the next item from the queue, returning
+// ErrQueueEmpty when the queue is empty
+func (q *mmapQueue) TryGet() (interface{}, error) {
+	return q.decode(false)
+}
+
+// decode gets and decodes the next item, applying the error policy to items
+// the codec fails on
+func (q *mmapQueue) decode(block bool) (interface{}, error) {
+	for {
+		data, err := q.get(block)
+		if err != nil {
+			return nil, err
+		}
+		item, err := q.codec.Decode(data)
+		if err == nil {
+			return item, nil
+		}
+		err = q.codecError(data, fmt.Errorf("decode item from %s: %w", q.path, err))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// get removes the data of the next item from the ring, waiting while the
+// queue is empty when block is set
+func (q *mmapQueue) get(block bool) ([]byte, error) {
+	q.mu.Lock()
+	for block && !q.closed && q.offsets.count == 0 {
+		q.notEmpty.Wait()
+	}
+	if q.closed {
+		q.mu.Unlock()
+		return nil, ErrQueueClosed
+	}
+	if q.offsets.count == 0 {
+		q.mu.Unlock()
+		return nil, ErrQueueEmpty
+	}
+	next := q.offsets
+	data := q.record(next.head)
+	next.head += uint64(mmapRecordSize + len(data))
+	next.count--
+	q.commit(next)
+	q.gets++
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+	return data, nil
+}
+
+// SetErrorPolicy sets what the queue does with items its codec fails on
+func (q *mmapQueue) SetErrorPolicy(policy ErrorPolicy, deadLetter Queue) error {
+	if policy == ErrorPolicyDeadLetter && deadLetter == nil {
+		return fmt.Errorf("error policy %v of %s requires a dead-letter queue", policy, q.path)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.policy = policy
+	q.deadLetter = deadLetter
+	return nil
+}
+
+// CodecErrors returns the number of items skipped or dead-lettered
+func (q *mmapQueue) CodecErrors() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.codecErrors
+}
+
+// codecError applies the error policy to item, which the codec failed on
+// with err. Returns the error to fail the operation with, nil to go on.
+func (q *mmapQueue) codecError(item interface{}, err error) error {
+	q.mu.Lock()
+	policy := q.policy
+	deadLetter := q.deadLetter
+	if policy != ErrorPolicyFail {
+		q.codecErrors++
+	}
+	q.mu.Unlock()
+
+	switch policy {
+	case ErrorPolicySkip:
+		return nil
+	case ErrorPolicyDeadLetter:
+		dlErr := deadLetter.Put(item)
+		if dlErr != nil {
+			return fmt.Errorf("dead-letter %v: %v", err, dlErr)
+		}
+		return nil
+	default:
+		return err
+	}
+}
+
+// Len returns the number of items in the queue
+func (q *mmapQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int(q.offsets.count)
+}
+
+// Cap returns -1, the queue is bounded by the bytes of its ring rather than
+// a number of items
+func (q *mmapQueue) Cap() int {
+	return -1
+}
+
+// Clear removes all items from the queue, it has no effect once the queue
+// is closed
+func (q *mmapQueue) Clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.clear()
+}
+
+// Reset removes all items, clears statistics and reopens the queue
+func (q *mmapQueue) Reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		err := q.open()
+		if err != nil {
+			logf("reopen of %s failed: %v", q.path, err)
+			return
+		}
+		q.closed = false
+	}
+	q.clear()
+	q.puts = 0
+	q.gets = 0
+}
+
+// Close closes the queue, waking all blocked callers, and flushes and
+// unmaps the file. Unlike BaseQueue, Get returns ErrQueueClosed right away,
+// the remaining items stay in the file until it is opened again.
+func (q *mmapQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	return q.release()
+}
+
+// Closed returns whether or not the queue is closed
+func (q *mmapQueue) Closed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// Sync flushes the queue to the file
+func (q *mmapQueue) Sync() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	return msync(q.data)
+}
+
+// Compact moves the records of the items left to the front of the ring and
+// truncates the file after them, so the file no longer holds the data of
+// items already gotten, and flushes the file. The file grows again as items
+// are put. Compact is safe to run concurrently with Put and Get, which wait
+// for it. The offsets are committed once the records are moved, a crash
+// while they are moved can lose the items left when they overlap the front
+// of the ring.
+func (q *mmapQueue) Compact() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	next := q.offsets
+	live := make([]byte, next.tail-next.head)
+	q.read(next.head, live)
+	if next.head%q.size != 0 {
+		// offsets only grow, the front of the ring is at the next multiple
+		// of its size
+		next.head = (next.tail/q.size + 1) * q.size
+		next.tail = next.head + uint64(len(live))
+		q.write(next.head, live)
+		err := msync(q.data)
+		if err != nil {
+			return err
+		}
+		q.commit(next)
+	}
+	err := msync(q.data)
+	if err != nil {
+		return err
+	}
+	err = q.file.Truncate(int64(mmapHeaderSize + len(live)))
+	if err != nil {
+		return fmt.Errorf("truncate %s: %w", q.path, err)
+	}
+	q.extent = uint64(len(live))
+	return nil
+}
+
+// Verify checks the header, the committed offsets and the framing of every
+// record in the ring, without decoding the items
+func (q *mmapQueue) Verify() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if string(q.data[:8]) != mmapMagic || binary.LittleEndian.Uint64(q.data[8:]) != q.size {
+		return fmt.Errorf("verify %s: corrupt header", q.path)
+	}
+	o := q.offsets
+	if o.seq > 0 && q.load() != o {
+		return fmt.Errorf("verify %s: offsets %d of slot %d do not match the queue", q.path, o.seq, o.seq%2)
+	}
+	if o.head > o.tail || o.tail-o.head > q.size {
+		return fmt.Errorf("verify %s: head %d and tail %d do not fit the ring of %d bytes", q.path, o.head, o.tail, q.size)
+	}
+	offset := o.head
+	for i := uint32(0); i < o.count; i++ {
+		if o.tail-offset < mmapRecordSize {
+			return fmt.Errorf("verify %s: record %d at offset %d overruns the tail %d", q.path, i, offset, o.tail)
+		}
+		var length [mmapRecordSize]byte
+		q.read(offset, length[:])
+		need := uint64(mmapRecordSize) + uint64(binary.LittleEndian.Uint32(length[:]))
+		if o.tail-offset < need {
+			return fmt.Errorf("verify %s: record %d at offset %d of %d bytes overruns the tail %d", q.path, i, offset, need, o.tail)
+		}
+		offset += need
+	}
+	if offset != o.tail {
+		return fmt.Errorf("verify %s: %d records end at offset %d, not at the tail %d", q.path, o.count, offset, o.tail)
+	}
+	return nil
+}
+
+// Each decodes the items of the queue in FIFO order and calls fn for each
+// item until fn returns false, without removing them. Items which fail to
+// decode are passed over unless the error policy is ErrorPolicyFail.
+func (q *mmapQueue) Each(fn func(item interface{}) bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	offset := q.offsets.head
+	for i := uint32(0); i < q.offsets.count; i++ {
+		data := q.record(offset)
+		offset += uint64(mmapRecordSize + len(data))
+		item, err := q.codec.Decode(data)
+		if err != nil && q.policy != ErrorPolicyFail {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("decode item from %s: %w", q.path, err)
+		}
+		if !fn(item) {
+			break
+		}
+	}
+	return nil
+}
+
+// PeekMatch returns the first item for which pred returns true, and whether
+// there is one, without removing it
+func (q *mmapQueue) PeekMatch(pred func(item interface{}) bool) (interface{}, bool, error) {
+	return peekMatch(q, pred)
+}
+
+// Stats returns the current statistics of the queue
+func (q *mmapQueue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStats{
+		Name:   q.path,
+		Len:    int(q.offsets.count),
+		Cap:    -1,
+		Puts:   q.puts,
+		Gets:   q.gets,
+		Closed: q.closed,
+	}
+}
+
+// Monitor sends the statistics of the queue every second, clears them on
+// request and sends the final statistics on shutdown
+func (q *mmapQueue) Monitor(mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	for {
+		select {
+		case <-mc.ClearChan:
+			q.mu.Lock()
+			q.puts = 0
+			q.gets = 0
+			q.mu.Unlock()
+		case <-mc.DoneChan:
+			mc.FinalStatsChan <- q.Stats()
+			return
+		case <-after(monitorInterval):
+			select {
+			case mc.StatsChan <- q.Stats():
+			default:
+			}
+		}
+	}
+}
+
+// free returns the number of unused bytes of the ring, must be called with
+// mu held
+func (q *mmapQueue) free() uint64 {
+	return q.size - (q.offsets.tail - q.offsets.head)
+}
+
+// grow extends the file to back the n bytes of the ring at offset, must be
+// called with mu held
+func (q *mmapQueue) grow(offset, n uint64) error {
+	end := offset%q.size + n
+	if end > q.size {
+		end = q.size
+	}
+	if end <= q.extent {
+		return nil
+	}
+	err := q.file.Truncate(int64(mmapHeaderSize + end))
+	if err != nil {
+		return fmt.Errorf("grow %s: %w", q.path, err)
+	}
+	q.extent = end
+	return nil
+}
+
+// clear empties the ring, must be called with mu held
+func (q *mmapQueue) clear() {
+	next := q.offsets
+	next.head = next.tail
+	next.count = 0
+	q.commit(next)
+	q.notFull.Broadcast()
+}
+
+// write copies b into the ring at offset, wrapping around its end, must be
+// called with mu held
+func (q *mmapQueue) write(offset uint64, b []byte) {
+	ring := q.data[mmapHeaderSize:]
+	pos := offset % q.size
+	n := copy(ring[pos:], b)
+	copy(ring, b[n:])
+}
+
+// read copies len(b) bytes of the ring at offset into b, wrapping around its
+// end, must be called with mu held
+func (q *mmapQueue) read(offset uint64, b []byte) {
+	ring := q.data[mmapHeaderSize:]
+	pos := offset % q.size
+	n := copy(b, ring[pos:])
+	copy(b[n:], ring)
+}
+
+// record returns a copy of the data of the record at offset, must be called
+// with mu held
+func (q *mmapQueue) record(offset uint64) []byte {
+	var length [mmapRecordSize]byte
+	q.read(offset, length[:])
+	data := make([]byte, binary.LittleEndian.Uint32(length[:]))
+	q.read(offset+mmapRecordSize, data)
+	return data
+}
+
+// commit stores next as the current offsets, writing it to the slot not
+// holding the previous offsets, must be called with mu held
+func (q *mmapQueue) commit(next mmapOffsets) {
+	next.seq = q.offsets.seq + 1
+	slot := q.data[mmapSlotOffset+int(next.seq%2)*mmapSlotSize:][:mmapSlotSize]
+	binary.LittleEndian.PutUint64(slot[0:], next.seq)
+	binary.LittleEndian.PutUint64(slot[8:], next.head)
+	binary.LittleEndian.PutUint64(slot[16:], next.tail)
+	binary.LittleEndian.PutUint32(slot[24:], next.count)
+	binary.LittleEndian.PutUint32(slot[28:], crc32.ChecksumIEEE(slot[:28]))
+	q.offsets = next
+}
+
+// load returns the most recently committed offsets whose slot is intact
+func (q *mmapQueue) load() mmapOffsets {
+	var latest mmapOffsets
+	for i := 0; i < 2; i++ {
+		slot := q.data[mmapSlotOffset+i*mmapSlotSize:][:mmapSlotSize]
+		if binary.LittleEndian.Uint32(slot[28:]) != crc32.ChecksumIEEE(slot[:28]) {
+			continue
+		}
+		offsets := mmapOffsets{
+			seq:   binary.LittleEndian.Uint64(slot[0:]),
+			head:  binary.LittleEndian.Uint64(slot[8:]),
+			tail:  binary.LittleEndian.Uint64(slot[16:]),
+			count: binary.LittleEndian.Uint32(slot[24:]),
+		}
+		if offsets.seq >= latest.seq {
+			latest = offsets
+		}
+	}
+	return latest
+}
@@ -0,0 +1,439 @@
+package icd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestMmapQueue(t *testing.T, path string, size int) Queue {
+	t.Helper()
+	q, err := NewMmapQueue(path, size, BytesCodec{})
+	if IsNotSupported(err) {
+		t.Skip("mmap not supported on this platform")
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return q
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "icd")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return dir
+}
+
+func getString(t *testing.T, q Queue) string {
+	t.Helper()
+	item, err := q.Get()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return string(item.([]byte))
+}
+
+func TestMmapQueueSurvivesReopen(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue")
+
+	q := newTestMmapQueue(t, path, 1024)
+	for _, item := range []string{"a", "bb", "ccc"} {
+		if err := q.Put(item); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got := getString(t, q); got != "a" {
+		t.Errorf("expected a, got %s", got)
+	}
+	if err := q.(Persistent).Sync(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := q.Get(); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+
+	q = newTestMmapQueue(t, path, 1024)
+	defer q.Close()
+	if q.Len() != 2 {
+		t.Fatalf("expected 2 items after reopen, got %d", q.Len())
+	}
+	for _, want := range []string{"bb", "ccc"} {
+		if got := getString(t, q); got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestMmapQueueWrapAround(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue")
+
+	// records of 4 + 5..9 bytes do not divide the ring, so they straddle
+	// its end at varying positions
+	q := newTestMmapQueue(t, path, 50)
+	next := 0
+	put := func() {
+		if err := q.Put(fmt.Sprintf("item%d", next)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		next++
+	}
+	want := 0
+	get := func() {
+		if got := getString(t, q); got != fmt.Sprintf("item%d", want) {
+			t.Fatalf("expected item%d, got %s", want, got)
+		}
+		want++
+	}
+
+	put()
+	put()
+	put()
+	for i := 0; i < 40; i++ {
+		put()
+		get()
+		if i%7 == 0 {
+			// reopen with items straddling the end of the ring
+			q.Close()
+			q = newTestMmapQueue(t, path, 50)
+		}
+	}
+	items, err := Items(q)
+	if err != nil || len(items) != 3 || string(items[0].([]byte)) != fmt.Sprintf("item%d", want) {
+		t.Errorf("unexpected items %v %v", items, err)
+	}
+	for q.Len() > 0 {
+		get()
+	}
+	q.Close()
+}
+
+func TestMmapQueueTornHeader(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue")
+
+	q := newTestMmapQueue(t, path, 64)
+	q.Put("a")
+	q.Put("b")
+	q.Close()
+
+	// the second commit went to the first slot, corrupting it leaves the
+	// offsets committed by the first put
+	f, _ := os.OpenFile(path, os.O_RDWR, 0)
+	f.WriteAt([]byte{0xff}, mmapSlotOffset+8)
+	f.Close()
+
+	q = newTestMmapQueue(t, path, 64)
+	defer q.Close()
+	if q.Len() != 1 || getString(t, q) != "a" {
+		t.Errorf("expected to fall back to the offsets holding only a")
+	}
+}
+
+func TestMmapQueueLimits(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue")
+
+	if _, err := NewMmapQueue(path, 4, BytesCodec{}); err == nil {
+		t.Error("expected an error for a ring too small to hold an item")
+	}
+	q := newTestMmapQueue(t, path, 16)
+	if err := q.Put("this item is too large"); !IsQueueFull(err) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	if err := q.Put(1); !IsNotSupported(err) {
+		t.Errorf("expected the codec error, got %v", err)
+	}
+	q.Close()
+	if _, err := NewMmapQueue(path, 32, BytesCodec{}); err == nil {
+		t.Error("expected an error when reopening with another size")
+	}
+}
+
+func TestMmapQueueBlocking(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := newTestMmapQueue(t, filepath.Join(dir, "queue"), 16)
+
+	q.Put("0123456789")
+	put := make(chan error)
+	go func() {
+		put <- q.Put("abc")
+	}()
+	if got := getString(t, q); got != "0123456789" {
+		t.Errorf("expected 0123456789, got %s", got)
+	}
+	if err := <-put; err != nil {
+		t.Errorf("expected the get to make room for the blocked put, got %v", err)
+	}
+	getString(t, q)
+
+	get := make(chan error)
+	go func() {
+		_, err := q.Get()
+		get <- err
+	}()
+	q.Close()
+	if err := <-get; !IsQueueClosed(err) {
+		t.Errorf("expected close to wake the getter with ErrQueueClosed, got %v", err)
+	}
+}
+
+// pickyCodec fails to decode the item "bad"
+type pickyCodec struct {
+	BytesCodec
+}
+
+func (c pickyCodec) Decode(data []byte) (interface{}, error) {
+	if string(data) == "bad" {
+		return nil, errors.New("malformed item")
+	}
+	return c.BytesCodec.Decode(data)
+}
+
+func newPolicyQueue(t *testing.T, dir string, policy ErrorPolicy, deadLetter Queue) Queue {
+	t.Helper()
+	q, err := NewMmapQueue(filepath.Join(dir, policy.String()), 256, pickyCodec{})
+	if IsNotSupported(err) {
+		t.Skip("mmap not supported on this platform")
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := q.(CodecBacked).SetErrorPolicy(policy, deadLetter); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	q.Put("bad")
+	q.Put("good")
+	return q
+}
+
+func TestMmapQueueErrorPolicyFail(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := newPolicyQueue(t, dir, ErrorPolicyFail, nil)
+	defer q.Close()
+
+	if err := q.Put(1); !IsNotSupported(err) {
+		t.Errorf("expected the encode error, got %v", err)
+	}
+	if _, err := q.Get(); err == nil || !strings.Contains(err.Error(), "malformed item") {
+		t.Errorf("expected the decode error, got %v", err)
+	}
+	if got := getString(t, q); got != "good" {
+		t.Errorf("expected good, got %s", got)
+	}
+	if n := q.(CodecBacked).CodecErrors(); n != 0 {
+		t.Errorf("expected no counted errors, got %d", n)
+	}
+}
+
+func TestMmapQueueErrorPolicySkip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := newPolicyQueue(t, dir, ErrorPolicySkip, nil)
+	defer q.Close()
+
+	if err := q.Put(1); err != nil {
+		t.Errorf("expected the unencodable item to be skipped, got %v", err)
+	}
+	items, _ := Items(q)
+	if len(items) != 1 {
+		t.Errorf("expected Each to pass over the bad item, got %v", items)
+	}
+	if got := getString(t, q); got != "good" {
+		t.Errorf("expected the bad item to be skipped, got %s", got)
+	}
+	if n := q.(CodecBacked).CodecErrors(); n != 2 {
+		t.Errorf("expected 2 counted errors, got %d", n)
+	}
+}
+
+func TestMmapQueueErrorPolicyDeadLetter(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	unset := newTestMmapQueue(t, filepath.Join(dir, "unset"), 64)
+	if unset.(CodecBacked).SetErrorPolicy(ErrorPolicyDeadLetter, nil) == nil {
+		t.Error("expected an error without a dead-letter queue")
+	}
+	unset.Close()
+
+	deadLetter := NewBaseQueue("dead-letter", 0)
+	q := newPolicyQueue(t, dir, ErrorPolicyDeadLetter, deadLetter)
+	defer q.Close()
+
+	q.Put(1)
+	if got := getString(t, q); got != "good" {
+		t.Errorf("expected the bad item to be dead-lettered, got %s", got)
+	}
+	items, _ := Items(deadLetter)
+	if len(items) != 2 || items[0] != 1 || string(items[1].([]byte)) != "bad" {
+		t.Errorf("expected the unencodable item and the undecodable bytes, got %v", items)
+	}
+	if n := q.(CodecBacked).CodecErrors(); n != 2 {
+		t.Errorf("expected 2 counted errors, got %d", n)
+	}
+}
+
+func TestMmapQueueCompact(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue")
+	q := newTestMmapQueue(t, path, 64)
+
+	// fill, then consume the first items, leaving their data in the file
+	for _, item := range []string{"consumed1", "consumed2", "live1", "live2"} {
+		q.Put(item)
+	}
+	getString(t, q)
+	getString(t, q)
+	if err := q.(Compacter).Compact(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	// only the live records, 4 length bytes plus 5 data bytes each, remain
+	if len(data) != mmapHeaderSize+2*(4+5) {
+		t.Errorf("expected the file to shrink to the live records, got %d bytes", len(data))
+	}
+	if strings.Contains(string(data), "consumed") {
+		t.Error("expected the data of consumed items to be reclaimed")
+	}
+	if err := q.(Verifier).Verify(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// the file grows again for items put after the compaction
+	if err := q.Put("live3"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Size() != mmapHeaderSize+3*(4+5) {
+		t.Errorf("expected the file to grow by one record, got %d bytes", info.Size())
+	}
+
+	q.Close()
+	q = newTestMmapQueue(t, path, 64)
+	defer q.Close()
+	for _, want := range []string{"live1", "live2", "live3"} {
+		if got := getString(t, q); got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+
+	// an empty queue compacts to its header, a wrapping put grows it to the
+	// whole ring
+	if err := q.(Compacter).Compact(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Size() != mmapHeaderSize {
+		t.Errorf("expected only the header to remain, got %d bytes", info.Size())
+	}
+	for i := 0; i < 8; i++ {
+		if err := q.Put("123456"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		getString(t, q)
+	}
+	if info, _ := os.Stat(path); info.Size() != mmapHeaderSize+64 {
+		t.Errorf("expected the ring to be backed by the file, got %d bytes", info.Size())
+	}
+
+	// records wrapping around the end of the ring are moved in order
+	for _, item := range []string{"wrap01", "wrap02", "wrap03", "wrap04", "wrap05"} {
+		q.Put(item)
+	}
+	getString(t, q)
+	if err := q.(Compacter).Compact(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info, _ := os.Stat(path); info.Size() != mmapHeaderSize+4*(4+6) {
+		t.Errorf("expected the file to shrink to the live records, got %d bytes", info.Size())
+	}
+	if err := q.(Verifier).Verify(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"wrap02", "wrap03", "wrap04", "wrap05"} {
+		if got := getString(t, q); got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestMmapQueueNonBlocking(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := newTestMmapQueue(t, filepath.Join(dir, "queue"), 16)
+	defer q.Close()
+	nb := q.(NonBlocking)
+
+	if _, err := nb.TryGet(); !IsQueueEmpty(err) {
+		t.Errorf("expected ErrQueueEmpty, got %v", err)
+	}
+	// each item takes its length plus 4 bytes of the 16 byte ring
+	if err := nb.TryPut("123"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := nb.TryPut("12345"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := nb.TryPut("x"); !IsQueueFull(err) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	if item, err := nb.TryGet(); err != nil || string(item.([]byte)) != "123" {
+		t.Errorf("expected 123, got %v, %v", item, err)
+	}
+	q.Close()
+	if err := nb.TryPut("x"); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+	if _, err := nb.TryGet(); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+}
+
+func TestMmapQueueVerify(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue")
+
+	q := newTestMmapQueue(t, path, 64)
+	if err := q.(Verifier).Verify(); err != nil {
+		t.Errorf("expected a new queue to verify, got %v", err)
+	}
+	for _, item := range []string{"a", "bb", "ccc"} {
+		q.Put(item)
+	}
+	getString(t, q)
+	if err := q.(Verifier).Verify(); err != nil {
+		t.Errorf("expected a healthy queue to verify, got %v", err)
+	}
+	q.Close()
+
+	// the length of bb, following the record of a, claims more bytes than
+	// the ring holds
+	f, _ := os.OpenFile(path, os.O_RDWR, 0)
+	f.WriteAt([]byte{200}, mmapHeaderSize+mmapRecordSize+1)
+	f.Close()
+
+	q = newTestMmapQueue(t, path, 64)
+	defer q.Close()
+	err := q.(Verifier).Verify()
+	if err == nil || !strings.Contains(err.Error(), "record 0 at offset 5 of 204 bytes overruns the tail 18") {
+		t.Errorf("expected the overrun of the corrupt record, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package icd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errorBuffer is the number of errors a Monitor buffers for reservoird
+const errorBuffer = 100
+
+// eventBuffer is the number of events a Monitor buffers for reservoird
+const eventBuffer = 100
+
+// Monitor contains what is needed to report on a plugin to reservoird
+type Monitor struct {
+	// Name of the plugin reported on
+	Name string
+	// The channel to send statistics messages
+	StatsChan chan interface{}
+	// The channel to send final stats before shutting down. Only send on
+	// shutdown.
+	FinalStatsChan chan interface{}
+	// The channel to receive the clear message to clear statistics
+	ClearChan chan struct{}
+	// The channel errors are sent to, errors reported while it is full are
+	// dropped
+	ErrorChan chan error
+	// The channel events are sent to, events reported while it is full are
+	// dropped
+	EventChan chan Event
+
+	mu        sync.Mutex
+	throttled map[string]*ThrottledError
+	spill     *statsSpill
+	// lifetime totals of the Summary
+	started   time.Time
+	processed uint64
+	errors    uint64
+	lastError string
+	// the statistics message last sent, for Snapshot
+	latest  interface{}
+	updated time.Time
+}
+
+// Monitored is the optional interface for plugins which report errors and
+// events through a Monitor. Reservoird sets the monitor before running the
+// plugin, plugins without one log their errors instead.
+type Monitored interface {
+	// SetMonitor sets the monitor the plugin reports to
+	SetMonitor(m *Monitor)
+}
+
+// NewMonitor creates a monitor sharing the statistics channels of mc, with a
+// buffered error channel
+func NewMonitor(mc *MonitorControl) *Monitor {
+	return &Monitor{
+		StatsChan:      mc.StatsChan,
+		FinalStatsChan: mc.FinalStatsChan,
+		ClearChan:      mc.ClearChan,
+		ErrorChan:      make(chan error, errorBuffer),
+		EventChan:      make(chan Event, eventBuffer),
+		throttled:      make(map[string]*ThrottledError),
+		started:        now(),
+	}
+}
+
+// Event is a structured record of something that happened to a plugin
+type Event struct {
+	// Name of the plugin the event happened to
+	Plugin string `json:"plugin"`
+	// Type of the event, e.g. "lifecycle"
+	Type string `json:"type"`
+	// When the event happened
+	Time time.Time `json:"time"`
+	// Details of the event
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// ThrottledError is reported by ErrorThrottled for an error which occurred
+// more than once within the window
+type ThrottledError struct {
+	// The first occurrence of the error
+	Err error
+	// Number of occurrences within the window
+	Count int
+}
+
+// Error returns the message of the error annotated with its count
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%v (%d occurrences)", e.Err, e.Count)
+}
+
+// Unwrap returns the first occurrence of the error
+func (e *ThrottledError) Unwrap() error {
+	return e.Err
+}
+
+// Error reports err to reservoird without blocking
+func (m *Monitor) Error(err error) {
+	m.countError(err)
+	m.sendError(err)
+}
+
+// sendError sends err to reservoird, dropping it when ErrorChan is full
+func (m *Monitor) sendError(err error) {
+	select {
+	case m.ErrorChan <- err:
+	default:
+	}
+}
+
+// Event reports an event of the given type with fields to reservoird
+// without blocking. The time of the event follows the package Clock.
+func (m *Monitor) Event(eventType string, fields map[string]string) {
+	e := Event{
+		Plugin: m.Name,
+		Type:   eventType,
+		Time:   now(),
+		Fields: fields,
+	}
+	select {
+	case m.EventChan <- e:
+	default:
+	}
+}
+
+// ErrorThrottled reports err to reservoird, coalescing errors with the same
+// message. The first occurrence opens a window of the given length and the
+// error is reported when the window closes, as is if it occurred once and
+// as a ThrottledError counting the occurrences otherwise. The window follows
+// the package Clock.
+func (m *Monitor) ErrorThrottled(err error, window time.Duration) {
+	m.countError(err)
+	key := err.Error()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending, ok := m.throttled[key]
+	if ok {
+		pending.Count++
+		return
+	}
+	if m.throttled == nil {
+		m.throttled = make(map[string]*ThrottledError)
+	}
+	pending = &ThrottledError{Err: err, Count: 1}
+	m.throttled[key] = pending
+
+	go func() {
+		<-after(window)
+		m.mu.Lock()
+		delete(m.throttled, key)
+		m.mu.Unlock()
+		if pending.Count == 1 {
+			m.sendError(pending.Err)
+		} else {
+			m.sendError(pending)
+		}
+	}()
+}
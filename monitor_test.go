@@ -0,0 +1,69 @@
+package icd
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMonitorError(t *testing.T) {
+	m := NewMonitor(newTestMonitorControl())
+	for i := 0; i < errorBuffer+1; i++ {
+		m.Error(errors.New("failed"))
+	}
+	if len(m.ErrorChan) != errorBuffer {
+		t.Errorf("expected errors beyond the buffer to be dropped, got %d", len(m.ErrorChan))
+	}
+}
+
+func TestMonitorErrorThrottled(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	m := NewMonitor(newTestMonitorControl())
+
+	first := errors.New("connection refused")
+	m.ErrorThrottled(first, time.Minute)
+	for i := 0; i < 4; i++ {
+		m.ErrorThrottled(errors.New("connection refused"), time.Minute)
+	}
+	m.ErrorThrottled(errors.New("timeout"), time.Minute)
+	waitFor(t, "the windows to open", func() bool { return c.Waiters() == 2 })
+	if len(m.ErrorChan) != 0 {
+		t.Fatal("expected nothing reported before the window closes")
+	}
+
+	c.Advance(time.Minute)
+	for i := 0; i < 2; i++ {
+		err := <-m.ErrorChan
+		if te, ok := err.(*ThrottledError); ok {
+			if te.Count != 5 || !errors.Is(err, first) {
+				t.Errorf("expected 5 coalesced occurrences of the first error, got %v", err)
+			}
+		} else if err.Error() != "timeout" {
+			t.Errorf("expected the single error as is, got %v", err)
+		}
+	}
+
+	// a new window opens once the previous one closed
+	m.ErrorThrottled(first, time.Minute)
+	waitFor(t, "the window to open", func() bool { return c.Waiters() == 1 })
+	c.Advance(time.Minute)
+	if err := <-m.ErrorChan; err != first {
+		t.Errorf("expected the error of the new window, got %v", err)
+	}
+}
+
+func TestMonitorEvent(t *testing.T) {
+	m := NewMonitor(newTestMonitorControl())
+	m.Name = "plugin"
+	for i := 0; i < eventBuffer+1; i++ {
+		m.Event("test", map[string]string{"n": "1"})
+	}
+	if len(m.EventChan) != eventBuffer {
+		t.Errorf("expected events beyond the buffer to be dropped, got %d", len(m.EventChan))
+	}
+	e := <-m.EventChan
+	if e.Plugin != "plugin" || e.Type != "test" || e.Fields["n"] != "1" {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
@@ -0,0 +1,28 @@
+package icd
+
+import (
+	"time"
+)
+
+// Stats is what a Monitor accounts for its plugin at one point in time, for
+// pull-based scrapers reading it on request instead of from the stats channel
+type Stats struct {
+	Summary
+	// The statistics message last sent with SendStats, nil before the first
+	Latest interface{} `json:"latest,omitempty"`
+	// When Latest was sent, following the package Clock
+	Updated time.Time `json:"updated,omitempty"`
+}
+
+// Snapshot returns the current Stats of the monitor synchronously, e.g. for
+// an HTTP scrape handler. The totals and the latest statistics message are
+// read together, so they are consistent with each other.
+func (m *Monitor) Snapshot() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return Stats{
+		Summary: m.summary(),
+		Latest:  m.latest,
+		Updated: m.updated,
+	}
+}
@@ -0,0 +1,57 @@
+package icd
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMonitorSnapshot(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	m := NewMonitor(newTestMonitorControl())
+	m.Name = "plugin"
+	if s := m.Snapshot(); s.Latest != nil || !s.Updated.IsZero() {
+		t.Errorf("expected no statistics before the first, got %+v", s)
+	}
+
+	m.Processed(3)
+	m.Error(errors.New("first"))
+	c.Advance(time.Second)
+	m.SendStats(PluginStats{Name: "plugin", Received: 3})
+	sent := now()
+	c.Advance(time.Second)
+	m.Processed(2)
+	m.Error(errors.New("second"))
+
+	s := m.Snapshot()
+	if s.Name != "plugin" || s.ItemsProcessed != 5 || s.Errors != 2 || s.LastError != "second" || s.Uptime != 2*time.Second {
+		t.Errorf("expected the current totals, got %+v", s.Summary)
+	}
+	if s.Latest != (PluginStats{Name: "plugin", Received: 3}) || !s.Updated.Equal(sent) {
+		t.Errorf("expected the statistics last sent, got %+v at %v", s.Latest, s.Updated)
+	}
+}
+
+func TestMonitorSnapshotConcurrent(t *testing.T) {
+	m := NewMonitor(newTestMonitorControl())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 1000; i++ {
+			m.Processed(1)
+			m.SendStats(i)
+		}
+	}()
+	for done := false; !done; {
+		s := m.Snapshot()
+		// the statistics are sent after counting, so they never run ahead
+		if s.Latest != nil && uint64(s.Latest.(int)) > s.ItemsProcessed {
+			t.Fatalf("inconsistent snapshot %+v", s)
+		}
+		done = s.Latest == 1000
+	}
+	wg.Wait()
+}
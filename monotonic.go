@@ -0,0 +1,72 @@
+package icd
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Watermarked is the optional interface for queues which track the value of
+// the last item accepted
+type Watermarked interface {
+	// LastAccepted returns the value of the last item accepted, and whether
+	// or not an item was accepted
+	LastAccepted() (int64, bool)
+}
+
+type monotonicQueue struct {
+	Queue
+	extract  func(interface{}) int64
+	mu       sync.Mutex
+	last     int64
+	accepted bool
+}
+
+// NewMonotonicQueue wraps q so that the values extract returns for the items
+// put are strictly increasing: Put rejects an item whose value is not
+// greater than the value of the last accepted item with an error wrapping
+// ErrOutOfOrder. An item the wrapped queue fails to accept does not count as
+// accepted. Reset forgets the last accepted value.
+func NewMonotonicQueue(q Queue, extract func(interface{}) int64) Queue {
+	return &monotonicQueue{
+		Queue:   q,
+		extract: extract,
+	}
+}
+
+// Put puts the item into the queue if its value follows the last accepted
+func (q *monotonicQueue) Put(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	v := q.extract(item)
+
+	// hold the lock across Put so the order checked is the enqueue order
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.accepted && v <= q.last {
+		return fmt.Errorf("value %d does not follow %d: %w", v, q.last, ErrOutOfOrder)
+	}
+	err := q.Queue.Put(item)
+	if err != nil {
+		return err
+	}
+	q.last = v
+	q.accepted = true
+	return nil
+}
+
+// LastAccepted returns the value of the last accepted item
+func (q *monotonicQueue) LastAccepted() (int64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.last, q.accepted
+}
+
+// Reset resets the wrapped queue and forgets the last accepted value
+func (q *monotonicQueue) Reset() {
+	q.mu.Lock()
+	q.last = 0
+	q.accepted = false
+	q.mu.Unlock()
+	q.Queue.Reset()
+}
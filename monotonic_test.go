@@ -0,0 +1,55 @@
+package icd
+
+import (
+	"testing"
+)
+
+func offset(item interface{}) int64 {
+	return int64(item.(int))
+}
+
+func TestMonotonicQueue(t *testing.T) {
+	q := NewMonotonicQueue(NewBaseQueue("offsets", 0), offset)
+	if _, ok := q.(Watermarked).LastAccepted(); ok {
+		t.Error("expected nothing accepted yet")
+	}
+	for _, v := range []int{-5, 1, 7} {
+		if err := q.Put(v); err != nil {
+			t.Fatalf("expected %d to be accepted, got %v", v, err)
+		}
+		if last, ok := q.(Watermarked).LastAccepted(); !ok || last != int64(v) {
+			t.Errorf("expected last accepted %d, got %d", v, last)
+		}
+	}
+	for _, v := range []int{7, 3} {
+		if err := q.Put(v); !IsOutOfOrder(err) {
+			t.Errorf("expected %d to be rejected with ErrOutOfOrder, got %v", v, err)
+		}
+	}
+	if last, _ := q.(Watermarked).LastAccepted(); last != 7 || q.Len() != 3 {
+		t.Errorf("expected rejections to leave the queue alone, last %d len %d", last, q.Len())
+	}
+	if err := q.Put(8); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMonotonicQueueFailedPut(t *testing.T) {
+	inner := NewBaseQueue("offsets", 0)
+	q := NewMonotonicQueue(inner, offset)
+	q.Put(1)
+	inner.Close()
+	if err := q.Put(5); !IsQueueClosed(err) {
+		t.Fatalf("expected ErrQueueClosed, got %v", err)
+	}
+	if last, _ := q.(Watermarked).LastAccepted(); last != 1 {
+		t.Errorf("expected a failed put not to count as accepted, got %d", last)
+	}
+	q.Reset()
+	if _, ok := q.(Watermarked).LastAccepted(); ok {
+		t.Error("expected reset to forget the last accepted value")
+	}
+	if err := q.Put(0); err != nil {
+		t.Errorf("unexpected error after reset: %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package icd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// MultiSinkBuffer is how many items a MultiSinkExpeller buffers for each
+	// sink
+	MultiSinkBuffer = 100
+	// MultiSinkFailures is how many consecutive failed writes open the
+	// circuit of a sink of a MultiSinkExpeller
+	MultiSinkFailures = 5
+	// MultiSinkCooldown is how long the circuit of a sink stays open before
+	// the sink is tried again
+	MultiSinkCooldown = 10 * time.Second
+)
+
+// SinkHealthReporter is the optional interface for expellers delivering to
+// several sinks which report the health of each sink
+type SinkHealthReporter interface {
+	// SinkHealth returns the current health of every sink
+	SinkHealth() []ComponentHealth
+}
+
+type sinkWorker struct {
+	name      string
+	sink      Sink
+	items     chan interface{}
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	lastErr   error
+	dropped   uint64
+}
+
+// record updates the circuit of the sink with the result of a write
+func (w *sinkWorker) record(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err == nil {
+		w.failures = 0
+		w.lastErr = nil
+		w.openUntil = time.Time{}
+		return
+	}
+	w.failures++
+	w.lastErr = err
+	if w.failures >= MultiSinkFailures {
+		w.openUntil = now().Add(MultiSinkCooldown)
+	}
+}
+
+// cooldown returns how long the circuit of the sink stays open
+func (w *sinkWorker) cooldown() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.openUntil.IsZero() {
+		return 0
+	}
+	return w.openUntil.Sub(now())
+}
+
+func (w *sinkWorker) drop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.dropped++
+}
+
+func (w *sinkWorker) health() Health {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case w.failures >= MultiSinkFailures:
+		return Health{Status: HealthUnhealthy, Message: fmt.Sprintf("circuit open: %v", w.lastErr)}
+	case w.failures > 0:
+		return Health{Status: HealthDegraded, Message: w.lastErr.Error()}
+	default:
+		return Health{Status: HealthHealthy}
+	}
+}
+
+type multiSinkExpeller struct {
+	runner
+	workers []*sinkWorker
+	mu      sync.Mutex
+	stopped bool
+}
+
+// MultiSinkExpeller creates an expeller delivering every item of its receive
+// queues to each of sinks, concurrently and independently, so a slow or
+// failing sink does not hold back the others. Each sink has a buffer of
+// MultiSinkBuffer items, an item arriving while the buffer of a sink is full
+// is dropped for that sink. MultiSinkFailures consecutive failed writes open
+// the circuit of a sink: its items stay buffered, or are dropped once the
+// buffer is full, until after MultiSinkCooldown the next item is tried. A
+// failed write is reported and its item dropped for that sink. Sent counts
+// the items written to a sink, Dropped those dropped, see DropCounter, and
+// SinkHealth the health of each sink, named by its Name() when it has one and
+// its position otherwise. When the expeller stops every sink gets its
+// buffered items, except those of a sink whose circuit is open, which are
+// dropped.
+func MultiSinkExpeller(name string, sinks []Sink) Expeller {
+	e := &multiSinkExpeller{
+		runner: runner{name: name, kind: KindExpeller},
+	}
+	for i, sink := range sinks {
+		e.workers = append(e.workers, &sinkWorker{
+			name:  componentName(sink, i),
+			sink:  sink,
+			items: make(chan interface{}, MultiSinkBuffer),
+		})
+	}
+	return e
+}
+
+// Expel delivers the items of rcv to the sinks until every queue is closed
+func (e *multiSinkExpeller) Expel(rcv []Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	e.start()
+	defer e.stop(mc)
+
+	e.mu.Lock()
+	e.stopped = false
+	e.mu.Unlock()
+	quit := make(chan struct{})
+	var workers sync.WaitGroup
+	for _, w := range e.workers {
+		workers.Add(1)
+		go func(w *sinkWorker) {
+			defer workers.Done()
+			e.deliver(w, quit)
+		}(w)
+	}
+
+	stop := make(chan struct{})
+	items, closed := fanIn(rcv, stop, e.dispatch)
+	for !e.poll(mc) && e.next(items, closed, mc) {
+	}
+
+	close(stop)
+	e.mu.Lock()
+	e.stopped = true
+	e.mu.Unlock()
+	close(quit)
+	workers.Wait()
+}
+
+// next dispatches the next item, returns false once every receive queue is
+// closed
+func (e *multiSinkExpeller) next(items <-chan interface{}, closed <-chan struct{}, mc *MonitorControl) bool {
+	select {
+	case item := <-items:
+		e.addReceived(1)
+		e.dispatch(item)
+	case <-closed:
+		return false
+	case <-mc.DoneChan:
+	}
+	return true
+}
+
+// dispatch buffers item for every sink, dropping it for the sinks whose
+// buffer is full and for all once the expeller stopped
+func (e *multiSinkExpeller) dispatch(item interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, w := range e.workers {
+		if e.stopped {
+			w.drop()
+			continue
+		}
+		select {
+		case w.items <- item:
+		default:
+			w.drop()
+		}
+	}
+}
+
+// deliver writes the buffered items to the sink of w until quit is closed,
+// then writes the items left in the buffer
+func (e *multiSinkExpeller) deliver(w *sinkWorker, quit <-chan struct{}) {
+	for {
+		select {
+		case item := <-w.items:
+			e.write(w, item, quit)
+		case <-quit:
+			for {
+				select {
+				case item := <-w.items:
+					e.write(w, item, quit)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write writes item to the sink of w once its circuit is closed, it drops
+// the item when quit is closed while the circuit is open
+func (e *multiSinkExpeller) write(w *sinkWorker, item interface{}, quit <-chan struct{}) {
+	wait := w.cooldown()
+	if wait > 0 {
+		select {
+		case <-after(wait):
+		case <-quit:
+			w.drop()
+			return
+		}
+	}
+	err := w.sink.Write(item)
+	w.record(err)
+	if err != nil {
+		w.drop()
+		e.report(fmt.Errorf("write %s: %w", w.name, err))
+		return
+	}
+	e.addSent(1)
+}
+
+// Dropped returns the number of items dropped, summed over the sinks
+func (e *multiSinkExpeller) Dropped() uint64 {
+	var dropped uint64
+	for _, w := range e.workers {
+		w.mu.Lock()
+		dropped += w.dropped
+		w.mu.Unlock()
+	}
+	return dropped
+}
+
+// SinkHealth returns the health of every sink, in the order of the sinks
+func (e *multiSinkExpeller) SinkHealth() []ComponentHealth {
+	var components []ComponentHealth
+	for _, w := range e.workers {
+		components = append(components, ComponentHealth{
+			Name:   w.name,
+			Health: w.health(),
+		})
+	}
+	return components
+}
+
+// Health returns unhealthy when no sink is healthy, degraded when some sinks
+// are not and healthy otherwise
+func (e *multiSinkExpeller) Health() Health {
+	var impaired []string
+	healthy := 0
+	for _, c := range e.SinkHealth() {
+		if c.Status == HealthHealthy {
+			healthy++
+			continue
+		}
+		impaired = append(impaired, c.Name)
+	}
+	switch {
+	case len(impaired) == 0:
+		return Health{Status: HealthHealthy}
+	case healthy == 0:
+		return Health{Status: HealthUnhealthy, Message: "no healthy sink"}
+	default:
+		return Health{Status: HealthDegraded, Message: "impaired sinks: " + strings.Join(impaired, ", ")}
+	}
+}
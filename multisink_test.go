@@ -0,0 +1,157 @@
+package icd
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+// flakySink fails its first failures writes
+type flakySink struct {
+	sliceSink
+	failures int
+	writes   int
+}
+
+func (s *flakySink) Write(item interface{}) error {
+	s.mu.Lock()
+	s.writes++
+	failed := s.writes <= s.failures
+	s.mu.Unlock()
+	if failed {
+		return errors.New("sink down")
+	}
+	return s.sliceSink.Write(item)
+}
+
+func (s *flakySink) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+// blockingSink blocks every write until release is closed
+type blockingSink struct {
+	sliceSink
+	release chan struct{}
+	blocked int32
+}
+
+func (s *blockingSink) Write(item interface{}) error {
+	atomic.AddInt32(&s.blocked, 1)
+	<-s.release
+	return s.sliceSink.Write(item)
+}
+
+func TestMultiSinkExpellerIsolatesFailingSink(t *testing.T) {
+	useFakeClock()
+	defer SetClock(nil)
+	good1 := &sliceSink{}
+	failing := &flakySink{failures: 1000}
+	good2 := &sliceSink{}
+	e := MultiSinkExpeller("multi", []Sink{good1, failing, good2})
+	m := NewMonitor(newTestMonitorControl())
+	e.(Monitored).SetMonitor(m)
+
+	rcv := NewBaseQueue("rcv", 0)
+	for i := 0; i < 20; i++ {
+		rcv.Put(i)
+	}
+	rcv.Close()
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	e.Expel([]Queue{rcv}, mc)
+
+	for _, sink := range []*sliceSink{good1, good2} {
+		if len(sink.items) != 20 {
+			t.Fatalf("expected the healthy sinks to get every item, got %v", sink.items)
+		}
+		for i, item := range sink.items {
+			if item != i {
+				t.Errorf("expected item %d in order, got %v", i, item)
+			}
+		}
+	}
+	// the open circuit stops writes to the failing sink
+	if failing.writes != MultiSinkFailures {
+		t.Errorf("expected %d writes to the failing sink, got %d", MultiSinkFailures, failing.writes)
+	}
+	if len(m.ErrorChan) != MultiSinkFailures {
+		t.Errorf("expected the failed writes to be reported, got %d errors", len(m.ErrorChan))
+	}
+	if dropped := e.(DropCounter).Dropped(); dropped != 20 {
+		t.Errorf("expected the items of the failing sink to be dropped, got %d", dropped)
+	}
+	health := e.(SinkHealthReporter).SinkHealth()
+	if len(health) != 3 || health[0].Status != HealthHealthy || health[1].Status != HealthUnhealthy || health[2].Status != HealthHealthy {
+		t.Errorf("unexpected sink health %+v", health)
+	}
+	if health[1].Name != "1" {
+		t.Errorf("expected an unnamed sink to be named by its position, got %q", health[1].Name)
+	}
+	if h := e.(HealthReporter).Health(); h.Status != HealthDegraded || h.Message != "impaired sinks: 1" {
+		t.Errorf("expected degraded health, got %+v", h)
+	}
+	final := (<-mc.FinalStatsChan).(PluginStats)
+	if final.Received != 20 || final.Sent != 40 {
+		t.Errorf("unexpected final stats %+v", final)
+	}
+}
+
+func TestMultiSinkExpellerCircuitRecovers(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	sink := &flakySink{failures: MultiSinkFailures}
+	e := MultiSinkExpeller("multi", []Sink{sink})
+	e.(Monitored).SetMonitor(NewMonitor(newTestMonitorControl()))
+
+	rcv := NewBaseQueue("rcv", 0)
+	for i := 0; i < MultiSinkFailures+2; i++ {
+		rcv.Put(i)
+	}
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go e.Expel([]Queue{rcv}, mc)
+
+	waitFor(t, "the circuit to open", func() bool { return c.Waiters() == 1 })
+	if h := e.(HealthReporter).Health(); h.Status != HealthUnhealthy {
+		t.Errorf("expected unhealthy while the circuit is open, got %+v", h)
+	}
+	c.Advance(MultiSinkCooldown)
+	waitFor(t, "the sink to recover", func() bool { return sink.Len() == 2 })
+	if h := e.(HealthReporter).Health(); h.Status != HealthHealthy {
+		t.Errorf("expected healthy after recovery, got %+v", h)
+	}
+	rcv.Close()
+	mc.WaitGroup.Wait()
+}
+
+func TestMultiSinkExpellerSlowSink(t *testing.T) {
+	defer func(buffer int) { MultiSinkBuffer = buffer }(MultiSinkBuffer)
+	MultiSinkBuffer = 2
+	fast := &flakySink{}
+	slow := &blockingSink{release: make(chan struct{})}
+	e := MultiSinkExpeller("multi", []Sink{fast, slow})
+
+	rcv := NewBaseQueue("rcv", 0)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go e.Expel([]Queue{rcv}, mc)
+	// the blocked sink does not hold back the other one
+	for i := 0; i < 10; i++ {
+		rcv.Put(i)
+		waitFor(t, "the fast sink", func() bool { return fast.Len() == i+1 })
+		if i == 0 {
+			waitFor(t, "the slow sink to block", func() bool { return atomic.LoadInt32(&slow.blocked) == 1 })
+		}
+	}
+	if dropped := e.(DropCounter).Dropped(); dropped != 7 {
+		t.Errorf("expected 7 items to be dropped for the blocked sink, got %d", dropped)
+	}
+	close(slow.release)
+	rcv.Close()
+	mc.WaitGroup.Wait()
+	if len(slow.items) != 3 {
+		t.Errorf("expected the blocked sink to get its buffered items, got %v", slow.items)
+	}
+}
@@ -0,0 +1,33 @@
+package icd
+
+// CloseNotifier is the optional interface for queues which run callbacks
+// when they close
+type CloseNotifier interface {
+	// OnClose registers fn to be called once, with the reason the queue
+	// closed, when the queue next closes. Callbacks run in registration
+	// order after the queue closed, a panicking callback is recovered and
+	// logged so the others still run. fn is called at once when the queue
+	// is already closed.
+	OnClose(fn func(err error))
+
+	// CloseWithError closes the queue for the reason err, Close closes it
+	// for the reason nil
+	CloseWithError(err error) error
+}
+
+// runOnClose calls the close callbacks of the queue named name with reason
+func runOnClose(name string, callbacks []func(err error), reason error) {
+	for _, fn := range callbacks {
+		runCloseCallback(name, fn, reason)
+	}
+}
+
+func runCloseCallback(name string, fn func(err error), reason error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			logf("warning: recovered panic in close callback of %s: %v", name, r)
+		}
+	}()
+	fn(reason)
+}
@@ -0,0 +1,60 @@
+package icd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOnCloseCallbacks(t *testing.T) {
+	var n CloseNotifier = NewBaseQueue("q", 0)
+	q := n.(Queue)
+	var calls []string
+	var reasons []error
+	n.OnClose(func(err error) {
+		calls = append(calls, "first")
+		reasons = append(reasons, err)
+	})
+	n.OnClose(func(err error) {
+		panic("broken callback")
+	})
+	n.OnClose(func(err error) {
+		calls = append(calls, "third")
+		reasons = append(reasons, err)
+	})
+
+	reason := errors.New("upstream gone")
+	n.CloseWithError(reason)
+	q.Close()
+	if len(calls) != 2 || calls[0] != "first" || calls[1] != "third" {
+		t.Fatalf("expected the callbacks once in order despite the panic, got %v", calls)
+	}
+	if reasons[0] != reason || reasons[1] != reason {
+		t.Errorf("expected the close reason, got %v", reasons)
+	}
+
+	// registered on a closed queue it runs at once
+	var late error
+	n.OnClose(func(err error) { late = err })
+	if late != reason {
+		t.Errorf("expected the reason of the close, got %v", late)
+	}
+}
+
+func TestOnCloseAfterReset(t *testing.T) {
+	q := NewBaseQueue("q", 0)
+	q.Close()
+	q.Reset()
+	called := 0
+	var reason error = errors.New("unset")
+	q.OnClose(func(err error) {
+		called++
+		reason = err
+	})
+	if called != 0 {
+		t.Fatal("expected the callback to wait for the reopened queue to close")
+	}
+	q.Close()
+	if called != 1 || reason != nil {
+		t.Errorf("expected one call with a nil reason, got %d and %v", called, reason)
+	}
+}
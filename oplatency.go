@@ -0,0 +1,91 @@
+package icd
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// LatencyOpPut names the histogram of the durations of Put
+	LatencyOpPut = "put"
+	// LatencyOpGet names the histogram of the durations of Get
+	LatencyOpGet = "get"
+)
+
+// OpLatencyRecorder is the optional interface for queues which measure how
+// long their operations take, including the time blocked on a full or empty
+// queue
+type OpLatencyRecorder interface {
+	// LatencyHistogram returns a copy of the histogram of the durations
+	// of op, LatencyOpPut or LatencyOpGet, nil when op is not measured
+	LatencyHistogram(op string) *LatencyHistogram
+}
+
+// SetLatencyBuckets makes the queue measure the durations of successful
+// blocking Puts and Gets into histograms with buckets bounded by bounds,
+// which must be ascending, see OpLatencyRecorder. The histograms are
+// reported as QueueStats.PutLatency and GetLatency and start over, nil
+// bounds stop the measurement. The clear message of Monitor and Reset empty
+// the histograms. The durations follow the package Clock.
+func (q *BaseQueue) SetLatencyBuckets(bounds []time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if bounds == nil {
+		q.putLatency = nil
+		q.getLatency = nil
+		atomic.StoreInt32(&q.timed, 0)
+		return
+	}
+	q.putLatency = NewLatencyHistogram(bounds)
+	q.getLatency = NewLatencyHistogram(bounds)
+	atomic.StoreInt32(&q.timed, 1)
+}
+
+// LatencyHistogram returns a copy of the histogram of the durations of op
+func (q *BaseQueue) LatencyHistogram(op string) *LatencyHistogram {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var h *LatencyHistogram
+	switch op {
+	case LatencyOpPut:
+		h = q.putLatency
+	case LatencyOpGet:
+		h = q.getLatency
+	}
+	return copyHistogram(h)
+}
+
+// copyHistogram returns a copy of h, nil when h is nil
+func copyHistogram(h *LatencyHistogram) *LatencyHistogram {
+	if h == nil {
+		return nil
+	}
+	return h.copy()
+}
+
+// startTimer returns the start time of an operation, zero when operations
+// are not measured
+func (q *BaseQueue) startTimer() time.Time {
+	if atomic.LoadInt32(&q.timed) == 0 {
+		return time.Time{}
+	}
+	return now()
+}
+
+// observe counts the duration of an operation started at start into h, must
+// be called with mu held
+func observe(h *LatencyHistogram, start time.Time) {
+	if h == nil || start.IsZero() {
+		return
+	}
+	h.Observe(now().Sub(start))
+}
+
+// clearLatency empties the histograms of the operations, must be called with
+// mu held
+func (q *BaseQueue) clearLatency() {
+	if q.putLatency != nil {
+		q.putLatency = NewLatencyHistogram(q.putLatency.Bounds)
+		q.getLatency = NewLatencyHistogram(q.getLatency.Bounds)
+	}
+}
@@ -0,0 +1,98 @@
+package icd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBaseQueueLatencyHistograms(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewBaseQueue("timed", 1)
+	q.SetLatencyBuckets([]time.Duration{time.Second, time.Minute})
+
+	// a put blocked on the full queue for 30s
+	q.Put("a")
+	put := make(chan error, 1)
+	go func() {
+		put <- q.Put("b")
+	}()
+	waitFor(t, "the blocked put", func() bool { return q.BlockedProducers() == 1 })
+	c.Advance(30 * time.Second)
+	q.Get()
+	<-put
+	q.Get()
+
+	// a get blocked on the empty queue for 2m
+	got := make(chan error, 1)
+	go func() {
+		_, err := q.Get()
+		got <- err
+	}()
+	waitFor(t, "the blocked get", func() bool { return q.BlockedConsumers() == 1 })
+	c.Advance(2 * time.Minute)
+	q.Put("c")
+	<-got
+
+	puts := q.LatencyHistogram(LatencyOpPut)
+	if puts.Count != 3 || puts.Counts[0] != 2 || puts.Counts[1] != 1 || puts.Counts[2] != 0 || puts.Sum != 30*time.Second {
+		t.Errorf("unexpected put histogram %+v", puts)
+	}
+	gets := q.Stats().GetLatency
+	if gets.Count != 3 || gets.Counts[0] != 2 || gets.Counts[1] != 0 || gets.Counts[2] != 1 || gets.Sum != 2*time.Minute {
+		t.Errorf("unexpected get histogram %+v", gets)
+	}
+
+	var buf bytes.Buffer
+	WritePrometheus(&buf, []QueueStats{q.Stats(), NewBaseQueue("untimed", 0).Stats()})
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE icd_queue_put_duration_seconds histogram\n",
+		`icd_queue_put_duration_seconds_bucket{queue="timed",le="1"} 2` + "\n",
+		`icd_queue_put_duration_seconds_bucket{queue="timed",le="60"} 3` + "\n",
+		`icd_queue_put_duration_seconds_bucket{queue="timed",le="+Inf"} 3` + "\n",
+		`icd_queue_put_duration_seconds_sum{queue="timed"} 30` + "\n",
+		`icd_queue_put_duration_seconds_count{queue="timed"} 3` + "\n",
+		`icd_queue_get_duration_seconds_bucket{queue="timed",le="60"} 2` + "\n",
+		`icd_queue_get_duration_seconds_bucket{queue="timed",le="+Inf"} 3` + "\n",
+		`icd_queue_get_duration_seconds_sum{queue="timed"} 120` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `duration_seconds_count{queue="untimed"}`) {
+		t.Errorf("expected no histogram for the untimed queue, got:\n%s", out)
+	}
+}
+
+func TestBaseQueueLatencyHistogramsClear(t *testing.T) {
+	useFakeClock()
+	defer SetClock(nil)
+	q := NewBaseQueue("timed", 0)
+	if q.LatencyHistogram(LatencyOpPut) != nil {
+		t.Error("expected no histogram before SetLatencyBuckets")
+	}
+	q.SetLatencyBuckets(LatencyBuckets)
+	q.Put("a")
+	if q.LatencyHistogram(LatencyOpPut).Count != 1 || q.LatencyHistogram("bogus") != nil {
+		t.Error("expected a put histogram and none for an unknown op")
+	}
+	q.Reset()
+	if q.LatencyHistogram(LatencyOpPut).Count != 0 {
+		t.Error("expected reset to empty the histograms")
+	}
+	q.SetLatencyBuckets(nil)
+	q.Put("a")
+	if q.LatencyHistogram(LatencyOpPut) != nil || q.Stats().PutLatency != nil {
+		t.Error("expected nil buckets to stop the measurement")
+	}
+
+	var buf bytes.Buffer
+	WritePrometheus(&buf, []QueueStats{q.Stats()})
+	if strings.Contains(buf.String(), "duration_seconds") {
+		t.Errorf("expected no histogram family without histograms, got:\n%s", buf.String())
+	}
+}
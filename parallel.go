@@ -0,0 +1,103 @@
+package icd
+
+import (
+	"fmt"
+	"sync"
+)
+
+type parallelResult struct {
+	item interface{}
+	err  error
+}
+
+type parallelJob struct {
+	item   interface{}
+	result chan parallelResult
+}
+
+type parallelOrderedDigester struct {
+	runner
+	workers   int
+	transform func(interface{}) (interface{}, error)
+	// what transform does, for the errors reported
+	op string
+}
+
+// ParallelOrderedDigester creates a digester which runs transform on
+// workers items at a time while sending the results in the order the items
+// were received. An item whose transform fails is dropped and the error
+// reported through the Monitor set with SetMonitor, a nil result drops the
+// item silently. At most twice workers items are in flight, the results
+// already in flight are flushed when the digester stops. A workers count
+// below 1 is raised to 1.
+func ParallelOrderedDigester(name string, workers int, transform func(interface{}) (interface{}, error)) Digester {
+	if workers < 1 {
+		workers = 1
+	}
+	return &parallelOrderedDigester{
+		runner:    runner{name: name, kind: KindDigester},
+		workers:   workers,
+		transform: transform,
+		op:        "transform",
+	}
+}
+
+// Digest transforms the items from rcv in parallel and sends the results to
+// snd in order until rcv is closed or reservoird shuts down
+func (d *parallelOrderedDigester) Digest(rcv Queue, snd Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	d.start()
+	defer d.stop(mc)
+
+	jobs := make(chan parallelJob)
+	pending := make(chan chan parallelResult, d.workers)
+	var workers sync.WaitGroup
+	workers.Add(d.workers)
+	for i := 0; i < d.workers; i++ {
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				item, err := d.transform(job.item)
+				job.result <- parallelResult{item: item, err: err}
+			}
+		}()
+	}
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for result := range pending {
+			d.send(snd, <-result)
+		}
+	}()
+
+	for !d.poll(mc) {
+		item, err := getOrDone(rcv, mc.DoneChan)
+		if err != nil {
+			break
+		}
+		d.addReceived(1)
+		result := make(chan parallelResult, 1)
+		pending <- result
+		jobs <- parallelJob{item: item, result: result}
+	}
+
+	close(jobs)
+	close(pending)
+	workers.Wait()
+	<-sent
+	snd.Close()
+}
+
+// send forwards the result of a transform, reporting it when it failed
+func (d *parallelOrderedDigester) send(snd Queue, result parallelResult) {
+	if result.err != nil {
+		d.report(fmt.Errorf("%s: %w", d.op, result.err))
+		return
+	}
+	if result.item == nil {
+		return
+	}
+	if snd.Put(result.item) == nil {
+		d.addSent(1)
+	}
+}
@@ -0,0 +1,144 @@
+package icd
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParallelOrderedDigesterKeepsOrder(t *testing.T) {
+	const workers = 4
+	var mu sync.Mutex
+	running, peak := 0, 0
+	transform := func(item interface{}) (interface{}, error) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		// later items finish first
+		time.Sleep(time.Duration(workers-item.(int)%workers) * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return item.(int) * 10, nil
+	}
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	d := ParallelOrderedDigester("parallel", workers, transform)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	for i := 0; i < 40; i++ {
+		rcv.Put(i)
+	}
+	rcv.Close()
+	go d.Digest(rcv, snd, mc)
+	mc.WaitGroup.Wait()
+
+	for i := 0; i < 40; i++ {
+		item, err := snd.Get()
+		if err != nil || item != i*10 {
+			t.Fatalf("expected %d at position %d, got %v, %v", i*10, i, item, err)
+		}
+	}
+	if !snd.Closed() {
+		t.Error("expected the send queue to be closed")
+	}
+	if peak < 2 || peak > workers {
+		t.Errorf("expected up to %d transforms in parallel, got %d", workers, peak)
+	}
+	final := (<-mc.FinalStatsChan).(PluginStats)
+	if final.Received != 40 || final.Sent != 40 {
+		t.Errorf("unexpected final stats %+v", final)
+	}
+}
+
+func TestParallelOrderedDigesterReportsErrors(t *testing.T) {
+	transform := func(item interface{}) (interface{}, error) {
+		if item.(int)%2 == 1 {
+			return nil, errors.New("odd")
+		}
+		return item, nil
+	}
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	d := ParallelOrderedDigester("parallel", 3, transform)
+	mc := newTestMonitorControl()
+	m := NewMonitor(mc)
+	d.(Monitored).SetMonitor(m)
+	mc.WaitGroup.Add(1)
+	for i := 0; i < 6; i++ {
+		rcv.Put(i)
+	}
+	rcv.Close()
+	go d.Digest(rcv, snd, mc)
+	mc.WaitGroup.Wait()
+
+	for _, want := range []int{0, 2, 4} {
+		item, _ := snd.Get()
+		if item != want {
+			t.Errorf("expected %d, got %v", want, item)
+		}
+	}
+	if snd.Len() != 0 || len(m.ErrorChan) != 3 {
+		t.Errorf("expected the 3 failed items to be reported, got %d errors", len(m.ErrorChan))
+	}
+	err := <-m.ErrorChan
+	if err.Error() != "transform: odd" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestParallelOrderedDigesterFlushesOnShutdown(t *testing.T) {
+	release := make(chan struct{})
+	transform := func(item interface{}) (interface{}, error) {
+		<-release
+		return item, nil
+	}
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	d := ParallelOrderedDigester("parallel", 2, transform)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go d.Digest(rcv, snd, mc)
+	rcv.Put("a")
+	rcv.Put("b")
+	waitFor(t, "items to be received", func() bool { return rcv.Len() == 0 })
+	close(mc.DoneChan)
+	rcv.Put("c")
+	close(release)
+	mc.WaitGroup.Wait()
+
+	for _, want := range []string{"a", "b"} {
+		item, _ := snd.Get()
+		if item != want {
+			t.Errorf("expected in flight item %s to be flushed, got %v", want, item)
+		}
+	}
+	if !snd.Closed() {
+		t.Error("expected the send queue to be closed")
+	}
+}
+
+func TestParallelOrderedDigesterStopsWhileWaiting(t *testing.T) {
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	d := ParallelOrderedDigester("parallel", 2, func(item interface{}) (interface{}, error) {
+		return item, nil
+	})
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go d.Digest(rcv, snd, mc)
+
+	// the digester waits on the open, empty receive queue when reservoird
+	// shuts down
+	rcv.Put("a")
+	waitFor(t, "the item to be sent", func() bool { return snd.Len() == 1 })
+	close(mc.DoneChan)
+	mc.WaitGroup.Wait()
+	if !snd.Closed() {
+		t.Error("expected the send queue to be closed")
+	}
+}
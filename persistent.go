@@ -0,0 +1,108 @@
+package icd
+
+import (
+	"fmt"
+)
+
+// Codec converts items to and from bytes, for queues which store their items
+// outside of the Go heap
+type Codec interface {
+	// Encode returns the bytes representing item
+	Encode(item interface{}) ([]byte, error)
+
+	// Decode returns the item represented by data. data is only valid for
+	// the duration of the call, so Decode must copy what it keeps.
+	Decode(data []byte) (interface{}, error)
+}
+
+// Persistent is the optional interface for queues whose items survive a
+// restart of reservoird
+type Persistent interface {
+	// Sync flushes the items of the queue to durable storage
+	Sync() error
+}
+
+// Verifier is the optional interface for persistent queues which can check
+// their storage for corruption, e.g. after a crash. Reservoird verifies the
+// queues implementing it on startup, before serving their items.
+type Verifier interface {
+	// Verify checks the invariants of the stored queue and returns an error
+	// describing the first inconsistency, nil when there is none
+	Verify() error
+}
+
+// Compacter is the optional interface for file-backed queues which can
+// reclaim the space of consumed items
+type Compacter interface {
+	// Compact rewrites the remaining items to the front of the storage and
+	// releases the space of the items already gotten, leaving the remaining
+	// items intact
+	Compact() error
+}
+
+// ErrorPolicy is what a codec-backed queue does with an item its Codec fails
+// to encode or decode
+type ErrorPolicy int
+
+const (
+	// ErrorPolicyFail fails the Put or Get with the codec error, the item is
+	// lost
+	ErrorPolicyFail ErrorPolicy = iota
+	// ErrorPolicySkip drops the item and counts it, a Get moves on to the
+	// next item
+	ErrorPolicySkip
+	// ErrorPolicyDeadLetter counts the item and puts it into the dead-letter
+	// queue, as is when encoding failed and as its encoded []byte when
+	// decoding failed, a Get moves on to the next item
+	ErrorPolicyDeadLetter
+)
+
+// String returns the name of the policy
+func (p ErrorPolicy) String() string {
+	switch p {
+	case ErrorPolicyFail:
+		return "fail"
+	case ErrorPolicySkip:
+		return "skip"
+	case ErrorPolicyDeadLetter:
+		return "dead-letter"
+	default:
+		return fmt.Sprintf("ErrorPolicy(%d)", int(p))
+	}
+}
+
+// CodecBacked is the optional interface for queues which store their items
+// encoded by a Codec
+type CodecBacked interface {
+	// SetErrorPolicy sets what the queue does with items its Codec fails
+	// on, deadLetter is required by ErrorPolicyDeadLetter and ignored
+	// otherwise. The default is ErrorPolicyFail.
+	SetErrorPolicy(policy ErrorPolicy, deadLetter Queue) error
+
+	// CodecErrors returns the number of items skipped or dead-lettered
+	CodecErrors() uint64
+}
+
+// BytesCodec is the Codec for []byte items, strings are encoded as their
+// bytes. Decoded items are always []byte.
+type BytesCodec struct{}
+
+// Encode returns item as bytes, ErrNotSupported when it is neither a []byte
+// nor a string
+func (BytesCodec) Encode(item interface{}) ([]byte, error) {
+	switch v := item.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, fmt.Errorf("encode %T: %w", item, ErrNotSupported)
+	}
+}
+
+// Decode returns a copy of data
+func (BytesCodec) Decode(data []byte) (interface{}, error) {
+	item := make([]byte, len(data))
+	copy(item, data)
+	return item, nil
+}
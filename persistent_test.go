@@ -0,0 +1,42 @@
+package icd
+
+import (
+	"testing"
+)
+
+func TestBytesCodec(t *testing.T) {
+	var codec Codec = BytesCodec{}
+	for _, item := range []interface{}{[]byte("abc"), "abc"} {
+		data, err := codec.Encode(item)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		decoded, _ := codec.Decode(data)
+		if string(decoded.([]byte)) != "abc" {
+			t.Errorf("expected abc, got %v", decoded)
+		}
+	}
+	if _, err := codec.Encode(1); !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+
+	data := []byte("abc")
+	decoded, _ := codec.Decode(data)
+	data[0] = 'x'
+	if string(decoded.([]byte)) != "abc" {
+		t.Error("expected Decode to copy the data")
+	}
+}
+
+func TestErrorPolicyString(t *testing.T) {
+	for policy, want := range map[ErrorPolicy]string{
+		ErrorPolicyFail:       "fail",
+		ErrorPolicySkip:       "skip",
+		ErrorPolicyDeadLetter: "dead-letter",
+		ErrorPolicy(7):        "ErrorPolicy(7)",
+	} {
+		if policy.String() != want {
+			t.Errorf("expected %s, got %s", want, policy.String())
+		}
+	}
+}
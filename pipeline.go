@@ -0,0 +1,171 @@
+package icd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Connected is the optional interface for plugins which report the queues
+// they are connected to
+type Connected interface {
+	// Inputs returns the queues the plugin receives from
+	Inputs() []Queue
+
+	// Outputs returns the queues the plugin sends to
+	Outputs() []Queue
+}
+
+// Stage is a running plugin together with the queues it is connected to
+type Stage interface {
+	Connected
+
+	// Name returns the name of the plugin
+	Name() string
+
+	// Kind returns the kind of the plugin
+	Kind() Kind
+
+	// Running returns whether or not the plugin is running
+	Running() bool
+}
+
+// PipelineStage is a plugin of a pipeline together with its queues, it
+// implements Stage
+type PipelineStage struct {
+	// The ingester, digester or expeller
+	Plugin interface{}
+	// The queues the plugin receives from
+	Rcv []Queue
+	// The queues the plugin sends to
+	Snd []Queue
+}
+
+// Name returns the name of the plugin of the stage
+func (s PipelineStage) Name() string {
+	return pluginName(s.Plugin)
+}
+
+// Kind returns the kind of the plugin of the stage
+func (s PipelineStage) Kind() Kind {
+	return KindOf(s.Plugin)
+}
+
+// Running returns whether or not the plugin of the stage is running, false
+// for plugins which do not report it
+func (s PipelineStage) Running() bool {
+	r, ok := s.Plugin.(interface{ Running() bool })
+	return ok && r.Running()
+}
+
+// Started returns whether or not the plugin of the stage started, true for
+// plugins which do not report it
+func (s PipelineStage) Started() bool {
+	st, ok := s.Plugin.(interface{ Started() bool })
+	return !ok || st.Started()
+}
+
+// Inputs returns the queues the plugin receives from
+func (s PipelineStage) Inputs() []Queue {
+	return s.Rcv
+}
+
+// Outputs returns the queues the plugin sends to
+func (s PipelineStage) Outputs() []Queue {
+	return s.Snd
+}
+
+// Pipeline describes how reservoird wired its plugins together, for
+// introspection of the running system
+type Pipeline struct {
+	mu     sync.Mutex
+	stages []PipelineStage
+}
+
+// NewPipeline creates an empty pipeline
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+// Add adds plugin, receiving from rcv and sending to snd, to the pipeline.
+// When plugin implements Connected, the queues it reports are used instead
+// of rcv and snd.
+func (p *Pipeline) Add(plugin interface{}, rcv []Queue, snd []Queue) {
+	c, ok := plugin.(Connected)
+	if ok {
+		rcv = c.Inputs()
+		snd = c.Outputs()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stages = append(p.stages, PipelineStage{Plugin: plugin, Rcv: rcv, Snd: snd})
+}
+
+// Stages returns the stages of the pipeline in the order they were added
+func (p *Pipeline) Stages() []PipelineStage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stages := make([]PipelineStage, len(p.stages))
+	copy(stages, p.stages)
+	return stages
+}
+
+// DetectCycles returns an error naming the path of a cycle when items can
+// flow from a queue of the pipeline back into it, e.g. a digester sending to
+// the queue it receives from, and nil otherwise. Such pipelines deadlock or
+// loop forever, so reservoird runs it before starting the plugins. The path
+// names the nodes like Topology does, e.g. "queue:a -> stage:d -> queue:a".
+func (p *Pipeline) DetectCycles() error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	stages := p.Stages()
+	receivers := map[Queue][]int{}
+	for i, s := range stages {
+		for _, q := range s.Inputs() {
+			receivers[q] = append(receivers[q], i)
+		}
+	}
+	state := make([]int, len(stages))
+	// the path from the stage the search started at, and where each stage
+	// being visited is on it
+	var path []string
+	at := make([]int, len(stages))
+	var visit func(i int) []string
+	visit = func(i int) []string {
+		state[i] = visiting
+		at[i] = len(path)
+		path = append(path, "stage:"+stages[i].Name())
+		for _, q := range stages[i].Outputs() {
+			path = append(path, "queue:"+q.Name())
+			for _, j := range receivers[q] {
+				switch state[j] {
+				case visiting:
+					cycle := append([]string{path[len(path)-1]}, path[at[j]:]...)
+					return cycle
+				case unvisited:
+					cycle := visit(j)
+					if cycle != nil {
+						return cycle
+					}
+				}
+			}
+			path = path[:len(path)-1]
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return nil
+	}
+	for i := range stages {
+		if state[i] != unvisited {
+			continue
+		}
+		cycle := visit(i)
+		if cycle != nil {
+			return fmt.Errorf("pipeline has a cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package icd
+
+import (
+	"testing"
+	"time"
+)
+
+// testIngester puts its items into snd
+type testIngester struct {
+	runner
+	items []interface{}
+}
+
+func (i *testIngester) Ingest(snd Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	i.start()
+	defer i.stop(mc)
+	for _, item := range i.items {
+		if snd.Put(item) == nil {
+			i.addSent(1)
+		}
+	}
+	snd.Close()
+}
+
+// connectedDigester reports its own queues
+type connectedDigester struct {
+	Digester
+	rcv Queue
+	snd Queue
+}
+
+func (d connectedDigester) Inputs() []Queue  { return []Queue{d.rcv} }
+func (d connectedDigester) Outputs() []Queue { return []Queue{d.snd} }
+
+func TestPipelineAdd(t *testing.T) {
+	in := NewBaseQueue("in", 0)
+	out := NewBaseQueue("out", 0)
+	p := NewPipeline()
+	p.Add(&testIngester{runner: runner{name: "source"}}, nil, []Queue{in})
+	p.Add(connectedDigester{
+		Digester: WindowDigester("window", time.Second, count),
+		rcv:      in,
+		snd:      out,
+	}, nil, nil)
+
+	stages := p.Stages()
+	if len(stages) != 2 {
+		t.Fatalf("expected 2 stages, got %d", len(stages))
+	}
+	if stages[0].Name() != "source" || stages[0].Kind() != KindIngester || stages[0].Outputs()[0] != in {
+		t.Errorf("unexpected first stage %+v", stages[0])
+	}
+	if stages[1].Name() != "window" || stages[1].Inputs()[0] != in || stages[1].Outputs()[0] != out {
+		t.Errorf("expected the queues reported by the plugin, got %+v", stages[1])
+	}
+}
+
+func TestPipelineDetectCycles(t *testing.T) {
+	a := NewBaseQueue("a", 0)
+	b := NewBaseQueue("b", 0)
+	c := NewBaseQueue("c", 0)
+	p := NewPipeline()
+	p.Add(&testIngester{runner: runner{name: "source"}}, nil, []Queue{a})
+	p.Add(WindowDigester("first", time.Second, count), []Queue{a}, []Queue{b})
+	p.Add(WindowDigester("second", time.Second, count), []Queue{a}, []Queue{b})
+	p.Add(WindowDigester("third", time.Second, count), []Queue{b}, []Queue{c})
+	if err := p.DetectCycles(); err != nil {
+		t.Fatalf("unexpected cycle in an acyclic pipeline: %v", err)
+	}
+
+	p.Add(WindowDigester("back", time.Second, count), []Queue{c}, []Queue{a})
+	err := p.DetectCycles()
+	want := "pipeline has a cycle: queue:a -> stage:first -> queue:b -> stage:third -> queue:c -> stage:back -> queue:a"
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
+
+func TestPipelineDetectCyclesSelfLoop(t *testing.T) {
+	a := NewBaseQueue("a", 0)
+	p := NewPipeline()
+	p.Add(WindowDigester("loop", time.Second, count), []Queue{a}, []Queue{a})
+	err := p.DetectCycles()
+	want := "pipeline has a cycle: queue:a -> stage:loop -> queue:a"
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
@@ -0,0 +1,345 @@
+package icd
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+type priorityItem struct {
+	item     interface{}
+	priority int
+	enqueued time.Time
+	seq      uint64
+	key      float64
+}
+
+type priorityHeap []*priorityItem
+
+func (h priorityHeap) Len() int { return len(h) }
+func (h priorityHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key > h[j].key
+	}
+	return h[i].seq < h[j].seq
+}
+func (h priorityHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *priorityHeap) Push(x interface{}) { *h = append(*h, x.(*priorityItem)) }
+func (h *priorityHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return x
+}
+
+// PriorityQueue is the built-in in-memory queue which gets the item with the
+// highest priority first, items of equal priority in FIFO order. Like
+// BaseQueue, Put blocks while the queue is full and Get blocks while it is
+// empty.
+//
+// To prevent low priority items from starving, the queue can age waiting
+// items: with an aging rate r, an item's effective priority is its priority
+// plus r for every second it has waited. Since all items age at the same rate
+// the relative order only changes between items enqueued at different times,
+// so a long waiting item eventually overtakes freshly enqueued items of
+// higher priority.
+type PriorityQueue struct {
+	name      string
+	capacity  int
+	priority  func(interface{}) int
+	origin    time.Time
+	mu        sync.Mutex
+	notEmpty  *sync.Cond
+	notFull   *sync.Cond
+	items     priorityHeap
+	agingRate float64
+	fifo      bool
+	closed    bool
+	seq       uint64
+	puts      uint64
+	gets      uint64
+	hooks     closeHooks
+}
+
+// NewPriorityQueue creates a priority queue holding at most capacity items,
+// a capacity less than 1 creates an unbounded queue. priority returns the
+// priority of an item, higher priorities are gotten first. Aging is disabled
+// until SetAgingRate is called.
+func NewPriorityQueue(name string, capacity int, priority func(interface{}) int) *PriorityQueue {
+	if capacity < 1 {
+		capacity = -1
+	}
+	q := &PriorityQueue{
+		name:     name,
+		capacity: capacity,
+		priority: priority,
+		origin:   now(),
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// SetAgingRate sets the effective priority an item gains per second of
+// waiting, 0 disables aging. Negative rates, which would let waiting items
+// sink below fresh ones, and NaN are clamped to 0.
+func (q *PriorityQueue) SetAgingRate(rate float64) {
+	if !(rate > 0) {
+		rate = 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.agingRate = rate
+	q.rekey()
+}
+
+// SetStrictFIFO switches the queue between priority order and plain FIFO
+// order, e.g. to rule out reordering while debugging. While enabled
+// priorities and aging are ignored; the items already queued are reordered
+// at once, in both directions.
+func (q *PriorityQueue) SetStrictFIFO(enabled bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.fifo = enabled
+	q.rekey()
+}
+
+// StrictFIFO returns whether or not the queue ignores priorities
+func (q *PriorityQueue) StrictFIFO() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.fifo
+}
+
+// AgingRate returns the effective priority an item gains per second of
+// waiting
+func (q *PriorityQueue) AgingRate() float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.agingRate
+}
+
+// Name provides the name of the queue
+func (q *PriorityQueue) Name() string {
+	return q.name
+}
+
+// Put puts an item into the queue, blocking while the queue is full
+func (q *PriorityQueue) Put(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	priority := q.priority(item)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && q.capacity >= 0 && len(q.items) >= q.capacity {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return ErrQueueClosed
+	}
+	q.seq++
+	pi := &priorityItem{
+		item:     item,
+		priority: priority,
+		enqueued: now(),
+		seq:      q.seq,
+	}
+	pi.key = q.key(pi)
+	heap.Push(&q.items, pi)
+	q.puts++
+	q.notEmpty.Signal()
+	return nil
+}
+
+// Get gets the item with the highest effective priority, blocking while the
+// queue is empty
+func (q *PriorityQueue) Get() (interface{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && len(q.items) == 0 {
+		q.notEmpty.Wait()
+	}
+	if len(q.items) == 0 {
+		return nil, ErrQueueClosed
+	}
+	pi := heap.Pop(&q.items).(*priorityItem)
+	q.gets++
+	q.notFull.Signal()
+	return pi.item, nil
+}
+
+// Len returns the number of items in the queue
+func (q *PriorityQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Cap returns the maximum number of items the queue can hold, -1 if
+// unbounded
+func (q *PriorityQueue) Cap() int {
+	return q.capacity
+}
+
+// Clear removes all items from the queue
+func (q *PriorityQueue) Clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = nil
+	q.notFull.Broadcast()
+}
+
+// Reset removes all items, clears statistics and reopens the queue
+func (q *PriorityQueue) Reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = nil
+	q.closed = false
+	q.puts = 0
+	q.gets = 0
+	q.notFull.Broadcast()
+}
+
+// Close closes the queue, waking all blocked callers. Close returns once the
+// running monitors of the queue sent statistics of the closed queue, or
+// dropped them when the stats channel was full.
+func (q *PriorityQueue) Close() error {
+	q.mu.Lock()
+	closing := !q.closed
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+	if closing {
+		q.hooks.fire()
+	}
+	return nil
+}
+
+// Closed returns whether or not the queue is closed
+func (q *PriorityQueue) Closed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// Each calls fn for every item in the queue, in the order Get would currently
+// return them, until fn returns false
+func (q *PriorityQueue) Each(fn func(item interface{}) bool) error {
+	q.mu.Lock()
+	sorted := q.sorted()
+	q.mu.Unlock()
+
+	for _, pi := range sorted {
+		if !fn(pi.item) {
+			break
+		}
+	}
+	return nil
+}
+
+// PeekMatch returns the first item for which pred returns true, and whether
+// there is one, without removing it
+func (q *PriorityQueue) PeekMatch(pred func(item interface{}) bool) (interface{}, bool, error) {
+	return peekMatch(q, pred)
+}
+
+// Stats returns the current statistics of the queue
+func (q *PriorityQueue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stats()
+}
+
+// Inspect returns the statistics and a copy of the items of the queue, in the
+// order Get would currently return them, taken under a single lock
+func (q *PriorityQueue) Inspect() (QueueStats, []interface{}) {
+	q.mu.Lock()
+	stats := q.stats()
+	sorted := q.sorted()
+	q.mu.Unlock()
+
+	items := make([]interface{}, len(sorted))
+	for i, pi := range sorted {
+		items[i] = pi.item
+	}
+	return stats, items
+}
+
+// SnapshotAt returns a snapshot of the statistics and items of the queue
+func (q *PriorityQueue) SnapshotAt() Snapshot {
+	return snapshotOf(q)
+}
+
+// Monitor sends the statistics of the queue every second and once more when
+// the queue closes, clears them on request and sends the final statistics on
+// shutdown
+func (q *PriorityQueue) Monitor(mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	hook := q.hooks.attach()
+	for {
+		select {
+		case <-hook.closing:
+			hook = q.hooks.flushClosed(hook, mc, q.Stats())
+		case <-mc.ClearChan:
+			q.mu.Lock()
+			q.puts = 0
+			q.gets = 0
+			q.mu.Unlock()
+		case <-mc.DoneChan:
+			q.hooks.detach(hook)
+			mc.FinalStatsChan <- q.Stats()
+			return
+		case <-after(monitorInterval):
+			select {
+			case mc.StatsChan <- q.Stats():
+			default:
+			}
+		}
+	}
+}
+
+// stats returns the current statistics, must be called with mu held
+func (q *PriorityQueue) stats() QueueStats {
+	return QueueStats{
+		Name:   q.name,
+		Len:    len(q.items),
+		Cap:    q.capacity,
+		Puts:   q.puts,
+		Gets:   q.gets,
+		Closed: q.closed,
+	}
+}
+
+// sorted returns a copy of the items in the order Get would return them, must
+// be called with mu held
+func (q *PriorityQueue) sorted() priorityHeap {
+	sorted := make(priorityHeap, len(q.items))
+	copy(sorted, q.items)
+	sort.Slice(sorted, func(i, j int) bool { return sorted.Less(i, j) })
+	return sorted
+}
+
+// rekey recomputes the keys of the queued items and restores the heap, must
+// be called with mu held
+func (q *PriorityQueue) rekey() {
+	for _, pi := range q.items {
+		pi.key = q.key(pi)
+	}
+	heap.Init(&q.items)
+}
+
+// key returns the heap key of pi. The effective priority at time t is
+// priority + rate*(t - enqueued), subtracting the common rate*t term leaves a
+// key which does not change while the item waits. In strict FIFO order the
+// key is 0 so the sequence decides. Must be called with mu held.
+func (q *PriorityQueue) key(pi *priorityItem) float64 {
+	if q.fifo {
+		return 0
+	}
+	return float64(pi.priority) - q.agingRate*pi.enqueued.Sub(q.origin).Seconds()
+}
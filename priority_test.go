@@ -0,0 +1,97 @@
+package icd
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func intPriority(item interface{}) int {
+	return item.(int)
+}
+
+func TestPriorityQueueOrder(t *testing.T) {
+	q := NewPriorityQueue("priority", 0, func(item interface{}) int { return len(item.(string)) })
+	for _, item := range []string{"b", "ccc", "a", "dd"} {
+		q.Put(item)
+	}
+	for _, want := range []string{"ccc", "dd", "b", "a"} {
+		item, _ := q.Get()
+		if item != want {
+			t.Errorf("expected %s, got %v", want, item)
+		}
+	}
+}
+
+func TestPriorityQueueAgingOvertakes(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewPriorityQueue("aging", 0, intPriority)
+	q.SetAgingRate(1)
+
+	q.Put(1)
+	c.Advance(5 * time.Second)
+	q.Put(3)
+	if item, _ := q.Get(); item != 1 {
+		t.Errorf("expected the aged item to overtake the fresher one, got %v", item)
+	}
+
+	q.Put(1)
+	c.Advance(time.Second)
+	q.Put(3)
+	if item, _ := q.Get(); item != 3 {
+		t.Errorf("expected the fresher item while the aged one has not caught up, got %v", item)
+	}
+}
+
+func TestPriorityQueueAgingRateClamped(t *testing.T) {
+	q := NewPriorityQueue("aging", 0, intPriority)
+	for _, rate := range []float64{-1, math.NaN()} {
+		q.SetAgingRate(rate)
+		if q.AgingRate() != 0 {
+			t.Errorf("expected rate %v to be clamped to 0, got %v", rate, q.AgingRate())
+		}
+	}
+}
+
+func TestPriorityQueueClosed(t *testing.T) {
+	q := NewPriorityQueue("closed", 1, intPriority)
+	if err := q.Put(nil); !IsNilItem(err) {
+		t.Errorf("expected ErrNilItem, got %v", err)
+	}
+	q.Put(1)
+	q.Close()
+	if err := q.Put(2); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+	if item, err := q.Get(); err != nil || item != 1 {
+		t.Errorf("expected remaining item after close, got %v %v", item, err)
+	}
+	if _, err := q.Get(); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+}
+
+func TestPriorityQueueStrictFIFO(t *testing.T) {
+	q := NewPriorityQueue("priority", 0, intPriority)
+	for _, item := range []int{1, 3, 2} {
+		q.Put(item)
+	}
+	q.SetStrictFIFO(true)
+	if !q.StrictFIFO() {
+		t.Fatal("expected strict FIFO to be enabled")
+	}
+	q.Put(5)
+	if item, _ := q.Get(); item != 1 {
+		t.Errorf("expected the oldest item 1 in FIFO order, got %v", item)
+	}
+
+	// switching back reorders the remaining 3, 2, 5 by priority
+	q.SetStrictFIFO(false)
+	for _, want := range []int{5, 3, 2} {
+		item, _ := q.Get()
+		if item != want {
+			t.Errorf("expected %d in priority order, got %v", want, item)
+		}
+	}
+}
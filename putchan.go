@@ -0,0 +1,133 @@
+package icd
+
+import (
+	"sync"
+)
+
+// putErrorBuffer is the number of errors a put channel buffers
+const putErrorBuffer = 16
+
+// ChanPutter is the optional interface for queues which accept items through
+// a channel, so producers can select between putting and other events:
+//
+//	select {
+//	case q.PutChan() <- item:
+//	case err, ok := <-q.PutErrors():
+//		...
+//	case <-ctx.Done():
+//	}
+type ChanPutter interface {
+	// PutChan returns the channel items are put through. A send completes
+	// once the queue is ready to take the item, the item is then put like
+	// with Put.
+	PutChan() chan<- interface{}
+
+	// PutErrors returns the channel receiving the errors of the items put
+	// through PutChan, errors arriving while it is full are dropped. Once
+	// the queue is closed the channel receives ErrQueueClosed and is closed
+	// itself, the put channel then no longer accepts items.
+	PutErrors() <-chan error
+}
+
+// putPump puts the items sent on in into a queue until stop is closed or the
+// queue is closed
+type putPump struct {
+	in   chan interface{}
+	errs chan error
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+type putChanQueue struct {
+	Queue
+	mu   sync.Mutex
+	pump *putPump
+}
+
+// NewPutChanQueue wraps q so items can also be put through a channel, see
+// ChanPutter. A goroutine receives the items sent and puts them into q, it
+// starts with the first call of PutChan or PutErrors and stops when the
+// queue closes; after a Reset the next call starts a new one with new
+// channels.
+func NewPutChanQueue(q Queue) Queue {
+	return &putChanQueue{Queue: q}
+}
+
+// PutChan returns the channel items are put through
+func (q *putChanQueue) PutChan() chan<- interface{} {
+	return q.running().in
+}
+
+// PutErrors returns the channel receiving the errors of the items put
+// through PutChan
+func (q *putChanQueue) PutErrors() <-chan error {
+	return q.running().errs
+}
+
+// running returns the pump, starting a new one unless it is running or the
+// queue is closed
+func (q *putChanQueue) running() *putPump {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pump != nil {
+		select {
+		case <-q.pump.done:
+			if q.Queue.Closed() {
+				return q.pump
+			}
+		default:
+			return q.pump
+		}
+	}
+	p := &putPump{
+		in:   make(chan interface{}),
+		errs: make(chan error, putErrorBuffer),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	q.pump = p
+	go q.run(p)
+	return p
+}
+
+// run puts the items of p into the queue until it stops
+func (q *putChanQueue) run(p *putPump) {
+	defer close(p.done)
+	defer close(p.errs)
+	for {
+		select {
+		case item := <-p.in:
+			err := q.Queue.Put(item)
+			if err == nil {
+				continue
+			}
+			select {
+			case p.errs <- err:
+			default:
+			}
+			if IsQueueClosed(err) {
+				return
+			}
+		case <-p.stop:
+			select {
+			case p.errs <- ErrQueueClosed:
+			default:
+			}
+			return
+		}
+	}
+}
+
+// Close closes the queue and stops the put channel
+func (q *putChanQueue) Close() error {
+	err := q.Queue.Close()
+	q.mu.Lock()
+	p := q.pump
+	q.mu.Unlock()
+	if p != nil {
+		p.once.Do(func() { close(p.stop) })
+		<-p.done
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package icd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPutChanQueueSelect(t *testing.T) {
+	inner := NewBaseQueue("inner", 1)
+	q := NewPutChanQueue(inner).(ChanPutter)
+	q.PutChan() <- "a"
+	// b is taken by the goroutine, which blocks putting it into the full queue
+	q.PutChan() <- "b"
+
+	cancel := make(chan struct{})
+	close(cancel)
+	select {
+	case q.PutChan() <- "c":
+		t.Fatal("expected the put of c to block while the queue is full")
+	case <-cancel:
+	}
+
+	for _, want := range []string{"a", "b"} {
+		item, _ := inner.Get()
+		if item != want {
+			t.Errorf("expected %s, got %v", want, item)
+		}
+	}
+}
+
+func TestPutChanQueueErrors(t *testing.T) {
+	q := NewPutChanQueue(NewBaseQueue("inner", 0))
+	cp := q.(ChanPutter)
+	cp.PutChan() <- nil
+	if err := <-cp.PutErrors(); !IsNilItem(err) {
+		t.Errorf("expected ErrNilItem, got %v", err)
+	}
+	cp.PutChan() <- "a"
+	waitFor(t, "the put", func() bool { return q.Len() == 1 })
+}
+
+func TestPutChanQueueClose(t *testing.T) {
+	q := NewPutChanQueue(NewBaseQueue("inner", 0))
+	cp := q.(ChanPutter)
+	putCh, errs := cp.PutChan(), cp.PutErrors()
+	q.Close()
+
+	if err := <-errs; !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+	select {
+	case putCh <- "a":
+		t.Error("expected the put channel to stop accepting items")
+	case _, ok := <-cp.PutErrors():
+		if ok {
+			t.Error("expected the error channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the closed error channel to end the select")
+	}
+
+	q.Reset()
+	q.(ChanPutter).PutChan() <- "b"
+	waitFor(t, "the put after the reset", func() bool { return q.Len() == 1 })
+}
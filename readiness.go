@@ -0,0 +1,62 @@
+package icd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ComponentHealth is the health of one component reported by
+// ReadinessHandler
+type ComponentHealth struct {
+	// Name of the component, its Name() when it has one, otherwise its
+	// position among the reporters
+	Name string `json:"name"`
+	Health
+}
+
+// Readiness is the body served by ReadinessHandler
+type Readiness struct {
+	// Whether or not every component is ready
+	Ready bool `json:"ready"`
+	// The components which are not ready
+	Components []ComponentHealth `json:"components,omitempty"`
+}
+
+// ReadinessHandler serves the combined health of reporters for liveness and
+// readiness probes, e.g. of Kubernetes: 200 when every reporter is healthy
+// and 503 otherwise, with a JSON Readiness body listing the components which
+// are not. With the query parameter degraded=ok degraded components count as
+// ready, e.g. for a liveness probe which should not restart a slowed down
+// process.
+func ReadinessHandler(reporters ...HealthReporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowDegraded := r.URL.Query().Get("degraded") == "ok"
+		readiness := Readiness{Ready: true}
+		for i, reporter := range reporters {
+			h := reporter.Health()
+			if h.Status == HealthHealthy || (allowDegraded && h.Status == HealthDegraded) {
+				continue
+			}
+			readiness.Ready = false
+			readiness.Components = append(readiness.Components, ComponentHealth{
+				Name:   componentName(reporter, i),
+				Health: h,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !readiness.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(readiness)
+	})
+}
+
+// componentName returns the name of reporter, or its position i
+func componentName(reporter interface{}, i int) string {
+	named, ok := reporter.(interface{ Name() string })
+	if ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%d", i)
+}
@@ -0,0 +1,74 @@
+package icd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type namedHealth struct {
+	name   string
+	health Health
+}
+
+func (n namedHealth) Name() string {
+	return n.name
+}
+
+func (n namedHealth) Health() Health {
+	return n.health
+}
+
+type anonymousHealth Health
+
+func (a anonymousHealth) Health() Health {
+	return Health(a)
+}
+
+func serveReadiness(t *testing.T, handler http.Handler, url string) (int, Readiness) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+	var readiness Readiness
+	if err := json.Unmarshal(rec.Body.Bytes(), &readiness); err != nil {
+		t.Fatalf("expected a JSON body, got %s: %v", rec.Body.String(), err)
+	}
+	if rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected content type %s", rec.Header().Get("Content-Type"))
+	}
+	return rec.Code, readiness
+}
+
+func TestReadinessHandlerAllHealthy(t *testing.T) {
+	handler := ReadinessHandler(
+		namedHealth{name: "in", health: Health{Status: HealthHealthy}},
+		anonymousHealth{Status: HealthHealthy},
+	)
+	code, readiness := serveReadiness(t, handler, "/readyz")
+	if code != http.StatusOK || !readiness.Ready || len(readiness.Components) != 0 {
+		t.Errorf("expected 200 and ready, got %d %+v", code, readiness)
+	}
+}
+
+func TestReadinessHandlerUnhealthy(t *testing.T) {
+	handler := ReadinessHandler(
+		namedHealth{name: "in", health: Health{Status: HealthHealthy}},
+		namedHealth{name: "sink", health: Health{Status: HealthUnhealthy, Message: "connection refused"}},
+		anonymousHealth{Status: HealthDegraded},
+	)
+	code, readiness := serveReadiness(t, handler, "/readyz")
+	if code != http.StatusServiceUnavailable || readiness.Ready || len(readiness.Components) != 2 {
+		t.Fatalf("expected 503 listing 2 components, got %d %+v", code, readiness)
+	}
+	sink := readiness.Components[0]
+	if sink.Name != "sink" || sink.Message != "connection refused" || readiness.Components[1].Name != "2" {
+		t.Errorf("unexpected components %+v", readiness.Components)
+	}
+
+	// degraded components are accepted, the unhealthy sink is not
+	code, readiness = serveReadiness(t, handler, "/healthz?degraded=ok")
+	if code != http.StatusServiceUnavailable || len(readiness.Components) != 1 {
+		t.Errorf("expected only the sink to fail, got %d %+v", code, readiness)
+	}
+}
@@ -0,0 +1,91 @@
+package icd
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// ErrPanic is wrapped by the PluginError reported for a plugin which
+// panicked, see RecoverRun
+var ErrPanic = errors.New("panic")
+
+// PluginError is an error of a plugin which reservoird acts upon, e.g. by
+// restarting the plugin when it is fatal
+type PluginError struct {
+	// Name of the plugin
+	Plugin string
+	// Whether or not the plugin stopped because of the error
+	Fatal bool
+	// The error
+	Err error
+	// Stack trace of the goroutine the error occurred on, nil when unknown
+	Stack []byte
+}
+
+// Error returns the message of the error prefixed with the plugin
+func (e *PluginError) Error() string {
+	msg := e.Err.Error()
+	if e.Fatal {
+		msg = "fatal: " + msg
+	}
+	if e.Plugin == "" {
+		return msg
+	}
+	return e.Plugin + ": " + msg
+}
+
+// Unwrap returns the error
+func (e *PluginError) Unwrap() error {
+	return e.Err
+}
+
+// IsFatal returns whether or not err is, or wraps, a fatal PluginError
+func IsFatal(err error) bool {
+	var pe *PluginError
+	return errors.As(err, &pe) && pe.Fatal
+}
+
+// panicError is the value of a recovered panic, it is ErrPanic and wraps the
+// value when it is an error
+type panicError struct {
+	value interface{}
+}
+
+func (e panicError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrPanic, e.value)
+}
+
+func (e panicError) Is(target error) bool {
+	return target == ErrPanic
+}
+
+func (e panicError) Unwrap() error {
+	err, _ := e.value.(error)
+	return err
+}
+
+// RecoverRun calls run, typically the Ingest, Digest or Expel of a plugin,
+// and recovers when it panics, so a plugin bug does not crash reservoird.
+// The panic is reported through monitor as a fatal *PluginError wrapping
+// ErrPanic, and the panic value when it is an error, with the stack trace of
+// the panic; without a monitor it is logged. RecoverRun then returns as if
+// run returned, for the supervisor to decide whether to restart the plugin.
+// A panicking plugin does not mark the WaitGroup of its MonitorControl done,
+// nor close its send queue.
+func RecoverRun(monitor *Monitor, run func()) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		pe := &PluginError{Fatal: true, Err: panicError{value: r}, Stack: debug.Stack()}
+		if monitor == nil {
+			logf("%v\n%s", pe, pe.Stack)
+			return
+		}
+		pe.Plugin = monitor.Name
+		monitor.Error(pe)
+	}()
+	run()
+}
@@ -0,0 +1,73 @@
+package icd
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestRecoverRun(t *testing.T) {
+	m := NewMonitor(newTestMonitorControl())
+	m.Name = "plugin"
+	ran := false
+	RecoverRun(m, func() {
+		ran = true
+		var items []int
+		_ = items[1]
+	})
+	if !ran {
+		t.Fatal("expected run to be called")
+	}
+	if len(m.ErrorChan) != 1 {
+		t.Fatalf("expected the panic to be reported, got %d errors", len(m.ErrorChan))
+	}
+	err := <-m.ErrorChan
+	var pe *PluginError
+	if !errors.As(err, &pe) || !IsFatal(err) || !errors.Is(err, ErrPanic) {
+		t.Fatalf("expected a fatal PluginError wrapping ErrPanic, got %v", err)
+	}
+	if pe.Plugin != "plugin" || !strings.HasPrefix(err.Error(), "plugin: fatal: panic: runtime error: index out of range") {
+		t.Errorf("unexpected error %q", err)
+	}
+	if !strings.Contains(string(pe.Stack), "TestRecoverRun") {
+		t.Errorf("expected the stack of the panic, got %s", pe.Stack)
+	}
+	if m.Summary().Errors != 1 {
+		t.Errorf("expected the panic to count as an error, got %d", m.Summary().Errors)
+	}
+}
+
+func TestRecoverRunErrorValue(t *testing.T) {
+	m := NewMonitor(newTestMonitorControl())
+	RecoverRun(m, func() { panic(errNegative) })
+	err := <-m.ErrorChan
+	if !errors.Is(err, errNegative) || !errors.Is(err, ErrPanic) {
+		t.Errorf("expected the panic value to be wrapped, got %v", err)
+	}
+	if err.Error() != "fatal: panic: negative" {
+		t.Errorf("unexpected message %q", err)
+	}
+}
+
+func TestRecoverRunLogs(t *testing.T) {
+	var logged bytes.Buffer
+	SetLogger(log.New(&logged, "", 0))
+	defer SetLogger(nil)
+	RecoverRun(nil, func() { panic("logged") })
+	if !strings.Contains(logged.String(), "fatal: panic: logged") || !strings.Contains(logged.String(), "TestRecoverRunLogs") {
+		t.Errorf("expected the panic to be logged with its stack, got %s", logged.String())
+	}
+}
+
+func TestRecoverRunWithoutPanic(t *testing.T) {
+	m := NewMonitor(newTestMonitorControl())
+	RecoverRun(m, func() {})
+	if len(m.ErrorChan) != 0 {
+		t.Errorf("expected no errors, got %d", len(m.ErrorChan))
+	}
+	if IsFatal(errNegative) || IsFatal(&PluginError{Err: errNegative}) {
+		t.Error("expected only fatal plugin errors to be fatal")
+	}
+}
@@ -0,0 +1,132 @@
+package icd
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// QueueFactory is the New function of a queue plugin
+type QueueFactory func(cfg string) (Queue, error)
+
+// IngesterFactory is the New function of an ingester plugin
+type IngesterFactory func(cfg string) (Ingester, error)
+
+// DigesterFactory is the New function of a digester plugin
+type DigesterFactory func(cfg string) (Digester, error)
+
+// ExpellerFactory is the New function of an expeller plugin
+type ExpellerFactory func(cfg string) (Expeller, error)
+
+// Descriptor describes a plugin for catalogs and validation tooling
+type Descriptor struct {
+	// Version of the plugin
+	Version string `json:"version,omitempty"`
+	// What the plugin does
+	Description string `json:"description,omitempty"`
+	// Example of the configuration passed to New, as JSON
+	Config string `json:"config,omitempty"`
+}
+
+// RegisteredPlugin is a factory of a Registry
+type RegisteredPlugin struct {
+	Name string `json:"name"`
+	Kind Kind   `json:"kind"`
+	// Descriptor of the plugin, nil when it was registered without one
+	Descriptor *Descriptor `json:"descriptor,omitempty"`
+}
+
+type registryKey struct {
+	kind Kind
+	name string
+}
+
+type registryEntry struct {
+	factory    interface{}
+	descriptor *Descriptor
+}
+
+// Registry holds the factories of the plugins available to reservoird, by
+// kind and name
+type Registry struct {
+	mu      sync.RWMutex
+	entries map[registryKey]registryEntry
+}
+
+// NewRegistry creates a registry without factories
+func NewRegistry() *Registry {
+	return &Registry{
+		entries: make(map[registryKey]registryEntry),
+	}
+}
+
+// Register adds factory under name, its kind given by the type of factory:
+// a QueueFactory, IngesterFactory, DigesterFactory or ExpellerFactory, or a
+// function of the same signature. desc may be nil. Returns ErrNotSupported
+// for any other factory and an error when a plugin of the same kind is
+// registered under name already.
+func (r *Registry) Register(name string, factory interface{}, desc *Descriptor) error {
+	kind := factoryKind(factory)
+	if kind == "" {
+		return fmt.Errorf("register %s factory %T: %w", name, factory, ErrNotSupported)
+	}
+	key := registryKey{kind: kind, name: name}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.entries[key]
+	if ok {
+		return fmt.Errorf("%s %s is registered already", kind, name)
+	}
+	r.entries[key] = registryEntry{factory: factory, descriptor: desc}
+	return nil
+}
+
+// Factory returns the factory of the plugin of kind registered under name,
+// ErrNotSupported when there is none
+func (r *Registry) Factory(kind Kind, name string) (interface{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.entries[registryKey{kind: kind, name: name}]
+	if !ok {
+		return nil, fmt.Errorf("%s %s: %w", kind, name, ErrNotSupported)
+	}
+	return entry.factory, nil
+}
+
+// List returns every registered plugin, sorted by kind and then by name
+func (r *Registry) List() []RegisteredPlugin {
+	r.mu.RLock()
+	plugins := make([]RegisteredPlugin, 0, len(r.entries))
+	for key, entry := range r.entries {
+		plugins = append(plugins, RegisteredPlugin{
+			Name:       key.name,
+			Kind:       key.kind,
+			Descriptor: entry.descriptor,
+		})
+	}
+	r.mu.RUnlock()
+	sort.Slice(plugins, func(i, j int) bool {
+		if plugins[i].Kind != plugins[j].Kind {
+			return plugins[i].Kind < plugins[j].Kind
+		}
+		return plugins[i].Name < plugins[j].Name
+	})
+	return plugins
+}
+
+// factoryKind returns the kind of plugin factory creates, "" when it is no
+// factory
+func factoryKind(factory interface{}) Kind {
+	switch factory.(type) {
+	case QueueFactory, func(string) (Queue, error):
+		return KindQueue
+	case IngesterFactory, func(string) (Ingester, error):
+		return KindIngester
+	case DigesterFactory, func(string) (Digester, error):
+		return KindDigester
+	case ExpellerFactory, func(string) (Expeller, error):
+		return KindExpeller
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,71 @@
+package icd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRegistryList(t *testing.T) {
+	r := NewRegistry()
+	newQueue := func(cfg string) (Queue, error) { return NewBaseQueue(cfg, 0), nil }
+	newDigester := DigesterFactory(func(cfg string) (Digester, error) {
+		return WindowDigester(cfg, time.Second, count), nil
+	})
+	newExpeller := func(cfg string) (Expeller, error) { return SinkToExpeller(cfg, &sliceSink{}), nil }
+	window := &Descriptor{Version: "1.0.0", Description: "counts items per window"}
+
+	for _, reg := range []struct {
+		name    string
+		factory interface{}
+		desc    *Descriptor
+	}{
+		{"window", newDigester, window},
+		{"memory", newQueue, nil},
+		{"slice", newExpeller, nil},
+		{"base", newQueue, nil},
+		{"memory", newDigester, nil},
+	} {
+		if err := r.Register(reg.name, reg.factory, reg.desc); err != nil {
+			t.Fatalf("unexpected error registering %s: %v", reg.name, err)
+		}
+	}
+
+	want := []RegisteredPlugin{
+		{Name: "memory", Kind: KindDigester},
+		{Name: "window", Kind: KindDigester, Descriptor: window},
+		{Name: "slice", Kind: KindExpeller},
+		{Name: "base", Kind: KindQueue},
+		{Name: "memory", Kind: KindQueue},
+	}
+	if got := r.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	factory, err := r.Factory(KindQueue, "memory")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	q, _ := factory.(func(string) (Queue, error))("q")
+	if q.Name() != "q" {
+		t.Errorf("expected the registered factory, got queue %s", q.Name())
+	}
+}
+
+func TestRegistryRegisterErrors(t *testing.T) {
+	r := NewRegistry()
+	newQueue := QueueFactory(func(cfg string) (Queue, error) { return NewBaseQueue(cfg, 0), nil })
+	r.Register("memory", newQueue, nil)
+	if err := r.Register("memory", newQueue, nil); err == nil {
+		t.Error("expected an error registering a plugin twice")
+	}
+	if err := r.Register("bad", func() {}, nil); !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	if _, err := r.Factory(KindIngester, "memory"); !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	if len(r.List()) != 1 {
+		t.Errorf("expected 1 plugin, got %+v", r.List())
+	}
+}
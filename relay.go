@@ -0,0 +1,50 @@
+package icd
+
+import (
+	"sync"
+)
+
+// relayControl returns the MonitorControl for a monitor run by a wrapper on
+// behalf of mc, with private buffered statistics channels so the wrapper
+// decides what reaches mc. Clear and done messages are those of mc.
+func relayControl(mc *MonitorControl) *MonitorControl {
+	return &MonitorControl{
+		StatsChan:      make(chan interface{}, 1),
+		FinalStatsChan: make(chan interface{}, 1),
+		ClearChan:      mc.ClearChan,
+		DoneChan:       mc.DoneChan,
+		WaitGroup:      &sync.WaitGroup{},
+	}
+}
+
+// relayStats passes the statistics sent on imc.StatsChan on to mc.StatsChan
+// through augment, a nil augment passes them as is, without blocking. It
+// returns once imc.WaitGroup is done, with the final statistics sent on
+// imc.FinalStatsChan and whether there were any, so a monitor returning
+// without sending them cannot hang the wrapper.
+func relayStats(imc *MonitorControl, mc *MonitorControl, augment func(interface{}) interface{}) (interface{}, bool) {
+	if augment == nil {
+		augment = func(stats interface{}) interface{} { return stats }
+	}
+	done := make(chan struct{})
+	go func() {
+		imc.WaitGroup.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case stats := <-imc.StatsChan:
+			select {
+			case mc.StatsChan <- augment(stats):
+			default:
+			}
+		case <-done:
+			select {
+			case final := <-imc.FinalStatsChan:
+				return final, true
+			default:
+				return nil, false
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package icd
+
+import (
+	"testing"
+)
+
+// silentQueue is a queue whose Monitor returns on shutdown without sending
+// final statistics
+type silentQueue struct {
+	Queue
+}
+
+func (q silentQueue) Monitor(mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	mc.StatsChan <- "periodic"
+	<-mc.DoneChan
+}
+
+func TestRelayStats(t *testing.T) {
+	mc := newTestMonitorControl()
+	imc := relayControl(mc)
+	imc.WaitGroup.Add(1)
+	go NewBaseQueue("inner", 0).Monitor(imc)
+	close(mc.DoneChan)
+	final, ok := relayStats(imc, mc, nil)
+	if !ok || final.(QueueStats).Name != "inner" {
+		t.Errorf("expected the final statistics of the inner monitor, got %v %v", final, ok)
+	}
+}
+
+func TestRelayStatsWithoutFinal(t *testing.T) {
+	mc := newTestMonitorControl()
+	imc := relayControl(mc)
+	imc.WaitGroup.Add(1)
+	go silentQueue{}.Monitor(imc)
+	got := make(chan bool)
+	go func() {
+		_, ok := relayStats(imc, mc, func(stats interface{}) interface{} {
+			return stats.(string) + " augmented"
+		})
+		got <- ok
+	}()
+	if stats := <-mc.StatsChan; stats != "periodic augmented" {
+		t.Errorf("expected the augmented statistics, got %v", stats)
+	}
+	close(mc.DoneChan)
+	if <-got {
+		t.Error("expected no final statistics")
+	}
+}
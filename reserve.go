@@ -0,0 +1,88 @@
+package icd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reserver is the optional interface for queues which can set capacity aside
+// for a burst of items, so a producer knows up front the whole burst fits
+type Reserver interface {
+	// Reserve blocks until the queue has room for n items and reserves it,
+	// the reserved slots count against the capacity until the reservation
+	// ends. commit puts up to n items into the queue at once and ends the
+	// reservation, cancel ends it without putting anything. Returns
+	// ErrQueueClosed when the queue closes and ErrQueueFull when n exceeds
+	// the capacity.
+	Reserve(n int) (commit func(items []interface{}) error, cancel func(), err error)
+}
+
+// errReservationDone is returned when committing an ended reservation
+var errReservationDone = errors.New("reservation is finished")
+
+// Reserve blocks until the queue has room for n items and reserves it, see
+// Reserver. Committing more than n items returns ErrQueueFull and a nil item
+// ErrNilItem, both keep the reservation; committing into a closed queue
+// returns ErrQueueClosed and ends it. Clear and Reset keep the reservations,
+// and shrinking the queue with Resize lets them exceed the capacity. An n
+// below 1 reserves nothing.
+func (q *BaseQueue) Reserve(n int) (func(items []interface{}) error, func(), error) {
+	if n < 0 {
+		n = 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.capacity >= 0 && n > q.capacity {
+		return nil, nil, fmt.Errorf("reserve %d items in %s of capacity %d: %w", n, q.name, q.capacity, ErrQueueFull)
+	}
+	if n > 0 && !q.closed && q.full(n) {
+		q.reservers++
+		for !q.closed && q.full(n) {
+			q.notFull.Wait()
+		}
+		q.reservers--
+	}
+	if q.closed {
+		return nil, nil, ErrQueueClosed
+	}
+	q.reserved += n
+
+	done := false
+	// release ends the reservation, must be called with mu held
+	release := func() {
+		done = true
+		q.reserved -= n
+		q.notFull.Broadcast()
+	}
+	commit := func(items []interface{}) error {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if done {
+			return errReservationDone
+		}
+		if len(items) > n {
+			return fmt.Errorf("commit %d items into a reservation of %d: %w", len(items), n, ErrQueueFull)
+		}
+		for _, item := range items {
+			if item == nil {
+				return ErrNilItem
+			}
+		}
+		release()
+		if q.closed {
+			return ErrQueueClosed
+		}
+		if len(items) > 0 {
+			q.add(items)
+		}
+		return nil
+	}
+	cancel := func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if !done {
+			release()
+		}
+	}
+	return commit, cancel, nil
+}
@@ -0,0 +1,125 @@
+package icd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBaseQueueReserveCommit(t *testing.T) {
+	q := NewBaseQueue("reserve", 5)
+	q.Put("a")
+	commit, _, err := q.Reserve(3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := q.TryPut("b"); err != nil {
+		t.Errorf("expected the unreserved slot to be free, got %v", err)
+	}
+	if err := q.TryPut("c"); !IsQueueFull(err) {
+		t.Errorf("expected the reserved slots to be taken, got %v", err)
+	}
+	if n, _ := q.TryPutBatch([]interface{}{"c", "d"}); n != 0 {
+		t.Errorf("expected no batch item to fit, got %d", n)
+	}
+
+	if err := commit([]interface{}{"x", "y", "z", "w"}); !IsQueueFull(err) {
+		t.Errorf("expected committing too many items to fail, got %v", err)
+	}
+	if err := commit([]interface{}{"x", nil}); !IsNilItem(err) {
+		t.Errorf("expected a nil item to fail, got %v", err)
+	}
+	if err := commit([]interface{}{"x", "y", "z"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	items, _ := q.TakeAll()
+	if !reflect.DeepEqual(items, []interface{}{"a", "b", "x", "y", "z"}) {
+		t.Errorf("expected the burst after the earlier items, got %v", items)
+	}
+	if err := commit([]interface{}{"v"}); err != errReservationDone {
+		t.Errorf("expected the reservation to be finished, got %v", err)
+	}
+	if q.Stats().Puts != 5 {
+		t.Errorf("expected 5 puts, got %d", q.Stats().Puts)
+	}
+}
+
+func TestBaseQueueReserveCancel(t *testing.T) {
+	q := NewBaseQueue("reserve", 2)
+	_, cancel, err := q.Reserve(2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	put := make(chan error)
+	go func() {
+		put <- q.Put("a")
+	}()
+	waitFor(t, "put to block", func() bool { return q.BlockedProducers() == 1 })
+	cancel()
+	if err := <-put; err != nil {
+		t.Errorf("expected the put to succeed once the reservation is canceled, got %v", err)
+	}
+	cancel()
+	if err := q.TryPut("b"); err != nil {
+		t.Errorf("expected canceling twice to release the slots once, got %v", err)
+	}
+}
+
+func TestBaseQueueReserveBlocks(t *testing.T) {
+	q := NewBaseQueue("reserve", 2)
+	q.Put("a")
+	q.Put("b")
+	reserved := make(chan error)
+	go func() {
+		_, _, err := q.Reserve(2)
+		reserved <- err
+	}()
+	waitFor(t, "reserve to block", func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.reservers == 1
+	})
+	q.Get()
+	select {
+	case <-reserved:
+		t.Fatal("expected the reservation to wait for two free slots")
+	default:
+	}
+	q.Get()
+	if err := <-reserved; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestBaseQueueReserveErrors(t *testing.T) {
+	q := NewBaseQueue("reserve", 2)
+	if _, _, err := q.Reserve(3); !IsQueueFull(err) {
+		t.Errorf("expected a reservation beyond the capacity to fail, got %v", err)
+	}
+
+	commit, _, _ := q.Reserve(1)
+	reserved := make(chan error)
+	go func() {
+		_, _, err := q.Reserve(2)
+		reserved <- err
+	}()
+	waitFor(t, "reserve to block", func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.reservers == 1
+	})
+	q.Close()
+	if err := <-reserved; !IsQueueClosed(err) {
+		t.Errorf("expected the waiting reservation to fail on close, got %v", err)
+	}
+	if err := commit([]interface{}{"a"}); !IsQueueClosed(err) {
+		t.Errorf("expected committing into a closed queue to fail, got %v", err)
+	}
+
+	q.Reset()
+	if n, _ := q.TryPutBatch([]interface{}{"a", "b"}); n != 2 {
+		t.Errorf("expected the failed commit to release its slot, got %d items put", n)
+	}
+	if _, _, err := NewBaseQueue("unbounded", 0).Reserve(1000); err != nil {
+		t.Errorf("expected an unbounded queue to reserve anything, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package icd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Sized is the optional interface for items which know their size in bytes
+type Sized interface {
+	// Size returns the size of the item in bytes
+	Size() int
+}
+
+// ItemSize returns the size in bytes accounted for item: Size for Sized
+// items, the length for []byte and string, the size of the headers and
+// payload for an *Envelope and 0 for other items
+func ItemSize(item interface{}) int64 {
+	switch v := item.(type) {
+	case Sized:
+		return int64(v.Size())
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	case *Envelope:
+		if v == nil {
+			return 0
+		}
+		size := ItemSize(v.Payload)
+		for key, value := range v.Headers {
+			size += int64(len(key) + len(value))
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
+// ResourceLimits are the resources a ResourceLimiter grants, a zero limit is
+// unlimited
+type ResourceLimits struct {
+	// Maximum number of concurrent Put calls, and separately of concurrent
+	// Get calls
+	MaxOperations int
+	// Maximum number of bytes, see ItemSize, of the items in the queue
+	MaxBytes int64
+}
+
+// ResourceUsage is the current usage of a ResourceLimiter
+type ResourceUsage struct {
+	// Number of Put and Get calls in progress
+	Operations int
+	// Number of items put through the limiter and not yet gotten
+	Items int
+	// Number of bytes of those items
+	Bytes int64
+}
+
+// ResourceLimiter wraps the queue of an untrusted plugin so the plugin cannot
+// exhaust the process: Put and Get block while MaxOperations calls are in
+// progress, including calls blocked on the wrapped queue, and Put blocks
+// while the items in the queue would exceed MaxBytes. Puts and gets have
+// separate budgets of MaxOperations, so consumers blocked on an empty queue
+// cannot keep producers out and producers blocked on a full queue cannot keep
+// consumers out. An item larger than MaxBytes on its own can never fit and is
+// rejected with an error wrapping ErrQueueFull. Only items put through the
+// limiter are accounted, getting an item put into the wrapped queue directly
+// frees no more than is accounted.
+type ResourceLimiter struct {
+	Queue
+	limits ResourceLimits
+	puts   *ConcurrencyController
+	gets   *ConcurrencyController
+	mu     sync.Mutex
+	space  *sync.Cond
+	items  int
+	bytes  int64
+}
+
+// NewResourceLimiter wraps q to grant at most limits
+func NewResourceLimiter(q Queue, limits ResourceLimits) *ResourceLimiter {
+	l := &ResourceLimiter{
+		Queue:  q,
+		limits: limits,
+	}
+	if limits.MaxOperations > 0 {
+		l.puts = NewConcurrencyController(limits.MaxOperations)
+		l.gets = NewConcurrencyController(limits.MaxOperations)
+	}
+	l.space = sync.NewCond(&l.mu)
+	return l
+}
+
+// Put puts the item into the queue once an operation and its bytes are
+// granted
+func (l *ResourceLimiter) Put(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	size := ItemSize(item)
+	if l.limits.MaxBytes > 0 && size > l.limits.MaxBytes {
+		return fmt.Errorf("item of %d bytes exceeds the limit of %d bytes: %w", size, l.limits.MaxBytes, ErrQueueFull)
+	}
+	release := acquire(l.puts)
+	defer release()
+
+	l.mu.Lock()
+	for l.limits.MaxBytes > 0 && l.bytes+size > l.limits.MaxBytes && !l.Queue.Closed() {
+		l.space.Wait()
+	}
+	l.items++
+	l.bytes += size
+	l.mu.Unlock()
+
+	err := l.Queue.Put(item)
+	if err != nil {
+		l.free(size)
+	}
+	return err
+}
+
+// Get gets the next item from the queue once an operation is granted
+func (l *ResourceLimiter) Get() (interface{}, error) {
+	release := acquire(l.gets)
+	defer release()
+	item, err := l.Queue.Get()
+	if err != nil {
+		return nil, err
+	}
+	l.free(ItemSize(item))
+	return item, nil
+}
+
+// Usage returns the current usage
+func (l *ResourceLimiter) Usage() ResourceUsage {
+	usage := ResourceUsage{}
+	if l.puts != nil {
+		usage.Operations = l.puts.InFlight() + l.gets.InFlight()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	usage.Items = l.items
+	usage.Bytes = l.bytes
+	return usage
+}
+
+// Clear removes all items from the queue and their accounting
+func (l *ResourceLimiter) Clear() {
+	l.Queue.Clear()
+	l.forget()
+}
+
+// Reset resets the wrapped queue and the accounting
+func (l *ResourceLimiter) Reset() {
+	l.Queue.Reset()
+	l.forget()
+}
+
+// Close closes the queue, waking the puts waiting for bytes
+func (l *ResourceLimiter) Close() error {
+	err := l.Queue.Close()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.space.Broadcast()
+	return err
+}
+
+// acquire grants an operation of the budget ops, returning its release
+func acquire(ops *ConcurrencyController) func() {
+	if ops == nil {
+		return func() {}
+	}
+	// the background context never ends, so Acquire cannot fail
+	release, _ := ops.Acquire(context.Background())
+	return release
+}
+
+// free returns the bytes of an item which left the queue, as far as they
+// are accounted
+func (l *ResourceLimiter) free(size int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.items == 0 {
+		return
+	}
+	l.items--
+	if size > l.bytes {
+		size = l.bytes
+	}
+	l.bytes -= size
+	l.space.Broadcast()
+}
+
+// forget drops the accounting of all items
+func (l *ResourceLimiter) forget() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.items = 0
+	l.bytes = 0
+	l.space.Broadcast()
+}
@@ -0,0 +1,120 @@
+package icd
+
+import (
+	"testing"
+	"time"
+)
+
+type sizedItem int
+
+func (s sizedItem) Size() int {
+	return int(s)
+}
+
+func TestItemSize(t *testing.T) {
+	env := NewEnvelope([]byte("12345"))
+	env.SetHeader("id", "ab")
+	cases := []struct {
+		item interface{}
+		want int64
+	}{
+		{sizedItem(7), 7},
+		{[]byte("123"), 3},
+		{"1234", 4},
+		{env, 9},
+		{(*Envelope)(nil), 0},
+		{42, 0},
+	}
+	for _, c := range cases {
+		if got := ItemSize(c.item); got != c.want {
+			t.Errorf("expected size %d for %#v, got %d", c.want, c.item, got)
+		}
+	}
+}
+
+func TestResourceLimiterBytes(t *testing.T) {
+	l := NewResourceLimiter(NewBaseQueue("q", 0), ResourceLimits{MaxBytes: 10})
+	l.Put("12345")
+	l.Put("67890")
+	if usage := l.Usage(); usage.Items != 2 || usage.Bytes != 10 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+	if err := l.Put("12345678901"); !IsQueueFull(err) {
+		t.Errorf("expected an oversized item to be rejected, got %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- l.Put("abc")
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected the put to wait for bytes")
+	case <-time.After(10 * time.Millisecond):
+	}
+	l.Get()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if usage := l.Usage(); usage.Items != 2 || usage.Bytes != 8 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+
+	l.Clear()
+	if usage := l.Usage(); usage.Items != 0 || usage.Bytes != 0 || l.Len() != 0 {
+		t.Errorf("expected clear to drop the accounting, got %+v", usage)
+	}
+}
+
+func TestResourceLimiterOperations(t *testing.T) {
+	l := NewResourceLimiter(NewBaseQueue("q", 0), ResourceLimits{MaxOperations: 2})
+	gets := make(chan error, 3)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := l.Get()
+			gets <- err
+		}()
+	}
+	waitFor(t, "the gets to block", func() bool { return l.Usage().Operations == 2 })
+
+	// a third get waits for a slot of the gets
+	go func() {
+		_, err := l.Get()
+		gets <- err
+	}()
+	// the puts have a budget of their own, blocked gets do not hold it
+	if err := l.Put(1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := <-gets; err != nil {
+		t.Errorf("expected a get to receive the item, got %v", err)
+	}
+	waitFor(t, "the third get to block", func() bool { return l.Usage().Operations == 2 })
+	select {
+	case err := <-gets:
+		t.Fatalf("expected the remaining gets to wait, got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	l.Close()
+	for i := 0; i < 2; i++ {
+		if err := <-gets; !IsQueueClosed(err) {
+			t.Errorf("expected ErrQueueClosed, got %v", err)
+		}
+	}
+	if usage := l.Usage(); usage.Operations != 0 || usage.Items != 0 {
+		t.Errorf("expected everything released, got %+v", usage)
+	}
+}
+
+func TestResourceLimiterFreesOnlyAccounted(t *testing.T) {
+	q := NewBaseQueue("q", 0)
+	l := NewResourceLimiter(q, ResourceLimits{MaxBytes: 10})
+	q.Put("bypassing the limiter")
+	l.Put("abc")
+	l.Get()
+	l.Get()
+	if usage := l.Usage(); usage.Items != 0 || usage.Bytes != 0 {
+		t.Errorf("expected the accounting to stay non-negative, got %+v", usage)
+	}
+}
@@ -0,0 +1,160 @@
+package icd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RestartTimeout is how long RestartPlugin waits for the old instance to stop
+// and release its resources
+var RestartTimeout = 30 * time.Second
+
+// RestartPlugin replaces the running plugin old by a new instance on the same
+// queues, leaving the queues and the neighboring stages untouched, e.g. to
+// apply a changed configuration:
+//
+//  1. old is stopped, through Stop when it is Stoppable, waited for to stop
+//     running and closed, see CloseTimeout
+//  2. the new instance is created by makeNew and handed monitor when it is
+//     Monitored
+//  3. the new instance is run on the queues of old in a goroutine of flow,
+//     until flow shuts down
+//
+// old is either a PipelineStage or a plugin implementing Connected, which
+// tells the queues, otherwise RestartPlugin returns ErrNotSupported without
+// touching it. old must leave its queues open when it stops through Stop, as
+// they belong to the new instance by then. The new instance is returned like
+// old was passed, as a PipelineStage when old was one, so it can be restarted
+// in turn. Step 1 is bounded by RestartTimeout, an error wrapping ErrTimeout
+// is returned and nothing started when old does not stop in time; a failure
+// to close old is only reported. Errors are reported through monitor, and
+// logged without one, which also receives the lifecycle of the restart. The
+// wait for old to stop follows the package Clock.
+func RestartPlugin(flow *Flow, monitor *Monitor, makeNew func() (interface{}, error), old interface{}) (interface{}, error) {
+	plugin, rcv, snd, stage := connectedQueues(old)
+	if plugin == nil {
+		return nil, fmt.Errorf("restart %s: %w", pluginName(old), ErrNotSupported)
+	}
+	name := pluginName(plugin)
+	fail := func(err error) (interface{}, error) {
+		err = fmt.Errorf("restart %s: %w", name, err)
+		reportRestart(monitor, err)
+		return nil, err
+	}
+
+	reportLifecycle(monitor, LifecycleStopping)
+	st, ok := plugin.(Stoppable)
+	if ok {
+		st.Stop()
+	}
+	deadline := now().Add(RestartTimeout)
+	r, ok := plugin.(interface{ Running() bool })
+	if ok && !waitUntil(deadline, func() bool { return !r.Running() }) {
+		return fail(fmt.Errorf("still running: %w", ErrTimeout))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deadline.Sub(now()))
+	err := CloseTimeout(ctx, plugin)
+	cancel()
+	if err != nil {
+		reportRestart(monitor, fmt.Errorf("restart %s: %w", name, err))
+	}
+	reportLifecycle(monitor, LifecycleStopped)
+
+	reportLifecycle(monitor, LifecycleStarting)
+	fresh, err := makeNew()
+	if err != nil {
+		return fail(fmt.Errorf("new instance: %w", err))
+	}
+	run, err := runnerOf(fresh, rcv, snd, monitor)
+	if err != nil {
+		return fail(err)
+	}
+	m, ok := fresh.(Monitored)
+	if ok && monitor != nil {
+		m.SetMonitor(monitor)
+	}
+	mc := &MonitorControl{DoneChan: flow.DoneChan, WaitGroup: &sync.WaitGroup{}}
+	if monitor != nil {
+		mc.StatsChan = monitor.StatsChan
+		mc.FinalStatsChan = monitor.FinalStatsChan
+		mc.ClearChan = monitor.ClearChan
+	} else {
+		// the final statistics are sent once per run, nobody reads them
+		mc.StatsChan = make(chan interface{}, 1)
+		mc.FinalStatsChan = make(chan interface{}, 1)
+	}
+	mc.WaitGroup.Add(1)
+	flow.Go(pluginName(fresh), KindOf(fresh), func(ctx context.Context) {
+		run(mc)
+	})
+	reportLifecycle(monitor, LifecycleStarted)
+
+	if stage {
+		return PipelineStage{Plugin: fresh, Rcv: rcv, Snd: snd}, nil
+	}
+	return fresh, nil
+}
+
+// connectedQueues returns the plugin of old and the queues it is connected
+// to, and whether old is a PipelineStage. The plugin is nil when old does not
+// tell its queues.
+func connectedQueues(old interface{}) (interface{}, []Queue, []Queue, bool) {
+	switch p := old.(type) {
+	case PipelineStage:
+		return p.Plugin, p.Rcv, p.Snd, true
+	case Connected:
+		return p, p.Inputs(), p.Outputs(), false
+	default:
+		return nil, nil, nil, false
+	}
+}
+
+// runnerOf returns how to run plugin on rcv and snd, reporting the error a
+// DigesterErr stops with through monitor, and an error when it is of no kind
+// which can run on them
+func runnerOf(plugin interface{}, rcv []Queue, snd []Queue, monitor *Monitor) (func(mc *MonitorControl), error) {
+	switch p := plugin.(type) {
+	case Ingester:
+		if len(snd) == 1 {
+			return func(mc *MonitorControl) { p.Ingest(snd[0], mc) }, nil
+		}
+	case DigesterMulti:
+		if len(snd) == 1 {
+			return func(mc *MonitorControl) { p.DigestMulti(rcv, snd[0], mc) }, nil
+		}
+	case Digester, DigesterErr:
+		if len(rcv) == 1 && len(snd) == 1 {
+			return func(mc *MonitorControl) {
+				err := RunDigester(p, rcv[0], snd[0], mc)
+				if err != nil {
+					reportRestart(monitor, err)
+				}
+			}, nil
+		}
+	case Expeller:
+		if len(snd) == 0 {
+			return func(mc *MonitorControl) { p.Expel(rcv, mc) }, nil
+		}
+	default:
+		return nil, fmt.Errorf("run %T: %w", plugin, ErrNotSupported)
+	}
+	return nil, fmt.Errorf("run %s on %d receive and %d send queues: %w", pluginName(plugin), len(rcv), len(snd), ErrNotSupported)
+}
+
+// reportRestart reports err through monitor, or logs it without one
+func reportRestart(monitor *Monitor, err error) {
+	if monitor == nil {
+		logf("%v", err)
+		return
+	}
+	monitor.Error(err)
+}
+
+// reportLifecycle reports phase through monitor, if there is one
+func reportLifecycle(monitor *Monitor, phase LifecyclePhase) {
+	if monitor != nil {
+		monitor.Lifecycle(phase)
+	}
+}
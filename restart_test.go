@@ -0,0 +1,161 @@
+package icd
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// restartableIngester puts its line and runs until it is stopped, leaving
+// its send queue open, or reservoird shuts down
+type restartableIngester struct {
+	runner
+	line     string
+	stopping chan struct{}
+	once     sync.Once
+	closed   int32
+}
+
+func newRestartableIngester(line string) *restartableIngester {
+	return &restartableIngester{
+		runner:   runner{name: "restartable", kind: KindIngester},
+		line:     line,
+		stopping: make(chan struct{}),
+	}
+}
+
+func (i *restartableIngester) Ingest(snd Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	i.start()
+	defer i.stop(mc)
+	if snd.Put(i.line) == nil {
+		i.addSent(1)
+	}
+	select {
+	case <-i.stopping:
+	case <-mc.DoneChan:
+		snd.Close()
+	}
+}
+
+func (i *restartableIngester) Stop() {
+	i.once.Do(func() { close(i.stopping) })
+}
+
+func (i *restartableIngester) Close() error {
+	atomic.StoreInt32(&i.closed, 1)
+	return nil
+}
+
+func TestRestartPlugin(t *testing.T) {
+	snd := NewBaseQueue("snd", 0)
+	old := newRestartableIngester("old")
+	oldMC := newTestMonitorControl()
+	oldMC.WaitGroup.Add(1)
+	go old.Ingest(snd, oldMC)
+	waitFor(t, "the old instance to send", func() bool { return snd.Len() == 1 })
+
+	flow := NewFlow(newTestMonitorControl())
+	m := NewMonitor(newTestMonitorControl())
+	fresh := newRestartableIngester("new")
+	restarted, err := RestartPlugin(flow, m, func() (interface{}, error) {
+		return fresh, nil
+	}, PipelineStage{Plugin: old, Snd: []Queue{snd}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(restarted, PipelineStage{Plugin: fresh, Snd: []Queue{snd}}) {
+		t.Errorf("expected the stage of the new instance, got %+v", restarted)
+	}
+	if old.Running() || atomic.LoadInt32(&old.closed) != 1 {
+		t.Error("expected the old instance to be stopped and closed")
+	}
+
+	waitFor(t, "the new instance to send", func() bool { return snd.Len() == 2 })
+	if items, _ := snd.TakeAll(); !reflect.DeepEqual(items, []interface{}{"old", "new"}) {
+		t.Errorf("expected the send queue to receive from both instances, got %v", items)
+	}
+	if snd.Closed() || !fresh.Running() || fresh.monitor != m {
+		t.Error("expected the new instance to run on the open send queue with the monitor")
+	}
+	var phases []string
+	for len(m.EventChan) > 0 {
+		phases = append(phases, (<-m.EventChan).Fields["phase"])
+	}
+	if want := []string{"stopping", "stopped", "starting", "started"}; !reflect.DeepEqual(phases, want) {
+		t.Errorf("expected the lifecycle %v, got %v", want, phases)
+	}
+
+	flow.Shutdown()
+	flow.Wait()
+	if !snd.Closed() || fresh.Running() {
+		t.Error("expected the new instance to stop with the flow")
+	}
+	stats := (<-m.FinalStatsChan).(PluginStats)
+	if stats.Sent != 1 {
+		t.Errorf("expected the final stats of the new instance, got %+v", stats)
+	}
+}
+
+func TestRestartPluginErrors(t *testing.T) {
+	flow := NewFlow(newTestMonitorControl())
+	if _, err := RestartPlugin(flow, nil, nil, &testIngester{}); !IsNotSupported(err) {
+		t.Errorf("expected a plugin without queues to be unsupported, got %v", err)
+	}
+
+	m := NewMonitor(newTestMonitorControl())
+	errConfig := errors.New("bad config")
+	old := PipelineStage{Plugin: newRestartableIngester("old"), Snd: []Queue{NewBaseQueue("snd", 0)}}
+	_, err := RestartPlugin(flow, m, func() (interface{}, error) {
+		return nil, errConfig
+	}, old)
+	if !errors.Is(err, errConfig) {
+		t.Errorf("expected the error of makeNew, got %v", err)
+	}
+	select {
+	case reported := <-m.ErrorChan:
+		if reported.Error() != "restart restartable: new instance: bad config" {
+			t.Errorf("unexpected error %v", reported)
+		}
+	default:
+		t.Error("expected the error to be reported")
+	}
+
+	// an ingester cannot run on two send queues
+	old.Snd = append(old.Snd, NewBaseQueue("other", 0))
+	_, err = RestartPlugin(flow, m, func() (interface{}, error) {
+		return newRestartableIngester("new"), nil
+	}, old)
+	if !IsNotSupported(err) {
+		t.Errorf("expected an ingester on two send queues to be unsupported, got %v", err)
+	}
+}
+
+func TestRestartPluginTimeout(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	old := &pausableDigester{running: 1}
+	made := int32(0)
+	result := make(chan error, 1)
+	go func() {
+		_, err := RestartPlugin(NewFlow(newTestMonitorControl()), nil, func() (interface{}, error) {
+			atomic.StoreInt32(&made, 1)
+			return &pausableDigester{}, nil
+		}, PipelineStage{Plugin: old})
+		result <- err
+	}()
+	waitFor(t, "the wait for the old instance", func() bool { return c.Waiters() == 1 })
+	for c.Waiters() > 0 {
+		c.Advance(RestartTimeout)
+		time.Sleep(time.Millisecond)
+	}
+	if err := <-result; !IsTimeout(err) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	if atomic.LoadInt32(&made) != 0 {
+		t.Error("expected no new instance while the old one runs")
+	}
+}
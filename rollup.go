@@ -0,0 +1,131 @@
+package icd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RollupWindow is a rolling window over which RollupStats computes rates
+type RollupWindow struct {
+	// Label used as the suffix of the rate names, e.g. "1m"
+	Label string
+	// Length of the window
+	Length time.Duration
+}
+
+// RollupWindows are the windows maintained by RollupStats, load average style
+var RollupWindows = []RollupWindow{
+	{Label: "1m", Length: time.Minute},
+	{Label: "5m", Length: 5 * time.Minute},
+	{Label: "15m", Length: 15 * time.Minute},
+}
+
+type rollupSample struct {
+	at   time.Time
+	puts uint64
+	gets uint64
+}
+
+// RollupStats periodically samples the statistics of a queue and maintains
+// per second put and get rates over each of the RollupWindows
+type RollupStats struct {
+	queue    StatsReporter
+	interval time.Duration
+	mu       sync.Mutex
+	samples  []rollupSample
+}
+
+// NewRollupStats creates a RollupStats sampling q every interval. The queue
+// must implement StatsReporter and the interval must be positive.
+func NewRollupStats(q Queue, interval time.Duration) (*RollupStats, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid rollup interval %v", interval)
+	}
+	sr, ok := q.(StatsReporter)
+	if !ok {
+		return nil, fmt.Errorf("queue %s statistics: %w", q.Name(), ErrNotSupported)
+	}
+	return &RollupStats{
+		queue:    sr,
+		interval: interval,
+	}, nil
+}
+
+// Run samples the queue every interval until done is closed
+func (r *RollupStats) Run(done <-chan struct{}) {
+	for {
+		r.Sample()
+		select {
+		case <-after(r.interval):
+		case <-done:
+			return
+		}
+	}
+}
+
+// Sample takes a sample of the queue statistics immediately
+func (r *RollupStats) Sample() {
+	stats := r.queue.Stats()
+	t := now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.samples = append(r.samples, rollupSample{
+		at:   t,
+		puts: stats.Puts,
+		gets: stats.Gets,
+	})
+
+	// keep the newest sample at or beyond the longest window so that the
+	// longest window always has a base to compute from
+	longest := RollupWindows[len(RollupWindows)-1].Length
+	cutoff := t.Add(-longest)
+	drop := 0
+	for drop < len(r.samples)-1 && !r.samples[drop+1].at.After(cutoff) {
+		drop++
+	}
+	r.samples = r.samples[drop:]
+}
+
+// Rates returns the per second put and get rates over each window, keyed by
+// "puts_<label>" and "gets_<label>". Rates are zero until two samples have
+// been taken.
+func (r *RollupStats) Rates() map[string]float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rates := make(map[string]float64)
+	for _, w := range RollupWindows {
+		puts := 0.0
+		gets := 0.0
+		if len(r.samples) > 1 {
+			latest := r.samples[len(r.samples)-1]
+			base := r.samples[0]
+			cutoff := latest.at.Add(-w.Length)
+			for _, s := range r.samples {
+				if !s.at.Before(cutoff) {
+					base = s
+					break
+				}
+			}
+			elapsed := latest.at.Sub(base.at).Seconds()
+			if elapsed > 0 {
+				puts = rate(base.puts, latest.puts, elapsed)
+				gets = rate(base.gets, latest.gets, elapsed)
+			}
+		}
+		rates["puts_"+w.Label] = puts
+		rates["gets_"+w.Label] = gets
+	}
+	return rates
+}
+
+// rate returns the per second rate between two counter readings, a counter
+// which went backwards, e.g. after the statistics were cleared, yields zero
+func rate(from uint64, to uint64, seconds float64) float64 {
+	if to < from {
+		return 0
+	}
+	return float64(to-from) / seconds
+}
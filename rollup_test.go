@@ -0,0 +1,96 @@
+package icd
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRollupStatsConverges(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewBaseQueue("rollup", 0)
+	r, err := NewRollupStats(q, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rates := r.Rates()
+	if rates["puts_1m"] != 0 {
+		t.Errorf("expected zero rate before sampling, got %v", rates["puts_1m"])
+	}
+
+	// 10 puts and 5 gets per second for 20 minutes
+	for i := 0; i < 20*60; i++ {
+		r.Sample()
+		for j := 0; j < 10; j++ {
+			q.Put(j)
+		}
+		for j := 0; j < 5; j++ {
+			q.Get()
+		}
+		c.Advance(time.Second)
+	}
+	r.Sample()
+
+	rates = r.Rates()
+	for _, w := range RollupWindows {
+		if math.Abs(rates["puts_"+w.Label]-10) > 0.01 {
+			t.Errorf("expected puts_%s of 10, got %v", w.Label, rates["puts_"+w.Label])
+		}
+		if math.Abs(rates["gets_"+w.Label]-5) > 0.01 {
+			t.Errorf("expected gets_%s of 5, got %v", w.Label, rates["gets_"+w.Label])
+		}
+	}
+
+	// stop putting, the short window drops to zero before the long one
+	for i := 0; i < 60; i++ {
+		c.Advance(time.Second)
+		r.Sample()
+	}
+	rates = r.Rates()
+	if rates["puts_1m"] != 0 {
+		t.Errorf("expected puts_1m of 0 after a minute idle, got %v", rates["puts_1m"])
+	}
+	if rates["puts_15m"] <= 0 || rates["puts_15m"] >= 10 {
+		t.Errorf("expected puts_15m between 0 and 10, got %v", rates["puts_15m"])
+	}
+}
+
+func TestRollupStatsRun(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewBaseQueue("rollup", 0)
+	r, _ := NewRollupStats(q, time.Second)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		r.Run(done)
+		close(stopped)
+	}()
+	for i := 0; i < 3; i++ {
+		waitFor(t, "sampling interval", func() bool { return c.Waiters() == 1 })
+		q.Put(i)
+		c.Advance(time.Second)
+	}
+	waitFor(t, "sampling interval", func() bool { return c.Waiters() == 1 })
+	close(done)
+	<-stopped
+
+	if r.Rates()["puts_1m"] != 1 {
+		t.Errorf("expected puts_1m of 1, got %v", r.Rates()["puts_1m"])
+	}
+}
+
+func TestNewRollupStatsInvalid(t *testing.T) {
+	_, err := NewRollupStats(NewBaseQueue("rollup", 0), 0)
+	if err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+	// a queue without statistics
+	_, err = NewRollupStats(struct{ Queue }{NewBaseQueue("inner", 0)}, time.Second)
+	if !IsNotSupported(err) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
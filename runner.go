@@ -0,0 +1,124 @@
+package icd
+
+import (
+	"sync/atomic"
+)
+
+// PluginStats contains the statistics of an ingester, digester or expeller
+type PluginStats struct {
+	// Name of the plugin
+	Name string
+	// Kind of the plugin
+	Kind Kind
+	// Whether or not the plugin is running
+	Running bool
+	// Number of items received
+	Received uint64
+	// Number of items sent
+	Sent uint64
+}
+
+// runner provides the naming, statistics and monitor control bookkeeping
+// shared by the built-in ingesters, digesters and expellers
+type runner struct {
+	// counters first to keep them 64-bit aligned for atomic access
+	received uint64
+	sent     uint64
+	running  int32
+	started  int32
+	name     string
+	kind     Kind
+	monitor  *Monitor
+}
+
+// Name returns the name of the plugin
+func (r *runner) Name() string {
+	return r.name
+}
+
+// Running returns whether or not the plugin is running
+func (r *runner) Running() bool {
+	return atomic.LoadInt32(&r.running) == 1
+}
+
+// Started returns whether or not the plugin started, it stays true once the
+// plugin stopped
+func (r *runner) Started() bool {
+	return atomic.LoadInt32(&r.started) == 1
+}
+
+// SetMonitor sets the monitor the plugin reports its errors and summary to,
+// naming it after the plugin unless it is named already
+func (r *runner) SetMonitor(m *Monitor) {
+	if m != nil && m.Name == "" {
+		m.Name = r.name
+	}
+	r.monitor = m
+}
+
+func (r *runner) start() {
+	atomic.StoreInt32(&r.started, 1)
+	atomic.StoreInt32(&r.running, 1)
+}
+
+// stop marks the plugin as stopped, emits the summary to the monitor and
+// sends the final statistics
+func (r *runner) stop(mc *MonitorControl) {
+	atomic.StoreInt32(&r.running, 0)
+	if r.monitor != nil {
+		r.monitor.EmitSummary()
+	}
+	mc.FinalStatsChan <- r.stats()
+}
+
+// poll clears statistics when requested, sends the latest statistics, and
+// returns whether or not reservoird is shutting down. It never blocks.
+func (r *runner) poll(mc *MonitorControl) bool {
+	select {
+	case <-mc.ClearChan:
+		atomic.StoreUint64(&r.received, 0)
+		atomic.StoreUint64(&r.sent, 0)
+	default:
+	}
+	select {
+	case mc.StatsChan <- r.stats():
+	default:
+	}
+	select {
+	case <-mc.DoneChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// report reports a non-fatal error through the monitor, or logs it when the
+// plugin has none
+func (r *runner) report(err error) {
+	if r.monitor == nil {
+		logf("%s: %v", r.name, err)
+		return
+	}
+	r.monitor.Error(err)
+}
+
+func (r *runner) addReceived(n int) {
+	atomic.AddUint64(&r.received, uint64(n))
+	if r.monitor != nil {
+		r.monitor.Processed(n)
+	}
+}
+
+func (r *runner) addSent(n int) {
+	atomic.AddUint64(&r.sent, uint64(n))
+}
+
+func (r *runner) stats() PluginStats {
+	return PluginStats{
+		Name:     r.name,
+		Kind:     r.kind,
+		Running:  r.Running(),
+		Received: atomic.LoadUint64(&r.received),
+		Sent:     atomic.LoadUint64(&r.sent),
+	}
+}
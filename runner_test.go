@@ -0,0 +1,52 @@
+package icd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRunnerPoll(t *testing.T) {
+	r := &runner{name: "test", kind: KindDigester}
+	mc := newTestMonitorControl()
+	r.start()
+	r.addReceived(2)
+	r.addSent(1)
+
+	if r.poll(mc) {
+		t.Fatal("expected poll to report running")
+	}
+	stats := (<-mc.StatsChan).(PluginStats)
+	if stats.Name != "test" || stats.Kind != KindDigester || !stats.Running || stats.Received != 2 || stats.Sent != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	mc.ClearChan <- struct{}{}
+	r.poll(mc)
+	stats = (<-mc.StatsChan).(PluginStats)
+	if stats.Received != 0 || stats.Sent != 0 {
+		t.Errorf("expected cleared stats, got %+v", stats)
+	}
+
+	close(mc.DoneChan)
+	if !r.poll(mc) {
+		t.Error("expected poll to report done")
+	}
+	r.stop(mc)
+	final := (<-mc.FinalStatsChan).(PluginStats)
+	if final.Running || r.Running() {
+		t.Errorf("expected stopped, got %+v", final)
+	}
+}
+
+func TestRunnerReport(t *testing.T) {
+	r := &runner{name: "test", kind: KindDigester}
+	// without a monitor the error is logged
+	r.report(errors.New("logged"))
+
+	m := NewMonitor(newTestMonitorControl())
+	r.SetMonitor(m)
+	r.report(errors.New("reported"))
+	if err := <-m.ErrorChan; err.Error() != "reported" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package icd
+
+import (
+	"container/heap"
+	"strconv"
+	"sync"
+)
+
+type sequencedQueue struct {
+	Queue
+	mu   sync.Mutex
+	next int64
+}
+
+// NewSequencedQueue wraps q so that every item put is stamped with a
+// monotonically increasing sequence number, starting at 1, in the
+// HeaderSequence header of its Envelope. Items which are not already an
+// *Envelope are wrapped in one, so consumers get *Envelope items.
+func NewSequencedQueue(q Queue) Queue {
+	return &sequencedQueue{
+		Queue: q,
+	}
+}
+
+// Put stamps the item with the next sequence number and puts it into the
+// queue. A nil item, including a nil *Envelope, returns ErrNilItem; when the
+// put fails the envelope's sequence header is left as it was.
+func (q *sequencedQueue) Put(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	env, ok := item.(*Envelope)
+	if ok && env == nil {
+		return ErrNilItem
+	}
+	if !ok {
+		env = NewEnvelope(item)
+	}
+
+	// hold the lock across Put so sequence order matches enqueue order
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	prev, stamped := env.Headers[HeaderSequence]
+	env.SetHeader(HeaderSequence, strconv.FormatInt(q.next+1, 10))
+	err := q.Queue.Put(env)
+	if err != nil {
+		// leave the caller's envelope as it was
+		if stamped {
+			env.Headers[HeaderSequence] = prev
+		} else {
+			delete(env.Headers, HeaderSequence)
+		}
+		return err
+	}
+	q.next++
+	return nil
+}
+
+// Sequence returns the sequence number stamped on item by a sequenced queue
+func Sequence(item interface{}) (int64, bool) {
+	env, ok := item.(*Envelope)
+	if !ok || env == nil {
+		return 0, false
+	}
+	seq, err := strconv.ParseInt(env.Header(HeaderSequence), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return seq, true
+}
+
+type sequencedItem struct {
+	seq  int64
+	item interface{}
+}
+
+type sequenceHeap []sequencedItem
+
+func (h sequenceHeap) Len() int            { return len(h) }
+func (h sequenceHeap) Less(i, j int) bool  { return h[i].seq < h[j].seq }
+func (h sequenceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sequenceHeap) Push(x interface{}) { *h = append(*h, x.(sequencedItem)) }
+func (h *sequenceHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = sequencedItem{}
+	*h = old[:n-1]
+	return x
+}
+
+type reorderBuffer struct {
+	Queue
+	window  int
+	getMu   sync.Mutex
+	mu      sync.Mutex
+	pending sequenceHeap
+	next    int64
+	drained bool
+}
+
+// NewReorderBuffer wraps q, whose items were stamped by a sequenced queue and
+// may since have been reordered, e.g. by parallel processing. Get returns the
+// items in sequence order, holding back up to window items while waiting for
+// a missing sequence number. Once window items are held back the gap is
+// skipped; a skipped item arriving later is returned as soon as it is gotten.
+// Items without a sequence number are returned as they arrive.
+func NewReorderBuffer(q Queue, window int) Queue {
+	if window < 1 {
+		window = 1
+	}
+	return &reorderBuffer{
+		Queue:  q,
+		window: window,
+		next:   1,
+	}
+}
+
+// Get gets the next item in sequence order
+func (q *reorderBuffer) Get() (interface{}, error) {
+	q.getMu.Lock()
+	defer q.getMu.Unlock()
+	for {
+		q.mu.Lock()
+		if len(q.pending) > 0 {
+			top := q.pending[0]
+			if top.seq <= q.next || len(q.pending) >= q.window || q.drained {
+				heap.Pop(&q.pending)
+				if top.seq >= q.next {
+					q.next = top.seq + 1
+				}
+				q.mu.Unlock()
+				return top.item, nil
+			}
+		}
+		drained := q.drained
+		q.mu.Unlock()
+		if drained {
+			return nil, ErrQueueClosed
+		}
+
+		item, err := q.Queue.Get()
+		if IsQueueClosed(err) {
+			q.mu.Lock()
+			q.drained = true
+			q.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		seq, ok := Sequence(item)
+		if !ok {
+			return item, nil
+		}
+		q.mu.Lock()
+		heap.Push(&q.pending, sequencedItem{seq: seq, item: item})
+		q.mu.Unlock()
+	}
+}
+
+// Len returns the number of items in the wrapped queue and held back
+func (q *reorderBuffer) Len() int {
+	q.mu.Lock()
+	n := len(q.pending)
+	q.mu.Unlock()
+	return n + q.Queue.Len()
+}
+
+// Clear clears the wrapped queue and the held back items
+func (q *reorderBuffer) Clear() {
+	q.mu.Lock()
+	q.pending = nil
+	q.mu.Unlock()
+	q.Queue.Clear()
+}
+
+// Reset resets the wrapped queue and the expected sequence number
+func (q *reorderBuffer) Reset() {
+	q.mu.Lock()
+	q.pending = nil
+	q.next = 1
+	q.drained = false
+	q.mu.Unlock()
+	q.Queue.Reset()
+}
@@ -0,0 +1,123 @@
+package icd
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSequencedQueueStamps(t *testing.T) {
+	q := NewSequencedQueue(NewBaseQueue("sequenced", 0))
+	q.Put("a")
+	q.Put(NewEnvelope("b"))
+	for i := int64(1); i <= 2; i++ {
+		item, _ := q.Get()
+		seq, ok := Sequence(item)
+		if !ok || seq != i {
+			t.Errorf("expected sequence %d, got %d %v", i, seq, ok)
+		}
+	}
+}
+
+func TestSequencedQueueNilEnvelope(t *testing.T) {
+	q := NewSequencedQueue(NewBaseQueue("sequenced", 0))
+	if err := q.Put((*Envelope)(nil)); !IsNilItem(err) {
+		t.Errorf("expected ErrNilItem, got %v", err)
+	}
+	if err := q.Put(nil); !IsNilItem(err) {
+		t.Errorf("expected ErrNilItem, got %v", err)
+	}
+}
+
+func TestSequencedQueueFailedPutKeepsHeader(t *testing.T) {
+	inner := NewBaseQueue("sequenced", 0)
+	q := NewSequencedQueue(inner)
+	inner.Close()
+
+	env := NewEnvelope("a")
+	if err := q.Put(env); !IsQueueClosed(err) {
+		t.Fatalf("expected ErrQueueClosed, got %v", err)
+	}
+	if _, ok := Sequence(env); ok {
+		t.Error("expected no sequence header after a failed put")
+	}
+
+	env.SetHeader(HeaderSequence, "7")
+	q.Put(env)
+	if seq, _ := Sequence(env); seq != 7 {
+		t.Errorf("expected the original sequence 7 to be restored, got %d", seq)
+	}
+
+	inner.Reset()
+	q.Put("b")
+	item, _ := q.Get()
+	if seq, _ := Sequence(item); seq != 1 {
+		t.Errorf("expected failed puts not to use up sequence numbers, got %d", seq)
+	}
+}
+
+func TestReorderBufferWithinWindow(t *testing.T) {
+	const n = 50
+	const window = 8
+	stamped := NewSequencedQueue(NewBaseQueue("stamped", 0))
+	for i := 0; i < n; i++ {
+		stamped.Put(i)
+	}
+	stamped.Close()
+	var items []interface{}
+	for {
+		item, err := stamped.Get()
+		if err != nil {
+			break
+		}
+		items = append(items, item)
+	}
+
+	// shuffle each item at most window-1 places away from its position
+	r := rand.New(rand.NewSource(1))
+	for start := 0; start < n; start += window {
+		end := start + window
+		if end > n {
+			end = n
+		}
+		chunk := items[start:end]
+		r.Shuffle(len(chunk), func(i, j int) { chunk[i], chunk[j] = chunk[j], chunk[i] })
+	}
+
+	inner := NewBaseQueue("shuffled", 0)
+	for _, item := range items {
+		inner.Put(item)
+	}
+	inner.Close()
+	q := NewReorderBuffer(inner, window)
+	for i := int64(1); i <= n; i++ {
+		item, err := q.Get()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if seq, _ := Sequence(item); seq != i {
+			t.Fatalf("expected sequence %d, got %d", i, seq)
+		}
+	}
+	if _, err := q.Get(); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed once drained, got %v", err)
+	}
+}
+
+func TestReorderBufferSkipsGap(t *testing.T) {
+	inner := NewBaseQueue("gap", 0)
+	for _, seq := range []string{"2", "3", "1"} {
+		env := NewEnvelope(seq)
+		env.SetHeader(HeaderSequence, seq)
+		inner.Put(env)
+	}
+	q := NewReorderBuffer(inner, 2)
+	var got []int64
+	for i := 0; i < 3; i++ {
+		item, _ := q.Get()
+		seq, _ := Sequence(item)
+		got = append(got, seq)
+	}
+	if got[0] != 2 || got[1] != 3 || got[2] != 1 {
+		t.Errorf("expected the gap to be skipped once the window filled, got %v", got)
+	}
+}
@@ -0,0 +1,196 @@
+package icd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// shutdownPoll is how often GracefulShutdown checks whether stages stopped
+const shutdownPoll = 10 * time.Millisecond
+
+// Stoppable is the optional interface for plugins which can be asked to stop
+type Stoppable interface {
+	// Stop asks the plugin to stop, it returns without waiting for it
+	Stop()
+}
+
+// GracefulShutdown shuts the stages of flow down in the order items flow
+// through them, following the queues connecting them, so that no item in
+// flight is lost:
+//
+//  1. sources are stopped: ingesters through Stop when they are Stoppable,
+//     and the input queues no stage sends to are closed
+//  2. the stages, upstream before downstream, drain their closed input
+//     queues and stop; a queue is closed once every stage sending to it
+//     stopped, which lets the stages receiving from it drain. A stage which
+//     did not start yet is waited for, it may still start and drain its
+//     inputs
+//  3. the flow is shut down, stopping the monitors, and its WaitGroup waited
+//     for
+//
+// Ingesters are not waited for, their output queues are closed once they
+// were asked to stop. Stages on a cycle are shut down last, in the order
+// given. When the sequence takes longer than grace the stragglers are force
+// stopped: the flow is shut down and every queue of the stages closed, and
+// an error wrapping ErrTimeout naming the stages still running is returned.
+// Waiting follows the package Clock.
+func GracefulShutdown(flow *Flow, stages []Stage, grace time.Duration) error {
+	deadline := now().Add(grace)
+	ordered := shutdownOrder(stages)
+	senders := map[Queue]int{}
+	for _, s := range ordered {
+		for _, q := range s.Outputs() {
+			senders[q]++
+		}
+	}
+
+	for _, s := range ordered {
+		st, ok := s.(Stoppable)
+		if ok && s.Kind() == KindIngester {
+			st.Stop()
+		}
+		for _, q := range s.Inputs() {
+			if senders[q] == 0 {
+				q.Close()
+			}
+		}
+	}
+	for _, s := range ordered {
+		if s.Kind() != KindIngester {
+			s := s
+			if !waitUntil(deadline, func() bool { return stageStopped(s) }) {
+				return forceStop(flow, ordered)
+			}
+		}
+		for _, q := range s.Outputs() {
+			senders[q]--
+			if senders[q] == 0 {
+				q.Close()
+			}
+		}
+	}
+
+	flow.Shutdown()
+	wait := make(chan struct{})
+	go func() {
+		defer close(wait)
+		if flow.WaitGroup != nil {
+			flow.WaitGroup.Wait()
+		}
+	}()
+	if !waitUntil(deadline, func() bool {
+		select {
+		case <-wait:
+			return true
+		default:
+			return false
+		}
+	}) {
+		return forceStop(flow, ordered)
+	}
+	return nil
+}
+
+// shutdownOrder orders the stages topologically by the queues connecting
+// them, a stage after every stage sending to its inputs, keeping the given
+// order among stages which do not depend on each other. The stages on a
+// cycle are appended in the given order.
+func shutdownOrder(stages []Stage) []Stage {
+	senders := map[Queue][]int{}
+	for i, s := range stages {
+		for _, q := range s.Outputs() {
+			senders[q] = append(senders[q], i)
+		}
+	}
+	// the number of stages each stage waits for, and the stages waiting
+	// for it
+	upstream := make([]int, len(stages))
+	downstream := make([][]int, len(stages))
+	for j, s := range stages {
+		seen := map[int]bool{}
+		for _, q := range s.Inputs() {
+			for _, i := range senders[q] {
+				if i == j || seen[i] {
+					continue
+				}
+				seen[i] = true
+				upstream[j]++
+				downstream[i] = append(downstream[i], j)
+			}
+		}
+	}
+
+	ordered := make([]Stage, 0, len(stages))
+	done := make([]bool, len(stages))
+	for len(ordered) < len(stages) {
+		next := -1
+		for i := range stages {
+			if !done[i] && upstream[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			// only stages on a cycle are left
+			for i := range stages {
+				if !done[i] {
+					next = i
+					break
+				}
+			}
+		}
+		done[next] = true
+		ordered = append(ordered, stages[next])
+		for _, j := range downstream[next] {
+			upstream[j]--
+		}
+	}
+	return ordered
+}
+
+// stageStopped returns whether or not s ran and stopped. Stages which do not
+// report whether they started are taken to have started.
+func stageStopped(s Stage) bool {
+	st, ok := s.(interface{ Started() bool })
+	if ok && !st.Started() {
+		return false
+	}
+	return !s.Running()
+}
+
+// waitUntil polls cond until it holds, returning false if it still does not
+// at the deadline
+func waitUntil(deadline time.Time, cond func() bool) bool {
+	for !cond() {
+		left := deadline.Sub(now())
+		if left <= 0 {
+			return false
+		}
+		if left > shutdownPoll {
+			left = shutdownPoll
+		}
+		<-after(left)
+	}
+	return true
+}
+
+// forceStop shuts the flow down and closes every queue of the stages
+func forceStop(flow *Flow, stages []Stage) error {
+	flow.Shutdown()
+	running := []string{}
+	for _, s := range stages {
+		closeQueues(s.Inputs())
+		closeQueues(s.Outputs())
+		if !stageStopped(s) {
+			running = append(running, s.Name())
+		}
+	}
+	return fmt.Errorf("graceful shutdown force stopped %s: %w", strings.Join(running, ", "), ErrTimeout)
+}
+
+func closeQueues(queues []Queue) {
+	for _, q := range queues {
+		q.Close()
+	}
+}
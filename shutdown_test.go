@@ -0,0 +1,197 @@
+package icd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// endlessIngester puts items until its queue is closed
+type endlessIngester struct {
+	runner
+}
+
+func (i *endlessIngester) Ingest(snd Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	i.start()
+	defer i.stop(mc)
+	for n := 0; !i.poll(mc); n++ {
+		if snd.Put(n) != nil {
+			return
+		}
+		i.addSent(1)
+	}
+}
+
+// collectingExpeller collects the items of its queue until it is closed or,
+// when stubborn, until reservoird shuts down
+type collectingExpeller struct {
+	runner
+	stubborn bool
+	items    []interface{}
+}
+
+func (e *collectingExpeller) Expel(rcv []Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	e.start()
+	defer e.stop(mc)
+	if e.stubborn {
+		<-mc.DoneChan
+		return
+	}
+	for !e.poll(mc) {
+		item, err := rcv[0].Get()
+		if err != nil {
+			return
+		}
+		e.addReceived(1)
+		e.items = append(e.items, item)
+	}
+}
+
+func startTestPipeline(expeller *collectingExpeller) (*Flow, []Stage, *endlessIngester) {
+	mc := newTestMonitorControl()
+	mc.StatsChan = make(chan interface{})
+	flow := NewFlow(mc)
+	in := NewBaseQueue("in", 10)
+	out := NewBaseQueue("out", 10)
+	ingester := &endlessIngester{runner: runner{name: "source", kind: KindIngester}}
+	digester := WindowDigester("window", time.Hour, count)
+
+	p := NewPipeline()
+	// added out of order, shutdown orders the stages by their queues
+	p.Add(expeller, []Queue{out}, nil)
+	p.Add(digester, []Queue{in}, []Queue{out})
+	p.Add(ingester, nil, []Queue{in})
+
+	mc.WaitGroup.Add(5)
+	go in.Monitor(mc)
+	go out.Monitor(mc)
+	go expeller.Expel([]Queue{out}, mc)
+	go digester.Digest(in, out, mc)
+	go ingester.Ingest(in, mc)
+
+	stages := []Stage{}
+	for _, s := range p.Stages() {
+		stages = append(stages, s)
+	}
+	return flow, stages, ingester
+}
+
+func TestGracefulShutdownFlushes(t *testing.T) {
+	expeller := &collectingExpeller{runner: runner{name: "sink", kind: KindExpeller}}
+	flow, stages, ingester := startTestPipeline(expeller)
+	waitFor(t, "items to be ingested", func() bool { return ingester.stats().Sent > 100 })
+
+	if err := GracefulShutdown(flow, stages, time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the window held every item in flight, its flush reached the sink
+	total := 0
+	for _, item := range expeller.items {
+		total += item.(int)
+	}
+	if sent := int(ingester.stats().Sent); total != sent || sent == 0 {
+		t.Errorf("expected all %d ingested items to reach the sink, got %d", sent, total)
+	}
+}
+
+func TestGracefulShutdownForceStops(t *testing.T) {
+	expeller := &collectingExpeller{runner: runner{name: "sink", kind: KindExpeller}, stubborn: true}
+	flow, stages, _ := startTestPipeline(expeller)
+	waitFor(t, "the sink to start", expeller.Running)
+
+	started := time.Now()
+	err := GracefulShutdown(flow, stages, 50*time.Millisecond)
+	if !IsTimeout(err) || !strings.Contains(err.Error(), "sink") {
+		t.Fatalf("expected a timeout naming the sink, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the grace period to bound the shutdown, took %v", elapsed)
+	}
+	flow.WaitGroup.Wait()
+	if expeller.Running() {
+		t.Error("expected the straggler to be force stopped")
+	}
+}
+
+func sum(items []interface{}) interface{} {
+	total := 0
+	for _, item := range items {
+		total += item.(int)
+	}
+	return total
+}
+
+func TestGracefulShutdownFollowsQueues(t *testing.T) {
+	mc := newTestMonitorControl()
+	mc.StatsChan = make(chan interface{})
+	flow := NewFlow(mc)
+	in := NewBaseQueue("in", 10)
+	mid := NewBaseQueue("mid", 10)
+	out := NewBaseQueue("out", 10)
+	ingester := &endlessIngester{runner: runner{name: "source", kind: KindIngester}}
+	counter := WindowDigester("count", time.Hour, count)
+	summer := WindowDigester("sum", time.Hour, sum)
+	expeller := &collectingExpeller{runner: runner{name: "sink", kind: KindExpeller}}
+
+	// the digesters are added downstream first, shutdown follows the queues
+	p := NewPipeline()
+	p.Add(expeller, []Queue{out}, nil)
+	p.Add(summer, []Queue{mid}, []Queue{out})
+	p.Add(counter, []Queue{in}, []Queue{mid})
+	p.Add(ingester, nil, []Queue{in})
+	mc.WaitGroup.Add(4)
+	go expeller.Expel([]Queue{out}, mc)
+	go summer.Digest(mid, out, mc)
+	go counter.Digest(in, mid, mc)
+	go ingester.Ingest(in, mc)
+	waitFor(t, "items to be ingested", func() bool { return ingester.stats().Sent > 100 })
+
+	stages := []Stage{}
+	for _, s := range p.Stages() {
+		stages = append(stages, s)
+	}
+	if err := GracefulShutdown(flow, stages, time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total, sent := sum(expeller.items).(int), int(ingester.stats().Sent); total != sent {
+		t.Errorf("expected all %d ingested items to reach the sink, got %d", sent, total)
+	}
+}
+
+func TestGracefulShutdownWaitsForUnstartedStages(t *testing.T) {
+	mc := newTestMonitorControl()
+	mc.StatsChan = make(chan interface{})
+	flow := NewFlow(mc)
+	in := NewBaseQueue("in", 10)
+	out := NewBaseQueue("out", 10)
+	for i := 0; i < 5; i++ {
+		in.Put(1)
+	}
+	in.Close()
+	digester := WindowDigester("window", time.Hour, count)
+	expeller := &collectingExpeller{runner: runner{name: "sink", kind: KindExpeller}}
+	stages := []Stage{
+		PipelineStage{Plugin: digester, Rcv: []Queue{in}, Snd: []Queue{out}},
+		PipelineStage{Plugin: expeller, Rcv: []Queue{out}},
+	}
+	mc.WaitGroup.Add(2)
+	go expeller.Expel([]Queue{out}, mc)
+
+	// the digester starts only once the shutdown is under way, its output
+	// stays open until it drained its input
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- GracefulShutdown(flow, stages, time.Second) }()
+	time.Sleep(5 * shutdownPoll)
+	if out.Closed() {
+		t.Fatal("expected the output of the unstarted digester to stay open")
+	}
+	go digester.Digest(in, out, mc)
+	if err := <-shutdown; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(expeller.items) != 1 || expeller.items[0] != 5 {
+		t.Errorf("expected the flushed window of 5 items, got %v", expeller.items)
+	}
+}
@@ -0,0 +1,117 @@
+package icd
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Snapshotter is the optional interface for queues which can capture their
+// state for comparison over time, see DiffSnapshots
+type Snapshotter interface {
+	// SnapshotAt returns a snapshot of the statistics and items of the
+	// queue taken now, like Inspect it is intended for diagnostics rather
+	// than the data path
+	SnapshotAt() Snapshot
+}
+
+// Snapshot is the state of a queue at a point in time. It is immutable, the
+// items it returns are copies.
+type Snapshot struct {
+	time  time.Time
+	stats QueueStats
+	items []interface{}
+}
+
+// snapshotOf takes a snapshot of the queue inspected by i, its time follows
+// the package Clock
+func snapshotOf(i Inspector) Snapshot {
+	stats, items := i.Inspect()
+	return Snapshot{
+		time:  now(),
+		stats: stats,
+		items: items,
+	}
+}
+
+// Time returns when the snapshot was taken
+func (s Snapshot) Time() time.Time {
+	return s.time
+}
+
+// Stats returns the statistics of the queue
+func (s Snapshot) Stats() QueueStats {
+	return s.stats
+}
+
+// Items returns a copy of the items of the queue, in the order Get would
+// have returned them
+func (s Snapshot) Items() []interface{} {
+	items := make([]interface{}, len(s.items))
+	copy(items, s.items)
+	return items
+}
+
+// SnapshotDiff is the change of a queue between two snapshots
+type SnapshotDiff struct {
+	// Time elapsed from the first snapshot to the second
+	Elapsed time.Duration
+	// Items in the second snapshot but not the first, in queue order
+	Added []interface{}
+	// Items in the first snapshot but not the second, in queue order
+	Removed []interface{}
+	// Change of the number of items
+	LenDelta int
+	// Items put and gotten in between, negative when the statistics were
+	// cleared in between
+	PutsDelta int64
+	GetsDelta int64
+}
+
+// String summarizes the difference
+func (d SnapshotDiff) String() string {
+	return fmt.Sprintf("after %v: %+d items, %d added, %d removed, %+d puts, %+d gets",
+		d.Elapsed, d.LenDelta, len(d.Added), len(d.Removed), d.PutsDelta, d.GetsDelta)
+}
+
+// DiffSnapshots returns the change of a queue from snapshot a to the later
+// snapshot b. Items are matched by equality, as with ==, or by their %#v
+// formatting when they are not comparable, so an item present in both
+// snapshots as often in a as in b is neither added nor removed.
+func DiffSnapshots(a Snapshot, b Snapshot) SnapshotDiff {
+	return SnapshotDiff{
+		Elapsed:   b.time.Sub(a.time),
+		Added:     missingFrom(b.items, a.items),
+		Removed:   missingFrom(a.items, b.items),
+		LenDelta:  len(b.items) - len(a.items),
+		PutsDelta: int64(b.stats.Puts) - int64(a.stats.Puts),
+		GetsDelta: int64(b.stats.Gets) - int64(a.stats.Gets),
+	}
+}
+
+// missingFrom returns the items of items which exceed their occurrences in
+// other, in order
+func missingFrom(items []interface{}, other []interface{}) []interface{} {
+	counts := make(map[interface{}]int)
+	for _, item := range other {
+		counts[snapshotKey(item)]++
+	}
+	var missing []interface{}
+	for _, item := range items {
+		key := snapshotKey(item)
+		if counts[key] > 0 {
+			counts[key]--
+			continue
+		}
+		missing = append(missing, item)
+	}
+	return missing
+}
+
+// snapshotKey returns a map key identifying item
+func snapshotKey(item interface{}) interface{} {
+	if reflect.TypeOf(item).Comparable() {
+		return item
+	}
+	return fmt.Sprintf("%T %#v", item, item)
+}
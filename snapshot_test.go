@@ -0,0 +1,74 @@
+package icd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	q := NewBaseQueue("snapshot", 0)
+	q.Put("a")
+	q.Put("b")
+	q.Put("c")
+	a := q.SnapshotAt()
+
+	q.Get()
+	q.Put("d")
+	q.Put("e")
+	c.Advance(time.Minute)
+	b := q.SnapshotAt()
+
+	diff := DiffSnapshots(a, b)
+	if !reflect.DeepEqual(diff.Added, []interface{}{"d", "e"}) {
+		t.Errorf("expected d and e to be added, got %v", diff.Added)
+	}
+	if !reflect.DeepEqual(diff.Removed, []interface{}{"a"}) {
+		t.Errorf("expected a to be removed, got %v", diff.Removed)
+	}
+	if diff.Elapsed != time.Minute || diff.LenDelta != 1 || diff.PutsDelta != 2 || diff.GetsDelta != 1 {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+	if s := diff.String(); s != "after 1m0s: +1 items, 2 added, 1 removed, +2 puts, +1 gets" {
+		t.Errorf("unexpected summary %q", s)
+	}
+}
+
+func TestSnapshotImmutable(t *testing.T) {
+	q := NewBaseQueue("snapshot", 0)
+	q.Put("a")
+	s := q.SnapshotAt()
+	items := s.Items()
+	items[0] = "changed"
+	q.Put("b")
+	if got := s.Items(); len(got) != 1 || got[0] != "a" {
+		t.Errorf("expected the snapshot to be unchanged, got %v", got)
+	}
+	if s.Stats().Len != 1 {
+		t.Errorf("expected the stats at the time of the snapshot, got %+v", s.Stats())
+	}
+}
+
+func TestDiffSnapshotsDuplicatesAndUncomparable(t *testing.T) {
+	var q Queue = NewPriorityQueue("snapshot", 0, intPriority)
+	q.Put(1)
+	q.Put(1)
+	a := q.(Snapshotter).SnapshotAt()
+	q.Get()
+	b := q.(Snapshotter).SnapshotAt()
+	diff := DiffSnapshots(a, b)
+	if len(diff.Added) != 0 || !reflect.DeepEqual(diff.Removed, []interface{}{1}) {
+		t.Errorf("expected one of the duplicates to be removed, got %+v", diff)
+	}
+
+	bq := NewBaseQueue("bytes", 0)
+	bq.Put([]byte("x"))
+	a = bq.SnapshotAt()
+	bq.Put([]byte("y"))
+	diff = DiffSnapshots(a, bq.SnapshotAt())
+	if !reflect.DeepEqual(diff.Added, []interface{}{[]byte("y")}) || len(diff.Removed) != 0 {
+		t.Errorf("expected the uncomparable item y to be added, got %+v", diff)
+	}
+}
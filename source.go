@@ -0,0 +1,113 @@
+package icd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Source is a simple source of items, SourceToIngester drives it as an
+// Ingester
+type Source interface {
+	// Next returns the next item, blocking until there is one. Returns
+	// io.EOF once the source is exhausted.
+	Next() (interface{}, error)
+}
+
+// Sink is a simple destination of items, SinkToExpeller drives it as an
+// Expeller
+type Sink interface {
+	// Write delivers the item
+	Write(item interface{}) error
+}
+
+type sourceIngester struct {
+	runner
+	src Source
+}
+
+// SourceToIngester creates an ingester putting the items of src into its
+// send queue. The ingester stops, closing the send queue, when src returns
+// io.EOF or another error, which is reported, or when reservoird shuts
+// down.
+func SourceToIngester(name string, src Source) Ingester {
+	return &sourceIngester{
+		runner: runner{name: name, kind: KindIngester},
+		src:    src,
+	}
+}
+
+// Ingest puts the items of the source into snd until it is exhausted
+func (i *sourceIngester) Ingest(snd Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	i.start()
+	defer i.stop(mc)
+
+	for !i.poll(mc) {
+		item, err := i.src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			i.report(fmt.Errorf("next: %w", err))
+			break
+		}
+		i.addReceived(1)
+		if snd.Put(item) != nil {
+			break
+		}
+		i.addSent(1)
+	}
+	snd.Close()
+}
+
+type sinkExpeller struct {
+	runner
+	mu   sync.Mutex
+	sink Sink
+}
+
+// SinkToExpeller creates an expeller writing the items of its receive queues
+// to sink, one at a time. An item sink fails to write is dropped and the
+// error reported. The expeller stops when every receive queue is closed and
+// drained or when reservoird shuts down, by then getters blocked on a queue
+// write the item they get next before they stop.
+func SinkToExpeller(name string, sink Sink) Expeller {
+	return &sinkExpeller{
+		runner: runner{name: name, kind: KindExpeller},
+		sink:   sink,
+	}
+}
+
+// Expel writes the items of rcv to the sink until every queue is closed
+func (e *sinkExpeller) Expel(rcv []Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	e.start()
+	defer e.stop(mc)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	items, closed := fanIn(rcv, stop, e.write)
+	for !e.poll(mc) {
+		select {
+		case item := <-items:
+			e.addReceived(1)
+			e.write(item)
+		case <-closed:
+			return
+		case <-mc.DoneChan:
+		}
+	}
+}
+
+// write writes item to the sink, reporting a failure
+func (e *sinkExpeller) write(item interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	err := e.sink.Write(item)
+	if err != nil {
+		e.report(fmt.Errorf("write: %w", err))
+		return
+	}
+	e.addSent(1)
+}
@@ -0,0 +1,110 @@
+package icd
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+type sliceSource struct {
+	items []interface{}
+	err   error
+}
+
+func (s *sliceSource) Next() (interface{}, error) {
+	if len(s.items) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	item := s.items[0]
+	s.items = s.items[1:]
+	return item, nil
+}
+
+type sliceSink struct {
+	mu    sync.Mutex
+	items []interface{}
+}
+
+func (s *sliceSink) Write(item interface{}) error {
+	if item == "bad" {
+		return errors.New("bad item")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = append(s.items, item)
+	return nil
+}
+
+func TestSourceToSinkPipeline(t *testing.T) {
+	src := &sliceSource{items: []interface{}{"a", "bad", "b", "c"}}
+	sink := &sliceSink{}
+	ingester := SourceToIngester("source", src)
+	expeller := SinkToExpeller("sink", sink)
+	m := NewMonitor(newTestMonitorControl())
+	expeller.(Monitored).SetMonitor(m)
+
+	q := NewBaseQueue("q", 1)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(2)
+	go ingester.Ingest(q, mc)
+	go expeller.Expel([]Queue{q}, mc)
+	// EOF closes the queue, which stops the expeller
+	mc.WaitGroup.Wait()
+
+	if len(sink.items) != 3 || sink.items[0] != "a" || sink.items[1] != "b" || sink.items[2] != "c" {
+		t.Errorf("expected a, b and c at the sink, got %v", sink.items)
+	}
+	if len(m.ErrorChan) != 1 {
+		t.Errorf("expected the failed write to be reported, got %d errors", len(m.ErrorChan))
+	}
+	if ingester.Running() || expeller.Running() || !q.Closed() {
+		t.Error("expected both plugins to stop and the queue to be closed")
+	}
+	stats := map[string]PluginStats{}
+	for i := 0; i < 2; i++ {
+		s := (<-mc.FinalStatsChan).(PluginStats)
+		stats[s.Name] = s
+	}
+	if stats["source"].Sent != 4 || stats["sink"].Received != 4 || stats["sink"].Sent != 3 {
+		t.Errorf("unexpected final stats %+v", stats)
+	}
+}
+
+func TestSourceToIngesterError(t *testing.T) {
+	src := &sliceSource{items: []interface{}{1}, err: errors.New("broken")}
+	ingester := SourceToIngester("source", src)
+	m := NewMonitor(newTestMonitorControl())
+	ingester.(Monitored).SetMonitor(m)
+	q := NewBaseQueue("q", 0)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	ingester.Ingest(q, mc)
+
+	if q.Len() != 1 || !q.Closed() {
+		t.Errorf("expected the item before the error and a closed queue, got %d items", q.Len())
+	}
+	if err := <-m.ErrorChan; err.Error() != "next: broken" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestSinkToExpellerMultipleQueues(t *testing.T) {
+	sink := &sliceSink{}
+	expeller := SinkToExpeller("sink", sink)
+	a := NewBaseQueue("a", 0)
+	b := NewBaseQueue("b", 0)
+	a.Put(1)
+	b.Put(2)
+	a.Close()
+	b.Close()
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	expeller.Expel([]Queue{a, b}, mc)
+	if len(sink.items) != 2 {
+		t.Errorf("expected the items of both queues, got %v", sink.items)
+	}
+}
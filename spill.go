@@ -0,0 +1,201 @@
+package icd
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sync"
+)
+
+func init() {
+	gob.Register(PluginStats{})
+	gob.Register(QueueStats{})
+}
+
+// SpillConfig configures the disk buffer a Monitor spills statistics to
+// while their consumer does not keep up, see Monitor.EnableSpill
+type SpillConfig struct {
+	// Path of the file backing the buffer. It is created when missing,
+	// statistics left in it by an earlier run are replayed first.
+	Path string
+	// Size of the buffer in bytes, the file takes this plus a small header.
+	// Statistics which do not fit are dropped and counted.
+	MaxBytes int
+	// Number of messages waiting on the stats channel from which further
+	// statistics spill to disk, at least 1
+	Threshold int
+}
+
+// statsSpill is the disk buffer of a Monitor and the replay of its messages
+type statsSpill struct {
+	queue     Queue
+	threshold int
+	mu        sync.Mutex
+	pending   int
+	dropped   uint64
+	wake      chan struct{}
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+// gobStats wraps a statistics message so gob records its concrete type
+type gobStats struct {
+	Stats interface{}
+}
+
+// statsCodec encodes statistics messages with gob, types other than
+// PluginStats and QueueStats must be registered with gob.Register
+type statsCodec struct{}
+
+func (statsCodec) Encode(item interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(&gobStats{Stats: item})
+	return b.Bytes(), err
+}
+
+func (statsCodec) Decode(data []byte) (interface{}, error) {
+	var s gobStats
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s)
+	return s.Stats, err
+}
+
+// EnableSpill makes SendStats spill statistics to a bounded disk buffer at
+// cfg.Path once cfg.Threshold messages wait on the stats channel, instead of
+// holding them in memory or dropping them. Spilled statistics are replayed
+// to the stats channel in order, as its consumer recovers, and newer
+// statistics queue up behind them. Statistics are encoded with gob, types
+// other than PluginStats and QueueStats must be registered with
+// gob.Register. Returns ErrNotSupported on platforms without mmap.
+func (m *Monitor) EnableSpill(cfg SpillConfig) error {
+	if cfg.Threshold < 1 {
+		cfg.Threshold = 1
+	}
+	q, err := NewMmapQueue(cfg.Path, cfg.MaxBytes, statsCodec{})
+	if err != nil {
+		return fmt.Errorf("stats spill: %w", err)
+	}
+	sp := &statsSpill{
+		queue:     q,
+		threshold: cfg.Threshold,
+		pending:   q.Len(),
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	m.mu.Lock()
+	old := m.spill
+	m.spill = sp
+	m.mu.Unlock()
+	if old != nil {
+		old.close()
+	}
+	go sp.replay(m.StatsChan)
+	return nil
+}
+
+// DisableSpill stops spilling and replaying statistics, those not replayed
+// yet stay in the file for a later EnableSpill
+func (m *Monitor) DisableSpill() error {
+	m.mu.Lock()
+	sp := m.spill
+	m.spill = nil
+	m.mu.Unlock()
+	if sp == nil {
+		return nil
+	}
+	return sp.close()
+}
+
+// SpillDropped returns the number of statistics messages dropped because the
+// disk buffer was full
+func (m *Monitor) SpillDropped() uint64 {
+	m.mu.Lock()
+	sp := m.spill
+	m.mu.Unlock()
+	if sp == nil {
+		return 0
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.dropped
+}
+
+// SendStats sends a statistics message to reservoird without blocking. The
+// message is dropped when the stats channel is full, unless spilling to disk
+// is enabled with EnableSpill. Snapshot returns the message last sent.
+func (m *Monitor) SendStats(stats interface{}) {
+	m.mu.Lock()
+	sp := m.spill
+	m.latest = stats
+	m.updated = now()
+	m.mu.Unlock()
+	if sp != nil {
+		sp.send(m.StatsChan, stats)
+		return
+	}
+	select {
+	case m.StatsChan <- stats:
+	default:
+	}
+}
+
+// send sends stats to ch, or spills it while the backlog is at the threshold
+// or spilled messages wait for replay
+func (sp *statsSpill) send(ch chan interface{}, stats interface{}) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.pending == 0 && len(ch) < sp.threshold {
+		select {
+		case ch <- stats:
+			return
+		default:
+		}
+	}
+	err := sp.queue.(NonBlocking).TryPut(stats)
+	if err != nil {
+		sp.dropped++
+		return
+	}
+	sp.pending++
+	select {
+	case sp.wake <- struct{}{}:
+	default:
+	}
+}
+
+// replay sends the spilled messages to ch, in order, until stopped. A
+// message is removed from the buffer only once it is sent.
+func (sp *statsSpill) replay(ch chan interface{}) {
+	defer close(sp.stopped)
+	for {
+		stats, ok, err := PeekMatch(sp.queue, func(interface{}) bool { return true })
+		if err != nil {
+			return
+		}
+		if !ok {
+			select {
+			case <-sp.wake:
+				continue
+			case <-sp.stop:
+				return
+			}
+		}
+		select {
+		case ch <- stats:
+		case <-sp.stop:
+			return
+		}
+		sp.queue.(NonBlocking).TryGet()
+		sp.mu.Lock()
+		sp.pending--
+		sp.mu.Unlock()
+	}
+}
+
+// close stops the replay, waiting for it so a message sent is removed from
+// the buffer, and closes the buffer
+func (sp *statsSpill) close() error {
+	close(sp.stop)
+	<-sp.stopped
+	return sp.queue.Close()
+}
@@ -0,0 +1,91 @@
+package icd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newSpillMonitor(t *testing.T, cfg SpillConfig, backlog int) *Monitor {
+	t.Helper()
+	mc := newTestMonitorControl()
+	mc.StatsChan = make(chan interface{}, backlog)
+	m := NewMonitor(mc)
+	err := m.EnableSpill(cfg)
+	if IsNotSupported(err) {
+		t.Skip("mmap not supported on this platform")
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return m
+}
+
+func TestMonitorSpillAndReplay(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stats")
+	m := newSpillMonitor(t, SpillConfig{Path: path, MaxBytes: 1 << 16, Threshold: 2}, 2)
+	defer m.DisableSpill()
+
+	// the consumer is stalled, everything beyond the backlog of 2 spills
+	for i := uint64(1); i <= 5; i++ {
+		m.SendStats(PluginStats{Name: "p", Sent: i})
+	}
+	waitFor(t, "stats to spill", func() bool { return len(m.StatsChan) == 2 })
+	info, err := os.Stat(path)
+	if err != nil || info.Size() <= 1<<16 {
+		t.Fatalf("expected the spill file, got %v", err)
+	}
+
+	// the consumer recovers and gets every message in order
+	for i := uint64(1); i <= 5; i++ {
+		stats := (<-m.StatsChan).(PluginStats)
+		if stats.Sent != i {
+			t.Fatalf("expected message %d, got %+v", i, stats)
+		}
+	}
+	m.SendStats(QueueStats{Name: "q"})
+	if stats := (<-m.StatsChan).(QueueStats); stats.Name != "q" {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if m.SpillDropped() != 0 {
+		t.Errorf("expected nothing dropped, got %d", m.SpillDropped())
+	}
+}
+
+func TestMonitorSpillBounded(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	m := newSpillMonitor(t, SpillConfig{Path: filepath.Join(dir, "stats"), MaxBytes: 512, Threshold: 1}, 1)
+	for i := 0; i < 20; i++ {
+		m.SendStats(PluginStats{Name: "p"})
+	}
+	if m.SpillDropped() == 0 {
+		t.Error("expected messages beyond the size cap to be dropped")
+	}
+	m.DisableSpill()
+	if m.SpillDropped() != 0 {
+		t.Error("expected no count without spilling")
+	}
+}
+
+func TestMonitorSpillSurvivesRestart(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	cfg := SpillConfig{Path: filepath.Join(dir, "stats"), MaxBytes: 1 << 16, Threshold: 1}
+	m := newSpillMonitor(t, cfg, 1)
+	for i := uint64(1); i <= 3; i++ {
+		m.SendStats(PluginStats{Sent: i})
+	}
+	// message 1 waits on the channel, 2 and 3 on disk
+	m.DisableSpill()
+
+	m2 := newSpillMonitor(t, cfg, 2)
+	defer m2.DisableSpill()
+	for i := uint64(2); i <= 3; i++ {
+		if stats := (<-m2.StatsChan).(PluginStats); stats.Sent != i {
+			t.Errorf("expected the spilled message %d to be replayed, got %+v", i, stats)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package icd
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// spscSpins is how often a blocked Put or Get of an spsc queue retries
+// before it parks
+const spscSpins = 64
+
+type spscQueue struct {
+	// the next slot to get and to put, each written by one side only and
+	// padded onto its own cache line; they double as the gets and puts
+	head uint64
+	_    [56]byte
+	tail uint64
+	_    [56]byte
+
+	closed   int32
+	waiting  [2]int32
+	buf      []interface{}
+	mask     uint64
+	capacity uint64
+	notEmpty chan struct{}
+	notFull  chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// waiting indices of the consumer and the producer
+const (
+	spscConsumer = iota
+	spscProducer
+)
+
+// NewSPSCQueue creates a queue holding at most capacity items for exactly
+// one producer and one consumer, such as the queue between two plugins of a
+// simple pipeline. Put and Get pass items through a lock-free ring buffer
+// and only park when the queue is full or empty, which makes it faster than
+// BaseQueue for this case. It is unsafe to Put from more than one goroutine
+// or Get from more than one goroutine at a time, and Clear and Reset must not
+// run concurrently with Put or Get; Len, Cap, Close, Closed and the
+// statistics are safe anywhere. A capacity below 1 is raised to 1.
+func NewSPSCQueue(capacity int) Queue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	size := 1
+	for size < capacity {
+		size <<= 1
+	}
+	return &spscQueue{
+		buf:      make([]interface{}, size),
+		mask:     uint64(size - 1),
+		capacity: uint64(capacity),
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// Name provides the name of the queue
+func (q *spscQueue) Name() string {
+	return "spsc"
+}
+
+// Put puts an item into the queue, blocking while the queue is full. Only
+// one goroutine may put at a time.
+func (q *spscQueue) Put(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	for spins := 0; ; spins++ {
+		err := q.TryPut(item)
+		if !IsQueueFull(err) {
+			return err
+		}
+		if spins < spscSpins {
+			runtime.Gosched()
+			continue
+		}
+		q.park(spscProducer, q.notFull, func() bool {
+			return q.Len() < int(q.capacity)
+		})
+	}
+}
+
+// TryPut puts an item into the queue, returning ErrQueueFull when the queue
+// is full. Only one goroutine may put at a time.
+func (q *spscQueue) TryPut(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	if q.Closed() {
+		return ErrQueueClosed
+	}
+	tail := atomic.LoadUint64(&q.tail)
+	if tail-atomic.LoadUint64(&q.head) >= q.capacity {
+		return ErrQueueFull
+	}
+	q.buf[tail&q.mask] = item
+	atomic.StoreUint64(&q.tail, tail+1)
+	q.wake(spscConsumer, q.notEmpty)
+	return nil
+}
+
+// Get gets the next item from the queue, blocking while the queue is empty.
+// Only one goroutine may get at a time.
+func (q *spscQueue) Get() (interface{}, error) {
+	for spins := 0; ; spins++ {
+		item, err := q.TryGet()
+		if !IsQueueEmpty(err) {
+			return item, err
+		}
+		if spins < spscSpins {
+			runtime.Gosched()
+			continue
+		}
+		q.park(spscConsumer, q.notEmpty, func() bool {
+			return q.Len() > 0
+		})
+	}
+}
+
+// TryGet gets the next item from the queue, returning ErrQueueEmpty when the
+// queue is empty. Only one goroutine may get at a time.
+func (q *spscQueue) TryGet() (interface{}, error) {
+	// closed before tail, so the items put before Close are seen
+	closed := q.Closed()
+	head := atomic.LoadUint64(&q.head)
+	if head == atomic.LoadUint64(&q.tail) {
+		if closed {
+			return nil, ErrQueueClosed
+		}
+		return nil, ErrQueueEmpty
+	}
+	slot := head & q.mask
+	item := q.buf[slot]
+	q.buf[slot] = nil
+	atomic.StoreUint64(&q.head, head+1)
+	q.wake(spscProducer, q.notFull)
+	return item, nil
+}
+
+// park blocks the side until it is woken through ready or the queue closes.
+// The side announces it waits before checking ready for the last time, so
+// the other side either sees it waiting or made it ready beforehand.
+func (q *spscQueue) park(side int, wake <-chan struct{}, ready func() bool) {
+	atomic.StoreInt32(&q.waiting[side], 1)
+	defer atomic.StoreInt32(&q.waiting[side], 0)
+	if ready() || q.Closed() {
+		return
+	}
+	select {
+	case <-wake:
+	case <-q.done:
+	}
+}
+
+// wake wakes the side when it is parked
+func (q *spscQueue) wake(side int, wake chan<- struct{}) {
+	if atomic.LoadInt32(&q.waiting[side]) == 0 {
+		return
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of items in the queue
+func (q *spscQueue) Len() int {
+	head := atomic.LoadUint64(&q.head)
+	return int(atomic.LoadUint64(&q.tail) - head)
+}
+
+// Cap returns the maximum number of items the queue can hold
+func (q *spscQueue) Cap() int {
+	return int(q.capacity)
+}
+
+// Clear removes all items from the queue, it must not run concurrently with
+// Put or Get
+func (q *spscQueue) Clear() {
+	for i := range q.buf {
+		q.buf[i] = nil
+	}
+	atomic.StoreUint64(&q.head, atomic.LoadUint64(&q.tail))
+}
+
+// Reset removes all items, clears statistics and reopens the queue, it must
+// not run concurrently with Put or Get
+func (q *spscQueue) Reset() {
+	for i := range q.buf {
+		q.buf[i] = nil
+	}
+	atomic.StoreUint64(&q.head, 0)
+	atomic.StoreUint64(&q.tail, 0)
+	q.done = make(chan struct{})
+	q.once = sync.Once{}
+	atomic.StoreInt32(&q.closed, 0)
+}
+
+// Close closes the queue, waking a blocked producer and consumer
+func (q *spscQueue) Close() error {
+	q.once.Do(func() {
+		atomic.StoreInt32(&q.closed, 1)
+		close(q.done)
+	})
+	return nil
+}
+
+// Closed returns whether or not the queue is closed
+func (q *spscQueue) Closed() bool {
+	return atomic.LoadInt32(&q.closed) == 1
+}
+
+// Stats returns the current statistics of the queue
+func (q *spscQueue) Stats() QueueStats {
+	gets := atomic.LoadUint64(&q.head)
+	puts := atomic.LoadUint64(&q.tail)
+	return QueueStats{
+		Name:   q.Name(),
+		Len:    int(puts - gets),
+		Cap:    q.Cap(),
+		Puts:   puts,
+		Gets:   gets,
+		Closed: q.Closed(),
+	}
+}
+
+// Monitor sends the statistics of the queue every second and the final
+// statistics on shutdown. The statistics count the items since the last
+// Reset, a clear request is ignored.
+func (q *spscQueue) Monitor(mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	for {
+		select {
+		case <-mc.ClearChan:
+		case <-mc.DoneChan:
+			mc.FinalStatsChan <- q.Stats()
+			return
+		case <-after(monitorInterval):
+			select {
+			case mc.StatsChan <- q.Stats():
+			default:
+			}
+		}
+	}
+}
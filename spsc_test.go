@@ -0,0 +1,116 @@
+package icd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSPSCQueueFIFO(t *testing.T) {
+	q := NewSPSCQueue(3)
+	if q.Cap() != 3 {
+		t.Errorf("expected capacity 3, got %d", q.Cap())
+	}
+	for i := 0; i < 3; i++ {
+		if err := q.(NonBlocking).TryPut(i); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if err := q.(NonBlocking).TryPut(3); !IsQueueFull(err) {
+		t.Errorf("expected ErrQueueFull beyond the capacity, got %v", err)
+	}
+	if err := q.Put(nil); !IsNilItem(err) {
+		t.Errorf("expected ErrNilItem, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		item, err := q.Get()
+		if err != nil || item != i {
+			t.Errorf("expected item %d, got %v %v", i, item, err)
+		}
+	}
+	if _, err := q.(NonBlocking).TryGet(); !IsQueueEmpty(err) {
+		t.Errorf("expected ErrQueueEmpty, got %v", err)
+	}
+	stats := q.(StatsReporter).Stats()
+	if stats.Puts != 3 || stats.Gets != 3 || stats.Len != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSPSCQueueProducerConsumer(t *testing.T) {
+	const n = 100000
+	q := NewSPSCQueue(16)
+	go func() {
+		for i := 0; i < n; i++ {
+			q.Put(i)
+		}
+		q.Close()
+	}()
+	for i := 0; ; i++ {
+		item, err := q.Get()
+		if IsQueueClosed(err) {
+			if i != n {
+				t.Errorf("expected %d items before the close, got %d", n, i)
+			}
+			return
+		}
+		if item != i {
+			t.Fatalf("expected item %d, got %v", i, item)
+		}
+	}
+}
+
+func TestSPSCQueueCloseWakesBlocked(t *testing.T) {
+	q := NewSPSCQueue(1)
+	q.Put("a")
+	put := make(chan error, 1)
+	go func() {
+		put <- q.Put("b")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	if err := <-put; !IsQueueClosed(err) {
+		t.Errorf("expected the blocked put to fail with ErrQueueClosed, got %v", err)
+	}
+	item, err := q.Get()
+	if err != nil || item != "a" {
+		t.Errorf("expected a to be drained after the close, got %v %v", item, err)
+	}
+	if _, err := q.Get(); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed once drained, got %v", err)
+	}
+
+	q.Reset()
+	got := make(chan error, 1)
+	go func() {
+		_, err := q.Get()
+		got <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	if err := <-got; !IsQueueClosed(err) {
+		t.Errorf("expected the blocked get to fail with ErrQueueClosed, got %v", err)
+	}
+}
+
+func benchmarkSPSC(b *testing.B, q Queue) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < b.N; i++ {
+			q.Get()
+		}
+	}()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q.Put(i)
+	}
+	<-done
+}
+
+func BenchmarkSPSCQueue(b *testing.B) {
+	benchmarkSPSC(b, NewSPSCQueue(1024))
+}
+
+func BenchmarkBaseQueueSPSC(b *testing.B) {
+	benchmarkSPSC(b, NewBaseQueue("base", 1024))
+}
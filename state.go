@@ -0,0 +1,138 @@
+package icd
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrIllegalTransition is returned when a StateMachine is asked for a
+// transition its lifecycle does not allow
+var ErrIllegalTransition = errors.New("illegal state transition")
+
+// stateObserverBuffer is how many transitions a channel returned by
+// Transitions buffers
+const stateObserverBuffer = 16
+
+// PluginState is a state in the lifecycle of a plugin
+type PluginState int
+
+const (
+	// StateCreated is the state of a plugin returned by New
+	StateCreated PluginState = iota
+	// StateInitialized is the state of a plugin ready to run
+	StateInitialized
+	// StateRunning is the state of a plugin processing items
+	StateRunning
+	// StatePaused is the state of a running plugin which holds off
+	// processing items
+	StatePaused
+	// StateStopping is the state of a plugin shutting down
+	StateStopping
+	// StateStopped is the state of a plugin which shut down
+	StateStopped
+	// StateFailed is the state of a plugin which stopped on an error
+	StateFailed
+)
+
+// transitions lists the states each state may change to. Stopped and failed
+// plugins may be initialized again, e.g. after a Reset.
+var transitions = map[PluginState][]PluginState{
+	StateCreated:     {StateInitialized, StateFailed},
+	StateInitialized: {StateRunning, StateStopping, StateFailed},
+	StateRunning:     {StatePaused, StateStopping, StateFailed},
+	StatePaused:      {StateRunning, StateStopping, StateFailed},
+	StateStopping:    {StateStopped, StateFailed},
+	StateStopped:     {StateInitialized},
+	StateFailed:      {StateInitialized},
+}
+
+// String returns the name of the state
+func (s PluginState) String() string {
+	switch s {
+	case StateCreated:
+		return "created"
+	case StateInitialized:
+		return "initialized"
+	case StateRunning:
+		return "running"
+	case StatePaused:
+		return "paused"
+	case StateStopping:
+		return "stopping"
+	case StateStopped:
+		return "stopped"
+	case StateFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("PluginState(%d)", int(s))
+	}
+}
+
+// MarshalText encodes the state as its name, e.g. in JSON
+func (s PluginState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// CanTransition returns whether or not a plugin in state s may change to to
+func (s PluginState) CanTransition(to PluginState) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StateMachine tracks the lifecycle state of a plugin, for plugins of any
+// kind to embed. It starts out in StateCreated and only makes the
+// transitions the lifecycle allows, see PluginState.CanTransition. The zero
+// value is ready to use and must not be copied once used.
+type StateMachine struct {
+	mu        sync.Mutex
+	state     PluginState
+	observers []chan PluginState
+}
+
+// State returns the current state
+func (m *StateMachine) State() PluginState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Running returns whether or not the plugin is running, paused or not
+func (m *StateMachine) Running() bool {
+	state := m.State()
+	return state == StateRunning || state == StatePaused
+}
+
+// Transition changes the state to to, returning ErrIllegalTransition, and
+// keeping the state, when the lifecycle does not allow it
+func (m *StateMachine) Transition(to PluginState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.state.CanTransition(to) {
+		return fmt.Errorf("%s to %s: %w", m.state, to, ErrIllegalTransition)
+	}
+	m.state = to
+	for _, observer := range m.observers {
+		select {
+		case observer <- to:
+		default:
+		}
+	}
+	return nil
+}
+
+// Transitions returns a channel receiving every state entered from now on.
+// Each call returns a new channel buffering 16 states, a
+// transition is dropped for an observer whose buffer is full so that a slow
+// observer never holds back the plugin. The channel is never closed.
+func (m *StateMachine) Transitions() <-chan PluginState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	observer := make(chan PluginState, stateObserverBuffer)
+	m.observers = append(m.observers, observer)
+	return observer
+}
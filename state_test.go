@@ -0,0 +1,95 @@
+package icd
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestStateMachineLifecycle(t *testing.T) {
+	var m StateMachine
+	if m.State() != StateCreated || m.Running() {
+		t.Fatalf("expected a new state machine to be created, got %s", m.State())
+	}
+	for _, to := range []PluginState{
+		StateInitialized, StateRunning, StatePaused, StateRunning,
+		StateStopping, StateStopped, StateInitialized,
+	} {
+		if err := m.Transition(to); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if m.State() != to {
+			t.Errorf("expected %s, got %s", to, m.State())
+		}
+		if m.Running() != (to == StateRunning || to == StatePaused) {
+			t.Errorf("unexpected Running %v in %s", m.Running(), to)
+		}
+	}
+}
+
+func TestStateMachineRejectsIllegalTransition(t *testing.T) {
+	var m StateMachine
+	err := m.Transition(StateRunning)
+	if !errors.Is(err, ErrIllegalTransition) || err.Error() != "created to running: illegal state transition" {
+		t.Errorf("expected an illegal transition, got %v", err)
+	}
+	if m.State() != StateCreated {
+		t.Errorf("expected the state to be kept, got %s", m.State())
+	}
+
+	m.Transition(StateFailed)
+	if err := m.Transition(StateStopped); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("expected a failed plugin not to stop, got %v", err)
+	}
+	if err := m.Transition(StateInitialized); err != nil {
+		t.Errorf("expected a failed plugin to be initialized again, got %v", err)
+	}
+}
+
+func TestStateMachineTransitions(t *testing.T) {
+	var m StateMachine
+	m.Transition(StateInitialized)
+	first := m.Transitions()
+	second := m.Transitions()
+	m.Transition(StateRunning)
+	// a rejected transition is not observed
+	m.Transition(StateRunning)
+	m.Transition(StateFailed)
+
+	for _, observer := range []<-chan PluginState{first, second} {
+		for _, want := range []PluginState{StateRunning, StateFailed} {
+			select {
+			case got := <-observer:
+				if got != want {
+					t.Errorf("expected %s, got %s", want, got)
+				}
+			default:
+				t.Fatalf("expected the transition to %s to be observed", want)
+			}
+		}
+		select {
+		case got := <-observer:
+			t.Errorf("expected no further transition, got %s", got)
+		default:
+		}
+	}
+
+	// a full observer drops transitions rather than blocking
+	for i := 0; i < 2*stateObserverBuffer; i++ {
+		m.Transition(StateInitialized)
+		m.Transition(StateFailed)
+	}
+	if len(first) != stateObserverBuffer {
+		t.Errorf("expected a full buffer, got %d", len(first))
+	}
+}
+
+func TestPluginStateMarshal(t *testing.T) {
+	data, _ := json.Marshal(map[string]PluginState{"state": StatePaused})
+	if string(data) != `{"state":"paused"}` {
+		t.Errorf("unexpected JSON %s", data)
+	}
+	if PluginState(42).String() != "PluginState(42)" {
+		t.Errorf("unexpected name %s", PluginState(42))
+	}
+}
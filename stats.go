@@ -0,0 +1,79 @@
+package icd
+
+// QueueStats contains the statistics of a queue
+type QueueStats struct {
+	// Name of the queue
+	Name string
+	// Number of items currently in the queue
+	Len int
+	// Maximum number of items the queue can hold, -1 if unbounded
+	Cap int
+	// Number of items handed out but not yet acknowledged, see
+	// InflightQueue
+	Inflight int
+	// Total number of items put into the queue
+	Puts uint64
+	// Total number of items gotten from the queue
+	Gets uint64
+	// Whether or not the queue is closed
+	Closed bool
+	// Buffering mode of an adaptive queue, see NewAdaptiveQueue, empty for
+	// other queues
+	Mode string
+	// Trace id of the most recent item put which carried one, see
+	// HeaderTraceID
+	LastTraceID string
+	// Time items spent in the queue, nil unless the queue measures it, see
+	// NewLatencyQueue
+	Latency *LatencyHistogram
+	// Durations of Put and Get, nil unless the queue measures them, see
+	// BaseQueue.SetLatencyBuckets
+	PutLatency *LatencyHistogram
+	GetLatency *LatencyHistogram
+}
+
+// StatsReporter is the optional interface for queues which keep statistics
+type StatsReporter interface {
+	// Stats returns the current statistics of the queue
+	Stats() QueueStats
+}
+
+// statsOf returns the statistics of q, as far as it reports them
+func statsOf(q Queue) QueueStats {
+	sr, ok := q.(StatsReporter)
+	if ok {
+		return sr.Stats()
+	}
+	return QueueStats{
+		Name:   q.Name(),
+		Len:    q.Len(),
+		Cap:    q.Cap(),
+		Closed: q.Closed(),
+	}
+}
+
+// BlockReporter is the optional interface for queues which count the
+// goroutines blocked on them, telling whether producers or consumers are the
+// bottleneck
+type BlockReporter interface {
+	// BlockedProducers returns the number of goroutines blocked putting
+	// into the full queue
+	BlockedProducers() int
+
+	// BlockedConsumers returns the number of goroutines blocked getting
+	// from the empty queue
+	BlockedConsumers() int
+}
+
+// Inspector is the optional interface for queues which can report their
+// statistics and contents as one consistent snapshot. Calling Stats and Each
+// separately can observe the queue in two different states when it is being
+// modified concurrently.
+type Inspector interface {
+	// Inspect returns the statistics and a copy of the items of the queue,
+	// in the order Get would return them, taken under a single lock. The
+	// copy costs time and memory proportional to the length of the queue
+	// and blocks other operations while it is taken, so it is intended for
+	// diagnostics rather than the data path.
+	Inspect() (QueueStats, []interface{})
+}
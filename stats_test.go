@@ -0,0 +1,65 @@
+package icd
+
+import (
+	"sync"
+	"testing"
+)
+
+type inspectable interface {
+	Queue
+	Inspector
+}
+
+func TestInspectConsistentUnderModification(t *testing.T) {
+	queues := []inspectable{
+		NewBaseQueue("base", 0),
+		NewPriorityQueue("priority", 0, func(interface{}) int { return 0 }),
+	}
+	for _, q := range queues {
+		var wg sync.WaitGroup
+		done := make(chan struct{})
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				q.Put(i)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if nb, ok := q.(NonBlocking); ok {
+					nb.TryGet()
+				} else if q.Len() > 0 {
+					q.Get()
+				}
+			}
+		}()
+
+		for i := 0; i < 200; i++ {
+			stats, items := q.Inspect()
+			if len(items) != stats.Len || stats.Puts-stats.Gets != uint64(stats.Len) {
+				t.Fatalf("%s: inconsistent snapshot, %d items for %+v", stats.Name, len(items), stats)
+			}
+			// items are put in increasing order, so the snapshot holds the
+			// consecutive items put after the last one gotten
+			for j, item := range items {
+				if item.(int) != int(stats.Gets)+j {
+					t.Fatalf("%s: expected item %d at %d, got %v", stats.Name, int(stats.Gets)+j, j, item)
+				}
+			}
+		}
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,79 @@
+package icd
+
+import (
+	"strconv"
+	"time"
+)
+
+// EventSummary is the type of the events reported by Monitor.EmitSummary,
+// the fields are those of the Summary
+const EventSummary = "summary"
+
+// Summary is the account of a plugin run, totalled over the lifetime of its
+// Monitor
+type Summary struct {
+	// Name of the plugin
+	Name string `json:"name"`
+	// Time since the Monitor was created
+	Uptime time.Duration `json:"uptime"`
+	// Number of items the plugin processed, see Monitor.Processed
+	ItemsProcessed uint64 `json:"items_processed"`
+	// Number of errors reported, including those dropped or coalesced
+	Errors uint64 `json:"errors"`
+	// Message of the last error reported, empty when there was none
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Processed counts n items as processed by the plugin for its Summary. The
+// built-in plugins count the items they receive.
+func (m *Monitor) Processed(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.processed += uint64(n)
+}
+
+// Summary returns the totals of the plugin since the Monitor was created.
+// The uptime follows the package Clock.
+func (m *Monitor) Summary() Summary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.summary()
+}
+
+// summary returns the Summary, must be called with mu held
+func (m *Monitor) summary() Summary {
+	s := Summary{
+		Name:           m.Name,
+		ItemsProcessed: m.processed,
+		Errors:         m.errors,
+		LastError:      m.lastError,
+	}
+	if !m.started.IsZero() {
+		s.Uptime = now().Sub(m.started)
+	}
+	return s
+}
+
+// EmitSummary reports the Summary as an EventSummary event. By convention a
+// plugin emits it once when it stops, the built-in plugins do so before
+// sending their final statistics.
+func (m *Monitor) EmitSummary() {
+	s := m.Summary()
+	fields := map[string]string{
+		"uptime":          s.Uptime.String(),
+		"items_processed": strconv.FormatUint(s.ItemsProcessed, 10),
+		"errors":          strconv.FormatUint(s.Errors, 10),
+	}
+	if s.LastError != "" {
+		fields["last_error"] = s.LastError
+	}
+	m.Event(EventSummary, fields)
+}
+
+// countError counts err for the Summary
+func (m *Monitor) countError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors++
+	m.lastError = err.Error()
+}
@@ -0,0 +1,76 @@
+package icd
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMonitorSummaryAtShutdown(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	m := NewMonitor(newTestMonitorControl())
+	e := SinkToExpeller("sink", &sliceSink{})
+	e.(Monitored).SetMonitor(m)
+
+	rcv := NewBaseQueue("rcv", 0)
+	rcv.Put("a")
+	rcv.Put("bad")
+	rcv.Put("b")
+	rcv.Close()
+	c.Advance(time.Minute)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	e.Expel([]Queue{rcv}, mc)
+
+	s := m.Summary()
+	expected := Summary{
+		Name:           "sink",
+		Uptime:         time.Minute,
+		ItemsProcessed: 3,
+		Errors:         1,
+		LastError:      "write: bad item",
+	}
+	if s != expected {
+		t.Errorf("expected summary %+v, got %+v", expected, s)
+	}
+	if len(m.EventChan) != 1 {
+		t.Fatalf("expected the summary event on shutdown, got %d events", len(m.EventChan))
+	}
+	event := <-m.EventChan
+	if event.Type != EventSummary || event.Plugin != "sink" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	fields := map[string]string{
+		"uptime":          "1m0s",
+		"items_processed": "3",
+		"errors":          "1",
+		"last_error":      "write: bad item",
+	}
+	for key, value := range fields {
+		if event.Fields[key] != value {
+			t.Errorf("expected field %s %q, got %q", key, value, event.Fields[key])
+		}
+	}
+}
+
+func TestMonitorSummaryCountsEveryError(t *testing.T) {
+	useFakeClock()
+	defer SetClock(nil)
+	m := NewMonitor(newTestMonitorControl())
+	m.Name = "plugin"
+	m.Processed(2)
+	m.Processed(3)
+	m.ErrorThrottled(errors.New("flaky"), time.Minute)
+	m.ErrorThrottled(errors.New("flaky"), time.Minute)
+	m.Error(errors.New("last"))
+
+	s := m.Summary()
+	if s.Name != "plugin" || s.ItemsProcessed != 5 || s.Errors != 3 || s.LastError != "last" {
+		t.Errorf("unexpected summary %+v", s)
+	}
+	m.EmitSummary()
+	if event := <-m.EventChan; event.Fields["errors"] != "3" {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
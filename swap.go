@@ -0,0 +1,208 @@
+package icd
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SwapQueue migrates the items of old into the fresh queue returned by
+// factory and returns the fresh queue. old is drained in order into the
+// fresh queue, closed, which quiesces it, and drained once more of the items
+// put meanwhile; it is left open and untouched when the fresh queue cannot
+// hold its items. When items remain in old which it no longer hands out once
+// closed, SwapQueue returns an error rather than losing them silently. Puts
+// into old racing the swap, including puts blocked on a full old, fail with
+// ErrQueueClosed once it is closed and getters blocked on old may still
+// receive items being drained, so callers should stop using old first or wrap
+// it with NewSwappableQueue, whose puts and gets instead wait for the swap and
+// continue on the fresh queue.
+func SwapQueue(old Queue, factory func() Queue) (Queue, error) {
+	fresh := factory()
+	if fresh == nil {
+		return nil, fmt.Errorf("factory returned nil queue")
+	}
+	n := old.Len()
+	if fresh.Cap() >= 0 && fresh.Cap() < n {
+		return nil, fmt.Errorf("queue %s cannot hold %d items: %w", fresh.Name(), n, ErrQueueFull)
+	}
+	err := migrate(old, fresh)
+	if err != nil {
+		return nil, err
+	}
+	err = old.Close()
+	if err != nil {
+		return nil, err
+	}
+	err = migrate(old, fresh)
+	if err != nil {
+		return nil, err
+	}
+	left := old.Len()
+	if left > 0 {
+		return nil, fmt.Errorf("%d items left in closed queue %s", left, old.Name())
+	}
+	return fresh, nil
+}
+
+// migrate moves the items available in old into fresh, in order and without
+// waiting for more
+func migrate(old Queue, fresh Queue) error {
+	var items []interface{}
+	switch q := old.(type) {
+	case Taker:
+		taken, err := q.TakeAll()
+		if err != nil && !IsQueueClosed(err) {
+			return err
+		}
+		items = taken
+	case NonBlocking:
+		for {
+			item, err := q.TryGet()
+			if IsQueueEmpty(err) || IsQueueClosed(err) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			err = putMigrated(fresh, item)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		for old.Len() > 0 {
+			item, err := old.Get()
+			if IsQueueClosed(err) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+	}
+	for _, item := range items {
+		err := putMigrated(fresh, item)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putMigrated(fresh Queue, item interface{}) error {
+	err := fresh.Put(item)
+	if err != nil {
+		return fmt.Errorf("migrate item to %s: %w", fresh.Name(), err)
+	}
+	return nil
+}
+
+// Swappable is the optional interface for queues whose backing queue can be
+// replaced at runtime
+type Swappable interface {
+	// Swap migrates the items of the backing queue into the fresh queue
+	// returned by factory, which backs the queue from then on
+	Swap(factory func() Queue) error
+}
+
+type swappableQueue struct {
+	mu sync.RWMutex
+	q  Queue
+}
+
+// NewSwappableQueue wraps q so that it can be replaced, see Swappable,
+// without its users noticing. While a swap is in progress puts and gets
+// block, puts and gets blocked on the old backing queue are woken, and all
+// of them continue on the fresh queue once the swap is done.
+func NewSwappableQueue(q Queue) Queue {
+	return &swappableQueue{
+		q: q,
+	}
+}
+
+// Swap migrates the items into the fresh queue returned by factory, see
+// SwapQueue, and switches to it. The backing queue is kept when the swap
+// fails.
+func (q *swappableQueue) Swap(factory func() Queue) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	fresh, err := SwapQueue(q.q, factory)
+	if err != nil {
+		return err
+	}
+	q.q = fresh
+	return nil
+}
+
+// Name provides the name of the backing queue
+func (q *swappableQueue) Name() string {
+	return q.current().Name()
+}
+
+// Put puts an item into the backing queue, moving on to the fresh queue when
+// a swap happens meanwhile
+func (q *swappableQueue) Put(item interface{}) error {
+	for {
+		cur := q.current()
+		err := cur.Put(item)
+		if !IsQueueClosed(err) || q.current() == cur {
+			return err
+		}
+	}
+}
+
+// Get gets the next item from the backing queue, moving on to the fresh
+// queue when a swap happens meanwhile
+func (q *swappableQueue) Get() (interface{}, error) {
+	for {
+		cur := q.current()
+		item, err := cur.Get()
+		if !IsQueueClosed(err) || q.current() == cur {
+			return item, err
+		}
+	}
+}
+
+// Len returns the number of items in the backing queue
+func (q *swappableQueue) Len() int {
+	return q.current().Len()
+}
+
+// Cap returns the capacity of the backing queue
+func (q *swappableQueue) Cap() int {
+	return q.current().Cap()
+}
+
+// Clear clears the backing queue
+func (q *swappableQueue) Clear() {
+	q.current().Clear()
+}
+
+// Reset resets the backing queue
+func (q *swappableQueue) Reset() {
+	q.current().Reset()
+}
+
+// Close closes the backing queue
+func (q *swappableQueue) Close() error {
+	return q.current().Close()
+}
+
+// Closed returns whether or not the backing queue is closed
+func (q *swappableQueue) Closed() bool {
+	return q.current().Closed()
+}
+
+// Monitor provides monitoring of the queue which backs it when Monitor is
+// called
+func (q *swappableQueue) Monitor(mc *MonitorControl) {
+	q.current().Monitor(mc)
+}
+
+// current returns the backing queue, waiting for a swap in progress
+func (q *swappableQueue) current() Queue {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.q
+}
@@ -0,0 +1,136 @@
+package icd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSwapQueue(t *testing.T) {
+	old := NewBaseQueue("memory", 0)
+	for i := 0; i < 100; i++ {
+		old.Put(i)
+	}
+	fresh, err := SwapQueue(old, func() Queue { return NewBaseQueue("fresh", 100) })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !old.Closed() || old.Len() != 0 {
+		t.Errorf("expected old to be closed and drained, got len %d", old.Len())
+	}
+	for i := 0; i < 100; i++ {
+		if item, _ := fresh.Get(); item != i {
+			t.Fatalf("expected %d, got %v", i, item)
+		}
+	}
+}
+
+func TestSwapQueueFromMmap(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	old := newTestMmapQueue(t, filepath.Join(dir, "queue"), 4096)
+	old.Put([]byte("a"))
+	old.Put([]byte("b"))
+	fresh, err := SwapQueue(old, func() Queue { return NewBaseQueue("fresh", 0) })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fresh.Len() != 2 || getString(t, fresh) != "a" || getString(t, fresh) != "b" {
+		t.Error("expected the items of the mmap queue to be migrated")
+	}
+}
+
+// lateQueue hands out no items once closed, and gets an item put as it
+// closes, like a put racing the swap
+type lateQueue struct {
+	Queue
+}
+
+func (q lateQueue) Get() (interface{}, error) {
+	if q.Closed() {
+		return nil, ErrQueueClosed
+	}
+	return q.Queue.Get()
+}
+
+func (q lateQueue) Close() error {
+	q.Queue.Put("late")
+	return q.Queue.Close()
+}
+
+func TestSwapQueueItemsLeft(t *testing.T) {
+	old := lateQueue{NewBaseQueue("late", 0)}
+	old.Put("a")
+	_, err := SwapQueue(old, func() Queue { return NewBaseQueue("fresh", 0) })
+	if err == nil || !strings.Contains(err.Error(), "1 items left") {
+		t.Errorf("expected the item left in old to fail the swap, got %v", err)
+	}
+}
+
+func TestSwapQueueTooSmall(t *testing.T) {
+	old := NewBaseQueue("memory", 0)
+	old.Put(1)
+	old.Put(2)
+	_, err := SwapQueue(old, func() Queue { return NewBaseQueue("fresh", 1) })
+	if !IsQueueFull(err) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	if old.Closed() || old.Len() != 2 {
+		t.Error("expected old to be left untouched")
+	}
+}
+
+func TestSwappableQueueBlockedPut(t *testing.T) {
+	q := NewSwappableQueue(NewBaseQueue("full", 1))
+	q.Put(1)
+	put := make(chan error)
+	go func() {
+		put <- q.Put(2)
+	}()
+	select {
+	case <-put:
+		t.Fatal("put did not block on the full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	err := q.(Swappable).Swap(func() Queue { return NewBaseQueue("fresh", 10) })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := <-put; err != nil {
+		t.Errorf("expected the blocked put to continue on the fresh queue, got %v", err)
+	}
+	if q.Name() != "fresh" || q.Closed() {
+		t.Errorf("expected the open fresh queue to back the queue, got %s", q.Name())
+	}
+	for i := 1; i <= 2; i++ {
+		if item, _ := q.Get(); item != i {
+			t.Errorf("expected %d, got %v", i, item)
+		}
+	}
+}
+
+func TestSwappableQueueBlockedGet(t *testing.T) {
+	q := NewSwappableQueue(NewBaseQueue("empty", 0))
+	get := make(chan interface{})
+	go func() {
+		item, _ := q.Get()
+		get <- item
+	}()
+	time.Sleep(20 * time.Millisecond)
+	q.(Swappable).Swap(func() Queue { return NewBaseQueue("fresh", 0) })
+	q.Put("after swap")
+	if item := <-get; item != "after swap" {
+		t.Errorf("expected the blocked get to continue on the fresh queue, got %v", item)
+	}
+}
+
+func TestSwappableQueueClose(t *testing.T) {
+	q := NewSwappableQueue(NewBaseQueue("queue", 0))
+	q.Close()
+	if err := q.Put(1); !IsQueueClosed(err) {
+		t.Errorf("expected ErrQueueClosed without a swap, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package icd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// FileTailInterval is how often a FileTailIngester checks its file for new
+// lines, rotation and truncation once it read everything
+var FileTailInterval = 250 * time.Millisecond
+
+type fileTailIngester struct {
+	runner
+	path          string
+	fromBeginning bool
+	file          *os.File
+	info          os.FileInfo
+	offset        int64
+	buf           []byte
+	partial       []byte
+}
+
+// FileTailIngester creates an ingester following the file at path, like
+// tail -F, and putting every line appended to it into its send queue as a
+// string without the newline. It starts at the end of the file, or at its
+// beginning when fromBeginning is set; files it opens later, because path did
+// not exist yet or was rotated, are read from their beginning. Every
+// FileTailInterval after reading everything it checks path: a different
+// file there, e.g. after logrotate renamed the old one, is opened once the
+// lines appended to the old file are read, and a file shorter than the lines
+// read so far is read again from its beginning as it was truncated. A last
+// line without a newline is sent when the file is rotated or truncated. The
+// ingester waits for a missing file, reports failures to open or read it and
+// stops, closing the send queue, when reservoird shuts down.
+func FileTailIngester(name, path string, fromBeginning bool) Ingester {
+	return &fileTailIngester{
+		runner:        runner{name: name, kind: KindIngester},
+		path:          path,
+		fromBeginning: fromBeginning,
+	}
+}
+
+// Ingest puts the lines of the file into snd until reservoird shuts down
+func (i *fileTailIngester) Ingest(snd Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	i.start()
+	defer i.stop(mc)
+	defer snd.Close()
+	defer i.close()
+
+	first := true
+	for !i.poll(mc) {
+		if i.file == nil {
+			err := i.open(first && !i.fromBeginning)
+			first = false
+			if err != nil {
+				if !os.IsNotExist(err) {
+					i.report(fmt.Errorf("open %s: %w", i.path, err))
+				}
+				i.wait(mc)
+				continue
+			}
+		}
+		read, err := i.read(snd)
+		if err != nil {
+			return
+		}
+		if read {
+			continue
+		}
+		if i.rotated(snd) {
+			continue
+		}
+		i.wait(mc)
+	}
+}
+
+// open opens the file at path, at its end when atEnd is set
+func (i *fileTailIngester) open(atEnd bool) error {
+	f, err := os.Open(i.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	i.offset = 0
+	if atEnd {
+		i.offset, err = f.Seek(0, io.SeekEnd)
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	i.file = f
+	i.info = info
+	i.partial = nil
+	return nil
+}
+
+func (i *fileTailIngester) close() {
+	if i.file != nil {
+		i.file.Close()
+		i.file = nil
+	}
+}
+
+// read puts the complete lines appended to the file into snd, returns
+// whether or not it read anything. A read failure is reported and the file
+// reopened, the error is only returned when snd fails.
+func (i *fileTailIngester) read(snd Queue) (bool, error) {
+	if i.buf == nil {
+		i.buf = make([]byte, 32*1024)
+	}
+	n, err := i.file.Read(i.buf)
+	if n > 0 {
+		i.offset += int64(n)
+		i.partial = append(i.partial, i.buf[:n]...)
+		for {
+			end := bytes.IndexByte(i.partial, '\n')
+			if end < 0 {
+				break
+			}
+			line := string(i.partial[:end])
+			i.partial = i.partial[end+1:]
+			putErr := i.put(snd, line)
+			if putErr != nil {
+				return true, putErr
+			}
+		}
+	}
+	if err != nil && err != io.EOF {
+		i.report(fmt.Errorf("read %s: %w", i.path, err))
+		i.close()
+	}
+	return n > 0, nil
+}
+
+// rotated checks whether the file at path was replaced or truncated and
+// switches to it, sending the last line of the old file first. It keeps
+// the old file while path is missing, as a writer may still append to it.
+func (i *fileTailIngester) rotated(snd Queue) bool {
+	info, err := os.Stat(i.path)
+	if err != nil {
+		return false
+	}
+	replaced := !os.SameFile(i.info, info)
+	truncated := !replaced && info.Size() < i.offset
+	if !replaced && !truncated {
+		return false
+	}
+	// the old file may have grown since it was last read
+	for replaced && i.file != nil {
+		read, err := i.read(snd)
+		if err != nil || !read {
+			break
+		}
+	}
+	if len(i.partial) > 0 {
+		i.put(snd, string(i.partial))
+		i.partial = nil
+	}
+	if replaced {
+		i.close()
+		return true
+	}
+	_, err = i.file.Seek(0, io.SeekStart)
+	if err != nil {
+		i.report(fmt.Errorf("seek %s: %w", i.path, err))
+		i.close()
+		return true
+	}
+	i.offset = 0
+	return true
+}
+
+func (i *fileTailIngester) put(snd Queue, line string) error {
+	i.addReceived(1)
+	err := snd.Put(line)
+	if err != nil {
+		return err
+	}
+	i.addSent(1)
+	return nil
+}
+
+// wait waits for FileTailInterval or reservoird to shut down
+func (i *fileTailIngester) wait(mc *MonitorControl) {
+	select {
+	case <-after(FileTailInterval):
+	case <-mc.DoneChan:
+	}
+}
@@ -0,0 +1,137 @@
+package icd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	_, err = f.WriteString(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// startTail runs a FileTailIngester on path polling every millisecond
+func startTail(path string, fromBeginning bool) (Ingester, *BaseQueue, *MonitorControl, func()) {
+	interval := FileTailInterval
+	FileTailInterval = time.Millisecond
+	snd := NewBaseQueue("snd", 0)
+	ing := FileTailIngester("tail", path, fromBeginning)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go ing.Ingest(snd, mc)
+	return ing, snd, mc, func() {
+		close(mc.DoneChan)
+		mc.WaitGroup.Wait()
+		FileTailInterval = interval
+	}
+}
+
+// takeLines waits for n lines and returns them
+func takeLines(t *testing.T, q *BaseQueue, n int) []interface{} {
+	t.Helper()
+	waitFor(t, "lines", func() bool { return q.Len() >= n })
+	items, _ := q.TakeAll()
+	return items
+}
+
+func TestFileTailIngesterFollowsRotation(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "a\nb\n")
+	_, snd, _, stop := startTail(path, true)
+	defer stop()
+
+	if got := takeLines(t, snd, 2); !reflect.DeepEqual(got, []interface{}{"a", "b"}) {
+		t.Errorf("expected the existing lines, got %v", got)
+	}
+	appendFile(t, path, "c\nd")
+	appendFile(t, path, "\n")
+	if got := takeLines(t, snd, 2); !reflect.DeepEqual(got, []interface{}{"c", "d"}) {
+		t.Errorf("expected the appended lines, got %v", got)
+	}
+
+	// lines written to the rotated file before the new one appears are kept
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	appendFile(t, path+".1", "e\nlast")
+	appendFile(t, path, "f\ng\n")
+	want := []interface{}{"e", "last", "f", "g"}
+	if got := takeLines(t, snd, 4); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v across the rotation, got %v", want, got)
+	}
+}
+
+func TestFileTailIngesterFromEnd(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "old\n")
+	ing, snd, _, stop := startTail(path, false)
+	waitFor(t, "ingester to start", ing.Running)
+
+	// which line the ingester starts at is racy until it opened the file
+	waitFor(t, "file to be opened", func() bool {
+		appendFile(t, path, "probe\n")
+		return snd.Len() > 0
+	})
+	snd.TakeAll()
+	appendFile(t, path, "new\n")
+	got := takeLines(t, snd, 1)
+	stop()
+	for _, line := range got {
+		if line == "old" {
+			t.Errorf("expected the existing line to be skipped, got %v", got)
+		}
+	}
+	if got[len(got)-1] != "new" {
+		t.Errorf("expected the appended line, got %v", got)
+	}
+	if !snd.Closed() || ing.Running() {
+		t.Error("expected the ingester to stop and close its send queue")
+	}
+}
+
+func TestFileTailIngesterTruncation(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "a long first line\n")
+	_, snd, _, stop := startTail(path, true)
+	defer stop()
+
+	takeLines(t, snd, 1)
+	if err := ioutil.WriteFile(path, []byte("b\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := takeLines(t, snd, 1); !reflect.DeepEqual(got, []interface{}{"b"}) {
+		t.Errorf("expected the truncated file to be read again, got %v", got)
+	}
+}
+
+func TestFileTailIngesterWaitsForFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	_, snd, _, stop := startTail(path, false)
+	defer stop()
+
+	time.Sleep(5 * time.Millisecond)
+	appendFile(t, path, "a\n")
+	if got := takeLines(t, snd, 1); !reflect.DeepEqual(got, []interface{}{"a"}) {
+		t.Errorf("expected a file created later to be read from its beginning, got %v", got)
+	}
+}
@@ -0,0 +1,112 @@
+package icd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Topology is a snapshot of the stages and queues of a pipeline and how they
+// are connected. It marshals to JSON as is, DOT renders it for Graphviz.
+type Topology struct {
+	Stages []TopologyStage `json:"stages"`
+	Queues []TopologyQueue `json:"queues"`
+	Edges  []TopologyEdge  `json:"edges"`
+}
+
+// TopologyStage is a plugin of a topology
+type TopologyStage struct {
+	// Id of the node, "stage:" followed by the name of the plugin
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Kind Kind   `json:"kind"`
+}
+
+// TopologyQueue is a queue of a topology
+type TopologyQueue struct {
+	// Id of the node, "queue:" followed by the name of the queue
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Len  int    `json:"len"`
+	Cap  int    `json:"cap"`
+}
+
+// TopologyEdge is the flow of items from one node of a topology to another,
+// from a queue to the stage receiving from it or from a stage to the queue
+// it sends to
+type TopologyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Topology returns a snapshot of the topology of the pipeline. Stages are
+// listed in the order they were added, queues in the order they are first
+// connected.
+func (p *Pipeline) Topology() Topology {
+	t := Topology{
+		Stages: []TopologyStage{},
+		Queues: []TopologyQueue{},
+		Edges:  []TopologyEdge{},
+	}
+	seen := map[Queue]string{}
+	queueID := func(q Queue) string {
+		id, ok := seen[q]
+		if !ok {
+			id = "queue:" + q.Name()
+			seen[q] = id
+			t.Queues = append(t.Queues, TopologyQueue{ID: id, Name: q.Name(), Len: q.Len(), Cap: q.Cap()})
+		}
+		return id
+	}
+	for _, s := range p.Stages() {
+		id := "stage:" + s.Name()
+		t.Stages = append(t.Stages, TopologyStage{ID: id, Name: s.Name(), Kind: s.Kind()})
+		for _, q := range s.Inputs() {
+			t.Edges = append(t.Edges, TopologyEdge{From: queueID(q), To: id})
+		}
+		for _, q := range s.Outputs() {
+			t.Edges = append(t.Edges, TopologyEdge{From: id, To: queueID(q)})
+		}
+	}
+	return t
+}
+
+// DOT renders the topology in the Graphviz DOT language, stages as boxes and
+// queues as ellipses labelled with their length and capacity
+func (t Topology) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph pipeline {\n")
+	for _, s := range t.Stages {
+		fmt.Fprintf(&b, "\t%s [label=%s shape=box];\n", dotQuote(s.ID), dotQuote(s.Name+"\n"+string(s.Kind)))
+	}
+	for _, q := range t.Queues {
+		fmt.Fprintf(&b, "\t%s [label=%s shape=ellipse];\n", dotQuote(q.ID), dotQuote(fmt.Sprintf("%s\n%d/%d", q.Name, q.Len, q.Cap)))
+	}
+	for _, e := range t.Edges {
+		fmt.Fprintf(&b, "\t%s -> %s;\n", dotQuote(e.From), dotQuote(e.To))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+// TopologyHandler serves the live topology of p, as JSON or, with the query
+// parameter format=dot, as DOT
+func TopologyHandler(p *Pipeline) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := p.Topology()
+		if r.URL.Query().Get("format") == "dot" {
+			w.Header().Set("Content-Type", "text/vnd.graphviz")
+			fmt.Fprint(w, t.DOT())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+	})
+}
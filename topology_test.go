@@ -0,0 +1,76 @@
+package icd
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestPipeline() *Pipeline {
+	in := NewBaseQueue("in", 10)
+	out := NewBaseQueue("out", 0)
+	in.Put(1)
+	p := NewPipeline()
+	p.Add(&testIngester{runner: runner{name: "stdin"}}, nil, []Queue{in})
+	p.Add(WindowDigester("window", time.Second, count), []Queue{in}, []Queue{out})
+	p.Add(&flakyExpeller{runner: runner{name: "stdout"}}, []Queue{out}, nil)
+	return p
+}
+
+func TestTopologyDOT(t *testing.T) {
+	want := `digraph pipeline {
+	"stage:stdin" [label="stdin\ningester" shape=box];
+	"stage:window" [label="window\ndigester" shape=box];
+	"stage:stdout" [label="stdout\nexpeller" shape=box];
+	"queue:in" [label="in\n1/10" shape=ellipse];
+	"queue:out" [label="out\n0/-1" shape=ellipse];
+	"stage:stdin" -> "queue:in";
+	"queue:in" -> "stage:window";
+	"stage:window" -> "queue:out";
+	"queue:out" -> "stage:stdout";
+}
+`
+	if got := newTestPipeline().Topology().DOT(); got != want {
+		t.Errorf("unexpected DOT output:\n%s\nexpected:\n%s", got, want)
+	}
+}
+
+func TestTopologyJSON(t *testing.T) {
+	data, err := json.Marshal(newTestPipeline().Topology())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"stages":[` +
+		`{"id":"stage:stdin","name":"stdin","kind":"ingester"},` +
+		`{"id":"stage:window","name":"window","kind":"digester"},` +
+		`{"id":"stage:stdout","name":"stdout","kind":"expeller"}],` +
+		`"queues":[` +
+		`{"id":"queue:in","name":"in","len":1,"cap":10},` +
+		`{"id":"queue:out","name":"out","len":0,"cap":-1}],` +
+		`"edges":[` +
+		`{"from":"stage:stdin","to":"queue:in"},` +
+		`{"from":"queue:in","to":"stage:window"},` +
+		`{"from":"stage:window","to":"queue:out"},` +
+		`{"from":"queue:out","to":"stage:stdout"}]}`
+	if string(data) != want {
+		t.Errorf("unexpected JSON:\n%s\nexpected:\n%s", data, want)
+	}
+}
+
+func TestTopologyHandler(t *testing.T) {
+	handler := TopologyHandler(newTestPipeline())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/topology", nil))
+	var topology Topology
+	if err := json.Unmarshal(rec.Body.Bytes(), &topology); err != nil || len(topology.Stages) != 3 {
+		t.Errorf("expected the JSON topology, got %s %v", rec.Body.String(), err)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/topology?format=dot", nil))
+	if rec.Header().Get("Content-Type") != "text/vnd.graphviz" || rec.Body.String() != newTestPipeline().Topology().DOT() {
+		t.Errorf("expected the DOT topology, got %s", rec.Body.String())
+	}
+}
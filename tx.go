@@ -0,0 +1,108 @@
+package icd
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Transactional is the optional interface for queues which take part in a
+// Transaction
+type Transactional interface {
+	// PrepareTx locks the queue and checks that items fit into it without
+	// blocking, returning ErrQueueClosed or ErrQueueFull, and the queue
+	// unlocked, when they do not. On success the queue stays locked until
+	// release is called; apply, which may only be called before release,
+	// puts items into the queue.
+	PrepareTx(items []interface{}) (apply func(), release func(), err error)
+}
+
+// errTxDone is returned when staging into a finished transaction
+var errTxDone = errors.New("transaction is finished")
+
+// txMu serializes the commits, so transactions locking the same queues in a
+// different order cannot deadlock
+var txMu sync.Mutex
+
+// QueueTx stages the puts of a Transaction
+type QueueTx struct {
+	queues []Queue
+	items  map[Queue][]interface{}
+	done   bool
+}
+
+// Put stages item to be put into q when the transaction commits. Returns
+// ErrNilItem for a nil item and ErrNotSupported when q is not
+// Transactional.
+func (tx *QueueTx) Put(q Queue, item interface{}) error {
+	if tx.done {
+		return errTxDone
+	}
+	if item == nil {
+		return ErrNilItem
+	}
+	_, ok := q.(Transactional)
+	if !ok {
+		return fmt.Errorf("transaction put into %s: %w", q.Name(), ErrNotSupported)
+	}
+	_, staged := tx.items[q]
+	if !staged {
+		tx.queues = append(tx.queues, q)
+	}
+	tx.items[q] = append(tx.items[q], item)
+	return nil
+}
+
+// Transaction runs fn and commits the puts it staged with tx once it returns
+// nil: either every item is put into its queue or none is. The staged items
+// are invisible until the commit, which makes them visible in all queues at
+// once. When fn returns an error, or a queue is closed or has no room for
+// its items, nothing is put and the error is returned. The commit never
+// blocks on a full queue. The queues must be Transactional, as BaseQueue is,
+// and tx must not be used after fn returns.
+func Transaction(fn func(tx *QueueTx) error) error {
+	tx := &QueueTx{items: make(map[Queue][]interface{})}
+	err := fn(tx)
+	tx.done = true
+	if err != nil {
+		return err
+	}
+
+	txMu.Lock()
+	defer txMu.Unlock()
+	var applies, releases []func()
+	defer func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}()
+	for _, q := range tx.queues {
+		apply, release, err := q.(Transactional).PrepareTx(tx.items[q])
+		if err != nil {
+			return fmt.Errorf("commit to %s: %w", q.Name(), err)
+		}
+		applies = append(applies, apply)
+		releases = append(releases, release)
+	}
+	for _, apply := range applies {
+		apply()
+	}
+	return nil
+}
+
+// PrepareTx locks the queue for a Transaction putting items
+func (q *BaseQueue) PrepareTx(items []interface{}) (func(), func(), error) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil, nil, ErrQueueClosed
+	}
+	if q.full(len(items)) {
+		q.mu.Unlock()
+		return nil, nil, ErrQueueFull
+	}
+	apply := func() {
+		q.add(items)
+	}
+	return apply, q.mu.Unlock, nil
+}
@@ -0,0 +1,85 @@
+package icd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTransactionCommitsToOneQueue(t *testing.T) {
+	even := NewBaseQueue("even", 0)
+	odd := NewBaseQueue("odd", 0)
+	for i := 0; i < 4; i++ {
+		i := i
+		err := Transaction(func(tx *QueueTx) error {
+			dest := even
+			if i%2 == 1 {
+				dest = odd
+			}
+			err := tx.Put(dest, i)
+			if err != nil {
+				return err
+			}
+			// staged items are invisible before the commit
+			if dest.Len() != i/2 {
+				t.Errorf("expected %d items in %s before the commit, got %d", i/2, dest.Name(), dest.Len())
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if even.Len() != 2 || odd.Len() != 2 {
+		t.Fatalf("expected 2 items in each queue, got %d and %d", even.Len(), odd.Len())
+	}
+	if item, _ := odd.Get(); item != 1 {
+		t.Errorf("expected 1, got %v", item)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	a := NewBaseQueue("a", 0)
+	b := NewBaseQueue("b", 1)
+	errRoute := errors.New("no route")
+	err := Transaction(func(tx *QueueTx) error {
+		tx.Put(a, "x")
+		tx.Put(b, "y")
+		return errRoute
+	})
+	if err != errRoute {
+		t.Errorf("expected the error of fn, got %v", err)
+	}
+
+	// b has no room for both, so a does not get its item either
+	err = Transaction(func(tx *QueueTx) error {
+		tx.Put(a, "x")
+		tx.Put(b, "y")
+		return tx.Put(b, "z")
+	})
+	if !IsQueueFull(err) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	if a.Len() != 0 || b.Len() != 0 {
+		t.Errorf("expected both queues untouched, got %d and %d", a.Len(), b.Len())
+	}
+	if err := b.Put("y"); err != nil {
+		t.Errorf("expected the queues to be unlocked after the rollback, got %v", err)
+	}
+}
+
+func TestQueueTxPutErrors(t *testing.T) {
+	var staged *QueueTx
+	Transaction(func(tx *QueueTx) error {
+		staged = tx
+		if err := tx.Put(NewBaseQueue("q", 0), nil); !IsNilItem(err) {
+			t.Errorf("expected ErrNilItem, got %v", err)
+		}
+		if err := tx.Put(NewSPSCQueue(1), "a"); !IsNotSupported(err) {
+			t.Errorf("expected ErrNotSupported, got %v", err)
+		}
+		return nil
+	})
+	if err := staged.Put(NewBaseQueue("q", 0), "a"); err == nil {
+		t.Error("expected an error staging into a finished transaction")
+	}
+}
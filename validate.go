@@ -0,0 +1,95 @@
+package icd
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Validated is the optional interface for queues which validate the items
+// put into them
+type Validated interface {
+	// SetErrorPolicy sets what the queue does with items failing
+	// validation, deadLetter is required by ErrorPolicyDeadLetter and
+	// ignored otherwise. The default is ErrorPolicyFail.
+	SetErrorPolicy(policy ErrorPolicy, deadLetter Queue) error
+
+	// Invalid returns the number of items which failed validation
+	Invalid() uint64
+}
+
+type validatingQueue struct {
+	Queue
+	validate   func(interface{}) error
+	mu         sync.Mutex
+	policy     ErrorPolicy
+	deadLetter Queue
+	invalid    uint64
+}
+
+// NewValidatingQueue wraps q so every item put is checked by validate before
+// it enters q. By default Put returns the error of validate for an invalid
+// item, SetErrorPolicy drops invalid items or puts them into a dead-letter
+// queue instead.
+func NewValidatingQueue(q Queue, validate func(interface{}) error) Queue {
+	return &validatingQueue{
+		Queue:    q,
+		validate: validate,
+	}
+}
+
+// Put puts the item into the queue if it is valid
+func (q *validatingQueue) Put(item interface{}) error {
+	if item == nil {
+		return ErrNilItem
+	}
+	err := q.validate(item)
+	if err == nil {
+		return q.Queue.Put(item)
+	}
+
+	q.mu.Lock()
+	q.invalid++
+	policy := q.policy
+	deadLetter := q.deadLetter
+	q.mu.Unlock()
+
+	switch policy {
+	case ErrorPolicySkip:
+		return nil
+	case ErrorPolicyDeadLetter:
+		dlErr := deadLetter.Put(item)
+		if dlErr != nil {
+			return fmt.Errorf("dead-letter %v: %v", err, dlErr)
+		}
+		return nil
+	default:
+		return err
+	}
+}
+
+// SetErrorPolicy sets what the queue does with items failing validation
+func (q *validatingQueue) SetErrorPolicy(policy ErrorPolicy, deadLetter Queue) error {
+	if policy == ErrorPolicyDeadLetter && deadLetter == nil {
+		return fmt.Errorf("error policy %v of %s requires a dead-letter queue", policy, q.Name())
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.policy = policy
+	q.deadLetter = deadLetter
+	return nil
+}
+
+// Invalid returns the number of items which failed validation
+func (q *validatingQueue) Invalid() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.invalid
+}
+
+// Reset resets the wrapped queue and the count of invalid items
+func (q *validatingQueue) Reset() {
+	q.mu.Lock()
+	q.invalid = 0
+	q.mu.Unlock()
+	q.Queue.Reset()
+}
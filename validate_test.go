@@ -0,0 +1,66 @@
+package icd
+
+import (
+	"errors"
+	"testing"
+)
+
+var errNegative = errors.New("negative")
+
+func nonNegative(item interface{}) error {
+	if item.(int) < 0 {
+		return errNegative
+	}
+	return nil
+}
+
+func TestValidatingQueueRejects(t *testing.T) {
+	q := NewValidatingQueue(NewBaseQueue("q", 10), nonNegative)
+	if err := q.Put(1); err != nil {
+		t.Errorf("expected a valid item to be accepted, got %v", err)
+	}
+	if err := q.Put(-1); err != errNegative {
+		t.Errorf("expected the validation error, got %v", err)
+	}
+	if err := q.Put(nil); !IsNilItem(err) {
+		t.Errorf("expected ErrNilItem, got %v", err)
+	}
+	if q.Len() != 1 || q.(Validated).Invalid() != 1 {
+		t.Errorf("expected 1 item and 1 invalid, got %d and %d", q.Len(), q.(Validated).Invalid())
+	}
+	q.Reset()
+	if q.(Validated).Invalid() != 0 {
+		t.Error("expected reset to clear the invalid count")
+	}
+}
+
+func TestValidatingQueueSkips(t *testing.T) {
+	q := NewValidatingQueue(NewBaseQueue("q", 10), nonNegative)
+	q.(Validated).SetErrorPolicy(ErrorPolicySkip, nil)
+	if err := q.Put(-1); err != nil {
+		t.Errorf("expected the invalid item to be dropped, got %v", err)
+	}
+	if q.Len() != 0 || q.(Validated).Invalid() != 1 {
+		t.Errorf("unexpected len %d and invalid %d", q.Len(), q.(Validated).Invalid())
+	}
+}
+
+func TestValidatingQueueDeadLetters(t *testing.T) {
+	dlq := NewBaseQueue("dlq", 1)
+	q := NewValidatingQueue(NewBaseQueue("q", 10), nonNegative)
+	if err := q.(Validated).SetErrorPolicy(ErrorPolicyDeadLetter, nil); err == nil {
+		t.Error("expected dead-lettering without a queue to fail")
+	}
+	q.(Validated).SetErrorPolicy(ErrorPolicyDeadLetter, dlq)
+	q.Put(2)
+	if err := q.Put(-1); err != nil {
+		t.Errorf("expected the invalid item to be dead-lettered, got %v", err)
+	}
+	if item, _ := dlq.Get(); item != -1 || q.Len() != 1 {
+		t.Errorf("expected -1 in the dead-letter queue, got %v", item)
+	}
+	dlq.Close()
+	if err := q.Put(-2); err == nil {
+		t.Error("expected a failing dead-letter queue to fail the put")
+	}
+}
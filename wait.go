@@ -0,0 +1,61 @@
+package icd
+
+import (
+	"context"
+)
+
+type getResult struct {
+	item interface{}
+	err  error
+}
+
+// getOrDone gets the next item from q like Get, returning context.Canceled
+// once done is closed. Queues which are LenWaiter and NonBlocking are waited
+// on without taking an item. For other queues the Get runs in a goroutine of
+// its own, the item it gets after done is closed is lost.
+func getOrDone(q Queue, done <-chan struct{}) (interface{}, error) {
+	select {
+	case <-done:
+		return nil, context.Canceled
+	default:
+	}
+	w, waits := q.(LenWaiter)
+	nb, ok := q.(NonBlocking)
+	if waits && ok {
+		var ctx context.Context
+		for {
+			item, err := nb.TryGet()
+			if !IsQueueEmpty(err) {
+				return item, err
+			}
+			if ctx == nil {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithCancel(context.Background())
+				defer cancel()
+				go func() {
+					select {
+					case <-done:
+						cancel()
+					case <-ctx.Done():
+					}
+				}()
+			}
+			err = w.WaitLen(ctx, 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	got := make(chan getResult, 1)
+	go func() {
+		item, err := q.Get()
+		got <- getResult{item: item, err: err}
+	}()
+	select {
+	case r := <-got:
+		return r.item, r.err
+	case <-done:
+		return nil, context.Canceled
+	}
+}
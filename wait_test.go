@@ -0,0 +1,39 @@
+package icd
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGetOrDone(t *testing.T) {
+	done := make(chan struct{})
+	for _, q := range []Queue{NewBaseQueue("waits", 0), NewLocalEchoQueue()} {
+		q.Put(1)
+		if item, err := getOrDone(q, done); err != nil || item != 1 {
+			t.Errorf("%s: expected 1, got %v %v", q.Name(), item, err)
+		}
+		got := make(chan error)
+		go func(q Queue) {
+			_, err := getOrDone(q, done)
+			got <- err
+		}(q)
+		q.Close()
+		if err := <-got; !IsQueueClosed(err) {
+			t.Errorf("%s: expected ErrQueueClosed, got %v", q.Name(), err)
+		}
+	}
+
+	// done stops a get blocked on the empty queue
+	for _, q := range []Queue{NewBaseQueue("waits", 0), NewLocalEchoQueue()} {
+		done := make(chan struct{})
+		got := make(chan error)
+		go func(q Queue) {
+			_, err := getOrDone(q, done)
+			got <- err
+		}(q)
+		close(done)
+		if err := <-got; err != context.Canceled {
+			t.Errorf("%s: expected context.Canceled, got %v", q.Name(), err)
+		}
+	}
+}
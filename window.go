@@ -0,0 +1,82 @@
+package icd
+
+import (
+	"sync"
+	"time"
+)
+
+type windowDigester struct {
+	runner
+	window    time.Duration
+	aggregate func(items []interface{}) interface{}
+	mu        sync.Mutex
+	items     []interface{}
+}
+
+// WindowDigester creates a digester which buffers items into tumbling windows
+// of the given length and, as each window closes, sends aggregate of the
+// window's items. Windows without items send nothing. The partial window is
+// flushed when the digester stops. Window boundaries follow the package Clock.
+// Windows shorter than a millisecond are clamped to a millisecond.
+func WindowDigester(name string, window time.Duration, aggregate func(items []interface{}) interface{}) Digester {
+	if window < minInterval {
+		window = minInterval
+	}
+	return &windowDigester{
+		runner:    runner{name: name, kind: KindDigester},
+		window:    window,
+		aggregate: aggregate,
+	}
+}
+
+// Digest aggregates the items from rcv per window and sends the aggregates
+// to snd until rcv is closed or reservoird shuts down
+func (d *windowDigester) Digest(rcv Queue, snd Queue, mc *MonitorControl) {
+	defer mc.WaitGroup.Done()
+	d.start()
+	defer d.stop(mc)
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-after(d.window):
+				d.flush(snd)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	for !d.poll(mc) {
+		item, err := getOrDone(rcv, mc.DoneChan)
+		if err != nil {
+			break
+		}
+		d.addReceived(1)
+		d.mu.Lock()
+		d.items = append(d.items, item)
+		d.mu.Unlock()
+	}
+
+	close(stop)
+	<-stopped
+	d.flush(snd)
+	snd.Close()
+}
+
+// flush sends the aggregate of the current window, if it has items
+func (d *windowDigester) flush(snd Queue) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.items) == 0 {
+		return
+	}
+	items := d.items
+	d.items = nil
+	if snd.Put(d.aggregate(items)) == nil {
+		d.addSent(1)
+	}
+}
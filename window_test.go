@@ -0,0 +1,104 @@
+package icd
+
+import (
+	"testing"
+	"time"
+)
+
+func count(items []interface{}) interface{} {
+	return len(items)
+}
+
+func TestWindowDigesterBoundaries(t *testing.T) {
+	c := useFakeClock()
+	defer SetClock(nil)
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	d := WindowDigester("window", time.Minute, count)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go d.Digest(rcv, snd, mc)
+	waitFor(t, "window timer", func() bool { return c.Waiters() == 1 })
+
+	rcv.Put("a")
+	rcv.Put("b")
+	waitFor(t, "items to be received", func() bool { return rcv.Len() == 0 })
+	c.Advance(time.Minute)
+	item, _ := snd.Get()
+	if item != 2 {
+		t.Errorf("expected first window aggregate 2, got %v", item)
+	}
+
+	// an empty window sends nothing
+	waitFor(t, "window timer", func() bool { return c.Waiters() == 1 })
+	c.Advance(time.Minute)
+	waitFor(t, "window timer", func() bool { return c.Waiters() == 1 })
+	if snd.Len() != 0 {
+		t.Errorf("expected nothing for an empty window, got %d items", snd.Len())
+	}
+
+	rcv.Put("c")
+	waitFor(t, "items to be received", func() bool { return rcv.Len() == 0 })
+	c.Advance(time.Minute)
+	item, _ = snd.Get()
+	if item != 1 {
+		t.Errorf("expected second window aggregate 1, got %v", item)
+	}
+
+	rcv.Close()
+	mc.WaitGroup.Wait()
+	if !snd.Closed() || d.Running() {
+		t.Error("expected the digester to stop and close its send queue")
+	}
+}
+
+func TestWindowDigesterFlushesOnShutdown(t *testing.T) {
+	useFakeClock()
+	defer SetClock(nil)
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	d := WindowDigester("window", time.Minute, count)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go d.Digest(rcv, snd, mc)
+
+	rcv.Put("a")
+	rcv.Put("b")
+	rcv.Put("c")
+	rcv.Close()
+	mc.WaitGroup.Wait()
+
+	item, _ := snd.Get()
+	if item != 3 {
+		t.Errorf("expected the partial window to be flushed, got %v", item)
+	}
+	final := (<-mc.FinalStatsChan).(PluginStats)
+	if final.Received != 3 || final.Sent != 1 {
+		t.Errorf("unexpected final stats %+v", final)
+	}
+}
+
+func TestWindowDigesterStopsWhileWaiting(t *testing.T) {
+	useFakeClock()
+	defer SetClock(nil)
+	rcv := NewBaseQueue("rcv", 0)
+	snd := NewBaseQueue("snd", 0)
+	d := WindowDigester("window", time.Minute, count)
+	mc := newTestMonitorControl()
+	mc.WaitGroup.Add(1)
+	go d.Digest(rcv, snd, mc)
+
+	// the digester waits on the open, empty receive queue when reservoird
+	// shuts down
+	rcv.Put("a")
+	waitFor(t, "the item to be received", func() bool { return rcv.Len() == 0 })
+	close(mc.DoneChan)
+	mc.WaitGroup.Wait()
+
+	if item, _ := snd.Get(); item != 1 {
+		t.Errorf("expected the partial window to be flushed, got %v", item)
+	}
+	if !snd.Closed() {
+		t.Error("expected the send queue to be closed")
+	}
+}